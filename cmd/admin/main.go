@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/repository"
+	"estacionamienti/internal/service"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+	"golang.org/x/term"
+)
+
+const usage = `usage: admin <command>
+
+commands:
+  bootstrap <user>   create the first owner, only while there are no admins; the password is read from
+                     ADMIN_PASSWORD or, if that is not set, from the first line of stdin,
+                     without echo when it is a terminal`
+
+func main() {
+	if len(os.Args) < 3 || os.Args[1] != "bootstrap" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if os.Getenv("RAILWAY_ENVIRONMENT") == "" {
+		if err := godotenv.Load(); err != nil {
+			log.Println("No .env file found")
+		}
+	}
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		log.Fatal("DATABASE_URL not set")
+	}
+	conn, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		log.Fatalf("Failed to open DB: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.Ping(); err != nil {
+		log.Fatalf("Failed to connect to DB: %v", err)
+	}
+	if _, err := db.MigrateUp(conn); err != nil {
+		log.Fatalf("Failed to apply migrations: %v", err)
+	}
+
+	password := os.Getenv("ADMIN_PASSWORD")
+	if password == "" {
+		password, err = readPassword()
+		if err != nil {
+			log.Fatalf("Could not read the password: %v", err)
+		}
+	}
+
+	adminAuthSvc := service.NewAdminAuthService(repository.NewAdminAuthRepository(conn))
+	owner, err := adminAuthSvc.BootstrapOwner(os.Args[2], password)
+	if err != nil {
+		log.Fatalf("Bootstrap failed: %v", err)
+	}
+	log.Printf("Owner %s created (id %d). Log in at /admin/login and create the other admins in /admin/users", owner.User, owner.ID)
+}
+
+// readPassword prompts for the password on a terminal without echoing it, or reads the first line of piped input.
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(password), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
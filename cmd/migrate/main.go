@@ -0,0 +1,82 @@
+package main
+
+import (
+	"database/sql"
+	"estacionamienti/internal/db"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+)
+
+const usage = `usage: migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    revert the last n migrations (default 1)
+  status      list migrations and when they were applied`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if os.Getenv("RAILWAY_ENVIRONMENT") == "" {
+		if err := godotenv.Load(); err != nil {
+			log.Println("No .env file found")
+		}
+	}
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		log.Fatal("DATABASE_URL not set")
+	}
+	conn, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		log.Fatalf("Failed to open DB: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.Ping(); err != nil {
+		log.Fatalf("Failed to connect to DB: %v", err)
+	}
+
+	switch os.Args[1] {
+	case "up":
+		applied, err := db.MigrateUp(conn)
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		log.Printf("Applied %d migrations", applied)
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid number of steps %q", os.Args[2])
+			}
+		}
+		reverted, err := db.MigrateDown(conn, steps)
+		if err != nil {
+			log.Fatalf("Revert failed: %v", err)
+		}
+		log.Printf("Reverted %d migrations", reverted)
+	case "status":
+		states, err := db.MigrationStatus(conn)
+		if err != nil {
+			log.Fatalf("Could not read migration status: %v", err)
+		}
+		for _, st := range states {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = st.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%04d_%-40s %s\n", st.Version, st.Name, applied)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
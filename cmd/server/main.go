@@ -4,9 +4,9 @@ import (
 	"database/sql"
 	"estacionamienti/internal/api"
 	"estacionamienti/internal/auth"
+	dbschema "estacionamienti/internal/db"
 	"estacionamienti/internal/repository"
 	"estacionamienti/internal/service"
-	"github.com/stripe/stripe-go/v82"
 	"log"
 	"net/http"
 	"os"
@@ -20,12 +20,65 @@ import (
 	"github.com/robfig/cron/v3"
 )
 
-func initStripe() {
+const fakeWebhookSecret = "whsec_fake_local"
+
+// initPaymentGateway returns the Stripe gateway, or the in-process fake when PAYMENT_GATEWAY=fake.
+// The fake is only meant for local development; its checkout pages are served under /dev/checkout.
+func initPaymentGateway(port, webhookSecret string) (service.PaymentGateway, *service.FakePaymentGateway) {
+	if os.Getenv("PAYMENT_GATEWAY") == "fake" {
+		baseURL := os.Getenv("FAKE_CHECKOUT_BASE_URL")
+		if baseURL == "" {
+			baseURL = "http://localhost:" + port + "/dev/checkout"
+		}
+		log.Printf("Using fake payment gateway, checkout pages at %s", baseURL)
+		fake := service.NewFakePaymentGateway(webhookSecret, baseURL)
+		return fake, fake
+	}
 	stripeSecretKey := os.Getenv("STRIPE_SECRET_KEY")
 	if stripeSecretKey == "" {
 		log.Fatal("STRIPE_SECRET_KEY no está configurada.")
 	}
-	stripe.Key = stripeSecretKey
+	return service.NewStripeGateway(stripeSecretKey), nil
+}
+
+// initNotificationSenders picks the email and SMS transports from EMAIL_PROVIDER (sendgrid, smtp or outbox) and
+// SMS_PROVIDER (twilio or outbox). The outbox writes messages to OUTBOX_PATH, or stdout, instead of sending them.
+func initNotificationSenders() (service.EmailSender, service.SMSSender) {
+	var outbox *service.OutboxSender
+	getOutbox := func() *service.OutboxSender {
+		if outbox == nil {
+			var err error
+			outbox, err = service.NewOutboxSender(os.Getenv("OUTBOX_PATH"))
+			if err != nil {
+				log.Fatalf("Failed to open outbox: %v", err)
+			}
+		}
+		return outbox
+	}
+
+	var emailSender service.EmailSender
+	switch provider := os.Getenv("EMAIL_PROVIDER"); provider {
+	case "", "sendgrid":
+		emailSender = service.NewSendGridEmailSender(os.Getenv("SENDGRID_API_KEY"), os.Getenv("SENDGRID_FROM_EMAIL"), os.Getenv("SENDGRID_FROM_NAME"))
+	case "smtp":
+		emailSender = service.NewSMTPEmailSender(os.Getenv("SMTP_HOST"), os.Getenv("SMTP_PORT"), os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"), os.Getenv("SMTP_FROM_EMAIL"), os.Getenv("SMTP_FROM_NAME"))
+	case "outbox":
+		emailSender = getOutbox()
+	default:
+		log.Fatalf("Unknown EMAIL_PROVIDER %q", provider)
+	}
+
+	var smsSender service.SMSSender
+	switch provider := os.Getenv("SMS_PROVIDER"); provider {
+	case "", "twilio":
+		smsSender = service.NewTwilioSMSSender(os.Getenv("TWILIO_ACCOUNT_SID"), os.Getenv("TWILIO_AUTH_TOKEN"), os.Getenv("TWILIO_FROM_NUMBER"))
+	case "outbox":
+		smsSender = getOutbox()
+	default:
+		log.Fatalf("Unknown SMS_PROVIDER %q", provider)
+	}
+	return emailSender, smsSender
 }
 
 // setupDeletePendingReservationsCron schedules the cron job to delete old pending reservations at 1am Italy time.
@@ -49,7 +102,7 @@ func setupDeletePendingReservationsCron(jobSvc *service.JobService) *cron.Cron {
 	return c
 }
 
-// setupUpdateFinishedReservationsCron schedules the cron job to update finished reservations every hour.
+// setupUpdateFinishedReservationsCron schedules the cron job that flags reservations past their end without check-out every hour.
 func setupUpdateFinishedReservationsCron(jobSvc *service.JobService) *cron.Cron {
 	c := cron.New(cron.WithLocation(time.UTC))
 	_, err := c.AddFunc("@hourly", func() {
@@ -66,6 +119,44 @@ func setupUpdateFinishedReservationsCron(jobSvc *service.JobService) *cron.Cron
 	return c
 }
 
+// setupRetryChangeRefundsCron schedules the retry of refunds owed by applied reservation changes every 10 minutes.
+func setupRetryChangeRefundsCron(reservationSvc *service.ReservationService) *cron.Cron {
+	c := cron.New(cron.WithLocation(time.UTC))
+	_, err := c.AddFunc("@every 10m", func() {
+		refunded, err := reservationSvc.RetryChangeRefunds()
+		if err != nil {
+			log.Printf("Error during scheduled task: RetryChangeRefunds: %v", err)
+		} else if refunded > 0 {
+			log.Printf("Refunded %d reservation changes", refunded)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Failed to add cron job: %v", err)
+	}
+	c.Start()
+	log.Println("RetryChangeRefunds cron scheduler started.")
+	return c
+}
+
+// setupDeliverNotificationsCron schedules the delivery of queued emails and SMS every 30 seconds.
+func setupDeliverNotificationsCron(notificationSvc *service.NotificationService) *cron.Cron {
+	c := cron.New(cron.WithLocation(time.UTC))
+	_, err := c.AddFunc("@every 30s", func() {
+		sent, err := notificationSvc.DeliverDue(time.Now().UTC())
+		if err != nil {
+			log.Printf("Error during scheduled task: DeliverNotifications: %v", err)
+		} else if sent > 0 {
+			log.Printf("Delivered %d notifications", sent)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Failed to add cron job: %v", err)
+	}
+	c.Start()
+	log.Println("DeliverNotifications cron scheduler started.")
+	return c
+}
+
 func main() {
 	if os.Getenv("RAILWAY_ENVIRONMENT") == "" {
 		err := godotenv.Load()
@@ -85,31 +176,77 @@ func main() {
 		log.Fatalf("Failed to connect to DB: %v", err)
 	}
 
-	initStripe()
+	// Migrations run at startup unless disabled; they can also be applied with `go run ./cmd/migrate up`.
+	if os.Getenv("AUTO_MIGRATE") != "false" {
+		applied, err := dbschema.MigrateUp(db)
+		if err != nil {
+			log.Fatalf("Failed to apply migrations: %v", err)
+		}
+		log.Printf("Database schema up to date (%d migrations applied)", applied)
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	if err := service.CheckQuoteSecret(); err != nil {
+		log.Fatal(err)
+	}
+
+	webhookSecret := os.Getenv("STRIPE_WEBHOOK_SECRET")
+	if webhookSecret == "" && os.Getenv("PAYMENT_GATEWAY") == "fake" {
+		webhookSecret = fakeWebhookSecret
+	}
+	paymentGateway, fakeGateway := initPaymentGateway(port, webhookSecret)
 
 	// Repositories
 	reservationRepo := repository.NewReservationRepository(db)
 	jobRepo := repository.NewJobRepository(db)
 	adminRepo := repository.NewAdminRepository(db)
 	adminAuthRepo := repository.NewAdminAuthRepository(db)
+	notificationRepo := repository.NewNotificationRepository(db)
+	stripeEventRepo := repository.NewStripeEventRepository(db)
+	paymentRepo := repository.NewPaymentRepository(db)
+	customerAuthRepo := repository.NewCustomerAuthRepository(db)
+	pricingRepo := repository.NewPricingRepository(db)
+	promoCodeRepo := repository.NewPromoCodeRepository(db)
+	refundPolicyRepo := repository.NewRefundPolicyRepository(db)
 
 	// Services
-	senderService := service.NewSenderService()
-	stripeSvc := service.NewStripeService(reservationRepo)
-	reservationSvc := service.NewReservationService(reservationRepo, stripeSvc, senderService)
+	emailSender, smsSender := initNotificationSenders()
+	senderService := service.NewSenderService(emailSender, smsSender)
+	senderService.AdminEmail = os.Getenv("ADMIN_NOTIFICATION_EMAIL")
+	paymentSvc := service.NewPaymentService(paymentRepo, reservationRepo)
+	stripeSvc := service.NewStripeService(reservationRepo, paymentGateway, paymentSvc)
+	reservationSvc := service.NewReservationService(reservationRepo, pricingRepo, promoCodeRepo, refundPolicyRepo, stripeSvc, senderService)
 	jobSvc := service.NewJobService(jobRepo)
-	adminSvc := service.NewAdminService(adminRepo, reservationRepo, stripeSvc, senderService)
+	adminSvc := service.NewAdminService(adminRepo, reservationRepo, pricingRepo, promoCodeRepo, refundPolicyRepo, stripeSvc, senderService)
 	adminAuthSvc := service.NewAdminAuthService(adminAuthRepo)
+	if admins, err := adminAuthSvc.ListAdmins(); err != nil {
+		log.Printf("Could not list admins: %v", err)
+	} else if len(admins) == 0 {
+		log.Println("No admin accounts yet: create the first owner with `go run ./cmd/admin bootstrap <user>`")
+	}
+	customerAuthSvc := service.NewCustomerAuthService(customerAuthRepo, reservationRepo, senderService)
+	customerAuthSvc.PortalURL = os.Getenv("CUSTOMER_PORTAL_URL")
+	notificationSvc := service.NewNotificationService(notificationRepo, reservationRepo, senderService)
+	stripeEventSvc := service.NewStripeEventService(stripeEventRepo, reservationRepo, stripeSvc, senderService)
 
 	// Handlers
 	userReservationHandler := api.NewUserReservationHandler(reservationSvc)
 	adminHandler := api.NewAdminHandler(adminSvc)
 	adminAuthHandler := api.NewAdminAuthHandler(adminAuthSvc)
-	stripeHandler := api.NewStripeWebhookHandler(os.Getenv("STRIPE_WEBHOOK_SECRET"), reservationSvc, senderService)
+	customerAuthHandler := api.NewCustomerAuthHandler(customerAuthSvc)
+	notificationHandler := api.NewAdminNotificationHandler(notificationSvc)
+	paymentHandler := api.NewAdminPaymentHandler(paymentSvc)
+	stripeHandler := api.NewStripeWebhookHandler(webhookSecret, reservationSvc, stripeEventSvc)
 
 	// Cron scheduler setup
 	_ = setupDeletePendingReservationsCron(jobSvc)
 	_ = setupUpdateFinishedReservationsCron(jobSvc)
+	_ = setupDeliverNotificationsCron(notificationSvc)
+	_ = setupRetryChangeRefundsCron(reservationSvc)
 
 	r := mux.NewRouter()
 
@@ -118,37 +255,83 @@ func main() {
 	r.HandleFunc("/api/vehicle-types", userReservationHandler.GetVehicleTypes).Methods("GET", "OPTIONS")
 	r.HandleFunc("/api/availability", userReservationHandler.CheckAvailability).Methods("GET", "OPTIONS")
 	r.HandleFunc("/api/total-price", userReservationHandler.GetTotalPriceForReservation).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/quotes", userReservationHandler.QuoteReservation).Methods("POST", "OPTIONS")
 	r.HandleFunc("/api/reservations", userReservationHandler.CreateReservation).Methods("POST", "OPTIONS")
-	r.HandleFunc("/api/reservations/{code}", userReservationHandler.GetReservation).Methods("GET", "OPTIONS")
 	r.HandleFunc("/api/reservation/by-session", stripeHandler.GetReservationBySessionIDHandler).Methods("GET", "OPTIONS")
-	r.HandleFunc("/api/reservations/{code}", userReservationHandler.CancelReservation).Methods("DELETE", "OPTIONS")
 
-	// Admin login
-	r.HandleFunc("/api/login", adminAuthHandler.CreateUserAdmin).Methods("POST", "OPTIONS")
+	// Customer login by magic link or code
+	r.HandleFunc("/api/auth/login", customerAuthHandler.RequestLogin).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/auth/verify", customerAuthHandler.VerifyLogin).Methods("POST", "OPTIONS")
+
+	// Customer endpoints (protected, scoped to the email of the customer token)
+	customer := func(h http.HandlerFunc) http.Handler { return auth.CustomerAuthMiddleware(h) }
+	r.Handle("/api/me/reservations", customer(userReservationHandler.ListMyReservations)).Methods("GET", "OPTIONS")
+	r.Handle("/api/reservations/{code}", customer(userReservationHandler.GetReservation)).Methods("GET", "OPTIONS")
+	r.Handle("/api/reservations/{code}", customer(userReservationHandler.CancelReservation)).Methods("DELETE", "OPTIONS")
+	r.Handle("/api/reservations/{code}", customer(userReservationHandler.ModifyReservation)).Methods("PATCH", "OPTIONS")
+	r.Handle("/api/reservations/{code}/extend", customer(userReservationHandler.ExtendReservation)).Methods("POST", "OPTIONS")
+	r.Handle("/api/reservations/{code}/cancellation", customer(userReservationHandler.GetCancellationQuote)).Methods("GET", "OPTIONS")
+
+	// Admin login. Owners create admin accounts in /admin/users; the first one comes from `go run ./cmd/admin bootstrap`.
 	r.HandleFunc("/admin/login", adminAuthHandler.Login).Methods("POST", "OPTIONS")
+	r.HandleFunc("/admin/refresh", adminAuthHandler.Refresh).Methods("POST", "OPTIONS")
+	r.HandleFunc("/admin/logout", adminAuthHandler.Logout).Methods("POST", "OPTIONS")
 
-	// Admin endpoints (protected)
+	// Admin endpoints (protected, each one limited to the roles with its permission)
 	adminRouter := r.PathPrefix("/admin").Subrouter()
 	adminRouter.Use(auth.AdminAuthMiddleware)
-	adminRouter.HandleFunc("/reservations", adminHandler.ListReservations).Methods("GET", "OPTIONS")
-	adminRouter.HandleFunc("/reservations", adminHandler.CreateReservation).Methods("POST", "OPTIONS")
-	adminRouter.HandleFunc("/reservations/{code}", adminHandler.AdminDeleteReservation).Methods("DELETE", "OPTIONS")
-	adminRouter.HandleFunc("/vehicle-config", adminHandler.ListVehicleSpaces).Methods("GET", "OPTIONS")
-	adminRouter.HandleFunc("/vehicle-config/{vehicle_type}", adminHandler.UpdateVehicleSpaces).Methods("PUT", "OPTIONS")
+	can := func(p auth.Permission, h http.HandlerFunc) http.Handler { return auth.RequirePermission(p)(h) }
+	adminRouter.HandleFunc("/logout-all", adminAuthHandler.LogoutAll).Methods("POST", "OPTIONS")
+	adminRouter.Handle("/reservations", can(auth.PermissionRead, adminHandler.ListReservations)).Methods("GET", "OPTIONS")
+	adminRouter.Handle("/reservations", can(auth.PermissionReservations, adminHandler.CreateReservation)).Methods("POST", "OPTIONS")
+	adminRouter.Handle("/reservations/{code}", can(auth.PermissionRefunds, adminHandler.AdminDeleteReservation)).Methods("DELETE", "OPTIONS")
+	adminRouter.Handle("/reservations/{code}", can(auth.PermissionReservations, adminHandler.ModifyReservation)).Methods("PATCH", "OPTIONS")
+	adminRouter.Handle("/vehicle-config", can(auth.PermissionRead, adminHandler.ListVehicleSpaces)).Methods("GET", "OPTIONS")
+	adminRouter.Handle("/vehicle-config/{vehicle_type}", can(auth.PermissionPricing, adminHandler.UpdateVehicleSpaces)).Methods("PUT", "OPTIONS")
+	adminRouter.Handle("/notifications/failed", can(auth.PermissionRead, notificationHandler.ListFailedNotifications)).Methods("GET", "OPTIONS")
+	adminRouter.Handle("/reservations/{code}/extend", can(auth.PermissionReservations, adminHandler.ExtendReservation)).Methods("POST", "OPTIONS")
+	adminRouter.Handle("/reservations/{code}/check-in", can(auth.PermissionGate, adminHandler.CheckIn)).Methods("POST", "OPTIONS")
+	adminRouter.Handle("/reservations/{code}/check-out", can(auth.PermissionGate, adminHandler.CheckOut)).Methods("POST", "OPTIONS")
+	adminRouter.Handle("/reservations/{code}/no-show", can(auth.PermissionGate, adminHandler.MarkNoShow)).Methods("POST", "OPTIONS")
+	adminRouter.Handle("/check-in", can(auth.PermissionGate, adminHandler.CheckIn)).Methods("POST", "OPTIONS")
+	adminRouter.Handle("/check-out", can(auth.PermissionGate, adminHandler.CheckOut)).Methods("POST", "OPTIONS")
+	adminRouter.Handle("/walk-ins", can(auth.PermissionGate, adminHandler.CreateWalkIn)).Methods("POST", "OPTIONS")
+	adminRouter.Handle("/reservations/{code}/notifications/resend", can(auth.PermissionReservations, notificationHandler.ResendNotifications)).Methods("POST", "OPTIONS")
+	adminRouter.Handle("/reservations/{code}/stripe-events", can(auth.PermissionRead, stripeHandler.ListReservationEvents)).Methods("GET", "OPTIONS")
+	adminRouter.Handle("/reservations/{code}/payments", can(auth.PermissionRead, paymentHandler.ListPayments)).Methods("GET", "OPTIONS")
+	adminRouter.Handle("/reservations/{code}/payments", can(auth.PermissionGate, paymentHandler.RecordPayment)).Methods("POST", "OPTIONS")
+	adminRouter.Handle("/stripe-events/{id}/replay", can(auth.PermissionRefunds, stripeHandler.ReplayEvent)).Methods("POST", "OPTIONS")
+	adminRouter.Handle("/space-pools", can(auth.PermissionRead, adminHandler.ListSpacePools)).Methods("GET", "OPTIONS")
+	adminRouter.Handle("/space-pools", can(auth.PermissionPricing, adminHandler.CreateSpacePool)).Methods("POST", "OPTIONS")
+	adminRouter.Handle("/vehicle-types/{vehicle_type}/space-pool", can(auth.PermissionPricing, adminHandler.UpdateVehicleTypePool)).Methods("PUT", "OPTIONS")
+	adminRouter.Handle("/refund-policy", can(auth.PermissionRead, adminHandler.ListRefundPolicy)).Methods("GET", "OPTIONS")
+	adminRouter.Handle("/refund-policy/{payment_method_id}", can(auth.PermissionPricing, adminHandler.UpdateRefundPolicy)).Methods("PUT", "OPTIONS")
+	adminRouter.Handle("/pricing-rules", can(auth.PermissionRead, adminHandler.ListPricingRules)).Methods("GET", "OPTIONS")
+	adminRouter.Handle("/pricing-rules", can(auth.PermissionPricing, adminHandler.CreatePricingRule)).Methods("POST", "OPTIONS")
+	adminRouter.Handle("/pricing-rules/{id}", can(auth.PermissionPricing, adminHandler.DeletePricingRule)).Methods("DELETE", "OPTIONS")
+	adminRouter.Handle("/promo-codes", can(auth.PermissionRead, adminHandler.ListPromoCodes)).Methods("GET", "OPTIONS")
+	adminRouter.Handle("/promo-codes", can(auth.PermissionPricing, adminHandler.CreatePromoCode)).Methods("POST", "OPTIONS")
+	adminRouter.Handle("/promo-codes/{id}", can(auth.PermissionPricing, adminHandler.UpdatePromoCode)).Methods("PUT", "OPTIONS")
+	adminRouter.Handle("/promo-codes/{id}", can(auth.PermissionPricing, adminHandler.DeletePromoCode)).Methods("DELETE", "OPTIONS")
+	adminRouter.Handle("/users", can(auth.PermissionAdmins, adminAuthHandler.ListAdmins)).Methods("GET", "OPTIONS")
+	adminRouter.Handle("/users", can(auth.PermissionAdmins, adminAuthHandler.CreateAdmin)).Methods("POST", "OPTIONS")
+	adminRouter.Handle("/users/{id}", can(auth.PermissionAdmins, adminAuthHandler.UpdateAdmin)).Methods("PATCH", "OPTIONS")
 
 	// Stripe
 	r.HandleFunc("/webhook/stripe", stripeHandler.HandleWebhook).Methods("POST", "OPTIONS")
+	if fakeGateway != nil {
+		fakeCheckoutHandler := api.NewFakeCheckoutHandler(fakeGateway, stripeHandler)
+		// Refund events arrive asynchronously, as they would from Stripe.
+		fakeGateway.Deliver = func(evt *service.FakeWebhook) { go fakeCheckoutHandler.Deliver(evt) }
+		r.HandleFunc("/dev/checkout/{session_id}", fakeCheckoutHandler.Checkout).Methods("GET")
+	}
 
 	allowedOrigins := handlers.AllowedOrigins([]string{
 		"https://front-estacionamiento-octaviomartinduarte-5073s-projects.vercel.app",
 	})
-	allowedMethods := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"})
+	allowedMethods := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"})
 	allowedHeaders := handlers.AllowedHeaders([]string{"Content-Type", "Authorization", "X-Requested-With"})
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
 	log.Printf("Server running on port %s", port)
 	log.Fatal(http.ListenAndServe(":"+port, handlers.CORS(allowedOrigins, allowedMethods, allowedHeaders)(r)))
 }
@@ -15,6 +15,7 @@ require (
 	github.com/stripe/stripe-go/v82 v82.2.1
 	github.com/twilio/twilio-go v1.26.0
 	golang.org/x/crypto v0.35.0
+	golang.org/x/term v0.29.0
 )
 
 require (
@@ -23,4 +24,5 @@ require (
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/sendgrid/rest v2.6.9+incompatible // indirect
 	github.com/stretchr/testify v1.9.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
 )
@@ -2,8 +2,14 @@ package api
 
 import (
 	"encoding/json"
+	"estacionamienti/internal/auth"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
 	"estacionamienti/internal/service"
 	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
 )
 
 type AdminAuthHandler struct {
@@ -19,10 +25,6 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
-type LoginResponse struct {
-	Token string `json:"token"`
-}
-
 func (h *AdminAuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -30,35 +32,111 @@ func (h *AdminAuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.service.Login(req.User, req.Password)
+	session, err := h.service.Login(req.User, req.Password)
 	if err != nil {
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
 
-	resp := LoginResponse{Token: token}
+// Refresh exchanges a refresh token for a new session. It is public: the refresh token is the credential.
+func (h *AdminAuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req entities.AdminRefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+	session, err := h.service.Refresh(req.RefreshToken)
+	if err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			http.Error(w, herr.Message, herr.Code)
+			return
+		}
+		http.Error(w, "Could not refresh session", http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	json.NewEncoder(w).Encode(session)
 }
 
-func (h *AdminAuthHandler) CreateUserAdmin(w http.ResponseWriter, r *http.Request) {
-	var request struct {
-		User     string `json:"user"`
-		Password string `json:"password"`
+// Logout ends the session of a refresh token.
+func (h *AdminAuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req entities.AdminRefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
 	}
+	if err := h.service.Logout(req.RefreshToken); err != nil {
+		http.Error(w, "Could not log out", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll ends every session of the admin calling it.
+func (h *AdminAuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.LogoutAll(auth.AdminID(r)); err != nil {
+		http.Error(w, "Could not log out", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	err := json.NewDecoder(r.Body).Decode(&request)
+// ListAdmins lists the admin accounts, for owners.
+func (h *AdminAuthHandler) ListAdmins(w http.ResponseWriter, r *http.Request) {
+	admins, err := h.service.ListAdmins()
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(admins)
+}
 
-	err = h.service.CreateAdmin(request.User, request.Password)
+// CreateAdmin creates an admin account with the given role, for owners.
+func (h *AdminAuthHandler) CreateAdmin(w http.ResponseWriter, r *http.Request) {
+	var req entities.AdminUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	admin, err := h.service.CreateAdmin(req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if herr, ok := err.(*errors.HTTPError); ok {
+			http.Error(w, herr.Message, herr.Code)
+			return
+		}
+		http.Error(w, "Could not create admin", http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(admin)
+}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Admin registered successfully"))
+// UpdateAdmin changes the role of an admin account or disables it, for owners.
+func (h *AdminAuthHandler) UpdateAdmin(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid admin", http.StatusBadRequest)
+		return
+	}
+	var update entities.AdminUserUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	admin, err := h.service.UpdateAdmin(id, update)
+	if err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			http.Error(w, herr.Message, herr.Code)
+			return
+		}
+		http.Error(w, "Could not update admin", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(admin)
 }
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"estacionamienti/internal/auth"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// CheckIn lets a car in by reservation code or plate.
+func (h *AdminHandler) CheckIn(w http.ResponseWriter, r *http.Request) {
+	var req entities.CheckInRequest
+	if !decodeGateRequest(w, r, &req) {
+		return
+	}
+	if code := mux.Vars(r)["code"]; code != "" {
+		req.Code = code
+	}
+	if req.Code != "" {
+		code, ok := checkReservationCode(w, req.Code)
+		if !ok {
+			return
+		}
+		req.Code = code
+	}
+	reservation, err := h.adminService.CheckIn(req)
+	if err != nil {
+		writeGateError(w, err, "Could not check in")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reservation)
+}
+
+// CheckOut lets a car out by reservation code or plate, collecting the balance due.
+func (h *AdminHandler) CheckOut(w http.ResponseWriter, r *http.Request) {
+	var req entities.CheckOutRequest
+	if !decodeGateRequest(w, r, &req) {
+		return
+	}
+	if code := mux.Vars(r)["code"]; code != "" {
+		req.Code = code
+	}
+	if req.Code != "" {
+		code, ok := checkReservationCode(w, req.Code)
+		if !ok {
+			return
+		}
+		req.Code = code
+	}
+	checkout, err := h.adminService.CheckOut(req, auth.AdminUser(r))
+	if err != nil {
+		writeGateError(w, err, "Could not check out")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(checkout)
+}
+
+// MarkNoShow records that the car of a reservation never came.
+func (h *AdminHandler) MarkNoShow(w http.ResponseWriter, r *http.Request) {
+	code, ok := reservationCodeVar(w, r)
+	if !ok {
+		return
+	}
+	reservation, err := h.adminService.MarkNoShow(code)
+	if err != nil {
+		writeGateError(w, err, "Could not mark reservation as no-show")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reservation)
+}
+
+// decodeGateRequest reads an optional JSON body: gate routes with the code in the path may send none.
+func decodeGateRequest(w http.ResponseWriter, r *http.Request, req interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeGateError(w http.ResponseWriter, err error, msg string) {
+	if herr, ok := err.(*errors.HTTPError); ok {
+		writeHTTPError(w, herr)
+		return
+	}
+	http.Error(w, msg, http.StatusInternalServerError)
+}
+
+// CreateWalkIn opens a session for a car arriving without a reservation.
+func (h *AdminHandler) CreateWalkIn(w http.ResponseWriter, r *http.Request) {
+	var req entities.WalkInRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	walkIn, err := h.adminService.CreateWalkIn(req)
+	if err != nil {
+		writeGateError(w, err, "Could not create walk-in")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(walkIn)
+}
@@ -2,8 +2,11 @@ package api
 
 import (
 	"encoding/json"
+	"estacionamienti/internal/auth"
+	"estacionamienti/internal/db"
 	"estacionamienti/internal/entities"
 	"estacionamienti/internal/errors"
+	"estacionamienti/internal/money"
 	"estacionamienti/internal/service"
 	"net/http"
 	"strconv"
@@ -47,7 +50,7 @@ func (h *AdminHandler) CreateReservation(w http.ResponseWriter, r *http.Request)
 	reservation, err := h.adminService.CreateReservation(&req)
 	if err != nil {
 		if herr, ok := err.(*errors.HTTPError); ok {
-			http.Error(w, herr.Message, herr.Code)
+			writeHTTPError(w, herr)
 			return
 		}
 		http.Error(w, err.Error(), http.StatusConflict)
@@ -59,7 +62,10 @@ func (h *AdminHandler) CreateReservation(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *AdminHandler) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
-	code := mux.Vars(r)["code"]
+	code, ok := reservationCodeVar(w, r)
+	if !ok {
+		return
+	}
 	refund := r.URL.Query().Get("refund")
 	refundBool, err := strconv.ParseBool(refund)
 	if err != nil {
@@ -73,6 +79,52 @@ func (h *AdminHandler) AdminDeleteReservation(w http.ResponseWriter, r *http.Req
 	json.NewEncoder(w).Encode(map[string]string{"message": "Reservation canceled with code: " + code})
 }
 
+func (h *AdminHandler) ModifyReservation(w http.ResponseWriter, r *http.Request) {
+	code, ok := reservationCodeVar(w, r)
+	if !ok {
+		return
+	}
+	var req entities.ReservationChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	change, err := h.adminService.ModifyReservation(code, req, auth.AdminUser(r))
+	if err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			writeHTTPError(w, herr)
+			return
+		}
+		http.Error(w, "Could not modify reservation", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(change)
+}
+
+func (h *AdminHandler) ExtendReservation(w http.ResponseWriter, r *http.Request) {
+	code, ok := reservationCodeVar(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Hours int `json:"hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	change, err := h.adminService.ExtendReservation(code, req.Hours, auth.AdminUser(r))
+	if err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			writeHTTPError(w, herr)
+			return
+		}
+		http.Error(w, "Could not extend reservation", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(change)
+}
+
 func (h *AdminHandler) ListVehicleSpaces(w http.ResponseWriter, r *http.Request) {
 	spaces, err := h.adminService.ListVehicleSpaces()
 	if err != nil {
@@ -86,8 +138,8 @@ func (h *AdminHandler) ListVehicleSpaces(w http.ResponseWriter, r *http.Request)
 func (h *AdminHandler) UpdateVehicleSpaces(w http.ResponseWriter, r *http.Request) {
 	vehicleType := mux.Vars(r)["vehicle_type"]
 	var req struct {
-		Spaces int                `json:"spaces"`
-		Prices map[string]float32 `json:"prices"`
+		Spaces int                     `json:"spaces"`
+		Prices map[string]money.Amount `json:"prices"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
@@ -95,8 +147,223 @@ func (h *AdminHandler) UpdateVehicleSpaces(w http.ResponseWriter, r *http.Reques
 	}
 	err := h.adminService.UpdateVehicleSpacesAndPrices(vehicleType, req.Spaces, req.Prices)
 	if err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			http.Error(w, herr.Message, herr.Code)
+			return
+		}
 		http.Error(w, "Could not update vehicle spaces/prices", http.StatusInternalServerError)
 		return
 	}
 	json.NewEncoder(w).Encode(map[string]string{"message": "Vehicle spaces and prices updated"})
 }
+
+func (h *AdminHandler) ListSpacePools(w http.ResponseWriter, r *http.Request) {
+	pools, err := h.adminService.ListSpacePools()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pools)
+}
+
+func (h *AdminHandler) CreateSpacePool(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name   string `json:"name"`
+		Spaces int    `json:"spaces"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	pool, err := h.adminService.CreateSpacePool(req.Name, req.Spaces)
+	if err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			http.Error(w, herr.Message, herr.Code)
+			return
+		}
+		http.Error(w, "Could not create space pool", http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(pool)
+}
+
+func (h *AdminHandler) UpdateVehicleTypePool(w http.ResponseWriter, r *http.Request) {
+	vehicleType := mux.Vars(r)["vehicle_type"]
+	var req struct {
+		SpacePool string `json:"space_pool"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SpacePool == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	err := h.adminService.AssignVehicleTypeToPool(vehicleType, req.SpacePool)
+	if err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			http.Error(w, herr.Message, herr.Code)
+			return
+		}
+		http.Error(w, "Could not update vehicle type space pool", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Vehicle type " + vehicleType + " moved to space pool " + req.SpacePool})
+}
+
+func (h *AdminHandler) ListRefundPolicy(w http.ResponseWriter, r *http.Request) {
+	tiers, err := h.adminService.ListRefundPolicy()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tiers)
+}
+
+func (h *AdminHandler) UpdateRefundPolicy(w http.ResponseWriter, r *http.Request) {
+	paymentMethodID, err := strconv.Atoi(mux.Vars(r)["payment_method_id"])
+	if err != nil {
+		http.Error(w, "Invalid payment method", http.StatusBadRequest)
+		return
+	}
+	var tiers []db.RefundTier
+	if err := json.NewDecoder(r.Body).Decode(&tiers); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	err = h.adminService.UpdateRefundPolicy(paymentMethodID, tiers)
+	if err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			http.Error(w, herr.Message, herr.Code)
+			return
+		}
+		http.Error(w, "Could not update refund policy", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Refund policy updated"})
+}
+
+func (h *AdminHandler) ListPricingRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.adminService.ListPricingRules()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if rules == nil {
+		rules = []db.PricingRule{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+func (h *AdminHandler) CreatePricingRule(w http.ResponseWriter, r *http.Request) {
+	var rule db.PricingRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := h.adminService.CreatePricingRule(&rule); err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			http.Error(w, herr.Message, herr.Code)
+			return
+		}
+		http.Error(w, "Could not create pricing rule", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (h *AdminHandler) DeletePricingRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid pricing rule", http.StatusBadRequest)
+		return
+	}
+	if err := h.adminService.DeletePricingRule(id); err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			http.Error(w, herr.Message, herr.Code)
+			return
+		}
+		http.Error(w, "Could not delete pricing rule", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Pricing rule deleted"})
+}
+
+func (h *AdminHandler) ListPromoCodes(w http.ResponseWriter, r *http.Request) {
+	promos, err := h.adminService.ListPromoCodes()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if promos == nil {
+		promos = []db.PromoCode{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promos)
+}
+
+func (h *AdminHandler) CreatePromoCode(w http.ResponseWriter, r *http.Request) {
+	// Codes are active unless the request says otherwise.
+	promo := db.PromoCode{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&promo); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	promo.ID = 0
+	if err := h.adminService.CreatePromoCode(&promo); err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			http.Error(w, herr.Message, herr.Code)
+			return
+		}
+		http.Error(w, "Could not create promo code", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(promo)
+}
+
+func (h *AdminHandler) UpdatePromoCode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid promo code", http.StatusBadRequest)
+		return
+	}
+	promo := db.PromoCode{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&promo); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	promo.ID = id
+	if err := h.adminService.UpdatePromoCode(&promo); err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			http.Error(w, herr.Message, herr.Code)
+			return
+		}
+		http.Error(w, "Could not update promo code", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promo)
+}
+
+func (h *AdminHandler) DeletePromoCode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid promo code", http.StatusBadRequest)
+		return
+	}
+	if err := h.adminService.DeletePromoCode(id); err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			http.Error(w, herr.Message, herr.Code)
+			return
+		}
+		http.Error(w, "Could not delete promo code", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Promo code deleted"})
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/service"
+	"net/http"
+)
+
+type AdminNotificationHandler struct {
+	notificationService *service.NotificationService
+}
+
+func NewAdminNotificationHandler(svc *service.NotificationService) *AdminNotificationHandler {
+	return &AdminNotificationHandler{notificationService: svc}
+}
+
+// ListFailedNotifications lists dead-lettered notifications, optionally filtered with ?code=.
+func (h *AdminNotificationHandler) ListFailedNotifications(w http.ResponseWriter, r *http.Request) {
+	notifications, err := h.notificationService.ListFailedNotifications(r.URL.Query().Get("code"))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if notifications == nil {
+		notifications = []db.Notification{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notifications)
+}
+
+// ResendNotifications queues the failed notifications of a reservation again.
+func (h *AdminNotificationHandler) ResendNotifications(w http.ResponseWriter, r *http.Request) {
+	code, ok := reservationCodeVar(w, r)
+	if !ok {
+		return
+	}
+	requeued, err := h.notificationService.ResendFailedNotifications(code)
+	if err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			writeHTTPError(w, herr)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"requeued": requeued})
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"estacionamienti/internal/auth"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/service"
+	"net/http"
+)
+
+type AdminPaymentHandler struct {
+	paymentService *service.PaymentService
+}
+
+func NewAdminPaymentHandler(svc *service.PaymentService) *AdminPaymentHandler {
+	return &AdminPaymentHandler{paymentService: svc}
+}
+
+// ListPayments returns the payments ledger of a reservation.
+func (h *AdminPaymentHandler) ListPayments(w http.ResponseWriter, r *http.Request) {
+	code, ok := reservationCodeVar(w, r)
+	if !ok {
+		return
+	}
+	payments, err := h.paymentService.ListPayments(code)
+	if err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			writeHTTPError(w, herr)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if payments == nil {
+		payments = []db.Payment{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payments)
+}
+
+// RecordPayment records money collected at the parking, or an adjustment, for a reservation.
+func (h *AdminPaymentHandler) RecordPayment(w http.ResponseWriter, r *http.Request) {
+	code, ok := reservationCodeVar(w, r)
+	if !ok {
+		return
+	}
+	var req entities.PaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	payment, err := h.paymentService.RecordAdminPayment(code, req, auth.AdminUser(r))
+	if err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			writeHTTPError(w, herr)
+			return
+		}
+		http.Error(w, "Could not record payment", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(payment)
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"encoding/json"
+	"estacionamienti/internal/auth"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/repository/memory"
+	"estacionamienti/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// adminRolesRouter wires the admin user routes and a few admin routes with the permissions the server gives them.
+func adminRolesRouter(store *memory.Store) *mux.Router {
+	users := NewAdminAuthHandler(service.NewAdminAuthService(store))
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r := mux.NewRouter()
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(auth.AdminAuthMiddleware)
+	can := func(p auth.Permission, h http.HandlerFunc) http.Handler { return auth.RequirePermission(p)(h) }
+	admin.Handle("/reservations", can(auth.PermissionRead, ok)).Methods("GET")
+	admin.Handle("/reservations/{code}", can(auth.PermissionRefunds, ok)).Methods("DELETE")
+	admin.Handle("/check-in", can(auth.PermissionGate, ok)).Methods("POST")
+	admin.Handle("/promo-codes", can(auth.PermissionPricing, ok)).Methods("POST")
+	admin.Handle("/users", can(auth.PermissionAdmins, users.ListAdmins)).Methods("GET")
+	admin.Handle("/users", can(auth.PermissionAdmins, users.CreateAdmin)).Methods("POST")
+	admin.Handle("/users/{id}", can(auth.PermissionAdmins, users.UpdateAdmin)).Methods("PATCH")
+	return r
+}
+
+func adminToken(t *testing.T, id int, user, role string) string {
+	t.Helper()
+	token, _, err := auth.NewAdminToken(id, user, role)
+	if err != nil {
+		t.Fatalf("NewAdminToken: %v", err)
+	}
+	return token
+}
+
+func TestAdminRoutesEnforceRolePermissions(t *testing.T) {
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	r := adminRolesRouter(memory.NewStore())
+
+	routes := []struct{ method, path string }{
+		{"GET", "/admin/reservations"},
+		{"POST", "/admin/check-in"},
+		{"DELETE", "/admin/reservations/0E9A1A01"},
+		{"POST", "/admin/promo-codes"},
+		{"GET", "/admin/users"},
+	}
+	allowed := map[string][]bool{
+		auth.RoleOwner:     {true, true, true, true, true},
+		auth.RoleManager:   {true, true, true, true, false},
+		auth.RoleAttendant: {true, true, false, false, false},
+		auth.RoleReadOnly:  {true, false, false, false, false},
+	}
+	for role, want := range allowed {
+		token := adminToken(t, 1, "admin", role)
+		for i, route := range routes {
+			rec := serve(r, route.method, route.path, token, "")
+			if got := rec.Code != http.StatusForbidden; got != want[i] {
+				t.Errorf("%s %s as %s: got %d", route.method, route.path, role, rec.Code)
+			}
+		}
+	}
+
+	// Tokens issued before roles existed need a new login.
+	old, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"admin_id": 1, "user": "admin"}).SignedString([]byte("jwt-secret"))
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	if rec := serve(r, "GET", "/admin/reservations", old, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with a token without role, got %d", rec.Code)
+	}
+}
+
+func TestOwnerManagesAdminUsers(t *testing.T) {
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	store := memory.NewStore()
+	owner, err := store.CreateNewUser("owner", "correct horse", auth.RoleOwner)
+	if err != nil {
+		t.Fatalf("CreateNewUser: %v", err)
+	}
+	r := adminRolesRouter(store)
+	token := adminToken(t, owner.ID, owner.User, owner.Role)
+
+	rec := serve(r, "POST", "/admin/users", token, `{"user": "luca", "password": "correct horse", "role": "attendant"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create answered %d: %s", rec.Code, rec.Body.String())
+	}
+	var luca entities.AdminUser
+	if err := json.NewDecoder(rec.Body).Decode(&luca); err != nil || luca.Role != auth.RoleAttendant {
+		t.Fatalf("unexpected admin %+v (%v)", luca, err)
+	}
+	if rec := serve(r, "POST", "/admin/users", token, `{"user": "x", "password": "correct horse", "role": "root"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown role, got %d", rec.Code)
+	}
+
+	rec = serve(r, "PATCH", "/admin/users/"+strconv.Itoa(luca.ID), token, `{"role": "manager", "active": false}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update answered %d: %s", rec.Code, rec.Body.String())
+	}
+	if got, _ := store.GetAdminByID(luca.ID); got.Role != auth.RoleManager || got.Active {
+		t.Fatalf("expected a disabled manager, got %+v", got)
+	}
+	if rec := serve(r, "PATCH", "/admin/users/"+strconv.Itoa(owner.ID), token, `{"active": false}`); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 disabling the last owner, got %d", rec.Code)
+	}
+
+	rec = serve(r, "GET", "/admin/users", token, "")
+	if rec.Code != http.StatusOK || !json.Valid(rec.Body.Bytes()) {
+		t.Fatalf("list answered %d: %s", rec.Code, rec.Body.String())
+	}
+	var admins []map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &admins)
+	if len(admins) != 2 || admins[0]["password_hash"] != nil {
+		t.Fatalf("unexpected admins %s", rec.Body.String())
+	}
+}
+
+func TestAdminSigningKeysRotate(t *testing.T) {
+	r := adminRolesRouter(memory.NewStore())
+
+	t.Setenv("JWT_KEYS", "2026-04:old-secret")
+	old := adminToken(t, 1, "admin", auth.RoleOwner)
+	t.Setenv("JWT_KEYS", "2026-10:new-secret, 2026-04:old-secret")
+	current := adminToken(t, 1, "admin", auth.RoleOwner)
+	for _, token := range []string{old, current} {
+		if rec := serve(r, "GET", "/admin/reservations", token, ""); rec.Code != http.StatusOK {
+			t.Fatalf("expected tokens of both keys accepted, got %d", rec.Code)
+		}
+	}
+
+	// Once the old key is dropped, its tokens stop working.
+	t.Setenv("JWT_KEYS", "2026-10:new-secret")
+	if rec := serve(r, "GET", "/admin/reservations", old, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with a token of a dropped key, got %d", rec.Code)
+	}
+	if rec := serve(r, "GET", "/admin/reservations", current, ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected the current key accepted, got %d", rec.Code)
+	}
+}
+
+func TestAdminSessionRoutes(t *testing.T) {
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	store := memory.NewStore()
+	svc := service.NewAdminAuthService(store)
+	if _, err := svc.BootstrapOwner("owner", "correct horse"); err != nil {
+		t.Fatalf("BootstrapOwner: %v", err)
+	}
+	handler := NewAdminAuthHandler(svc)
+	r := adminRolesRouter(store)
+	r.HandleFunc("/admin/login", handler.Login).Methods("POST")
+	r.HandleFunc("/admin/refresh", handler.Refresh).Methods("POST")
+	r.HandleFunc("/admin/logout", handler.Logout).Methods("POST")
+	sessionOf := func(rec *httptest.ResponseRecorder) entities.AdminSession {
+		t.Helper()
+		var session entities.AdminSession
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected a session, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&session); err != nil {
+			t.Fatalf("decoding session: %v", err)
+		}
+		return session
+	}
+
+	login := sessionOf(serve(r, "POST", "/admin/login", "", `{"user": "owner", "password": "correct horse"}`))
+	if rec := serve(r, "GET", "/admin/users", login.Token, ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected the access token to work, got %d", rec.Code)
+	}
+	refreshed := sessionOf(serve(r, "POST", "/admin/refresh", "", `{"refresh_token": "`+login.RefreshToken+`"}`))
+	if rec := serve(r, "POST", "/admin/refresh", "", `{"refresh_token": "`+login.RefreshToken+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 reusing a refresh token, got %d", rec.Code)
+	}
+	if rec := serve(r, "POST", "/admin/refresh", "", `{"refresh_token": "`+refreshed.RefreshToken+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the reuse to revoke the whole session, got %d", rec.Code)
+	}
+
+	again := sessionOf(serve(r, "POST", "/admin/login", "", `{"user": "owner", "password": "correct horse"}`))
+	if rec := serve(r, "POST", "/admin/logout", "", `{"refresh_token": "`+again.RefreshToken+`"}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("logout answered %d", rec.Code)
+	}
+	if rec := serve(r, "POST", "/admin/refresh", "", `{"refresh_token": "`+again.RefreshToken+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 after logout, got %d", rec.Code)
+	}
+}
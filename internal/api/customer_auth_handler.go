@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/service"
+	"net/http"
+)
+
+type CustomerAuthHandler struct {
+	Service *service.CustomerAuthService
+}
+
+func NewCustomerAuthHandler(svc *service.CustomerAuthService) *CustomerAuthHandler {
+	return &CustomerAuthHandler{Service: svc}
+}
+
+// RequestLogin emails a magic link and a login code to the customer. It answers 202 whether the email has
+// reservations or not.
+func (h *CustomerAuthHandler) RequestLogin(w http.ResponseWriter, r *http.Request) {
+	var req entities.CustomerLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := h.Service.RequestLogin(req); err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			http.Error(w, herr.Message, herr.Code)
+			return
+		}
+		http.Error(w, "Could not send the login code", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If the email has reservations, a login link and code are on their way",
+	})
+}
+
+// VerifyLogin exchanges a magic link token, or an email and login code, for a customer token.
+func (h *CustomerAuthHandler) VerifyLogin(w http.ResponseWriter, r *http.Request) {
+	var req entities.CustomerVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	session, err := h.Service.VerifyLogin(req)
+	if err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			http.Error(w, herr.Message, herr.Code)
+			return
+		}
+		http.Error(w, "Could not sign in", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
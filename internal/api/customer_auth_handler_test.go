@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"estacionamienti/internal/auth"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// customerRouter wires the customer login and reservation routes as the server does, plus one admin route.
+func customerRouter(env *webhookEnv) *mux.Router {
+	customerAuth := NewCustomerAuthHandler(service.NewCustomerAuthService(env.store, env.store, env.sender))
+	reservations := NewUserReservationHandler(env.reservationSvc)
+	customer := func(h http.HandlerFunc) http.Handler { return auth.CustomerAuthMiddleware(h) }
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/auth/login", customerAuth.RequestLogin).Methods("POST")
+	r.HandleFunc("/api/auth/verify", customerAuth.VerifyLogin).Methods("POST")
+	r.Handle("/api/me/reservations", customer(reservations.ListMyReservations)).Methods("GET")
+	r.Handle("/api/reservations/{code}", customer(reservations.GetReservation)).Methods("GET")
+	r.Handle("/api/reservations/{code}", customer(reservations.CancelReservation)).Methods("DELETE")
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(auth.AdminAuthMiddleware)
+	admin.HandleFunc("/reservations", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	return r
+}
+
+func serve(r http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCustomerSignsInAndManagesOwnReservations(t *testing.T) {
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	env := newWebhookEnv()
+	created := env.createOnlineReservation(t)
+	r := customerRouter(env)
+
+	if rec := serve(r, "DELETE", "/api/reservations/"+created.Code, "", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 canceling without a token, got %d", rec.Code)
+	}
+
+	rec := serve(r, "POST", "/api/auth/login", "", `{"email": "mario@example.com"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("login answered %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, err := env.notifier.DeliverDue(time.Now().UTC()); err != nil {
+		t.Fatalf("DeliverDue: %v", err)
+	}
+	messages := env.outbox.Messages()
+	code := regexp.MustCompile(`\b\d{6}\b`).FindString(messages[len(messages)-1].Body)
+	rec = serve(r, "POST", "/api/auth/verify", "", `{"email": "mario@example.com", "code": "`+code+`"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("verify answered %d: %s", rec.Code, rec.Body.String())
+	}
+	var session entities.CustomerSession
+	if err := json.NewDecoder(rec.Body).Decode(&session); err != nil {
+		t.Fatalf("decoding session: %v", err)
+	}
+
+	rec = serve(r, "GET", "/api/me/reservations", session.Token, "")
+	var mine []entities.ReservationResponse
+	if err := json.NewDecoder(rec.Body).Decode(&mine); err != nil || len(mine) != 1 || mine[0].Code != created.Code {
+		t.Fatalf("expected the reservation listed, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(r, "GET", "/api/reservations/"+created.Code, session.Token, ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected the reservation, got %d", rec.Code)
+	}
+	if rec := serve(r, "DELETE", "/api/reservations/"+created.Code, session.Token, ""); rec.Code != http.StatusOK {
+		t.Fatalf("cancel answered %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Customer tokens don't open admin routes.
+	if rec := serve(r, "GET", "/admin/reservations", session.Token, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 on an admin route, got %d", rec.Code)
+	}
+}
+
+func TestCustomerTokenOnlyReachesItsEmail(t *testing.T) {
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	env := newWebhookEnv()
+	created := env.createOnlineReservation(t)
+	r := customerRouter(env)
+
+	luigi, _, err := auth.NewCustomerToken("luigi@example.com")
+	if err != nil {
+		t.Fatalf("NewCustomerToken: %v", err)
+	}
+	if rec := serve(r, "DELETE", "/api/reservations/"+created.Code, luigi, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 canceling someone else's reservation, got %d", rec.Code)
+	}
+	if got := env.store.Reservation(created.Code); got.Status == "canceled" {
+		t.Fatalf("reservation canceled by another customer")
+	}
+
+	// Admin tokens are not customer tokens, even when signed with the same secret.
+	admin, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user": "admin", "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("jwt-secret"))
+	if err != nil {
+		t.Fatalf("signing admin token: %v", err)
+	}
+	if rec := serve(r, "GET", "/api/me/reservations", admin, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with an admin token, got %d", rec.Code)
+	}
+}
+
+func TestReservationRoutesRejectMalformedCodes(t *testing.T) {
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	env := newWebhookEnv()
+	created := env.createOnlineReservation(t)
+	r := customerRouter(env)
+	token, _, err := auth.NewCustomerToken("mario@example.com")
+	if err != nil {
+		t.Fatalf("NewCustomerToken: %v", err)
+	}
+
+	for _, code := range []string{"ABC", "UUUUUUUU", created.Code + "7"} {
+		if rec := serve(r, "GET", "/api/reservations/"+code, token, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for code %q, got %d", code, rec.Code)
+		}
+	}
+	// Codes from before random codes are still looked up; this one just isn't the customer's.
+	if rec := serve(r, "GET", "/api/reservations/00b09b2f", token, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected a legacy code to be looked up, got %d", rec.Code)
+	}
+	// Codes are read in any case, with dashes.
+	typed := strings.ToLower(created.Code[:4] + "-" + created.Code[4:])
+	if rec := serve(r, "GET", "/api/reservations/"+typed, token, ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected %q to find %s, got %d", typed, created.Code, rec.Code)
+	}
+}
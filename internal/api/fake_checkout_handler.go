@@ -0,0 +1,61 @@
+package api
+
+import (
+	"estacionamienti/internal/service"
+	"log"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gorilla/mux"
+)
+
+// FakeCheckoutHandler serves the checkout pages of service.FakePaymentGateway, so the full
+// pay -> confirm -> cancel -> refund flow can be exercised locally without Stripe.
+type FakeCheckoutHandler struct {
+	gateway *service.FakePaymentGateway
+	webhook *StripeWebhookHandler
+}
+
+func NewFakeCheckoutHandler(gateway *service.FakePaymentGateway, webhook *StripeWebhookHandler) *FakeCheckoutHandler {
+	return &FakeCheckoutHandler{gateway: gateway, webhook: webhook}
+}
+
+// Checkout pays the session and redirects to its success URL, or to its cancel URL when called with ?cancel=true.
+func (h *FakeCheckoutHandler) Checkout(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["session_id"]
+	sess, ok := h.gateway.Session(sessionID)
+	if !ok {
+		http.Error(w, "Checkout session not found", http.StatusNotFound)
+		return
+	}
+	if r.URL.Query().Get("cancel") == "true" {
+		http.Redirect(w, r, sess.CancelURL, http.StatusSeeOther)
+		return
+	}
+
+	evt, err := h.gateway.CompleteCheckout(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if status := h.Deliver(evt); status != http.StatusOK {
+		http.Error(w, "Webhook delivery failed", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, sess.SuccessURL, http.StatusSeeOther)
+}
+
+// Deliver posts a signed event to the Stripe webhook handler and returns the status it answered with.
+func (h *FakeCheckoutHandler) Deliver(evt *service.FakeWebhook) int {
+	req, err := evt.Request("/webhook/stripe")
+	if err != nil {
+		log.Printf("Error building fake webhook %s: %v", evt.EventID, err)
+		return http.StatusInternalServerError
+	}
+	rec := httptest.NewRecorder()
+	h.webhook.HandleWebhook(rec, req)
+	if rec.Code != http.StatusOK {
+		log.Printf("Fake webhook %s answered %d", evt.EventID, rec.Code)
+	}
+	return rec.Code
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"encoding/json"
+	"estacionamienti/internal/errors"
+	"net/http"
+)
+
+// writeHTTPError writes herr as plain text, or as JSON when it carries details for the client.
+func writeHTTPError(w http.ResponseWriter, herr *errors.HTTPError) {
+	if herr.Details == nil {
+		http.Error(w, herr.Message, herr.Code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(herr.Code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":   herr.Message,
+		"details": herr.Details,
+	})
+}
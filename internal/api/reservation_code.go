@@ -0,0 +1,25 @@
+package api
+
+import (
+	"estacionamienti/internal/reservationcode"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// reservationCodeVar returns the {code} of the route, normalized, or answers 400 when it can't be a reservation code
+// so malformed codes never reach the database.
+func reservationCodeVar(w http.ResponseWriter, r *http.Request) (string, bool) {
+	return checkReservationCode(w, mux.Vars(r)["code"])
+}
+
+// checkReservationCode normalizes code, or answers 400 when it can't be a reservation code. Codes in the hexadecimal
+// format issued before random codes are still looked up.
+func checkReservationCode(w http.ResponseWriter, code string) (string, bool) {
+	code = reservationcode.Normalize(code)
+	if !reservationcode.Valid(code) && !reservationcode.ValidLegacy(code) {
+		http.Error(w, "Invalid reservation code", http.StatusBadRequest)
+		return "", false
+	}
+	return code, true
+}
@@ -2,34 +2,28 @@ package api
 
 import (
 	"encoding/json"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/errors"
 	"estacionamienti/internal/service"
 	"io"
 	"log"
 	"net/http"
 
-	"github.com/stripe/stripe-go/v82"
+	"github.com/gorilla/mux"
 	"github.com/stripe/stripe-go/v82/webhook"
 )
 
-const (
-	active          = "active"
-	canceled        = "canceled"
-	refunded        = "refunded"
-	confirmed       = "confirmed"
-	statusSucceeded = "succeeded"
-)
-
 type StripeWebhookHandler struct {
 	StripeSecret       string
 	reservationService *service.ReservationService
-	senderService      *service.SenderService
+	eventService       *service.StripeEventService
 }
 
-func NewStripeWebhookHandler(stripeSecret string, reservationService *service.ReservationService, senderService *service.SenderService) *StripeWebhookHandler {
+func NewStripeWebhookHandler(stripeSecret string, reservationService *service.ReservationService, eventService *service.StripeEventService) *StripeWebhookHandler {
 	return &StripeWebhookHandler{
 		StripeSecret:       stripeSecret,
 		reservationService: reservationService,
-		senderService:      senderService,
+		eventService:       eventService,
 	}
 }
 
@@ -51,61 +45,13 @@ func (h *StripeWebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Manejar eventos de Stripe Checkout
-	switch event.Type {
-	case "checkout.session.completed":
-		var sess stripe.CheckoutSession
-		if err := json.Unmarshal(event.Data.Raw, &sess); err != nil {
-			log.Printf("Error parsing checkout.session: %v", err)
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		if sess.ID == "" {
-			log.Printf("No session ID in checkout.session.completed")
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		paymentIntentID := ""
-		if sess.PaymentIntent != nil {
-			paymentIntentID = sess.PaymentIntent.ID
-		}
-		err := h.reservationService.UpdateReservationStatusPaymentAndIntentBySessionID(sess.ID, active, statusSucceeded, paymentIntentID)
-		if err != nil {
-			log.Printf("DB error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		reservation, err := h.reservationService.GetReservationBySessionID(sess.ID)
-		if err != nil {
-			log.Printf("DB error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		statusTraducido := h.senderService.StatusTranslation(confirmed, reservation.Language)
-		h.senderService.SendReservationSMS(*reservation, statusTraducido)
-		h.senderService.SendReservationEmail(*reservation, statusTraducido)
-
-	case "charge.refunded":
-		var charge stripe.Charge
-		json.Unmarshal(event.Data.Raw, &charge)
-		if charge.PaymentIntent != nil && charge.PaymentIntent.ID != "" {
-			si, err := h.reservationService.GetSessionIDByPaymentIntentID(charge.PaymentIntent.ID)
-			if err != nil {
-				log.Printf("No session_id found for PaymentIntent %s: %v", charge.PaymentIntent.ID, err)
-				return
-			}
-			err = h.reservationService.UpdateReservationAndPaymentStatusBySessionID(si, canceled, refunded)
-			if err != nil {
-				log.Printf("DB error: %v", err)
-				return
-			}
-		}
-	default:
-		log.Printf("Unhandled event type: %s", event.Type)
+	if err := h.eventService.HandleEvent(event, payload); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
-
 	w.WriteHeader(http.StatusOK)
 }
+
 func (h *StripeWebhookHandler) GetReservationBySessionIDHandler(w http.ResponseWriter, r *http.Request) {
 	sessionID := r.URL.Query().Get("session_id")
 	if sessionID == "" {
@@ -120,3 +66,37 @@ func (h *StripeWebhookHandler) GetReservationBySessionIDHandler(w http.ResponseW
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(reservation)
 }
+
+// ListReservationEvents lists the Stripe events received for a reservation, for admins.
+func (h *StripeWebhookHandler) ListReservationEvents(w http.ResponseWriter, r *http.Request) {
+	code, ok := reservationCodeVar(w, r)
+	if !ok {
+		return
+	}
+	events, err := h.eventService.ListEventsForReservation(code)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if events == nil {
+		events = []db.StripeEvent{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// ReplayEvent processes a failed Stripe event again, for admins.
+func (h *StripeWebhookHandler) ReplayEvent(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	event, err := h.eventService.ReplayEvent(id)
+	if err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			writeHTTPError(w, herr)
+			return
+		}
+		http.Error(w, "Could not replay event", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(event)
+}
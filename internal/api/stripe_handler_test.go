@@ -0,0 +1,592 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"estacionamienti/internal/auth"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/money"
+	"estacionamienti/internal/repository/memory"
+	"estacionamienti/internal/service"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// TestMain runs the tests from the repository root, where the email templates are looked up.
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		fmt.Fprintf(os.Stderr, "could not change to repository root: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// webhookEnv wires the webhook handler to the fake gateway, an in-memory store and an outbox.
+type webhookEnv struct {
+	store          *memory.Store
+	gateway        *service.FakePaymentGateway
+	outbox         *service.OutboxSender
+	sender         *service.SenderService
+	reservationSvc *service.ReservationService
+	notifier       *service.NotificationService
+	handler        *StripeWebhookHandler
+}
+
+func newWebhookEnv() *webhookEnv {
+	store := memory.NewSeededStore()
+	gateway := service.NewFakePaymentGateway(testWebhookSecret, "http://localhost/dev/checkout")
+	outbox := service.NewOutboxWriter(io.Discard)
+	senderSvc := service.NewSenderService(outbox, outbox)
+	stripeSvc := service.NewStripeService(store, gateway, service.NewPaymentService(store, store))
+	reservationSvc := service.NewReservationService(store, store, store, store, stripeSvc, senderSvc)
+	eventSvc := service.NewStripeEventService(store, store, stripeSvc, senderSvc)
+	return &webhookEnv{
+		store:          store,
+		gateway:        gateway,
+		outbox:         outbox,
+		sender:         senderSvc,
+		reservationSvc: reservationSvc,
+		notifier:       service.NewNotificationService(store, store, senderSvc),
+		handler:        NewStripeWebhookHandler(testWebhookSecret, reservationSvc, eventSvc),
+	}
+}
+
+func (e *webhookEnv) post(evt *service.FakeWebhook) int {
+	req, _ := evt.Request("/webhook/stripe")
+	rec := httptest.NewRecorder()
+	e.handler.HandleWebhook(rec, req)
+	return rec.Code
+}
+
+func (e *webhookEnv) deliver(t *testing.T, evt *service.FakeWebhook) {
+	t.Helper()
+	if code := e.post(evt); code != http.StatusOK {
+		t.Fatalf("webhook %s answered %d", evt.EventID, code)
+	}
+}
+
+// createOnlineReservation books a car online for three hours, three days from now, and returns the checkout.
+func (e *webhookEnv) createOnlineReservation(t *testing.T) *entities.StripeSessionResponse {
+	t.Helper()
+	start := time.Now().UTC().Truncate(time.Hour).Add(72 * time.Hour)
+	end := start.Add(3 * time.Hour)
+	price, err := e.reservationSvc.GetTotalPriceForReservation(1, start, end)
+	if err != nil {
+		t.Fatalf("GetTotalPriceForReservation: %v", err)
+	}
+	created, err := e.reservationSvc.CreateReservation(&entities.ReservationRequest{
+		VehicleTypeID:   1,
+		UserName:        "Mario Rossi",
+		UserEmail:       "mario@example.com",
+		UserPhone:       "+390000000000",
+		PaymentMethodID: 2,
+		StartTime:       start,
+		EndTime:         end,
+		TotalPrice:      price.TotalPrice,
+		Language:        "en",
+	})
+	if err != nil {
+		t.Fatalf("CreateReservation: %v", err)
+	}
+	return created
+}
+
+func lastSMS(outbox *service.OutboxSender) *service.OutboxMessage {
+	msgs := outbox.Messages()
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Channel == "sms" {
+			return &msgs[i]
+		}
+	}
+	return nil
+}
+
+func TestFakeGatewayPayConfirmCancelRefund(t *testing.T) {
+	env := newWebhookEnv()
+	created := env.createOnlineReservation(t)
+	if created.URL != "http://localhost/dev/checkout/"+created.SessionID {
+		t.Fatalf("unexpected checkout URL %q for session %q", created.URL, created.SessionID)
+	}
+	sess, ok := env.gateway.Session(created.SessionID)
+	if !ok || sess.Amount <= 0 {
+		t.Fatalf("expected an open checkout, got %+v", sess)
+	}
+	if got := env.store.Reservation(created.Code); got.Status != "pending" || got.DepositPayment.Cents() != sess.Amount {
+		t.Fatalf("expected a pending reservation charging %d cents, got %+v", sess.Amount, got)
+	}
+
+	paid, err := env.gateway.CompleteCheckout(created.SessionID)
+	if err != nil {
+		t.Fatalf("CompleteCheckout: %v", err)
+	}
+	env.deliver(t, paid)
+	got := env.store.Reservation(created.Code)
+	if got.Status != "active" || got.PaymentStatus.String != "succeeded" {
+		t.Fatalf("expected active/succeeded after payment, got %s/%s", got.Status, got.PaymentStatus.String)
+	}
+	paymentIntentID := got.StripePaymentIntentID.String
+	if paymentIntentID == "" {
+		t.Fatal("payment intent was not stored")
+	}
+	if sent, err := env.notifier.DeliverDue(time.Now().UTC()); err != nil || sent != 2 {
+		t.Fatalf("expected the confirmation email and SMS to be delivered, sent %d, err %v", sent, err)
+	}
+	if sms := lastSMS(env.outbox); sms == nil || !strings.Contains(sms.Body, created.Code) || !strings.Contains(sms.Body, "confirmed") {
+		t.Fatalf("expected a confirmation SMS for %s, got %+v", created.Code, sms)
+	}
+
+	if _, err := env.reservationSvc.CancelReservation(created.Code, "mario@example.com"); err != nil {
+		t.Fatalf("CancelReservation: %v", err)
+	}
+	if sent, err := env.notifier.DeliverDue(time.Now().UTC()); err != nil || sent != 2 {
+		t.Fatalf("expected the cancellation email and SMS to be delivered, sent %d, err %v", sent, err)
+	}
+	if sms := lastSMS(env.outbox); !strings.Contains(sms.Body, "canceled") {
+		t.Fatalf("expected a cancellation SMS, got %q", sms.Body)
+	}
+	refunds := env.gateway.Refunds()
+	if len(refunds) != 1 || refunds[0].PaymentIntentID != paymentIntentID || refunds[0].Amount != sess.Amount {
+		t.Fatalf("expected one full refund of %s, got %+v", paymentIntentID, refunds)
+	}
+
+	refundedEvt, err := env.gateway.RefundedWebhook(paymentIntentID)
+	if err != nil {
+		t.Fatalf("RefundedWebhook: %v", err)
+	}
+	env.deliver(t, refundedEvt)
+	got = env.store.Reservation(created.Code)
+	if got.Status != "canceled" || got.PaymentStatus.String != "refunded" {
+		t.Fatalf("expected canceled/refunded after refund webhook, got %s/%s", got.Status, got.PaymentStatus.String)
+	}
+
+	// The refund is in the ledger once, although both the cancellation and the webhook recorded it.
+	payments, err := env.store.ListPaymentsByReservation(got.ID)
+	if err != nil {
+		t.Fatalf("ListPaymentsByReservation: %v", err)
+	}
+	if len(payments) != 2 || payments[0].Kind != "charge" || payments[1].Kind != "refund" ||
+		payments[1].ExternalID.String != refunds[0].ID || payments[0].Amount != payments[1].Amount {
+		t.Fatalf("expected the charge and its refund in the ledger, got %+v", payments)
+	}
+}
+
+func TestWebhookRecordsChargeAndBalanceDue(t *testing.T) {
+	env := newWebhookEnv()
+	created := env.createOnlineReservation(t)
+	env.confirm(t, created)
+
+	res, err := env.reservationSvc.GetReservationByCode(created.Code, "mario@example.com")
+	if err != nil {
+		t.Fatalf("GetReservationByCode: %v", err)
+	}
+	if res.AmountPaid != res.TotalPrice || res.BalanceDue != 0 {
+		t.Fatalf("expected an online reservation to be fully paid, got paid %s of %s, due %s", res.AmountPaid, res.TotalPrice, res.BalanceDue)
+	}
+	payments, _ := env.store.ListPaymentsByReservation(env.store.Reservation(created.Code).ID)
+	if len(payments) != 1 || payments[0].Kind != "charge" {
+		t.Fatalf("expected one charge, got %+v", payments)
+	}
+}
+
+func TestReservationBySessionHidesCustomerDetails(t *testing.T) {
+	env := newWebhookEnv()
+	created := env.createOnlineReservation(t)
+	env.confirm(t, created)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/reservation/by-session?session_id="+created.SessionID, nil)
+	rec := httptest.NewRecorder()
+	env.handler.GetReservationBySessionIDHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(body) != 3 || body["code"] != created.Code || body["status"] != "active" || body["payment_status"] != "succeeded" {
+		t.Fatalf("expected only the code and status, got %s", rec.Body)
+	}
+}
+
+func TestWebhookRetriesAreProcessedOnce(t *testing.T) {
+	env := newWebhookEnv()
+	created := env.createOnlineReservation(t)
+	paid, err := env.gateway.CompleteCheckout(created.SessionID)
+	if err != nil {
+		t.Fatalf("CompleteCheckout: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		env.deliver(t, paid)
+	}
+	if queued := env.store.Notifications(created.Code); len(queued) != 2 {
+		t.Fatalf("expected one email and one SMS despite retries, got %d notifications", len(queued))
+	}
+	events, err := env.store.ListStripeEventsByReservation(created.Code)
+	if err != nil {
+		t.Fatalf("ListStripeEventsByReservation: %v", err)
+	}
+	if len(events) != 1 || events[0].ID != paid.EventID || events[0].Status != "processed" || events[0].Attempts != 1 {
+		t.Fatalf("expected the event recorded once as processed, got %+v", events)
+	}
+}
+
+func TestWebhookRefundBeforeCompletionIsNotUndone(t *testing.T) {
+	env := newWebhookEnv()
+	created := env.createOnlineReservation(t)
+	paid, err := env.gateway.CompleteCheckout(created.SessionID)
+	if err != nil {
+		t.Fatalf("CompleteCheckout: %v", err)
+	}
+	sess, _ := env.gateway.Session(created.SessionID)
+	if _, err := env.gateway.Refund(service.RefundRequest{PaymentIntentID: sess.PaymentIntentID}); err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	refundedEvt, err := env.gateway.RefundedWebhook(sess.PaymentIntentID)
+	if err != nil {
+		t.Fatalf("RefundedWebhook: %v", err)
+	}
+
+	// Stripe delivers the refund first.
+	env.deliver(t, refundedEvt)
+	env.deliver(t, paid)
+
+	got := env.store.Reservation(created.Code)
+	if got.Status != "canceled" || got.PaymentStatus.String != "refunded" {
+		t.Fatalf("late checkout.session.completed reactivated the reservation: %s/%s", got.Status, got.PaymentStatus.String)
+	}
+	if queued := env.store.Notifications(created.Code); len(queued) != 0 {
+		t.Fatalf("expected no confirmation for a refunded reservation, got %d notifications", len(queued))
+	}
+	events, _ := env.store.ListStripeEventsByReservation(created.Code)
+	if len(events) != 2 || events[1].Status != "ignored" {
+		t.Fatalf("expected the late completion to be recorded as ignored, got %+v", events)
+	}
+}
+
+// confirm pays the checkout of a reservation and delivers the completion, returning the payment intent.
+func (e *webhookEnv) confirm(t *testing.T, created *entities.StripeSessionResponse) string {
+	t.Helper()
+	paid, err := e.gateway.CompleteCheckout(created.SessionID)
+	if err != nil {
+		t.Fatalf("CompleteCheckout: %v", err)
+	}
+	e.deliver(t, paid)
+	return e.store.Reservation(created.Code).StripePaymentIntentID.String
+}
+
+func TestWebhookExpiredCheckoutReleasesSpace(t *testing.T) {
+	env := newWebhookEnv()
+	created := env.createOnlineReservation(t)
+	expired, err := env.gateway.ExpireCheckout(created.SessionID)
+	if err != nil {
+		t.Fatalf("ExpireCheckout: %v", err)
+	}
+	env.deliver(t, expired)
+
+	got := env.store.Reservation(created.Code)
+	if got.Status != "canceled" || got.PaymentStatus.String != "expired" {
+		t.Fatalf("expected canceled/expired, got %s/%s", got.Status, got.PaymentStatus.String)
+	}
+	if _, err := env.notifier.DeliverDue(time.Now().UTC()); err != nil {
+		t.Fatalf("DeliverDue: %v", err)
+	}
+	if sms := lastSMS(env.outbox); sms == nil || !strings.Contains(sms.Body, "expired") {
+		t.Fatalf("expected an expiry SMS, got %+v", sms)
+	}
+	slots, err := env.store.GetHourlyAvailabilityDetails(got.StartTime, got.EndTime, got.VehicleTypeID, time.Now().UTC().Add(-time.Hour), 0)
+	if err != nil {
+		t.Fatalf("GetHourlyAvailabilityDetails: %v", err)
+	}
+	for _, slot := range slots {
+		if slot.BookedSpaces != 0 {
+			t.Fatalf("expected the space to be free again, slot %s has %d booked", slot.SlotStart, slot.BookedSpaces)
+		}
+	}
+}
+
+func TestWebhookDelayedPayment(t *testing.T) {
+	env := newWebhookEnv()
+	settled := env.createOnlineReservation(t)
+	failed := env.createOnlineReservation(t)
+
+	for _, created := range []*entities.StripeSessionResponse{settled, failed} {
+		evt, err := env.gateway.CompleteCheckoutDelayed(created.SessionID)
+		if err != nil {
+			t.Fatalf("CompleteCheckoutDelayed: %v", err)
+		}
+		env.deliver(t, evt)
+		got := env.store.Reservation(created.Code)
+		if got.Status != "pending" || got.PaymentStatus.String != "processing" || !got.StripePaymentIntentID.Valid {
+			t.Fatalf("expected pending/processing with a payment intent, got %+v", got)
+		}
+	}
+	// Processing payments keep their space past the checkout hold and are not cleaned up.
+	if n, err := env.store.DeletePendingReservationsOlderThan(time.Now().UTC().Add(time.Hour)); err != nil || n != 0 {
+		t.Fatalf("expected no processing reservation to be deleted, deleted %d, err %v", n, err)
+	}
+
+	ok, err := env.gateway.SettleDelayedPayment(settled.SessionID, true)
+	if err != nil {
+		t.Fatalf("SettleDelayedPayment: %v", err)
+	}
+	env.deliver(t, ok)
+	if got := env.store.Reservation(settled.Code); got.Status != "active" || got.PaymentStatus.String != "succeeded" {
+		t.Fatalf("expected active/succeeded, got %s/%s", got.Status, got.PaymentStatus.String)
+	}
+
+	ko, err := env.gateway.SettleDelayedPayment(failed.SessionID, false)
+	if err != nil {
+		t.Fatalf("SettleDelayedPayment: %v", err)
+	}
+	env.deliver(t, ko)
+	if got := env.store.Reservation(failed.Code); got.Status != "canceled" || got.PaymentStatus.String != "failed" {
+		t.Fatalf("expected canceled/failed, got %s/%s", got.Status, got.PaymentStatus.String)
+	}
+}
+
+func TestWebhookPaymentFailedKeepsReservationPending(t *testing.T) {
+	env := newWebhookEnv()
+	created := env.createOnlineReservation(t)
+	paymentIntentID := env.confirm(t, created)
+	// A failure reported after the payment went through must not touch it.
+	evt, err := env.gateway.SignedEvent("payment_intent.payment_failed", map[string]interface{}{
+		"id":                 paymentIntentID,
+		"object":             "payment_intent",
+		"last_payment_error": map[string]string{"message": "Your card was declined."},
+	})
+	if err != nil {
+		t.Fatalf("SignedEvent: %v", err)
+	}
+	env.deliver(t, evt)
+	if got := env.store.Reservation(created.Code); got.Status != "active" || got.PaymentStatus.String != "succeeded" {
+		t.Fatalf("expected active/succeeded, got %s/%s", got.Status, got.PaymentStatus.String)
+	}
+	record, _ := env.store.GetStripeEvent(evt.EventID)
+	if record.Status != "ignored" {
+		t.Fatalf("expected the late failure to be ignored, got %s", record.Status)
+	}
+}
+
+func TestWebhookPartialRefund(t *testing.T) {
+	env := newWebhookEnv()
+	created := env.createOnlineReservation(t)
+	paymentIntentID := env.confirm(t, created)
+	sess, _ := env.gateway.Session(created.SessionID)
+
+	if _, err := env.gateway.Refund(service.RefundRequest{PaymentIntentID: paymentIntentID, Amount: money.Amount(sess.Amount / 2)}); err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	refundedEvt, err := env.gateway.RefundedWebhook(paymentIntentID)
+	if err != nil {
+		t.Fatalf("RefundedWebhook: %v", err)
+	}
+	env.deliver(t, refundedEvt)
+	got := env.store.Reservation(created.Code)
+	if got.Status != "active" || got.PaymentStatus.String != "partially_refunded" {
+		t.Fatalf("expected active/partially_refunded, got %s/%s", got.Status, got.PaymentStatus.String)
+	}
+
+	refund := env.gateway.Refunds()[0]
+	updated, err := env.gateway.SignedEvent("charge.refund.updated", map[string]interface{}{
+		"id":             refund.ID,
+		"object":         "refund",
+		"amount":         refund.Amount,
+		"payment_intent": paymentIntentID,
+		"status":         "failed",
+		"failure_reason": "expired_or_canceled_card",
+	})
+	if err != nil {
+		t.Fatalf("SignedEvent: %v", err)
+	}
+	env.sender.AdminEmail = "admin@example.com"
+	env.deliver(t, updated)
+	if got := env.store.Reservation(created.Code); got.PaymentStatus.String != "refund_failed" {
+		t.Fatalf("expected refund_failed, got %s", got.PaymentStatus.String)
+	}
+	queued := env.store.Notifications(created.Code)
+	if last := queued[len(queued)-1]; last.Recipient != "admin@example.com" || !strings.Contains(last.Body, refund.ID) {
+		t.Fatalf("expected an admin alert about %s, got %+v", refund.ID, last)
+	}
+}
+
+func TestWebhookDisputeAlertsAdmin(t *testing.T) {
+	env := newWebhookEnv()
+	env.sender.AdminEmail = "admin@example.com"
+	created := env.createOnlineReservation(t)
+	paymentIntentID := env.confirm(t, created)
+
+	dispute, err := env.gateway.DisputeWebhook(paymentIntentID, "fraudulent")
+	if err != nil {
+		t.Fatalf("DisputeWebhook: %v", err)
+	}
+	env.deliver(t, dispute)
+	env.deliver(t, dispute)
+
+	got := env.store.Reservation(created.Code)
+	if got.Status != "active" || got.PaymentStatus.String != "disputed" {
+		t.Fatalf("expected active/disputed, got %s/%s", got.Status, got.PaymentStatus.String)
+	}
+	var alerts int
+	for _, n := range env.store.Notifications(created.Code) {
+		if n.Recipient == "admin@example.com" {
+			alerts++
+			if !strings.Contains(n.Body, "fraudulent") {
+				t.Fatalf("expected the dispute reason in the alert, got %q", n.Body)
+			}
+		}
+	}
+	if alerts != 1 {
+		t.Fatalf("expected one admin alert, got %d", alerts)
+	}
+}
+
+func TestAdminReplaysFailedEvent(t *testing.T) {
+	env := newWebhookEnv()
+	checkout, err := env.gateway.CreateCheckoutSession(service.CheckoutRequest{Price: money.New(1200, "eur"), CustomerEmail: "mario@example.com"})
+	if err != nil {
+		t.Fatalf("CreateCheckoutSession: %v", err)
+	}
+	paid, err := env.gateway.CompleteCheckout(checkout.ID)
+	if err != nil {
+		t.Fatalf("CompleteCheckout: %v", err)
+	}
+	// The session is not linked to any reservation yet, so processing fails and Stripe is asked to retry.
+	if code := env.post(paid); code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 for an event that cannot be applied yet, got %d", code)
+	}
+	record, err := env.store.GetStripeEvent(paid.EventID)
+	if err != nil || record.Status != "failed" {
+		t.Fatalf("expected the event to be stored as failed, got %+v, %v", record, err)
+	}
+
+	start := time.Now().UTC().Truncate(time.Hour).Add(72 * time.Hour)
+	res := &db.Reservation{
+		Code:            "0E9A1A01",
+		UserName:        "Mario Rossi",
+		UserEmail:       "mario@example.com",
+		VehicleTypeID:   1,
+		PaymentMethodID: 2,
+		Status:          "pending",
+		StartTime:       start,
+		EndTime:         start.Add(2 * time.Hour),
+		StripeSessionID: sql.NullString{String: checkout.ID, Valid: true},
+		Language:        "en",
+	}
+	env.store.InsertReservation(res)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/stripe-events/{id}/replay", env.handler.ReplayEvent).Methods("POST")
+	router.HandleFunc("/admin/reservations/{code}/stripe-events", env.handler.ListReservationEvents).Methods("GET")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/stripe-events/"+paid.EventID+"/replay", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("replay answered %d: %s", rec.Code, rec.Body.String())
+	}
+	var replayed db.StripeEvent
+	if err := json.NewDecoder(rec.Body).Decode(&replayed); err != nil {
+		t.Fatalf("decoding replayed event: %v", err)
+	}
+	if replayed.Status != "processed" || replayed.Attempts != 2 || replayed.ReservationCode.String != "0E9A1A01" {
+		t.Fatalf("unexpected replayed event %+v", replayed)
+	}
+	if got := env.store.Reservation("0E9A1A01"); got.Status != "active" {
+		t.Fatalf("expected the replay to confirm the reservation, got %s", got.Status)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/stripe-events/"+paid.EventID+"/replay", nil))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 replaying a processed event, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/reservations/0E9A1A01/stripe-events", nil))
+	var events []db.StripeEvent
+	if err := json.NewDecoder(rec.Body).Decode(&events); err != nil || len(events) != 1 {
+		t.Fatalf("expected one event for 0E9A1A01, got %d (%v)", len(events), err)
+	}
+}
+
+func TestWebhookRejectsBadSignature(t *testing.T) {
+	env := newWebhookEnv()
+	other := service.NewFakePaymentGateway("whsec_other", "http://localhost/dev/checkout")
+	evt, err := other.SignedEvent("checkout.session.completed", map[string]string{"id": "cs_fake_1"})
+	if err != nil {
+		t.Fatalf("SignedEvent: %v", err)
+	}
+	if code := env.post(evt); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an event signed with another secret, got %d", code)
+	}
+}
+
+func TestModifyReservationPaidThroughCheckout(t *testing.T) {
+	env := newWebhookEnv()
+	created := env.createOnlineReservation(t)
+	env.confirm(t, created)
+	before := env.store.Reservation(created.Code)
+
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	token, _, err := auth.NewCustomerToken("mario@example.com")
+	if err != nil {
+		t.Fatalf("NewCustomerToken: %v", err)
+	}
+	r := mux.NewRouter()
+	r.Handle("/api/reservations/{code}", auth.CustomerAuthMiddleware(http.HandlerFunc(NewUserReservationHandler(env.reservationSvc).ModifyReservation))).Methods("PATCH")
+	newEnd := before.EndTime.Add(2 * time.Hour)
+	body := fmt.Sprintf(`{"end_time": %q}`, newEnd.Format(time.RFC3339))
+	req := httptest.NewRequest(http.MethodPatch, "/api/reservations/"+created.Code, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PATCH answered %d: %s", rec.Code, rec.Body.String())
+	}
+	var change entities.ReservationChangeResponse
+	if err := json.NewDecoder(rec.Body).Decode(&change); err != nil {
+		t.Fatalf("decoding change: %v", err)
+	}
+	if change.Status != "awaiting_payment" || change.AmountDue != 800 || change.URL == "" {
+		t.Fatalf("expected a checkout for the 8 EUR difference, got %+v", change)
+	}
+
+	paid, err := env.gateway.CompleteCheckout(change.SessionID)
+	if err != nil {
+		t.Fatalf("CompleteCheckout: %v", err)
+	}
+	env.deliver(t, paid)
+	got := env.store.Reservation(created.Code)
+	if !got.EndTime.Equal(newEnd) || got.Status != "active" {
+		t.Fatalf("paid change not applied: %+v", got)
+	}
+	notifications := env.store.Notifications(created.Code)
+	if last := notifications[len(notifications)-1]; !strings.Contains(last.Body, "modified") {
+		t.Fatalf("expected the customer told about the modification, got %q", last.Body)
+	}
+
+	// Refunding the modification payment from the dashboard doesn't cancel the reservation.
+	sess, _ := env.gateway.Session(change.SessionID)
+	if _, err := env.gateway.Refund(service.RefundRequest{PaymentIntentID: sess.PaymentIntentID}); err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	refunded, err := env.gateway.RefundedWebhook(sess.PaymentIntentID)
+	if err != nil {
+		t.Fatalf("RefundedWebhook: %v", err)
+	}
+	env.deliver(t, refunded)
+	if got := env.store.Reservation(created.Code); got.Status != "active" {
+		t.Fatalf("refunding the modification payment canceled the reservation: %+v", got)
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"estacionamienti/internal/auth"
 	"estacionamienti/internal/entities"
 	"estacionamienti/internal/errors"
 	"estacionamienti/internal/service"
@@ -10,8 +11,6 @@ import (
 	"net/http"
 	"strconv"
 	"time"
-
-	"github.com/gorilla/mux"
 )
 
 type UserReservationHandler struct {
@@ -154,7 +153,7 @@ func (h *UserReservationHandler) GetTotalPriceForReservation(w http.ResponseWrit
 	}
 	endTime = endTime.UTC()
 
-	totalPrice, err := h.Service.GetTotalPriceForReservation(vehicleTypeID, startTime, endTime)
+	breakdown, err := h.Service.GetTotalPriceForReservation(vehicleTypeID, startTime, endTime)
 	if err != nil {
 		if herr, ok := err.(*errors.HTTPError); ok {
 			http.Error(w, herr.Message, herr.Code)
@@ -164,9 +163,30 @@ func (h *UserReservationHandler) GetTotalPriceForReservation(w http.ResponseWrit
 		return
 	}
 
-	response := map[string]float32{"total_price": totalPrice}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(breakdown)
+}
+
+// QuoteReservation returns the itemized price of a reservation and a quote_token to book it at that price.
+func (h *UserReservationHandler) QuoteReservation(w http.ResponseWriter, r *http.Request) {
+	var req entities.QuoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	req.StartTime = req.StartTime.UTC()
+	req.EndTime = req.EndTime.UTC()
+	quote, err := h.Service.QuoteReservation(req)
+	if err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			writeHTTPError(w, herr)
+			return
+		}
+		http.Error(w, "Could not quote the reservation", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
 }
 
 func (h *UserReservationHandler) CreateReservation(w http.ResponseWriter, r *http.Request) {
@@ -180,7 +200,7 @@ func (h *UserReservationHandler) CreateReservation(w http.ResponseWriter, r *htt
 	reservation, err := h.Service.CreateReservation(&req)
 	if err != nil {
 		if herr, ok := err.(*errors.HTTPError); ok {
-			http.Error(w, herr.Message, herr.Code)
+			writeHTTPError(w, herr)
 			return
 		}
 		http.Error(w, err.Error(), http.StatusConflict)
@@ -191,14 +211,23 @@ func (h *UserReservationHandler) CreateReservation(w http.ResponseWriter, r *htt
 	})
 }
 
-func (h *UserReservationHandler) GetReservation(w http.ResponseWriter, r *http.Request) {
-	code := mux.Vars(r)["code"]
+// ListMyReservations returns every reservation of the signed-in customer.
+func (h *UserReservationHandler) ListMyReservations(w http.ResponseWriter, r *http.Request) {
+	reservations, err := h.Service.ListCustomerReservations(auth.CustomerEmail(r))
+	if err != nil {
+		http.Error(w, "Could not list reservations", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reservations)
+}
 
-	email := r.URL.Query().Get("email")
-	if email == "" {
-		http.Error(w, "Missing email query parameter", http.StatusBadRequest)
+func (h *UserReservationHandler) GetReservation(w http.ResponseWriter, r *http.Request) {
+	code, ok := reservationCodeVar(w, r)
+	if !ok {
 		return
 	}
+	email := auth.CustomerEmail(r)
 
 	res, err := h.Service.GetReservationByCode(code, email)
 	if err != nil {
@@ -212,9 +241,30 @@ func (h *UserReservationHandler) GetReservation(w http.ResponseWriter, r *http.R
 	json.NewEncoder(w).Encode(res)
 }
 
+// GetCancellationQuote returns the refund the customer would get by canceling now.
+func (h *UserReservationHandler) GetCancellationQuote(w http.ResponseWriter, r *http.Request) {
+	code, ok := reservationCodeVar(w, r)
+	if !ok {
+		return
+	}
+	quote, err := h.Service.QuoteCancellation(code, auth.CustomerEmail(r))
+	if err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			http.Error(w, herr.Message, herr.Code)
+			return
+		}
+		http.Error(w, "Reservation not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(quote)
+}
+
 func (h *UserReservationHandler) CancelReservation(w http.ResponseWriter, r *http.Request) {
-	code := mux.Vars(r)["code"]
-	err := h.Service.CancelReservation(code)
+	code, ok := reservationCodeVar(w, r)
+	if !ok {
+		return
+	}
+	refund, err := h.Service.CancelReservation(code, auth.CustomerEmail(r))
 	if err != nil {
 		if herr, ok := err.(*errors.HTTPError); ok {
 			http.Error(w, herr.Message, herr.Code)
@@ -223,5 +273,58 @@ func (h *UserReservationHandler) CancelReservation(w http.ResponseWriter, r *htt
 		http.Error(w, "Could not cancel reservation", http.StatusInternalServerError)
 		return
 	}
-	json.NewEncoder(w).Encode(map[string]string{"message": "Reservation cancelled"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Reservation cancelled",
+		"refund":  refund,
+	})
+}
+
+// ModifyReservation changes the window or vehicle of the reservation. When the change costs more, the response carries
+// the checkout URL for the difference and the change applies once it is paid.
+func (h *UserReservationHandler) ModifyReservation(w http.ResponseWriter, r *http.Request) {
+	code, ok := reservationCodeVar(w, r)
+	if !ok {
+		return
+	}
+	email := auth.CustomerEmail(r)
+	var req entities.ReservationChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	change, err := h.Service.ModifyReservation(code, email, req)
+	if err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			writeHTTPError(w, herr)
+			return
+		}
+		http.Error(w, "Could not modify reservation", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(change)
+}
+
+func (h *UserReservationHandler) ExtendReservation(w http.ResponseWriter, r *http.Request) {
+	code, ok := reservationCodeVar(w, r)
+	if !ok {
+		return
+	}
+	email := auth.CustomerEmail(r)
+	var req struct {
+		Hours int `json:"hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	change, err := h.Service.ExtendReservation(code, email, req.Hours)
+	if err != nil {
+		if herr, ok := err.(*errors.HTTPError); ok {
+			writeHTTPError(w, herr)
+			return
+		}
+		http.Error(w, "Could not extend reservation", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(change)
 }
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// customerAudience marks customer tokens, so they are never taken for admin ones.
+	customerAudience = "customer"
+	// CustomerTokenTTL is how long a customer stays signed in after using a login code.
+	CustomerTokenTTL = 30 * time.Minute
+)
+
+type customerContextKey struct{}
+
+// customerSecret signs customer tokens: CUSTOMER_JWT_SECRET, or JWT_SECRET if that is not set.
+func customerSecret() ([]byte, error) {
+	secret := os.Getenv("CUSTOMER_JWT_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	if secret == "" {
+		return nil, errors.New("neither CUSTOMER_JWT_SECRET nor JWT_SECRET is set")
+	}
+	return []byte(secret), nil
+}
+
+// NewCustomerToken signs a token that proves its holder controls email, valid for CustomerTokenTTL.
+func NewCustomerToken(email string) (string, time.Time, error) {
+	secret, err := customerSecret()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(CustomerTokenTTL)
+	claims := jwt.RegisteredClaims{
+		Subject:   strings.ToLower(email),
+		Audience:  jwt.ClaimStrings{customerAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// CustomerAuthMiddleware only lets through requests with a customer token from NewCustomerToken. The email it was
+// issued for is available to handlers with CustomerEmail.
+func CustomerAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenStr, ok := bearerToken(r)
+		if !ok {
+			http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
+			return
+		}
+		secret, err := customerSecret()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var claims jwt.RegisteredClaims
+		token, err := jwt.ParseWithClaims(tokenStr, &claims, func(token *jwt.Token) (interface{}, error) {
+			return secret, nil
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(customerAudience),
+			jwt.WithExpirationRequired())
+		if err != nil || !token.Valid || claims.Subject == "" {
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), customerContextKey{}, claims.Subject)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// CustomerEmail returns the email of the customer authenticated by CustomerAuthMiddleware, or "" outside customer
+// routes.
+func CustomerEmail(r *http.Request) string {
+	email, _ := r.Context().Value(customerContextKey{}).(string)
+	return email
+}
+
+// bearerToken returns the token of an "Authorization: Bearer <token>" header.
+func bearerToken(r *http.Request) (string, bool) {
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || parts[0] != "Bearer" || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// isCustomerToken reports whether the claims are those of a customer token.
+func isCustomerToken(claims jwt.Claims) bool {
+	audience, _ := claims.GetAudience()
+	return slices.Contains(audience, customerAudience)
+}
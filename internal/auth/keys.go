@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultKeyID is the kid of JWT_SECRET when JWT_KEYS is not set.
+const defaultKeyID = "default"
+
+// adminKeys returns the secrets admin tokens are verified with, by kid, and the kid of the one that signs new tokens.
+// JWT_KEYS lists them as "kid:secret" pairs separated by commas, the first one signing. Without it, JWT_SECRET is the
+// only key.
+func adminKeys() (map[string][]byte, string, error) {
+	list := os.Getenv("JWT_KEYS")
+	if list == "" {
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			return nil, "", errors.New("neither JWT_KEYS nor JWT_SECRET is set")
+		}
+		return map[string][]byte{defaultKeyID: []byte(secret)}, defaultKeyID, nil
+	}
+
+	keys := map[string][]byte{}
+	var signing string
+	for _, pair := range strings.Split(list, ",") {
+		kid, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || kid == "" || secret == "" {
+			return nil, "", fmt.Errorf("JWT_KEYS: %q is not kid:secret", pair)
+		}
+		if _, dup := keys[kid]; dup {
+			return nil, "", fmt.Errorf("JWT_KEYS: kid %q appears twice", kid)
+		}
+		keys[kid] = []byte(secret)
+		if signing == "" {
+			signing = kid
+		}
+	}
+	return keys, signing, nil
+}
@@ -2,47 +2,122 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"net/http"
-	"os"
-	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// AdminTokenTTL is how long an admin access token works. Admins stay signed in longer by refreshing it.
+const AdminTokenTTL = 15 * time.Minute
+
+// AdminClaims are the claims of admin tokens.
+type AdminClaims struct {
+	AdminID int    `json:"admin_id"`
+	User    string `json:"user"`
+	Role    string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+type adminContextKey struct{}
+
+// NewAdminToken signs an access token for the admin, valid for AdminTokenTTL, with the current signing key named in
+// its kid header.
+func NewAdminToken(adminID int, user, role string) (string, time.Time, error) {
+	keys, kid, err := adminKeys()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(AdminTokenTTL)
+	claims := AdminClaims{
+		AdminID: adminID,
+		User:    user,
+		Role:    role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(keys[kid])
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// AdminAuthMiddleware only lets through requests with an admin token from NewAdminToken. The admin is available to
+// handlers with AdminUser and AdminRole.
 func AdminAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
+		if r.Header.Get("Authorization") == "" {
 			http.Error(w, "Missing Authorization header", http.StatusUnauthorized)
 			return
 		}
-
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
+		tokenStr, ok := bearerToken(r)
+		if !ok {
 			http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
 			return
 		}
 
-		tokenStr := parts[1]
-		secret := os.Getenv("JWT_SECRET")
-		if secret == "" {
-			http.Error(w, "JWT_SECRET not set", http.StatusInternalServerError)
+		keys, _, err := adminKeys()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
+		// Any key still listed verifies the tokens it signed, so keys can be rotated without logging admins out.
+		var claims AdminClaims
+		token, err := jwt.ParseWithClaims(tokenStr, &claims, func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			key, ok := keys[kid]
+			if !ok {
+				return nil, errors.New("unknown signing key")
 			}
-			return []byte(secret), nil
-		})
+			return key, nil
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
 
-		if err != nil || !token.Valid {
+		// Customer tokens may share JWT_SECRET, they must not open admin routes. Tokens issued before roles existed
+		// carry none and need a new login.
+		if err != nil || !token.Valid || isCustomerToken(&claims) || !ValidRole(claims.Role) {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "admin", token.Claims)
+		ctx := context.WithValue(r.Context(), adminContextKey{}, &claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// adminClaims returns the claims of the admin authenticated by AdminAuthMiddleware, or nil outside admin routes.
+func adminClaims(r *http.Request) *AdminClaims {
+	claims, _ := r.Context().Value(adminContextKey{}).(*AdminClaims)
+	return claims
+}
+
+// AdminUser returns the user name of the admin authenticated by AdminAuthMiddleware, or "" outside admin routes.
+func AdminUser(r *http.Request) string {
+	if claims := adminClaims(r); claims != nil {
+		return claims.User
+	}
+	return ""
+}
+
+// AdminID returns the ID of the admin authenticated by AdminAuthMiddleware, or 0 outside admin routes.
+func AdminID(r *http.Request) int {
+	if claims := adminClaims(r); claims != nil {
+		return claims.AdminID
+	}
+	return 0
+}
+
+// AdminRole returns the role of the admin authenticated by AdminAuthMiddleware, or "" outside admin routes.
+func AdminRole(r *http.Request) string {
+	if claims := adminClaims(r); claims != nil {
+		return claims.Role
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Admin roles, from most to least privileged.
+const (
+	RoleOwner     = "owner"
+	RoleManager   = "manager"
+	RoleAttendant = "attendant"
+	RoleReadOnly  = "read_only"
+)
+
+// Permission is what an admin route requires from the role of the caller.
+type Permission string
+
+const (
+	// PermissionRead lets admins see reservations, payments, notifications and settings.
+	PermissionRead Permission = "read"
+	// PermissionReservations lets admins create, modify and extend reservations and resend their notifications.
+	PermissionReservations Permission = "reservations"
+	// PermissionGate lets admins check vehicles in and out, register walk-ins and no-shows and record payments.
+	PermissionGate Permission = "gate"
+	// PermissionRefunds lets admins cancel reservations, with or without a refund, and replay Stripe events.
+	PermissionRefunds Permission = "refunds"
+	// PermissionPricing lets admins change spaces, prices, pricing rules, promo codes and the refund policy.
+	PermissionPricing Permission = "pricing"
+	// PermissionAdmins lets admins manage admin accounts.
+	PermissionAdmins Permission = "admins"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleOwner:     {PermissionRead, PermissionReservations, PermissionGate, PermissionRefunds, PermissionPricing, PermissionAdmins},
+	RoleManager:   {PermissionRead, PermissionReservations, PermissionGate, PermissionRefunds, PermissionPricing},
+	RoleAttendant: {PermissionRead, PermissionReservations, PermissionGate},
+	RoleReadOnly:  {PermissionRead},
+}
+
+// ValidRole reports whether role is one of the admin roles.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Can reports whether the role grants the permission.
+func Can(role string, permission Permission) bool {
+	return slices.Contains(rolePermissions[role], permission)
+}
+
+// RequirePermission only lets through admins whose role grants the permission. It goes after AdminAuthMiddleware.
+func RequirePermission(permission Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !Can(AdminRole(r), permission) {
+				http.Error(w, "Forbidden: your role does not allow this action", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
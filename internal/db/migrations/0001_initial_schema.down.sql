@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS reservations;
+DROP TABLE IF EXISTS payment_method;
+DROP TABLE IF EXISTS vehicle_spaces;
+DROP TABLE IF EXISTS vehicle_prices;
+DROP TABLE IF EXISTS reservation_times;
+DROP TABLE IF EXISTS vehicle_types;
+DROP TABLE IF EXISTS admins;
@@ -0,0 +1,121 @@
+-- Esquema inicial. Es idempotente para poder aplicarse sobre bases creadas a mano con create_tables.sql.
+
+-- Tabla de administradores
+CREATE TABLE IF NOT EXISTS admins (
+    id SERIAL PRIMARY KEY,
+    user_name VARCHAR(150) UNIQUE NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Tabla de tipos de vehículos
+CREATE TABLE IF NOT EXISTS vehicle_types (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) UNIQUE NOT NULL -- car, motorcycle, suv
+);
+
+CREATE TABLE IF NOT EXISTS reservation_times (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) UNIQUE NOT NULL -- hour, daily, weekly, monthly
+);
+
+CREATE TABLE IF NOT EXISTS vehicle_prices (
+    id SERIAL PRIMARY KEY,
+    vehicle_type_id INT NOT NULL REFERENCES vehicle_types(id),
+    reservation_time_id INT NOT NULL REFERENCES reservation_times(id),
+    price FLOAT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS vehicle_spaces (
+    id SERIAL PRIMARY KEY,
+    vehicle_type_id INT NOT NULL REFERENCES vehicle_types(id),
+    spaces INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Tabla de pagos
+CREATE TABLE IF NOT EXISTS payment_method (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) UNIQUE NOT NULL -- onsite or online
+);
+
+-- Tabla de reservas
+CREATE TABLE IF NOT EXISTS reservations (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(10) UNIQUE NOT NULL,
+    user_name VARCHAR(100) NOT NULL,
+    user_email VARCHAR(150) NOT NULL,
+    user_phone VARCHAR(20),
+    vehicle_type_id INT NOT NULL REFERENCES vehicle_types(id),
+    payment_method_id INT NOT NULL REFERENCES payment_method(id),
+    vehicle_plate VARCHAR(20),
+    vehicle_model VARCHAR(50),
+    status VARCHAR(20) DEFAULT 'active',
+    start_time TIMESTAMPTZ NOT NULL,
+    end_time TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    payment_status VARCHAR(50),
+    stripe_session_id VARCHAR(255),
+    stripe_payment_intent_id VARCHAR(255),
+    language VARCHAR(20),
+    total_price FLOAT,
+    deposit_payment FLOAT
+);
+
+-- Columnas agregadas después de la primera versión del script
+ALTER TABLE reservations ADD COLUMN IF NOT EXISTS payment_status VARCHAR(50);
+ALTER TABLE reservations ADD COLUMN IF NOT EXISTS stripe_session_id VARCHAR(255);
+ALTER TABLE reservations ADD COLUMN IF NOT EXISTS stripe_payment_intent_id VARCHAR(255);
+ALTER TABLE reservations ADD COLUMN IF NOT EXISTS language VARCHAR(20);
+ALTER TABLE reservations ADD COLUMN IF NOT EXISTS total_price FLOAT;
+ALTER TABLE reservations ADD COLUMN IF NOT EXISTS deposit_payment FLOAT;
+
+-- Teléfono, matrícula y modelo son opcionales: el código guarda NULL cuando no se informan
+ALTER TABLE reservations ALTER COLUMN user_phone DROP NOT NULL;
+ALTER TABLE reservations ALTER COLUMN vehicle_plate DROP NOT NULL;
+ALTER TABLE reservations ALTER COLUMN vehicle_model DROP NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_reservations_stripe_session_id ON reservations (stripe_session_id);
+CREATE INDEX IF NOT EXISTS idx_reservations_vehicle_window ON reservations (vehicle_type_id, start_time, end_time);
+
+INSERT INTO vehicle_types (name) VALUES ('car'), ('motorcycle'), ('suv')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO reservation_times (name) VALUES ('hour'), ('daily'), ('weekly'), ('monthly')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO payment_method (name) VALUES ('onsite'), ('online')
+ON CONFLICT (name) DO NOTHING;
+
+-- Precios y espacios por defecto, sólo en bases vacías
+INSERT INTO vehicle_prices (vehicle_type_id, reservation_time_id, price)
+SELECT vt.id, rt.id, seed.price
+FROM (VALUES
+    ('car', 'hour', 4),
+    ('car', 'daily', 10),
+    ('car', 'weekly', 20),
+    ('car', 'monthly', 40),
+    ('motorcycle', 'hour', 2),
+    ('motorcycle', 'daily', 8),
+    ('motorcycle', 'weekly', 15),
+    ('motorcycle', 'monthly', 30),
+    ('suv', 'hour', 6),
+    ('suv', 'daily', 12),
+    ('suv', 'weekly', 25),
+    ('suv', 'monthly', 50)
+) AS seed(vehicle_type, reservation_time, price)
+JOIN vehicle_types vt ON vt.name = seed.vehicle_type
+JOIN reservation_times rt ON rt.name = seed.reservation_time
+WHERE NOT EXISTS (SELECT 1 FROM vehicle_prices);
+
+INSERT INTO vehicle_spaces (vehicle_type_id, spaces)
+SELECT vt.id, seed.spaces
+FROM (VALUES
+    ('car', 20),
+    ('motorcycle', 20),
+    ('suv', 10)
+) AS seed(vehicle_type, spaces)
+JOIN vehicle_types vt ON vt.name = seed.vehicle_type
+WHERE NOT EXISTS (SELECT 1 FROM vehicle_spaces);
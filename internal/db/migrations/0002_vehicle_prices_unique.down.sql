@@ -0,0 +1 @@
+ALTER TABLE vehicle_prices DROP CONSTRAINT IF EXISTS vehicle_prices_vehicle_type_reservation_time_key;
@@ -0,0 +1,10 @@
+-- UpdateVehiclePrice hace un upsert con ON CONFLICT (vehicle_type_id, reservation_time_id), que necesita esta restricción.
+-- Si hay precios duplicados se conserva el más reciente.
+DELETE FROM vehicle_prices a
+USING vehicle_prices b
+WHERE a.vehicle_type_id = b.vehicle_type_id
+  AND a.reservation_time_id = b.reservation_time_id
+  AND a.id < b.id;
+
+ALTER TABLE vehicle_prices
+    ADD CONSTRAINT vehicle_prices_vehicle_type_reservation_time_key UNIQUE (vehicle_type_id, reservation_time_id);
@@ -0,0 +1,17 @@
+CREATE TABLE vehicle_spaces (
+    id SERIAL PRIMARY KEY,
+    vehicle_type_id INT NOT NULL REFERENCES vehicle_types(id),
+    spaces INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Cada tipo recupera los espacios de su pool; sólo el tipo que da nombre al pool los conserva si lo comparte
+INSERT INTO vehicle_spaces (vehicle_type_id, spaces)
+SELECT vt.id, sp.spaces
+FROM vehicle_types vt
+JOIN space_pools sp ON sp.id = vt.space_pool_id
+WHERE sp.name = vt.name
+   OR NOT EXISTS (SELECT 1 FROM vehicle_types owner WHERE owner.space_pool_id = sp.id AND owner.name = sp.name);
+
+ALTER TABLE vehicle_types DROP COLUMN space_pool_id;
+DROP TABLE space_pools;
@@ -0,0 +1,29 @@
+-- Los espacios pasan a definirse por pool; cada tipo de vehículo ocupa lugar en un pool.
+CREATE TABLE space_pools (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) UNIQUE NOT NULL,
+    spaces INT NOT NULL DEFAULT 0 CHECK (spaces >= 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE vehicle_types ADD COLUMN space_pool_id INT REFERENCES space_pools(id);
+
+-- Un pool por cada tipo con espacios configurados, salvo suv que comparte el pool de car
+INSERT INTO space_pools (name, spaces)
+SELECT DISTINCT ON (vt.id) vt.name, vs.spaces
+FROM vehicle_spaces vs
+JOIN vehicle_types vt ON vt.id = vs.vehicle_type_id
+WHERE vt.name <> 'suv' OR NOT EXISTS (SELECT 1 FROM vehicle_types WHERE name = 'car')
+ORDER BY vt.id, vs.id DESC;
+
+UPDATE vehicle_types vt
+SET space_pool_id = sp.id
+FROM space_pools sp
+WHERE sp.name = vt.name;
+
+UPDATE vehicle_types vt
+SET space_pool_id = sp.id
+FROM space_pools sp
+WHERE vt.name = 'suv' AND sp.name = 'car';
+
+DROP TABLE vehicle_spaces;
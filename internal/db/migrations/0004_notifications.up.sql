@@ -0,0 +1,23 @@
+-- Cola de notificaciones: se escriben en la misma transacción que el cambio de estado de la reserva
+-- y un worker las envía con reintentos.
+CREATE TABLE notifications (
+    id SERIAL PRIMARY KEY,
+    reservation_id INT NOT NULL REFERENCES reservations(id) ON DELETE CASCADE,
+    reservation_code VARCHAR(10) NOT NULL,
+    channel VARCHAR(10) NOT NULL CHECK (channel IN ('email', 'sms')),
+    recipient VARCHAR(150) NOT NULL,
+    recipient_name VARCHAR(100) NOT NULL DEFAULT '',
+    subject TEXT NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    html_body TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error TEXT,
+    sent_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_notifications_due ON notifications (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_notifications_reservation_code ON notifications (reservation_code);
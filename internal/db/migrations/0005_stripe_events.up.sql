@@ -0,0 +1,16 @@
+-- Eventos de webhook de Stripe, indexados por el id del evento para procesar cada uno una sola vez.
+CREATE TABLE stripe_events (
+    id VARCHAR(255) PRIMARY KEY,
+    type VARCHAR(100) NOT NULL,
+    reservation_code VARCHAR(10),
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('processing', 'processed', 'ignored', 'failed')),
+    result TEXT,
+    attempts INT NOT NULL DEFAULT 1,
+    stripe_created_at TIMESTAMPTZ NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    processed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_stripe_events_reservation_code ON stripe_events (reservation_code);
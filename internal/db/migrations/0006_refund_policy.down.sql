@@ -0,0 +1,2 @@
+ALTER TABLE reservations DROP COLUMN IF EXISTS refunded_amount;
+DROP TABLE IF EXISTS refund_policy_tiers;
@@ -0,0 +1,24 @@
+-- Política de reembolso por método de pago: cada tramo devuelve un porcentaje de lo pagado si se cancela
+-- con al menos min_hours_before horas de anticipación. Se aplica el tramo con más horas que se cumpla.
+CREATE TABLE refund_policy_tiers (
+    id SERIAL PRIMARY KEY,
+    payment_method_id INT NOT NULL REFERENCES payment_method(id),
+    min_hours_before INT NOT NULL CHECK (min_hours_before >= 0),
+    refund_percent INT NOT NULL CHECK (refund_percent BETWEEN 0 AND 100),
+    UNIQUE (payment_method_id, min_hours_before)
+);
+
+-- onsite: sólo se pagó la seña; online: se pagó el total y bajo 48h se retiene la parte de la seña
+INSERT INTO refund_policy_tiers (payment_method_id, min_hours_before, refund_percent)
+SELECT pm.id, seed.min_hours_before, seed.refund_percent
+FROM (VALUES
+    ('onsite', 48, 100),
+    ('onsite', 12, 50),
+    ('onsite', 0, 0),
+    ('online', 48, 100),
+    ('online', 12, 70),
+    ('online', 0, 0)
+) AS seed(payment_method, min_hours_before, refund_percent)
+JOIN payment_method pm ON pm.name = seed.payment_method;
+
+ALTER TABLE reservations ADD COLUMN refunded_amount FLOAT NOT NULL DEFAULT 0;
@@ -0,0 +1,30 @@
+-- Libro de pagos: una fila por cobro, reembolso, cobro en el estacionamiento o ajuste manual.
+-- amount es siempre positivo salvo en los ajustes, donde un valor negativo es un cargo extra.
+CREATE TABLE payments (
+    id SERIAL PRIMARY KEY,
+    reservation_id INT NOT NULL REFERENCES reservations(id),
+    reservation_code VARCHAR(10) NOT NULL,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('charge', 'refund', 'onsite', 'adjustment')),
+    amount FLOAT NOT NULL CHECK (amount > 0 OR kind = 'adjustment'),
+    method VARCHAR(20) NOT NULL DEFAULT '',
+    external_id VARCHAR(255) UNIQUE,
+    note TEXT NOT NULL DEFAULT '',
+    recorded_by VARCHAR(150) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_payments_reservation_id ON payments (reservation_id);
+
+-- Cobros y reembolsos anteriores al libro, a partir de las columnas de la reserva
+INSERT INTO payments (reservation_id, reservation_code, kind, amount, method, external_id, note, created_at)
+SELECT id, code, 'charge', deposit_payment, 'stripe', stripe_payment_intent_id, 'backfill', created_at
+FROM reservations
+WHERE stripe_payment_intent_id IS NOT NULL AND stripe_payment_intent_id <> '' AND deposit_payment > 0;
+
+INSERT INTO payments (reservation_id, reservation_code, kind, amount, method, note, created_at)
+SELECT id, code, 'refund',
+       CASE WHEN refunded_amount > 0 THEN refunded_amount ELSE deposit_payment END,
+       'stripe', 'backfill', updated_at
+FROM reservations
+WHERE stripe_payment_intent_id IS NOT NULL AND stripe_payment_intent_id <> '' AND deposit_payment > 0
+  AND (refunded_amount > 0 OR payment_status = 'refunded');
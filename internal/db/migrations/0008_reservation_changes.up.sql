@@ -0,0 +1,23 @@
+-- Cambios de horario o vehículo de una reserva. Los que suben el precio de una reserva pagada online esperan el pago
+-- de la diferencia en su propia sesión de Stripe; el resto se aplica en el momento.
+CREATE TABLE reservation_changes (
+    id SERIAL PRIMARY KEY,
+    reservation_id INT NOT NULL REFERENCES reservations(id),
+    reservation_code VARCHAR(10) NOT NULL,
+    start_time TIMESTAMPTZ NOT NULL,
+    end_time TIMESTAMPTZ NOT NULL,
+    vehicle_type_id INT NOT NULL REFERENCES vehicle_types(id),
+    vehicle_plate VARCHAR(20),
+    vehicle_model VARCHAR(50),
+    old_total_price FLOAT NOT NULL,
+    new_total_price FLOAT NOT NULL,
+    new_deposit_payment FLOAT NOT NULL,
+    amount_due FLOAT NOT NULL DEFAULT 0,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('awaiting_payment', 'applied', 'superseded', 'expired', 'rejected')),
+    stripe_session_id VARCHAR(255) UNIQUE,
+    requested_by VARCHAR(150) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_reservation_changes_reservation_id ON reservation_changes (reservation_id);
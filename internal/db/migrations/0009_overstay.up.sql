@@ -0,0 +1,3 @@
+-- Hora real de salida del vehículo y recargo por quedarse más allá de end_time, ya sumado a total_price.
+ALTER TABLE reservations ADD COLUMN checked_out_at TIMESTAMPTZ;
+ALTER TABLE reservations ADD COLUMN overstay_fee FLOAT NOT NULL DEFAULT 0;
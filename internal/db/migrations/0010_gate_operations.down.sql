@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_reservations_normalized_plate;
+ALTER TABLE reservations DROP COLUMN IF EXISTS checked_in_at;
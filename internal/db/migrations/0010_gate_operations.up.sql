@@ -0,0 +1,5 @@
+-- Hora real de entrada del vehículo, registrada por el personal en la barrera.
+ALTER TABLE reservations ADD COLUMN checked_in_at TIMESTAMPTZ;
+
+-- Búsqueda por matrícula en la barrera, sin espacios ni guiones y en mayúsculas.
+CREATE INDEX idx_reservations_normalized_plate ON reservations (UPPER(REPLACE(REPLACE(vehicle_plate, ' ', ''), '-', '')));
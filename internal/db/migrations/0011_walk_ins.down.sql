@@ -0,0 +1,4 @@
+ALTER TABLE reservations DROP CONSTRAINT IF EXISTS reservations_end_time_check;
+UPDATE reservations SET end_time = COALESCE(checked_out_at, NOW()) WHERE end_time IS NULL;
+ALTER TABLE reservations ALTER COLUMN end_time SET NOT NULL;
+ALTER TABLE reservations DROP COLUMN IF EXISTS walk_in;
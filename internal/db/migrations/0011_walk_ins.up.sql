@@ -0,0 +1,5 @@
+-- Sesiones sin reserva previa: empiezan al entrar el coche y no tienen hora de fin hasta el check-out, cuando se
+-- calcula su precio.
+ALTER TABLE reservations ADD COLUMN walk_in BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE reservations ALTER COLUMN end_time DROP NOT NULL;
+ALTER TABLE reservations ADD CONSTRAINT reservations_end_time_check CHECK (end_time IS NOT NULL OR walk_in);
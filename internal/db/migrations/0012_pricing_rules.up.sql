@@ -0,0 +1,20 @@
+-- Reglas de precio dinámico. Cada hora de una reserva toma la regla de mayor prioridad que la cubra (fechas, días de
+-- la semana y franja horaria, en hora de Italia) y multiplica su precio base o lo reemplaza por hourly_price.
+-- weekdays usa 0 para el domingo; una franja con start_hour mayor que end_hour cruza la medianoche.
+CREATE TABLE pricing_rules (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    vehicle_type_id INT REFERENCES vehicle_types(id),
+    start_date DATE,
+    end_date DATE,
+    weekdays INT[] NOT NULL DEFAULT '{}',
+    start_hour INT CHECK (start_hour BETWEEN 0 AND 23),
+    end_hour INT CHECK (end_hour BETWEEN 0 AND 24),
+    multiplier FLOAT CHECK (multiplier >= 0),
+    hourly_price FLOAT CHECK (hourly_price >= 0),
+    priority INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((multiplier IS NULL) <> (hourly_price IS NULL)),
+    CHECK ((start_hour IS NULL) = (end_hour IS NULL)),
+    CHECK (start_date IS NULL OR end_date IS NULL OR end_date >= start_date)
+);
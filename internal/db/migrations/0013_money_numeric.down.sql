@@ -0,0 +1,17 @@
+ALTER TABLE pricing_rules ALTER COLUMN hourly_price TYPE FLOAT;
+
+ALTER TABLE reservation_changes
+    ALTER COLUMN old_total_price TYPE FLOAT,
+    ALTER COLUMN new_total_price TYPE FLOAT,
+    ALTER COLUMN new_deposit_payment TYPE FLOAT,
+    ALTER COLUMN amount_due TYPE FLOAT;
+
+ALTER TABLE payments ALTER COLUMN amount TYPE FLOAT;
+
+ALTER TABLE reservations
+    ALTER COLUMN total_price TYPE FLOAT,
+    ALTER COLUMN deposit_payment TYPE FLOAT,
+    ALTER COLUMN refunded_amount TYPE FLOAT,
+    ALTER COLUMN overstay_fee TYPE FLOAT;
+
+ALTER TABLE vehicle_prices ALTER COLUMN price TYPE FLOAT;
@@ -0,0 +1,21 @@
+-- Los importes pasan de FLOAT a NUMERIC(12,2): se guardan exactos al céntimo y se leen como money.Amount.
+ALTER TABLE vehicle_prices
+    ALTER COLUMN price TYPE NUMERIC(12,2) USING ROUND(price::numeric, 2);
+
+ALTER TABLE reservations
+    ALTER COLUMN total_price TYPE NUMERIC(12,2) USING ROUND(total_price::numeric, 2),
+    ALTER COLUMN deposit_payment TYPE NUMERIC(12,2) USING ROUND(deposit_payment::numeric, 2),
+    ALTER COLUMN refunded_amount TYPE NUMERIC(12,2) USING ROUND(refunded_amount::numeric, 2),
+    ALTER COLUMN overstay_fee TYPE NUMERIC(12,2) USING ROUND(overstay_fee::numeric, 2);
+
+ALTER TABLE payments
+    ALTER COLUMN amount TYPE NUMERIC(12,2) USING ROUND(amount::numeric, 2);
+
+ALTER TABLE reservation_changes
+    ALTER COLUMN old_total_price TYPE NUMERIC(12,2) USING ROUND(old_total_price::numeric, 2),
+    ALTER COLUMN new_total_price TYPE NUMERIC(12,2) USING ROUND(new_total_price::numeric, 2),
+    ALTER COLUMN new_deposit_payment TYPE NUMERIC(12,2) USING ROUND(new_deposit_payment::numeric, 2),
+    ALTER COLUMN amount_due TYPE NUMERIC(12,2) USING ROUND(amount_due::numeric, 2);
+
+ALTER TABLE pricing_rules
+    ALTER COLUMN hourly_price TYPE NUMERIC(12,2) USING ROUND(hourly_price::numeric, 2);
@@ -0,0 +1,5 @@
+ALTER TABLE reservation_changes DROP COLUMN IF EXISTS new_discount_amount;
+DROP INDEX IF EXISTS idx_reservations_promo_code;
+ALTER TABLE reservations DROP COLUMN IF EXISTS discount_amount;
+ALTER TABLE reservations DROP COLUMN IF EXISTS promo_code_id;
+DROP TABLE IF EXISTS promo_codes;
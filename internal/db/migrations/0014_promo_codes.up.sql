@@ -0,0 +1,29 @@
+-- Códigos promocionales. Cada código descuenta percent_off por ciento o amount_off del precio total de las reservas
+-- hechas entre valid_from y valid_until, para los tipos de vehículo de vehicle_type_ids (vacío son todos) y de al
+-- menos min_duration_hours. max_redemptions y max_redemptions_per_email limitan sus usos; NULL es sin límite.
+CREATE TABLE promo_codes (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    percent_off INT CHECK (percent_off BETWEEN 1 AND 100),
+    amount_off NUMERIC(12,2) CHECK (amount_off > 0),
+    valid_from TIMESTAMPTZ,
+    valid_until TIMESTAMPTZ,
+    vehicle_type_ids INT[] NOT NULL DEFAULT '{}',
+    min_duration_hours INT NOT NULL DEFAULT 0 CHECK (min_duration_hours >= 0),
+    max_redemptions INT CHECK (max_redemptions > 0),
+    max_redemptions_per_email INT CHECK (max_redemptions_per_email > 0),
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((percent_off IS NULL) <> (amount_off IS NULL)),
+    CHECK (valid_from IS NULL OR valid_until IS NULL OR valid_until > valid_from)
+);
+
+-- La reserva guarda el código usado y lo que descontó; total_price ya es el precio con el descuento aplicado.
+-- Las reservas canceladas no cuentan como usos del código.
+ALTER TABLE reservations ADD COLUMN promo_code_id INT REFERENCES promo_codes(id);
+ALTER TABLE reservations ADD COLUMN discount_amount NUMERIC(12,2) NOT NULL DEFAULT 0;
+CREATE INDEX idx_reservations_promo_code ON reservations (promo_code_id) WHERE promo_code_id IS NOT NULL;
+
+-- Al modificar una reserva con código, el descuento se recalcula sobre el nuevo precio.
+ALTER TABLE reservation_changes ADD COLUMN new_discount_amount NUMERIC(12,2) NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_reservations_user_email;
+DROP TABLE IF EXISTS customer_login_codes;
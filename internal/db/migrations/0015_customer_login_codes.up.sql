@@ -0,0 +1,17 @@
+-- Códigos de acceso de clientes: un enlace mágico (token) y un código OTP de 6 dígitos enviados al email de sus
+-- reservas. Se guardan solo los hashes; cada código se usa una sola vez y admite pocos intentos.
+CREATE TABLE customer_login_codes (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(150) NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_customer_login_codes_email ON customer_login_codes (LOWER(email), created_at);
+
+-- "Mis reservas" busca por email sin distinguir mayúsculas.
+CREATE INDEX idx_reservations_user_email ON reservations (LOWER(user_email));
@@ -0,0 +1,8 @@
+-- Roles de administradores: owner, manager, attendant y read_only. Los administradores existentes pasan a ser
+-- owner para no perder acceso; las cuentas nuevas son read_only salvo que se indique otro rol.
+ALTER TABLE admins
+    ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'owner'
+        CHECK (role IN ('owner', 'manager', 'attendant', 'read_only')),
+    ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
+
+ALTER TABLE admins ALTER COLUMN role SET DEFAULT 'read_only';
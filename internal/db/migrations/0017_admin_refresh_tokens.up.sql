@@ -0,0 +1,14 @@
+-- Refresh tokens de administradores. Se guarda solo el hash; cada uso lo rota por uno nuevo de la misma familia
+-- (una familia por login). Reusar un token ya rotado revoca toda la familia.
+CREATE TABLE admin_refresh_tokens (
+    id SERIAL PRIMARY KEY,
+    admin_id INT NOT NULL REFERENCES admins (id) ON DELETE CASCADE,
+    family_id VARCHAR(64) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_admin_refresh_tokens_family ON admin_refresh_tokens (family_id);
+CREATE INDEX idx_admin_refresh_tokens_admin ON admin_refresh_tokens (admin_id) WHERE revoked_at IS NULL;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_reservation_changes_refund_pending;
+UPDATE reservation_changes SET status = 'applied' WHERE status = 'refund_pending';
+ALTER TABLE reservation_changes DROP CONSTRAINT reservation_changes_status_check;
+ALTER TABLE reservation_changes ADD CONSTRAINT reservation_changes_status_check
+    CHECK (status IN ('awaiting_payment', 'applied', 'superseded', 'expired', 'rejected'));
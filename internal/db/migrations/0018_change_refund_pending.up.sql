@@ -0,0 +1,6 @@
+-- Un cambio que baja el precio queda en 'refund_pending' hasta que se emite su reembolso, para poder reintentarlo.
+ALTER TABLE reservation_changes DROP CONSTRAINT reservation_changes_status_check;
+ALTER TABLE reservation_changes ADD CONSTRAINT reservation_changes_status_check
+    CHECK (status IN ('awaiting_payment', 'applied', 'refund_pending', 'superseded', 'expired', 'rejected'));
+
+CREATE INDEX idx_reservation_changes_refund_pending ON reservation_changes (created_at) WHERE status = 'refund_pending';
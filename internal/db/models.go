@@ -2,6 +2,8 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
+	"estacionamienti/internal/money"
 	"time"
 )
 
@@ -9,6 +11,8 @@ type Admin struct {
 	ID           int       `json:"id"`
 	UserName     string    `json:"user_name"`
 	PasswordHash string    `json:"password_hash"`
+	Role         string    `json:"role"`
+	Active       bool      `json:"active"`
 	CreatedAt    time.Time `json:"created_at"`
 }
 
@@ -23,11 +27,19 @@ type ReservationTime struct {
 }
 
 type VehiclePrice struct {
-	ID                int       `json:"id"`
-	VehicleTypeID     int       `json:"vehicle_type_id"`
-	ReservationTimeID int       `json:"reservation_time_id"`
-	Price             float32   `json:"price"`
-	CreatedAt         time.Time `json:"created_at"`
+	ID                int          `json:"id"`
+	VehicleTypeID     int          `json:"vehicle_type_id"`
+	ReservationTimeID int          `json:"reservation_time_id"`
+	Price             money.Amount `json:"price"`
+	CreatedAt         time.Time    `json:"created_at"`
+}
+
+// SpacePool is a group of parking spaces shared by one or more vehicle types.
+type SpacePool struct {
+	ID           int      `json:"id"`
+	Name         string   `json:"name"`
+	Spaces       int      `json:"spaces"`
+	VehicleTypes []string `json:"vehicle_types"`
 }
 
 type VehicleSpace struct {
@@ -37,30 +49,186 @@ type VehicleSpace struct {
 }
 
 type VehicleSpaceWithPrices struct {
-	VehicleType string             `json:"vehicle_type"`
-	Spaces      int                `json:"spaces"`
-	Prices      map[string]float32 `json:"prices"`
+	VehicleType string                  `json:"vehicle_type"`
+	SpacePool   string                  `json:"space_pool"`
+	Spaces      int                     `json:"spaces"`
+	Prices      map[string]money.Amount `json:"prices"`
 }
 
 type Reservation struct {
-	ID                    int             `json:"id"`
-	Code                  string          `json:"code"`
-	UserName              string          `json:"user_name"`
-	UserEmail             string          `json:"user_email"`
-	UserPhone             sql.NullString  `json:"user_phone"`
-	VehicleTypeID         int             `json:"vehicle_type_id"`
-	VehiclePlate          sql.NullString  `json:"vehicle_plate"`
-	VehicleModel          sql.NullString  `json:"vehicle_model"`
-	PaymentMethodID       int             `json:"payment_method_id"`
-	Status                string          `json:"status"`
-	StartTime             time.Time       `json:"start_time"`
-	EndTime               time.Time       `json:"end_time"`
-	CreatedAt             time.Time       `json:"created_at"`
-	UpdatedAt             time.Time       `json:"updated_at"`
-	StripeSessionID       sql.NullString  `json:"stripe_session_id,omitempty"`
-	PaymentStatus         sql.NullString  `json:"payment_status,omitempty"`
-	Language              string          `json:"language"`
-	StripePaymentIntentID sql.NullString  `json:"stripe_payment_intent_id,omitempty"`
-	TotalPrice            sql.NullFloat64 `json:"total_price,omitempty"`
-	DepositPayment        sql.NullFloat64 `json:"deposit_payment,omitempty"`
+	ID                    int            `json:"id"`
+	Code                  string         `json:"code"`
+	UserName              string         `json:"user_name"`
+	UserEmail             string         `json:"user_email"`
+	UserPhone             sql.NullString `json:"user_phone"`
+	VehicleTypeID         int            `json:"vehicle_type_id"`
+	VehiclePlate          sql.NullString `json:"vehicle_plate"`
+	VehicleModel          sql.NullString `json:"vehicle_model"`
+	PaymentMethodID       int            `json:"payment_method_id"`
+	Status                string         `json:"status"`
+	StartTime             time.Time      `json:"start_time"`
+	EndTime               time.Time      `json:"end_time"` // zero while a walk-in is open
+	CreatedAt             time.Time      `json:"created_at"`
+	UpdatedAt             time.Time      `json:"updated_at"`
+	StripeSessionID       sql.NullString `json:"stripe_session_id,omitempty"`
+	PaymentStatus         sql.NullString `json:"payment_status,omitempty"`
+	Language              string         `json:"language"`
+	StripePaymentIntentID sql.NullString `json:"stripe_payment_intent_id,omitempty"`
+	TotalPrice            money.Amount   `json:"total_price,omitempty"`
+	DepositPayment        money.Amount   `json:"deposit_payment,omitempty"`
+	RefundedAmount        money.Amount   `json:"refunded_amount"`
+	CheckedInAt           sql.NullTime   `json:"checked_in_at,omitempty"`
+	CheckedOutAt          sql.NullTime   `json:"checked_out_at,omitempty"`
+	OverstayFee           money.Amount   `json:"overstay_fee"`
+	WalkIn                bool           `json:"walk_in"`
+	PromoCodeID           sql.NullInt64  `json:"promo_code_id,omitempty"`
+	DiscountAmount        money.Amount   `json:"discount_amount"` // already taken off TotalPrice
+}
+
+// RefundTier refunds RefundPercent of what was paid when a reservation is canceled at least MinHoursBefore hours
+// before it starts.
+type RefundTier struct {
+	ID              int `json:"id"`
+	PaymentMethodID int `json:"payment_method_id"`
+	MinHoursBefore  int `json:"min_hours_before"`
+	RefundPercent   int `json:"refund_percent"`
+}
+
+// PricingRule changes the price of the reservation hours it covers: those from StartDate to EndDate ("2006-01-02",
+// inclusive), on Weekdays (0 is Sunday) and from StartHour to EndHour, in Italian time. Empty fields cover everything
+// and a StartHour after EndHour wraps past midnight. A covered hour costs its base price times Multiplier, or
+// HourlyPrice. When rules overlap, the one with the highest Priority wins.
+type PricingRule struct {
+	ID            int           `json:"id"`
+	Name          string        `json:"name"`
+	VehicleTypeID *int          `json:"vehicle_type_id,omitempty"`
+	StartDate     string        `json:"start_date,omitempty"`
+	EndDate       string        `json:"end_date,omitempty"`
+	Weekdays      []int         `json:"weekdays,omitempty"`
+	StartHour     *int          `json:"start_hour,omitempty"`
+	EndHour       *int          `json:"end_hour,omitempty"`
+	Multiplier    *float64      `json:"multiplier,omitempty"`
+	HourlyPrice   *money.Amount `json:"hourly_price,omitempty"`
+	Priority      int           `json:"priority"`
+}
+
+// PromoCode takes PercentOff percent or AmountOff off the total price of reservations booked with it between
+// ValidFrom and ValidUntil, for VehicleTypeIDs (empty for all) and of at least MinDurationHours. MaxRedemptions and
+// MaxRedemptionsPerEmail cap its uses, nil for no limit. Redemptions and DiscountGiven sum the reservations not
+// canceled that used it and are only filled in admin listings.
+type PromoCode struct {
+	ID                     int           `json:"id"`
+	Code                   string        `json:"code"`
+	Description            string        `json:"description"`
+	PercentOff             *int          `json:"percent_off,omitempty"`
+	AmountOff              *money.Amount `json:"amount_off,omitempty"`
+	ValidFrom              *time.Time    `json:"valid_from,omitempty"`
+	ValidUntil             *time.Time    `json:"valid_until,omitempty"`
+	VehicleTypeIDs         []int         `json:"vehicle_type_ids,omitempty"`
+	MinDurationHours       int           `json:"min_duration_hours"`
+	MaxRedemptions         *int          `json:"max_redemptions,omitempty"`
+	MaxRedemptionsPerEmail *int          `json:"max_redemptions_per_email,omitempty"`
+	Active                 bool          `json:"active"`
+	Redemptions            int           `json:"redemptions"`
+	DiscountGiven          money.Amount  `json:"discount_given"`
+	CreatedAt              time.Time     `json:"created_at"`
+}
+
+// CustomerLoginCode is a sign-in sent to the email of a customer: a magic link with a random token and a 6-digit code
+// to type in. Only their SHA-256 hashes are kept. It can be used once, before ExpiresAt.
+type CustomerLoginCode struct {
+	ID        int
+	Email     string
+	CodeHash  string
+	TokenHash string
+	Attempts  int
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
+}
+
+// AdminRefreshToken is a stored refresh token of an admin session. Tokens of one login share FamilyID; each refresh
+// revokes the token used and issues the next one of the family.
+type AdminRefreshToken struct {
+	ID        int
+	AdminID   int
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+	RevokedAt sql.NullTime
+	CreatedAt time.Time
+}
+
+// Notification is an email or SMS queued for a customer. It is written together with the reservation change that
+// triggers it and delivered later by the notification worker.
+type Notification struct {
+	ID              int            `json:"id"`
+	ReservationID   int            `json:"reservation_id"`
+	ReservationCode string         `json:"reservation_code"`
+	Channel         string         `json:"channel"` // email or sms
+	Recipient       string         `json:"recipient"`
+	RecipientName   string         `json:"recipient_name,omitempty"`
+	Subject         string         `json:"subject,omitempty"`
+	Body            string         `json:"body"`
+	HTMLBody        string         `json:"-"`
+	Status          string         `json:"status"` // pending, sent or failed
+	Attempts        int            `json:"attempts"`
+	NextAttemptAt   time.Time      `json:"next_attempt_at"`
+	LastError       sql.NullString `json:"last_error"`
+	SentAt          sql.NullTime   `json:"sent_at"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+}
+
+// StripeEvent is a webhook event received from Stripe, kept so retries are processed only once and failures can be
+// replayed.
+type StripeEvent struct {
+	ID              string          `json:"id"`
+	Type            string          `json:"type"`
+	ReservationCode sql.NullString  `json:"reservation_code"`
+	Payload         json.RawMessage `json:"payload"`
+	Status          string          `json:"status"` // processing, processed, ignored or failed
+	Result          sql.NullString  `json:"result"`
+	Attempts        int             `json:"attempts"`
+	StripeCreatedAt time.Time       `json:"stripe_created_at"`
+	ReceivedAt      time.Time       `json:"received_at"`
+	ProcessedAt     sql.NullTime    `json:"processed_at"`
+}
+
+// Payment is one entry of a reservation's payments ledger: a Stripe charge or refund, money collected on site or a
+// manual adjustment. Amount is positive except for adjustments, where a negative amount is an extra charge.
+type Payment struct {
+	ID              int            `json:"id"`
+	ReservationID   int            `json:"reservation_id"`
+	ReservationCode string         `json:"reservation_code"`
+	Kind            string         `json:"kind"`
+	Amount          money.Amount   `json:"amount"`
+	Method          string         `json:"method,omitempty"`
+	ExternalID      sql.NullString `json:"external_id,omitempty"`
+	Note            string         `json:"note,omitempty"`
+	RecordedBy      string         `json:"recorded_by,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+}
+
+// ReservationChange is a new window or vehicle requested for a reservation. AmountDue is what the customer has to pay
+// online before it applies; a negative amount was refunded when it applied.
+type ReservationChange struct {
+	ID                int            `json:"id"`
+	ReservationID     int            `json:"reservation_id"`
+	ReservationCode   string         `json:"reservation_code"`
+	StartTime         time.Time      `json:"start_time"`
+	EndTime           time.Time      `json:"end_time"`
+	VehicleTypeID     int            `json:"vehicle_type_id"`
+	VehiclePlate      sql.NullString `json:"vehicle_plate"`
+	VehicleModel      sql.NullString `json:"vehicle_model"`
+	OldTotalPrice     money.Amount   `json:"old_total_price"`
+	NewTotalPrice     money.Amount   `json:"new_total_price"`
+	NewDepositPayment money.Amount   `json:"new_deposit_payment"`
+	NewDiscount       money.Amount   `json:"new_discount_amount"`
+	AmountDue         money.Amount   `json:"amount_due"`
+	Status            string         `json:"status"`
+	StripeSessionID   sql.NullString `json:"stripe_session_id,omitempty"`
+	RequestedBy       string         `json:"requested_by,omitempty"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
 }
@@ -0,0 +1,39 @@
+package entities
+
+import "time"
+
+// AdminUser is an admin account as owners see it, without its password.
+type AdminUser struct {
+	ID        int       `json:"id"`
+	User      string    `json:"user"`
+	Role      string    `json:"role"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AdminUserRequest creates an admin account.
+type AdminUserRequest struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// AdminUserUpdate changes the role of an admin account or disables it. Fields left out are kept.
+type AdminUserUpdate struct {
+	Role   *string `json:"role,omitempty"`
+	Active *bool   `json:"active,omitempty"`
+}
+
+// AdminSession is what admins get when they log in or refresh: a short-lived access Token for the Authorization
+// header, and the RefreshToken that gets the next one. Each refresh token works once.
+type AdminSession struct {
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// AdminRefreshRequest carries the refresh token of an admin session, to refresh it or log it out.
+type AdminRefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
@@ -0,0 +1,23 @@
+package entities
+
+import "time"
+
+// CustomerLoginRequest asks for a magic link and a login code to be emailed to a customer.
+type CustomerLoginRequest struct {
+	Email    string `json:"email"`
+	Language string `json:"language,omitempty"`
+}
+
+// CustomerVerifyRequest signs a customer in with the token of the magic link, or with their email and the code.
+type CustomerVerifyRequest struct {
+	Token string `json:"token,omitempty"`
+	Email string `json:"email,omitempty"`
+	Code  string `json:"code,omitempty"`
+}
+
+// CustomerSession is the bearer token that gives access to the reservations of Email until ExpiresAt.
+type CustomerSession struct {
+	Token     string    `json:"token"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,40 @@
+package entities
+
+import (
+	"estacionamienti/internal/money"
+	"time"
+)
+
+// CheckInRequest lets a car in, found by its reservation code or its plate. CheckedInAt defaults to now.
+type CheckInRequest struct {
+	Code        string     `json:"code"`
+	Plate       string     `json:"plate"`
+	CheckedInAt *time.Time `json:"checked_in_at"`
+}
+
+// CheckOutRequest lets a car out, found by its reservation code or, once checked in, its plate. CheckedOutAt
+// defaults to now; PaymentMethod is how the balance is collected at the gate, cash (default) or card.
+type CheckOutRequest struct {
+	Code          string     `json:"code"`
+	Plate         string     `json:"plate"`
+	CheckedOutAt  *time.Time `json:"checked_out_at"`
+	PaymentMethod string     `json:"payment_method"`
+}
+
+// CheckOutResponse is the finished reservation with what was collected at the gate.
+type CheckOutResponse struct {
+	*ReservationResponse
+	AmountCollected money.Amount `json:"amount_collected"`
+	PaymentMethod   string       `json:"payment_method,omitempty"`
+}
+
+// WalkInRequest opens a session for a car arriving without a reservation. Only the vehicle is required.
+type WalkInRequest struct {
+	VehicleTypeID int    `json:"vehicle_type_id"`
+	VehiclePlate  string `json:"vehicle_plate"`
+	VehicleModel  string `json:"vehicle_model"`
+	UserName      string `json:"user_name"`
+	UserEmail     string `json:"user_email"`
+	UserPhone     string `json:"user_phone"`
+	Language      string `json:"language"`
+}
@@ -0,0 +1,11 @@
+package entities
+
+import "estacionamienti/internal/money"
+
+// PaymentRequest is an admin entry for the payments ledger: money collected on site or a manual adjustment.
+type PaymentRequest struct {
+	Kind   string       `json:"kind"` // onsite (default) or adjustment
+	Amount money.Amount `json:"amount"`
+	Method string       `json:"method"` // cash or card, for onsite payments
+	Note   string       `json:"note"`
+}
@@ -1,7 +1,33 @@
 package entities
 
+import "estacionamienti/internal/money"
+
 type PriceResponse struct {
-	VehicleType     string  `json:"vehicle_type"`
-	ReservationTime string  `json:"reservation_time"`
-	Price           float32 `json:"price"`
+	VehicleType     string       `json:"vehicle_type"`
+	ReservationTime string       `json:"reservation_time"`
+	Price           money.Amount `json:"price"`
+}
+
+// PriceBreakdown itemizes the price of a reservation: its base price by unit and what pricing rules add or take off.
+type PriceBreakdown struct {
+	Units       []PriceUnitLine       `json:"units"`
+	BasePrice   money.Amount          `json:"base_price"`
+	Adjustments []PriceAdjustmentLine `json:"adjustments"`
+	TotalPrice  money.Amount          `json:"total_price"`
+}
+
+// PriceUnitLine is Quantity months, weeks, days or hours at UnitPrice.
+type PriceUnitLine struct {
+	Unit      string       `json:"unit"`
+	Quantity  int          `json:"quantity"`
+	UnitPrice money.Amount `json:"unit_price"`
+	Amount    money.Amount `json:"amount"`
+}
+
+// PriceAdjustmentLine is what a pricing rule changed in the Hours of the reservation it covers.
+type PriceAdjustmentLine struct {
+	RuleID int          `json:"rule_id"`
+	Rule   string       `json:"rule"`
+	Hours  int          `json:"hours"`
+	Amount money.Amount `json:"amount"`
 }
@@ -0,0 +1,51 @@
+package entities
+
+import (
+	"estacionamienti/internal/money"
+	"time"
+)
+
+// QuoteRequest is the body of a price quote. UserEmail is optional and only used to check the per-email limit of
+// PromoCode.
+type QuoteRequest struct {
+	VehicleTypeID   int       `json:"vehicle_type_id"`
+	PaymentMethodID int       `json:"payment_method_id"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+	PromoCode       string    `json:"promo_code,omitempty"`
+	UserEmail       string    `json:"user_email,omitempty"`
+}
+
+// QuoteLine is one item of a quote. Units are months, weeks, days or hours at UnitAmount; surcharges and discounts
+// come from pricing rules over Quantity hours, discounts with a negative Amount. A promo line is the negative discount
+// of the promo code.
+type QuoteLine struct {
+	Kind        string       `json:"kind"`
+	Description string       `json:"description"`
+	Quantity    int          `json:"quantity"`
+	UnitAmount  money.Amount `json:"unit_amount,omitempty"`
+	Amount      money.Amount `json:"amount"`
+}
+
+// Quote is the itemized price of a reservation in Currency. Prices include VAT, TaxAmount is the VAT share of the
+// total. DepositAmount is what is paid online when booking and DueOnSiteAmount the rest. Token lets the reservation be
+// booked at this price until ExpiresAt.
+type Quote struct {
+	VehicleTypeID   int          `json:"vehicle_type_id"`
+	PaymentMethodID int          `json:"payment_method_id"`
+	StartTime       time.Time    `json:"start_time"`
+	EndTime         time.Time    `json:"end_time"`
+	Currency        string       `json:"currency"`
+	PromoCode       string       `json:"promo_code,omitempty"`
+	Lines           []QuoteLine  `json:"lines"`
+	SubtotalAmount  money.Amount `json:"subtotal_amount"`
+	SurchargeAmount money.Amount `json:"surcharge_amount"`
+	DiscountAmount  money.Amount `json:"discount_amount"`
+	TaxRate         float64      `json:"tax_rate"`
+	TaxAmount       money.Amount `json:"tax_amount"`
+	TotalAmount     money.Amount `json:"total_amount"`
+	DepositAmount   money.Amount `json:"deposit_amount"`
+	DueOnSiteAmount money.Amount `json:"due_on_site_amount"`
+	Token           string       `json:"quote_token"`
+	ExpiresAt       time.Time    `json:"expires_at"`
+}
@@ -0,0 +1,15 @@
+package entities
+
+import "estacionamienti/internal/money"
+
+// RefundQuote is what canceling a reservation refunds under the refund policy of its payment method.
+type RefundQuote struct {
+	Code             string       `json:"code"`
+	PaymentMethodID  int          `json:"payment_method_id"`
+	HoursBeforeStart float64      `json:"hours_before_start"`
+	AmountPaid       money.Amount `json:"amount_paid"`
+	AlreadyRefunded  money.Amount `json:"already_refunded"`
+	RefundPercent    int          `json:"refund_percent"`
+	RefundAmount     money.Amount `json:"refund_amount"`
+	Canceled         bool         `json:"canceled"`
+}
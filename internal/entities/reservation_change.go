@@ -0,0 +1,36 @@
+package entities
+
+import (
+	"estacionamienti/internal/money"
+	"time"
+)
+
+// ReservationChangeRequest is the body of a reservation modification. Omitted fields keep their current value.
+type ReservationChangeRequest struct {
+	StartTime     *time.Time `json:"start_time"`
+	EndTime       *time.Time `json:"end_time"`
+	VehicleTypeID *int       `json:"vehicle_type_id"`
+	VehiclePlate  *string    `json:"vehicle_plate"`
+	VehicleModel  *string    `json:"vehicle_model"`
+}
+
+// ReservationChangeResponse is the outcome of a modification. An "applied" change is already in the reservation; one
+// "awaiting_payment" applies once AmountDue is paid at URL, and one "refund_pending" is applied but its refund failed
+// and is retried. RefundAmount is what was refunded because it costs less. BalanceDue is what is left to pay on site
+// once the change is settled.
+type ReservationChangeResponse struct {
+	Code          string       `json:"code"`
+	Status        string       `json:"status"`
+	StartTime     time.Time    `json:"start_time"`
+	EndTime       time.Time    `json:"end_time"`
+	VehicleTypeID int          `json:"vehicle_type_id"`
+	VehiclePlate  string       `json:"vehicle_plate"`
+	VehicleModel  string       `json:"vehicle_model"`
+	OldTotalPrice money.Amount `json:"old_total_price"`
+	NewTotalPrice money.Amount `json:"new_total_price"`
+	AmountDue     money.Amount `json:"amount_due"`
+	RefundAmount  money.Amount `json:"refund_amount"`
+	BalanceDue    money.Amount `json:"balance_due"`
+	URL           string       `json:"url,omitempty"`
+	SessionID     string       `json:"session_id,omitempty"`
+}
@@ -1,44 +1,69 @@
 package entities
 
 import (
+	"estacionamienti/internal/money"
 	"time"
 )
 
+// ReservationRequest is the body of a reservation creation. With a QuoteToken the reservation is booked at the quoted
+// price; otherwise TotalPrice is only checked against the price computed by the server, after the PromoCode discount.
+// DepositPayment is ignored and always computed server-side.
 type ReservationRequest struct {
-	VehicleTypeID   int       `json:"vehicle_type_id"`
-	UserName        string    `json:"user_name"`
-	UserEmail       string    `json:"user_email"`
-	UserPhone       string    `json:"user_phone"`
-	VehiclePlate    string    `json:"vehicle_plate"`
-	VehicleModel    string    `json:"vehicle_model"`
-	PaymentMethodID int       `json:"payment_method_id"`
-	Status          string    `json:"status"`
-	StartTime       time.Time `json:"start_time"`
-	EndTime         time.Time `json:"end_time"`
-	TotalPrice      float32   `json:"total_price"`
-	DepositPayment  float32   `json:"deposit_payment"`
-	Language        string    `json:"language"`
+	VehicleTypeID   int          `json:"vehicle_type_id"`
+	UserName        string       `json:"user_name"`
+	UserEmail       string       `json:"user_email"`
+	UserPhone       string       `json:"user_phone"`
+	VehiclePlate    string       `json:"vehicle_plate"`
+	VehicleModel    string       `json:"vehicle_model"`
+	PaymentMethodID int          `json:"payment_method_id"`
+	Status          string       `json:"status"`
+	StartTime       time.Time    `json:"start_time"`
+	EndTime         time.Time    `json:"end_time"`
+	TotalPrice      money.Amount `json:"total_price"`
+	DepositPayment  money.Amount `json:"deposit_payment"`
+	Language        string       `json:"language"`
+	QuoteToken      string       `json:"quote_token,omitempty"`
+	PromoCode       string       `json:"promo_code,omitempty"`
 }
 
 type ReservationResponse struct {
-	Code              string    `json:"code"`
-	UserName          string    `json:"user_name"`
-	UserEmail         string    `json:"user_email"`
-	UserPhone         string    `json:"user_phone"`
-	VehicleTypeID     int       `json:"vehicle_type_id"`
-	VehicleTypeName   string    `json:"vehicle_type_name"`
-	VehiclePlate      string    `json:"vehicle_plate"`
-	VehicleModel      string    `json:"vehicle_model"`
-	PaymentMethodID   int       `json:"payment_method_id"`
-	PaymentMethodName string    `json:"payment_method_name"`
-	StripeSessionID   string    `json:"stripe_session_id,omitempty"`
-	PaymentStatus     string    `json:"payment_status,omitempty"`
-	Status            string    `json:"status"`
-	Language          string    `json:"language,omitempty"`
-	StartTime         time.Time `json:"start_time"`
-	EndTime           time.Time `json:"end_time"`
-	CreatedAt         time.Time `json:"created_at"`
-	UpdatedAt         time.Time `json:"updated_at"`
-	TotalPrice        float32   `json:"total_price,omitempty"`
-	DepositPayment    float32   `json:"deposit_payment,omitempty"`
+	Code              string       `json:"code"`
+	UserName          string       `json:"user_name"`
+	UserEmail         string       `json:"user_email"`
+	UserPhone         string       `json:"user_phone"`
+	VehicleTypeID     int          `json:"vehicle_type_id"`
+	VehicleTypeName   string       `json:"vehicle_type_name"`
+	VehiclePlate      string       `json:"vehicle_plate"`
+	VehicleModel      string       `json:"vehicle_model"`
+	PaymentMethodID   int          `json:"payment_method_id"`
+	PaymentMethodName string       `json:"payment_method_name"`
+	StripeSessionID   string       `json:"stripe_session_id,omitempty"`
+	PaymentStatus     string       `json:"payment_status,omitempty"`
+	Status            string       `json:"status"`
+	Language          string       `json:"language,omitempty"`
+	StartTime         time.Time    `json:"start_time"`
+	EndTime           *time.Time   `json:"end_time"` // null while a walk-in is open
+	CreatedAt         time.Time    `json:"created_at"`
+	UpdatedAt         time.Time    `json:"updated_at"`
+	TotalPrice        money.Amount `json:"total_price,omitempty"`
+	DepositPayment    money.Amount `json:"deposit_payment,omitempty"`
+	RefundedAmount    money.Amount `json:"refunded_amount,omitempty"`
+	CheckedInAt       *time.Time   `json:"checked_in_at,omitempty"`
+	CheckedOutAt      *time.Time   `json:"checked_out_at,omitempty"`
+	OverstayFee       money.Amount `json:"overstay_fee,omitempty"`
+	WalkIn            bool         `json:"walk_in,omitempty"`
+	PromoCode         string       `json:"promo_code,omitempty"`
+	DiscountAmount    money.Amount `json:"discount_amount,omitempty"`
+	AmountPaid        money.Amount `json:"amount_paid"`
+	BalanceDue        money.Amount `json:"balance_due"`
+}
+
+// SetAmountPaid stores what the payments ledger says was paid and derives the balance still due. Canceled
+// reservations and no-shows owe nothing.
+func (r *ReservationResponse) SetAmountPaid(paid money.Amount) {
+	r.AmountPaid = paid
+	r.BalanceDue = 0
+	if r.Status != "canceled" && r.Status != "no_show" && r.TotalPrice > r.AmountPaid {
+		r.BalanceDue = r.TotalPrice - r.AmountPaid
+	}
 }
@@ -5,3 +5,11 @@ type StripeSessionResponse struct {
 	URL       string `json:"url"`
 	SessionID string `json:"session_id"`
 }
+
+// ReservationSessionStatus is what the public checkout return page can see of a reservation from its Stripe session:
+// whether it was paid, but none of the customer's details, which need a customer token.
+type ReservationSessionStatus struct {
+	Code          string `json:"code"`
+	Status        string `json:"status"`
+	PaymentStatus string `json:"payment_status"`
+}
@@ -3,9 +3,11 @@ package errors
 import "net/http"
 
 // HTTPError represents an error with an associated HTTP status code.
+// Details is optional structured data returned to the client alongside the message.
 type HTTPError struct {
 	Code    int
 	Message string
+	Details interface{}
 }
 
 func (e *HTTPError) Error() string {
@@ -23,4 +25,7 @@ func NewHTTPError(code int, message string) *HTTPError {
 // Helper for common errors
 var (
 	ErrUnauthorized = func(msg string) *HTTPError { return NewHTTPError(http.StatusUnauthorized, msg) }
+	ErrConflict     = func(msg string, details interface{}) *HTTPError {
+		return &HTTPError{Code: http.StatusConflict, Message: msg, Details: details}
+	}
 )
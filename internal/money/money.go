@@ -0,0 +1,128 @@
+// Package money handles amounts of money as integer cents, so prices, payments and refunds add up to the cent.
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Amount is an amount of money in cents. It is stored as NUMERIC(12,2) and written in JSON as a decimal number of
+// whole units, so 1250 is 12.5.
+type Amount int64
+
+// Money is an amount in an ISO 4217 currency.
+type Money struct {
+	Amount   Amount `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// New returns the amount in the given currency.
+func New(amount Amount, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToLower(currency)}
+}
+
+// Of returns the amount in the currency of the parking.
+func Of(amount Amount) Money {
+	return New(amount, DefaultCurrency())
+}
+
+// DefaultCurrency is the currency prices are set and charged in: CURRENCY, or eur when it is not set.
+func DefaultCurrency() string {
+	if currency := os.Getenv("CURRENCY"); currency != "" {
+		return strings.ToLower(currency)
+	}
+	return "eur"
+}
+
+// FromFloat rounds a decimal number of whole units to the cent.
+func FromFloat(units float64) Amount {
+	return Amount(math.Round(units * 100))
+}
+
+// Cents returns the amount in cents, as payment providers take it.
+func (a Amount) Cents() int64 {
+	return int64(a)
+}
+
+// Float64 returns the amount in whole units.
+func (a Amount) Float64() float64 {
+	return float64(a) / 100
+}
+
+// Mul multiplies the amount, rounding to the cent.
+func (a Amount) Mul(factor float64) Amount {
+	return Amount(math.Round(float64(a) * factor))
+}
+
+// Percent returns percent % of the amount, rounded to the cent.
+func (a Amount) Percent(percent int) Amount {
+	return Amount(math.Round(float64(a) * float64(percent) / 100))
+}
+
+// String formats the amount with two decimals, as 12.50.
+func (a Amount) String() string {
+	sign := ""
+	cents := int64(a)
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatFloat(a.Float64(), 'f', -1, 64)), nil
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	units, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return fmt.Errorf("invalid amount %s: %w", data, err)
+	}
+	*a = FromFloat(units)
+	return nil
+}
+
+// Scan reads a NUMERIC or FLOAT column. NULL reads as zero.
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+	case int64:
+		*a = Amount(v * 100)
+	case float64:
+		*a = FromFloat(v)
+	case []byte:
+		return a.parse(string(v))
+	case string:
+		return a.parse(v)
+	default:
+		return fmt.Errorf("cannot scan %T into money.Amount", src)
+	}
+	return nil
+}
+
+func (a *Amount) parse(s string) error {
+	units, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("invalid amount %q: %w", s, err)
+	}
+	*a = FromFloat(units)
+	return nil
+}
+
+// Value writes the amount as a decimal string, which Postgres takes as NUMERIC without going through a float.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// String formats the money as 12.50 EUR.
+func (m Money) String() string {
+	return m.Amount.String() + " " + strings.ToUpper(m.Currency)
+}
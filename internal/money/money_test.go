@@ -0,0 +1,46 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAmountJSONRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		amount Amount
+		json   string
+	}{{1250, "12.5"}, {1999, "19.99"}, {-430, "-4.3"}, {0, "0"}, {7, "0.07"}} {
+		data, err := json.Marshal(tt.amount)
+		if err != nil || string(data) != tt.json {
+			t.Fatalf("Marshal(%d) = %s, %v; want %s", tt.amount, data, err, tt.json)
+		}
+		var back Amount
+		if err := json.Unmarshal(data, &back); err != nil || back != tt.amount {
+			t.Fatalf("Unmarshal(%s) = %d, %v; want %d", data, back, err, tt.amount)
+		}
+	}
+}
+
+func TestAmountScan(t *testing.T) {
+	for _, tt := range []struct {
+		src  interface{}
+		want Amount
+	}{{[]byte("12.34"), 1234}, {"0.10", 10}, {float64(19.99), 1999}, {int64(3), 300}, {nil, 0}} {
+		var got Amount = 99
+		if err := got.Scan(tt.src); err != nil || got != tt.want {
+			t.Fatalf("Scan(%v) = %d, %v; want %d", tt.src, got, err, tt.want)
+		}
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	if got := Amount(1850).Mul(0.3); got != 555 {
+		t.Fatalf("Mul = %d, want 555", got)
+	}
+	if got := Amount(1999).Percent(70); got != 1399 {
+		t.Fatalf("Percent = %d, want 1399", got)
+	}
+	if got := Of(-5).String(); got != "-0.05 EUR" {
+		t.Fatalf("String = %s", got)
+	}
+}
@@ -3,18 +3,50 @@ package repository
 import (
 	"database/sql"
 	"errors"
+	"estacionamienti/internal/db"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	// ErrLastOwner is returned when a change would leave no active owner.
+	ErrLastOwner = errors.New("at least one active owner is required")
+	// ErrAdminExists is returned when the user name is taken.
+	ErrAdminExists = errors.New("admin user name already exists")
+	// ErrAdminsExist is returned by CreateFirstOwner once there are admins.
+	ErrAdminsExist = errors.New("admins already exist")
+)
+
 type Admin struct {
 	ID           int
 	User         string
 	PasswordHash string
+	Role         string
+	Active       bool
+	CreatedAt    time.Time
 }
 
 type AdminAuthRepository interface {
 	GetByEmail(user string) (*Admin, error)
-	CreateNewUser(user, password string) error
+	GetAdminByID(id int) (*Admin, error)
+	ListAdmins() ([]Admin, error)
+	// CreateNewUser returns ErrAdminExists when the user name is taken.
+	CreateNewUser(user, password, role string) (*Admin, error)
+	// CreateFirstOwner creates an owner only while there are no admins at all, and returns ErrAdminsExist otherwise.
+	CreateFirstOwner(user, password string) (*Admin, error)
+	// UpdateAdmin sets the role and active flag of an admin, unless that leaves no active owner (ErrLastOwner).
+	UpdateAdmin(id int, role string, active bool) error
+
+	CreateRefreshToken(token *db.AdminRefreshToken) error
+	GetRefreshTokenByHash(tokenHash string) (*db.AdminRefreshToken, error)
+	// RotateRefreshToken revokes the token used and stores the next one, and reports false without storing it when the
+	// token used was already revoked.
+	RotateRefreshToken(usedID int, next *db.AdminRefreshToken, at time.Time) (bool, error)
+	RevokeRefreshTokenFamily(familyID string, at time.Time) error
+	RevokeAdminRefreshTokens(adminID int, at time.Time) error
 }
 
 type adminAuthRepository struct {
@@ -25,31 +57,144 @@ func NewAdminAuthRepository(db *sql.DB) AdminAuthRepository {
 	return &adminAuthRepository{db: db}
 }
 
-func (r *adminAuthRepository) GetByEmail(email string) (*Admin, error) {
+const adminSelectSQL = "SELECT id, user_name, password_hash, role, active, created_at FROM admins"
+
+func scanAdmin(row interface{ Scan(...interface{}) error }) (*Admin, error) {
 	var admin Admin
-	err := r.db.QueryRow("SELECT user_name, password_hash FROM admins WHERE user_name = $1", email).
-		Scan(&admin.User, &admin.PasswordHash)
+	var createdAt sql.NullTime
+	if err := row.Scan(&admin.ID, &admin.User, &admin.PasswordHash, &admin.Role, &admin.Active, &createdAt); err != nil {
+		return nil, err
+	}
+	admin.CreatedAt = createdAt.Time
+	return &admin, nil
+}
+
+func (r *adminAuthRepository) GetByEmail(email string) (*Admin, error) {
+	admin, err := scanAdmin(r.db.QueryRow(adminSelectSQL+" WHERE user_name = $1", email))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	return &admin, nil
+	return admin, nil
 }
 
-func (r *adminAuthRepository) CreateNewUser(user, password string) error {
+func (r *adminAuthRepository) GetAdminByID(id int) (*Admin, error) {
+	admin, err := scanAdmin(r.db.QueryRow(adminSelectSQL+" WHERE id = $1", id))
+	if err != nil {
+		return nil, fmt.Errorf("admin %d: %w", id, err)
+	}
+	return admin, nil
+}
+
+func (r *adminAuthRepository) ListAdmins() ([]Admin, error) {
+	rows, err := r.db.Query(adminSelectSQL + " ORDER BY user_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var admins []Admin
+	for rows.Next() {
+		admin, err := scanAdmin(rows)
+		if err != nil {
+			return nil, err
+		}
+		admins = append(admins, *admin)
+	}
+	return admins, rows.Err()
+}
+
+func (r *adminAuthRepository) CreateNewUser(user, password, role string) (*Admin, error) {
 	// Hashear la contraseña usando bcrypt
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "INSERT INTO admins (user_name, password_hash, role) VALUES ($1, $2, $3) " +
+		"RETURNING id, user_name, password_hash, role, active, created_at"
+	admin, err := scanAdmin(r.db.QueryRow(query, user, hashedPassword, role))
+	if isUniqueViolation(err) {
+		return nil, ErrAdminExists
+	}
+	return admin, err
+}
+
+func (r *adminAuthRepository) CreateFirstOwner(user, password string) (*Admin, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// El bloqueo evita que dos arranques simultáneos creen cada uno su owner.
+	if _, err := tx.Exec("LOCK TABLE admins IN EXCLUSIVE MODE"); err != nil {
+		return nil, err
+	}
+	query := "INSERT INTO admins (user_name, password_hash, role) SELECT $1, $2, 'owner' " +
+		"WHERE NOT EXISTS (SELECT 1 FROM admins) RETURNING id, user_name, password_hash, role, active, created_at"
+	admin, err := scanAdmin(tx.QueryRow(query, user, hashedPassword))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAdminsExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return admin, tx.Commit()
+}
+
+// isUniqueViolation reports whether err is Postgres rejecting a duplicate on a unique constraint.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func (r *adminAuthRepository) UpdateAdmin(id int, role string, active bool) error {
+	tx, err := r.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	query := "INSERT INTO admins (user_name, password_hash) VALUES ($1, $2)"
-	_, err = r.db.Exec(query, user, hashedPassword)
+	// Bloqueamos los owners activos para que dos cambios simultáneos no dejen la cuenta sin ninguno.
+	rows, err := tx.Query("SELECT id FROM admins WHERE role = 'owner' AND active FOR UPDATE")
 	if err != nil {
 		return err
 	}
+	var otherOwners int
+	for rows.Next() {
+		var ownerID int
+		if err := rows.Scan(&ownerID); err != nil {
+			rows.Close()
+			return err
+		}
+		if ownerID != id {
+			otherOwners++
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if otherOwners == 0 && (role != "owner" || !active) {
+		return ErrLastOwner
+	}
 
-	return nil
+	result, err := tx.Exec("UPDATE admins SET role = $2, active = $3 WHERE id = $1", id, role, active)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("admin %d: %w", id, sql.ErrNoRows)
+	}
+	return tx.Commit()
 }
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"estacionamienti/internal/db"
+	"fmt"
+	"time"
+)
+
+const adminRefreshTokenColumns = `id, admin_id, family_id, token_hash, expires_at, revoked_at, created_at`
+
+func insertRefreshToken(q queryer, token *db.AdminRefreshToken) error {
+	query := `
+		INSERT INTO admin_refresh_tokens (admin_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+	if err := q.QueryRow(query, token.AdminID, token.FamilyID, token.TokenHash, token.ExpiresAt).Scan(&token.ID, &token.CreatedAt); err != nil {
+		return fmt.Errorf("error inserting refresh token: %w", err)
+	}
+	return nil
+}
+
+func (r *adminAuthRepository) CreateRefreshToken(token *db.AdminRefreshToken) error {
+	return insertRefreshToken(r.db, token)
+}
+
+// GetRefreshTokenByHash returns the refresh token with the hash, revoked or expired too.
+func (r *adminAuthRepository) GetRefreshTokenByHash(tokenHash string) (*db.AdminRefreshToken, error) {
+	var token db.AdminRefreshToken
+	err := r.db.QueryRow(`SELECT `+adminRefreshTokenColumns+` FROM admin_refresh_tokens WHERE token_hash = $1`, tokenHash).
+		Scan(&token.ID, &token.AdminID, &token.FamilyID, &token.TokenHash, &token.ExpiresAt, &token.RevokedAt, &token.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("refresh token: %w", err)
+	}
+	return &token, nil
+}
+
+func (r *adminAuthRepository) RotateRefreshToken(usedID int, next *db.AdminRefreshToken, at time.Time) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Solo una de dos peticiones simultáneas con el mismo token consigue revocarlo.
+	result, err := tx.Exec(`UPDATE admin_refresh_tokens SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL`, usedID, at)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return false, err
+	} else if n == 0 {
+		return false, nil
+	}
+	if err := insertRefreshToken(tx, next); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (r *adminAuthRepository) RevokeRefreshTokenFamily(familyID string, at time.Time) error {
+	_, err := r.db.Exec(`UPDATE admin_refresh_tokens SET revoked_at = $2 WHERE family_id = $1 AND revoked_at IS NULL`, familyID, at)
+	return err
+}
+
+func (r *adminAuthRepository) RevokeAdminRefreshTokens(adminID int, at time.Time) error {
+	_, err := r.db.Exec(`UPDATE admin_refresh_tokens SET revoked_at = $2 WHERE admin_id = $1 AND revoked_at IS NULL`, adminID, at)
+	return err
+}
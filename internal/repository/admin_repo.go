@@ -5,20 +5,40 @@ import (
 	"errors"
 	"estacionamienti/internal/db"
 	"estacionamienti/internal/entities"
+	"estacionamienti/internal/money"
 	"fmt"
+	"github.com/lib/pq"
 	"strconv"
 	"time"
 )
 
-type AdminRepository struct {
+type AdminRepository interface {
+	ListReservationsWithFilters(startTime, endTime, code, vehicleType, status, limit, offset string) (entities.ReservationsList, error)
+	FindReservationByCode(code string) (*entities.ReservationResponse, error)
+	ListVehicleSpaces() ([]db.VehicleSpaceWithPrices, error)
+	UpdateVehicleSpaces(vehicleType string, spaces int) error
+	UpdateVehiclePrice(vehicleType string, timeName string, price money.Amount) error
+	ListSpacePools() ([]db.SpacePool, error)
+	CreateSpacePool(name string, spaces int) (*db.SpacePool, error)
+	AssignVehicleTypeToPool(vehicleType, poolName string) error
+	ListPricingRules() ([]db.PricingRule, error)
+	CreatePricingRule(rule *db.PricingRule) error
+	DeletePricingRule(id int) error
+	ListPromoCodes() ([]db.PromoCode, error)
+	CreatePromoCode(promo *db.PromoCode) error
+	UpdatePromoCode(promo *db.PromoCode) error
+	DeletePromoCode(id int) error
+}
+
+type adminRepository struct {
 	DB *sql.DB
 }
 
-func NewAdminRepository(db *sql.DB) *AdminRepository {
-	return &AdminRepository{DB: db}
+func NewAdminRepository(db *sql.DB) AdminRepository {
+	return &adminRepository{DB: db}
 }
 
-func (r *AdminRepository) ListReservationsWithFilters(startTime, endTime, code, vehicleType, status, limit, offset string) (reservationsList entities.ReservationsList, err error) {
+func (r *adminRepository) ListReservationsWithFilters(startTime, endTime, code, vehicleType, status, limit, offset string) (reservationsList entities.ReservationsList, err error) {
 	loc, _ := time.LoadLocation("Europe/Rome") // Horario de Italia
 
 	// Build WHERE clause
@@ -90,12 +110,15 @@ func (r *AdminRepository) ListReservationsWithFilters(startTime, endTime, code,
 	// Main query
 	query := `
 	SELECT
-		r.code, r.user_name, r.user_email, r.user_phone, r.vehicle_type_id, vt.name AS vehicle_type_name,
-		r.vehicle_plate, r.vehicle_model, r.payment_method_id, pm.name AS payment_method_name, COALESCE(r.payment_status, '') AS payment_status,
-		r.status, r.start_time, r.end_time, r.created_at, r.updated_at, COALESCE(r.total_price, 0) AS total_price, COALESCE(r.deposit_payment, 0) AS deposit_payment
+		r.code, r.user_name, r.user_email, COALESCE(r.user_phone, '') AS user_phone, r.vehicle_type_id, vt.name AS vehicle_type_name,
+		COALESCE(r.vehicle_plate, '') AS vehicle_plate, COALESCE(r.vehicle_model, '') AS vehicle_model, r.payment_method_id, pm.name AS payment_method_name, COALESCE(r.payment_status, '') AS payment_status,
+		r.status, r.start_time, r.end_time, r.created_at, r.updated_at, COALESCE(r.total_price, 0) AS total_price, COALESCE(r.deposit_payment, 0) AS deposit_payment,
+		r.refunded_amount, r.checked_in_at, r.checked_out_at, r.overstay_fee, r.walk_in, COALESCE(pc.code, '') AS promo_code,
+		r.discount_amount, ` + paymentsNetPaidSQL + `
 	FROM reservations r
 	JOIN vehicle_types vt ON vt.id = r.vehicle_type_id
 	JOIN payment_method pm ON pm.id = r.payment_method_id
+	LEFT JOIN promo_codes pc ON pc.id = r.promo_code_id
 	` + whereClause
 
 	// Ordenamiento dinámico
@@ -122,12 +145,23 @@ func (r *AdminRepository) ListReservationsWithFilters(startTime, endTime, code,
 
 	for rows.Next() {
 		var res entities.ReservationResponse
+		var amountPaid money.Amount
+		var checkedInAt, checkedOutAt sql.NullTime
 		err := rows.Scan(
 			&res.Code, &res.UserName, &res.UserEmail, &res.UserPhone, &res.VehicleTypeID, &res.VehicleTypeName,
 			&res.VehiclePlate, &res.VehicleModel, &res.PaymentMethodID, &res.PaymentMethodName, &res.PaymentStatus,
 			&res.Status, &res.StartTime, &res.EndTime, &res.CreatedAt, &res.UpdatedAt, &res.TotalPrice, &res.DepositPayment,
+			&res.RefundedAmount, &checkedInAt, &checkedOutAt, &res.OverstayFee, &res.WalkIn, &res.PromoCode, &res.DiscountAmount,
+			&amountPaid,
 		)
 		if err == nil {
+			if checkedInAt.Valid {
+				res.CheckedInAt = &checkedInAt.Time
+			}
+			if checkedOutAt.Valid {
+				res.CheckedOutAt = &checkedOutAt.Time
+			}
+			res.SetAmountPaid(amountPaid)
 			reservationsList.Reservations = append(reservationsList.Reservations, res)
 		}
 	}
@@ -155,19 +189,24 @@ func (r *AdminRepository) ListReservationsWithFilters(startTime, endTime, code,
 }
 
 // FindReservationByCode returns a reservation by code and maps it to entities.ReservationResponse
-func (r *AdminRepository) FindReservationByCode(code string) (*entities.ReservationResponse, error) {
+func (r *adminRepository) FindReservationByCode(code string) (*entities.ReservationResponse, error) {
 	var res entities.ReservationResponse
+	var amountPaid money.Amount
+	var checkedInAt, checkedOutAt sql.NullTime
 
 	query := `
         SELECT
-            r.code, r.user_name, r.user_email, r.user_phone,
+            r.code, r.user_name, r.user_email, COALESCE(r.user_phone, ''),
             r.vehicle_type_id, vt.name AS vehicle_type_name,
-            r.vehicle_plate, r.vehicle_model,
+            COALESCE(r.vehicle_plate, ''), COALESCE(r.vehicle_model, ''),
             r.payment_method_id, pm.name AS payment_method_name,
-            r.status, r.start_time, r.end_time, r.created_at, r.updated_at, r.language, r.total_price
+            r.status, r.start_time, r.end_time, r.created_at, r.updated_at, r.language, r.total_price, r.refunded_amount,
+            r.checked_in_at, r.checked_out_at, r.overstay_fee, r.walk_in, COALESCE(pc.code, ''), r.discount_amount,
+            ` + paymentsNetPaidSQL + `
         FROM reservations r
         JOIN vehicle_types vt ON vt.id = r.vehicle_type_id
         JOIN payment_method pm ON pm.id = r.payment_method_id
+        LEFT JOIN promo_codes pc ON pc.id = r.promo_code_id
         WHERE r.code = $1`
 
 	err := r.DB.QueryRow(query, code).Scan(
@@ -175,7 +214,8 @@ func (r *AdminRepository) FindReservationByCode(code string) (*entities.Reservat
 		&res.VehicleTypeID, &res.VehicleTypeName,
 		&res.VehiclePlate, &res.VehicleModel,
 		&res.PaymentMethodID, &res.PaymentMethodName,
-		&res.Status, &res.StartTime, &res.EndTime, &res.CreatedAt, &res.UpdatedAt, &res.Language, &res.TotalPrice,
+		&res.Status, &res.StartTime, &res.EndTime, &res.CreatedAt, &res.UpdatedAt, &res.Language, &res.TotalPrice, &res.RefundedAmount,
+		&checkedInAt, &checkedOutAt, &res.OverstayFee, &res.WalkIn, &res.PromoCode, &res.DiscountAmount, &amountPaid,
 	)
 
 	if err != nil {
@@ -184,11 +224,22 @@ func (r *AdminRepository) FindReservationByCode(code string) (*entities.Reservat
 		}
 		return nil, fmt.Errorf("error querying or scanning reservation: %w", err)
 	}
+	if checkedInAt.Valid {
+		res.CheckedInAt = &checkedInAt.Time
+	}
+	if checkedOutAt.Valid {
+		res.CheckedOutAt = &checkedOutAt.Time
+	}
+	res.SetAmountPaid(amountPaid)
 	return &res, nil
 }
 
-func (r *AdminRepository) ListVehicleSpaces() ([]db.VehicleSpaceWithPrices, error) {
-	query := `SELECT vt.id, vt.name, vs.spaces FROM vehicle_spaces vs JOIN vehicle_types vt ON vs.vehicle_type_id = vt.id`
+func (r *adminRepository) ListVehicleSpaces() ([]db.VehicleSpaceWithPrices, error) {
+	query := `
+		SELECT vt.id, vt.name, sp.name, sp.spaces
+		FROM vehicle_types vt
+		JOIN space_pools sp ON sp.id = vt.space_pool_id
+		ORDER BY vt.name`
 	rows, err := r.DB.Query(query)
 	if err != nil {
 		return nil, err
@@ -199,8 +250,9 @@ func (r *AdminRepository) ListVehicleSpaces() ([]db.VehicleSpaceWithPrices, erro
 	for rows.Next() {
 		var vehicleTypeID int
 		var vehicleTypeName string
+		var poolName string
 		var spaces int
-		err := rows.Scan(&vehicleTypeID, &vehicleTypeName, &spaces)
+		err := rows.Scan(&vehicleTypeID, &vehicleTypeName, &poolName, &spaces)
 		if err != nil {
 			continue
 		}
@@ -211,10 +263,10 @@ func (r *AdminRepository) ListVehicleSpaces() ([]db.VehicleSpaceWithPrices, erro
 		if err != nil {
 			continue
 		}
-		prices := make(map[string]float32)
+		prices := make(map[string]money.Amount)
 		for priceRows.Next() {
 			var reservationTime string
-			var price float32
+			var price money.Amount
 			if err := priceRows.Scan(&reservationTime, &price); err == nil {
 				prices[reservationTime] = price
 			}
@@ -223,6 +275,7 @@ func (r *AdminRepository) ListVehicleSpaces() ([]db.VehicleSpaceWithPrices, erro
 
 		result = append(result, db.VehicleSpaceWithPrices{
 			VehicleType: vehicleTypeName,
+			SpacePool:   poolName,
 			Spaces:      spaces,
 			Prices:      prices,
 		})
@@ -230,18 +283,85 @@ func (r *AdminRepository) ListVehicleSpaces() ([]db.VehicleSpaceWithPrices, erro
 	return result, nil
 }
 
-func (r *AdminRepository) UpdateVehicleSpaces(vehicleType string, spaces int) error {
+// UpdateVehicleSpaces sets the spaces of the pool the vehicle type belongs to, which also changes the capacity
+// of every other vehicle type sharing that pool.
+func (r *adminRepository) UpdateVehicleSpaces(vehicleType string, spaces int) error {
 	query := `
-		UPDATE vehicle_spaces vs
+		UPDATE space_pools sp
 		SET spaces = $1
 		FROM vehicle_types vt
-		WHERE vs.vehicle_type_id = vt.id AND vt.name = $2
+		WHERE vt.space_pool_id = sp.id AND vt.name = $2
 	`
-	_, err := r.DB.Exec(query, spaces, vehicleType)
-	return err
+	result, err := r.DB.Exec(query, spaces, vehicleType)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("vehicle type '%s' not found or not assigned to a space pool: %w", vehicleType, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// ListSpacePools returns every space pool with the names of the vehicle types that use it.
+func (r *adminRepository) ListSpacePools() ([]db.SpacePool, error) {
+	query := `
+		SELECT sp.id, sp.name, sp.spaces, COALESCE(array_agg(vt.name ORDER BY vt.name) FILTER (WHERE vt.id IS NOT NULL), '{}')
+		FROM space_pools sp
+		LEFT JOIN vehicle_types vt ON vt.space_pool_id = sp.id
+		GROUP BY sp.id, sp.name, sp.spaces
+		ORDER BY sp.name`
+	rows, err := r.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pools []db.SpacePool
+	for rows.Next() {
+		var pool db.SpacePool
+		if err := rows.Scan(&pool.ID, &pool.Name, &pool.Spaces, pq.Array(&pool.VehicleTypes)); err != nil {
+			return nil, fmt.Errorf("error scanning space pool: %w", err)
+		}
+		pools = append(pools, pool)
+	}
+	return pools, rows.Err()
+}
+
+// CreateSpacePool creates an empty pool; vehicle types are moved into it with AssignVehicleTypeToPool.
+func (r *adminRepository) CreateSpacePool(name string, spaces int) (*db.SpacePool, error) {
+	pool := db.SpacePool{Name: name, Spaces: spaces, VehicleTypes: []string{}}
+	err := r.DB.QueryRow(`INSERT INTO space_pools (name, spaces) VALUES ($1, $2) RETURNING id`, name, spaces).Scan(&pool.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &pool, nil
+}
+
+// AssignVehicleTypeToPool moves a vehicle type to another pool. Existing reservations start counting against the new pool.
+func (r *adminRepository) AssignVehicleTypeToPool(vehicleType, poolName string) error {
+	query := `
+		UPDATE vehicle_types
+		SET space_pool_id = (SELECT id FROM space_pools WHERE name = $2)
+		WHERE name = $1 AND EXISTS (SELECT 1 FROM space_pools WHERE name = $2)`
+	result, err := r.DB.Exec(query, vehicleType, poolName)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("vehicle type '%s' or space pool '%s' not found: %w", vehicleType, poolName, sql.ErrNoRows)
+	}
+	return nil
 }
 
-func (r *AdminRepository) UpdateVehiclePrice(vehicleType string, timeName string, price float32) error {
+func (r *adminRepository) UpdateVehiclePrice(vehicleType string, timeName string, price money.Amount) error {
 	// Upsert price with subqueries to fetch IDs in a single statement
 	query := `
 		INSERT INTO vehicle_prices (vehicle_type_id, reservation_time_id, price)
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"estacionamienti/internal/db"
+	"fmt"
+	"time"
+)
+
+type CustomerAuthRepository interface {
+	CreateLoginCode(code *db.CustomerLoginCode, notifications []db.Notification) error
+	CountLoginCodesSince(email string, since time.Time) (int, error)
+	GetActiveLoginCodeByEmail(email string, now time.Time) (*db.CustomerLoginCode, error)
+	GetActiveLoginCodeByTokenHash(tokenHash string, now time.Time) (*db.CustomerLoginCode, error)
+	RecordLoginCodeAttempt(id, maxAttempts int) (bool, error)
+	MarkLoginCodeUsed(id int, usedAt time.Time) (bool, error)
+}
+
+type customerAuthRepository struct {
+	DB *sql.DB
+}
+
+func NewCustomerAuthRepository(db *sql.DB) CustomerAuthRepository {
+	return &customerAuthRepository{DB: db}
+}
+
+const customerLoginCodeColumns = `id, email, code_hash, token_hash, attempts, expires_at, used_at, created_at`
+
+// CreateLoginCode stores a new login code and retires the unused ones of the same email, so only the last one sent
+// works. The notifications sending it are queued in the same transaction, on the reservation they name.
+func (r *customerAuthRepository) CreateLoginCode(code *db.CustomerLoginCode, notifications []db.Notification) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE customer_login_codes SET used_at = NOW() WHERE LOWER(email) = LOWER($1) AND used_at IS NULL`, code.Email)
+	if err != nil {
+		return fmt.Errorf("error retiring login codes: %w", err)
+	}
+	query := `
+		INSERT INTO customer_login_codes (email, code_hash, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+	if err := tx.QueryRow(query, code.Email, code.CodeHash, code.TokenHash, code.ExpiresAt).Scan(&code.ID, &code.CreatedAt); err != nil {
+		return fmt.Errorf("error inserting login code: %w", err)
+	}
+	if len(notifications) > 0 {
+		var reservationID int
+		if err := tx.QueryRow(`SELECT id FROM reservations WHERE code = $1`, notifications[0].ReservationCode).Scan(&reservationID); err != nil {
+			return fmt.Errorf("error getting reservation %s for the login email: %w", notifications[0].ReservationCode, err)
+		}
+		if err := insertNotifications(tx, reservationID, notifications); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CountLoginCodesSince counts the login codes sent to the email since the given time, used or not.
+func (r *customerAuthRepository) CountLoginCodesSince(email string, since time.Time) (int, error) {
+	var count int
+	err := r.DB.QueryRow(`SELECT COUNT(*) FROM customer_login_codes WHERE LOWER(email) = LOWER($1) AND created_at >= $2`,
+		email, since).Scan(&count)
+	return count, err
+}
+
+// GetActiveLoginCodeByEmail returns the last login code of the email that is neither used nor expired.
+func (r *customerAuthRepository) GetActiveLoginCodeByEmail(email string, now time.Time) (*db.CustomerLoginCode, error) {
+	row := r.DB.QueryRow(`SELECT `+customerLoginCodeColumns+` FROM customer_login_codes
+		WHERE LOWER(email) = LOWER($1) AND used_at IS NULL AND expires_at > $2
+		ORDER BY created_at DESC LIMIT 1`, email, now)
+	return scanCustomerLoginCode(row)
+}
+
+// GetActiveLoginCodeByTokenHash returns the login code of a magic link if it is neither used nor expired.
+func (r *customerAuthRepository) GetActiveLoginCodeByTokenHash(tokenHash string, now time.Time) (*db.CustomerLoginCode, error) {
+	row := r.DB.QueryRow(`SELECT `+customerLoginCodeColumns+` FROM customer_login_codes
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2`, tokenHash, now)
+	return scanCustomerLoginCode(row)
+}
+
+// RecordLoginCodeAttempt counts an attempt at typing the code, and reports false without counting it when the code
+// already had maxAttempts. Counting happens before comparing, so concurrent guesses can't go past the limit.
+func (r *customerAuthRepository) RecordLoginCodeAttempt(id, maxAttempts int) (bool, error) {
+	result, err := r.DB.Exec(`UPDATE customer_login_codes SET attempts = attempts + 1 WHERE id = $1 AND attempts < $2`, id, maxAttempts)
+	if err != nil {
+		return false, fmt.Errorf("error recording attempt on login code %d: %w", id, err)
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+// MarkLoginCodeUsed uses up the login code, and reports false if it had already been used.
+func (r *customerAuthRepository) MarkLoginCodeUsed(id int, usedAt time.Time) (bool, error) {
+	result, err := r.DB.Exec(`UPDATE customer_login_codes SET used_at = $2 WHERE id = $1 AND used_at IS NULL`, id, usedAt)
+	if err != nil {
+		return false, fmt.Errorf("error marking login code %d used: %w", id, err)
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+func scanCustomerLoginCode(row *sql.Row) (*db.CustomerLoginCode, error) {
+	var code db.CustomerLoginCode
+	err := row.Scan(&code.ID, &code.Email, &code.CodeHash, &code.TokenHash, &code.Attempts, &code.ExpiresAt, &code.UsedAt, &code.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("login code not found: %w", err)
+		}
+		return nil, fmt.Errorf("error querying login code: %w", err)
+	}
+	return &code, nil
+}
@@ -8,21 +8,27 @@ import (
 	"time"
 )
 
-type JobRepository struct {
+type JobRepository interface {
+	GetReservationIDsPastEndTime(status string) ([]int, error)
+	UpdateReservationStatuses(ids []int, newStatus string) error
+	DeletePendingReservationsOlderThan(before time.Time) (int64, error)
+}
+
+type jobRepository struct {
 	DB *sql.DB
 }
 
-func NewJobRepository(db *sql.DB) *JobRepository {
-	return &JobRepository{DB: db}
+func NewJobRepository(db *sql.DB) JobRepository {
+	return &jobRepository{DB: db}
 }
 
-// GetActiveReservationIDsPastEndTime busca IDs de reservas activas cuya fecha de fin ya pasó.
-func (r *JobRepository) GetActiveReservationIDsPastEndTime() ([]int, error) {
+// GetReservationIDsPastEndTime busca IDs de reservas en el estado dado cuya fecha de fin ya pasó y que no hicieron check-out.
+func (r *jobRepository) GetReservationIDsPastEndTime(status string) ([]int, error) {
 	now := time.Now().UTC()
-	query := `SELECT id FROM reservations WHERE status = 'active' AND end_time < $1`
-	rows, err := r.DB.Query(query, now)
+	query := `SELECT id FROM reservations WHERE status = $2 AND end_time < $1 AND checked_out_at IS NULL`
+	rows, err := r.DB.Query(query, now, status)
 	if err != nil {
-		return nil, fmt.Errorf("error querying active reservations past end time: %w", err)
+		return nil, fmt.Errorf("error querying %s reservations past end time: %w", status, err)
 	}
 	defer rows.Close()
 
@@ -42,7 +48,7 @@ func (r *JobRepository) GetActiveReservationIDsPastEndTime() ([]int, error) {
 
 // UpdateReservationStatusesToFinished actualiza el estado de una lista de reservas a 'Finalizada'.
 // También actualiza el campo updated_at.
-func (r *JobRepository) UpdateReservationStatuses(ids []int, newStatus string) error {
+func (r *jobRepository) UpdateReservationStatuses(ids []int, newStatus string) error {
 	if len(ids) == 0 {
 		return nil // No hay nada que actualizar
 	}
@@ -62,9 +68,11 @@ func (r *JobRepository) UpdateReservationStatuses(ids []int, newStatus string) e
 	return nil
 }
 
-// DeletePendingReservationsOlderThan deletes all reservations with status 'pending' created before the given time.
-func (r *JobRepository) DeletePendingReservationsOlderThan(before time.Time) (int64, error) {
-	query := `DELETE FROM reservations WHERE status = 'pending' AND created_at < $1`
+// DeletePendingReservationsOlderThan deletes all reservations with status 'pending' created before the given time,
+// except those whose payment is still being processed by Stripe or that already have payments recorded.
+func (r *jobRepository) DeletePendingReservationsOlderThan(before time.Time) (int64, error) {
+	query := `DELETE FROM reservations WHERE status = 'pending' AND created_at < $1 AND COALESCE(payment_status, '') <> 'processing'
+		AND NOT EXISTS (SELECT 1 FROM payments p WHERE p.reservation_id = reservations.id)`
 	result, err := r.DB.Exec(query, before)
 	if err != nil {
 		return 0, fmt.Errorf("error deleting old pending reservations: %w", err)
@@ -0,0 +1,181 @@
+package memory
+
+import (
+	"database/sql"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/repository"
+	"fmt"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func (s *Store) adminByIDLocked(id int) *repository.Admin {
+	for _, admin := range s.admins {
+		if admin.ID == id {
+			return admin
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetByEmail(user string) (*repository.Admin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, admin := range s.admins {
+		if admin.User == user {
+			cp := *admin
+			return &cp, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *Store) GetAdminByID(id int) (*repository.Admin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	admin := s.adminByIDLocked(id)
+	if admin == nil {
+		return nil, notFound(fmt.Sprintf("admin %d", id))
+	}
+	cp := *admin
+	return &cp, nil
+}
+
+func (s *Store) ListAdmins() ([]repository.Admin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	admins := make([]repository.Admin, 0, len(s.admins))
+	for _, admin := range s.admins {
+		admins = append(admins, *admin)
+	}
+	sort.Slice(admins, func(i, j int) bool { return admins[i].User < admins[j].User })
+	return admins, nil
+}
+
+func (s *Store) CreateNewUser(user, password, role string) (*repository.Admin, error) {
+	// The lowest cost keeps tests fast; the hash is checked the same way.
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, admin := range s.admins {
+		if admin.User == user {
+			return nil, repository.ErrAdminExists
+		}
+	}
+	return s.addAdminLocked(user, hash, role), nil
+}
+
+func (s *Store) CreateFirstOwner(user, password string) (*repository.Admin, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.admins) > 0 {
+		return nil, repository.ErrAdminsExist
+	}
+	return s.addAdminLocked(user, hash, "owner"), nil
+}
+
+func (s *Store) addAdminLocked(user string, hash []byte, role string) *repository.Admin {
+	s.nextAdminID++
+	admin := &repository.Admin{
+		ID:           s.nextAdminID,
+		User:         user,
+		PasswordHash: string(hash),
+		Role:         role,
+		Active:       true,
+		CreatedAt:    time.Now().UTC(),
+	}
+	s.admins = append(s.admins, admin)
+	cp := *admin
+	return &cp
+}
+
+func (s *Store) UpdateAdmin(id int, role string, active bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	admin := s.adminByIDLocked(id)
+	if admin == nil {
+		return notFound(fmt.Sprintf("admin %d", id))
+	}
+	otherOwners := 0
+	for _, other := range s.admins {
+		if other.ID != id && other.Role == "owner" && other.Active {
+			otherOwners++
+		}
+	}
+	if otherOwners == 0 && (role != "owner" || !active) {
+		return repository.ErrLastOwner
+	}
+	admin.Role, admin.Active = role, active
+	return nil
+}
+
+func (s *Store) CreateRefreshToken(token *db.AdminRefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addRefreshTokenLocked(token)
+	return nil
+}
+
+func (s *Store) addRefreshTokenLocked(token *db.AdminRefreshToken) {
+	s.nextRefreshTokenID++
+	token.ID = s.nextRefreshTokenID
+	token.CreatedAt = time.Now().UTC()
+	cp := *token
+	s.refreshTokens = append(s.refreshTokens, &cp)
+}
+
+func (s *Store) GetRefreshTokenByHash(tokenHash string) (*db.AdminRefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range s.refreshTokens {
+		if token.TokenHash == tokenHash {
+			cp := *token
+			return &cp, nil
+		}
+	}
+	return nil, notFound("refresh token")
+}
+
+func (s *Store) RotateRefreshToken(usedID int, next *db.AdminRefreshToken, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range s.refreshTokens {
+		if token.ID == usedID {
+			if token.RevokedAt.Valid {
+				return false, nil
+			}
+			token.RevokedAt = sql.NullTime{Time: at, Valid: true}
+			s.addRefreshTokenLocked(next)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) RevokeRefreshTokenFamily(familyID string, at time.Time) error {
+	return s.revokeRefreshTokens(at, func(token *db.AdminRefreshToken) bool { return token.FamilyID == familyID })
+}
+
+func (s *Store) RevokeAdminRefreshTokens(adminID int, at time.Time) error {
+	return s.revokeRefreshTokens(at, func(token *db.AdminRefreshToken) bool { return token.AdminID == adminID })
+}
+
+func (s *Store) revokeRefreshTokens(at time.Time, match func(*db.AdminRefreshToken) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range s.refreshTokens {
+		if match(token) && !token.RevokedAt.Valid {
+			token.RevokedAt = sql.NullTime{Time: at, Valid: true}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"estacionamienti/internal/db"
+	"fmt"
+	"strings"
+	"time"
+)
+
+func (s *Store) CreateLoginCode(code *db.CustomerLoginCode, notifications []db.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res *db.Reservation
+	if len(notifications) > 0 {
+		if res = s.byCodeLocked(notifications[0].ReservationCode); res == nil {
+			return notFound(fmt.Sprintf("reservation with code '%s'", notifications[0].ReservationCode))
+		}
+	}
+	now := time.Now().UTC()
+	for _, existing := range s.loginCodes {
+		if strings.EqualFold(existing.Email, code.Email) && !existing.UsedAt.Valid {
+			existing.UsedAt.Time, existing.UsedAt.Valid = now, true
+		}
+	}
+	s.nextLoginCodeID++
+	code.ID = s.nextLoginCodeID
+	code.CreatedAt = now
+	cp := *code
+	s.loginCodes = append(s.loginCodes, &cp)
+	if res != nil {
+		s.queueLocked(res.ID, notifications)
+	}
+	return nil
+}
+
+func (s *Store) CountLoginCodesSince(email string, since time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, code := range s.loginCodes {
+		if strings.EqualFold(code.Email, email) && !code.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *Store) GetActiveLoginCodeByEmail(email string, now time.Time) (*db.CustomerLoginCode, error) {
+	return s.activeLoginCode(now, func(code *db.CustomerLoginCode) bool { return strings.EqualFold(code.Email, email) })
+}
+
+func (s *Store) GetActiveLoginCodeByTokenHash(tokenHash string, now time.Time) (*db.CustomerLoginCode, error) {
+	return s.activeLoginCode(now, func(code *db.CustomerLoginCode) bool { return code.TokenHash == tokenHash })
+}
+
+// activeLoginCode returns the last login code matching that is neither used nor expired.
+func (s *Store) activeLoginCode(now time.Time, match func(*db.CustomerLoginCode) bool) (*db.CustomerLoginCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.loginCodes) - 1; i >= 0; i-- {
+		code := s.loginCodes[i]
+		if match(code) && !code.UsedAt.Valid && code.ExpiresAt.After(now) {
+			cp := *code
+			return &cp, nil
+		}
+	}
+	return nil, notFound("login code")
+}
+
+func (s *Store) RecordLoginCodeAttempt(id, maxAttempts int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code := s.loginCodeLocked(id)
+	if code == nil || code.Attempts >= maxAttempts {
+		return false, nil
+	}
+	code.Attempts++
+	return true, nil
+}
+
+func (s *Store) MarkLoginCodeUsed(id int, usedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code := s.loginCodeLocked(id)
+	if code == nil || code.UsedAt.Valid {
+		return false, nil
+	}
+	code.UsedAt.Time, code.UsedAt.Valid = usedAt, true
+	return true, nil
+}
+
+func (s *Store) loginCodeLocked(id int) *db.CustomerLoginCode {
+	for _, code := range s.loginCodes {
+		if code.ID == id {
+			return code
+		}
+	}
+	return nil
+}
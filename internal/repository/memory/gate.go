@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"database/sql"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/money"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+func normalizePlate(plate string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(plate))
+}
+
+func (s *Store) FindReservationCodesByPlate(plate string, statuses []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var matches []*db.Reservation
+	for _, res := range s.reservations {
+		if normalizePlate(res.VehiclePlate.String) != plate {
+			continue
+		}
+		for _, status := range statuses {
+			if res.Status == status {
+				matches = append(matches, res)
+				break
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].StartTime.Before(matches[j].StartTime) })
+	codes := make([]string, 0, len(matches))
+	for _, res := range matches {
+		codes = append(codes, res.Code)
+	}
+	return codes, nil
+}
+
+func (s *Store) CheckInReservation(reservationID int, checkedInAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := s.byIDLocked(reservationID)
+	if res == nil || res.Status != "active" {
+		return fmt.Errorf("reservation %d not found in the expected status: %w", reservationID, sql.ErrNoRows)
+	}
+	res.Status = "checked_in"
+	res.CheckedInAt = sql.NullTime{Time: checkedInAt, Valid: true}
+	res.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+func (s *Store) CheckOutReservation(reservationID int, checkedOutAt time.Time, charge, overstayFee money.Amount, payment *db.Payment) error {
+	s.mu.Lock()
+	res := s.byIDLocked(reservationID)
+	if res == nil || (res.Status != "active" && res.Status != "checked_in" && res.Status != "overstay" && res.Status != "no_show") {
+		s.mu.Unlock()
+		return fmt.Errorf("reservation %d not found in the expected status: %w", reservationID, sql.ErrNoRows)
+	}
+	res.Status = "finished"
+	res.CheckedOutAt = sql.NullTime{Time: checkedOutAt, Valid: true}
+	if res.EndTime.IsZero() {
+		res.EndTime = checkedOutAt
+	}
+	res.OverstayFee = overstayFee
+	res.TotalPrice += charge
+	res.UpdatedAt = time.Now().UTC()
+	s.mu.Unlock()
+	if payment != nil {
+		_, err := s.RecordPayment(payment)
+		return err
+	}
+	return nil
+}
+
+func (s *Store) MarkReservationNoShow(reservationID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := s.byIDLocked(reservationID)
+	if res == nil || res.Status != "active" {
+		return fmt.Errorf("reservation %d not found in the expected status: %w", reservationID, sql.ErrNoRows)
+	}
+	res.Status = "no_show"
+	res.UpdatedAt = time.Now().UTC()
+	return nil
+}
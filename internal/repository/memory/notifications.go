@@ -0,0 +1,134 @@
+package memory
+
+import (
+	"estacionamienti/internal/db"
+	"sort"
+	"time"
+)
+
+func (s *Store) queueLocked(reservationID int, notifications []db.Notification) {
+	now := time.Now().UTC()
+	for _, n := range notifications {
+		n.ID = s.nextNotificationID
+		s.nextNotificationID++
+		n.ReservationID = reservationID
+		n.Status = "pending"
+		n.Attempts = 0
+		n.NextAttemptAt = now
+		n.CreatedAt = now
+		n.UpdatedAt = now
+		s.notifications = append(s.notifications, &n)
+	}
+}
+
+// Notifications returns a copy of every notification queued for the reservation code, oldest first.
+func (s *Store) Notifications(code string) []db.Notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []db.Notification
+	for _, n := range s.notifications {
+		if n.ReservationCode == code {
+			out = append(out, *n)
+		}
+	}
+	return out
+}
+
+func (s *Store) notificationLocked(id int) *db.Notification {
+	for _, n := range s.notifications {
+		if n.ID == id {
+			return n
+		}
+	}
+	return nil
+}
+
+func (s *Store) ClaimDueNotifications(now time.Time, lease time.Duration, limit int) ([]db.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []*db.Notification
+	for _, n := range s.notifications {
+		if n.Status == "pending" && !n.NextAttemptAt.After(now) {
+			due = append(due, n)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	claimed := make([]db.Notification, 0, len(due))
+	for _, n := range due {
+		n.NextAttemptAt = now.Add(lease)
+		n.UpdatedAt = time.Now().UTC()
+		claimed = append(claimed, *n)
+	}
+	return claimed, nil
+}
+
+func (s *Store) MarkNotificationSent(id int, sentAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := s.notificationLocked(id); n != nil {
+		n.Status = "sent"
+		n.Attempts++
+		n.SentAt.Time, n.SentAt.Valid = sentAt, true
+		n.LastError.Valid = false
+		n.UpdatedAt = time.Now().UTC()
+	}
+	return nil
+}
+
+func (s *Store) MarkNotificationRetry(id int, attempts int, nextAttemptAt time.Time, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := s.notificationLocked(id); n != nil {
+		n.Attempts = attempts
+		n.NextAttemptAt = nextAttemptAt
+		n.LastError.String, n.LastError.Valid = lastError, true
+		n.UpdatedAt = time.Now().UTC()
+	}
+	return nil
+}
+
+func (s *Store) MarkNotificationFailed(id int, attempts int, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := s.notificationLocked(id); n != nil {
+		n.Status = "failed"
+		n.Attempts = attempts
+		n.LastError.String, n.LastError.Valid = lastError, true
+		n.UpdatedAt = time.Now().UTC()
+	}
+	return nil
+}
+
+func (s *Store) ListFailedNotifications(code string) ([]db.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []db.Notification
+	for i := len(s.notifications) - 1; i >= 0; i-- {
+		n := s.notifications[i]
+		if n.Status == "failed" && (code == "" || n.ReservationCode == code) {
+			out = append(out, *n)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].UpdatedAt.After(out[j].UpdatedAt) })
+	return out, nil
+}
+
+func (s *Store) RequeueFailedNotifications(code string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	var requeued int64
+	for _, n := range s.notifications {
+		if n.Status == "failed" && n.ReservationCode == code {
+			n.Status = "pending"
+			n.Attempts = 0
+			n.NextAttemptAt = now
+			n.UpdatedAt = now
+			requeued++
+		}
+	}
+	return requeued, nil
+}
@@ -0,0 +1,59 @@
+package memory
+
+import (
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/money"
+	"time"
+)
+
+func (s *Store) RecordPayment(p *db.Payment) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p.ExternalID.Valid {
+		for _, existing := range s.payments {
+			if existing.ExternalID.Valid && existing.ExternalID.String == p.ExternalID.String {
+				return false, nil
+			}
+		}
+	}
+	p.ID = len(s.payments) + 1
+	p.CreatedAt = time.Now().UTC()
+	s.payments = append(s.payments, *p)
+	return true, nil
+}
+
+func (s *Store) ListPaymentsByReservation(reservationID int) ([]db.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []db.Payment
+	for _, p := range s.payments {
+		if p.ReservationID == reservationID {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) netPaidLocked(reservationID int) money.Amount {
+	var paid money.Amount
+	for _, p := range s.payments {
+		if p.ReservationID != reservationID {
+			continue
+		}
+		if p.Kind == "refund" {
+			paid -= p.Amount
+		} else {
+			paid += p.Amount
+		}
+	}
+	return paid
+}
+
+func (s *Store) hasPaymentsLocked(reservationID int) bool {
+	for _, p := range s.payments {
+		if p.ReservationID == reservationID {
+			return true
+		}
+	}
+	return false
+}
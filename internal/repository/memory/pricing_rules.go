@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"database/sql"
+	"estacionamienti/internal/db"
+	"fmt"
+	"sort"
+)
+
+func (s *Store) GetPricingRules(vehicleTypeID int) ([]db.PricingRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rules []db.PricingRule
+	for _, rule := range s.pricingRules {
+		if rule.VehicleTypeID == nil || *rule.VehicleTypeID == vehicleTypeID {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+func (s *Store) ListPricingRules() ([]db.PricingRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rules := append([]db.PricingRule(nil), s.pricingRules...)
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority > rules[j].Priority })
+	return rules, nil
+}
+
+func (s *Store) CreatePricingRule(rule *db.PricingRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextPricingRuleID++
+	rule.ID = s.nextPricingRuleID
+	s.pricingRules = append(s.pricingRules, *rule)
+	return nil
+}
+
+func (s *Store) DeletePricingRule(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, rule := range s.pricingRules {
+		if rule.ID == id {
+			s.pricingRules = append(s.pricingRules[:i], s.pricingRules[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("pricing rule %d not found: %w", id, sql.ErrNoRows)
+}
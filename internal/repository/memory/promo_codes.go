@@ -0,0 +1,141 @@
+package memory
+
+import (
+	"database/sql"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/repository"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+func (s *Store) promoByIDLocked(id int) *db.PromoCode {
+	for _, promo := range s.promoCodes {
+		if promo.ID == id {
+			return promo
+		}
+	}
+	return nil
+}
+
+// redemptionsLocked mirrors the redemption count of the promo code: reservations not canceled booked with it, in
+// total and with the given email.
+func (s *Store) redemptionsLocked(promoCodeID int, email string) (total, byEmail int) {
+	for _, res := range s.reservations {
+		if !res.PromoCodeID.Valid || int(res.PromoCodeID.Int64) != promoCodeID || res.Status == "canceled" {
+			continue
+		}
+		total++
+		if strings.EqualFold(res.UserEmail, email) {
+			byEmail++
+		}
+	}
+	return total, byEmail
+}
+
+func (s *Store) checkPromoRedemptionsLocked(res *db.Reservation) error {
+	promo := s.promoByIDLocked(int(res.PromoCodeID.Int64))
+	if promo == nil {
+		return fmt.Errorf("promo code %d not found: %w", res.PromoCodeID.Int64, sql.ErrNoRows)
+	}
+	total, byEmail := s.redemptionsLocked(promo.ID, res.UserEmail)
+	if (promo.MaxRedemptions != nil && total >= *promo.MaxRedemptions) ||
+		(promo.MaxRedemptionsPerEmail != nil && byEmail >= *promo.MaxRedemptionsPerEmail) {
+		return repository.ErrPromoCodeExhausted
+	}
+	return nil
+}
+
+func (s *Store) GetPromoCodeByCode(code string) (*db.PromoCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, promo := range s.promoCodes {
+		if promo.Code == code {
+			cp := *promo
+			return &cp, nil
+		}
+	}
+	return nil, notFound(fmt.Sprintf("promo code '%s'", code))
+}
+
+func (s *Store) GetPromoCodeByID(id int) (*db.PromoCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	promo := s.promoByIDLocked(id)
+	if promo == nil {
+		return nil, notFound(fmt.Sprintf("promo code %d", id))
+	}
+	cp := *promo
+	return &cp, nil
+}
+
+func (s *Store) CountPromoRedemptions(promoCodeID int, email string) (int, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total, byEmail := s.redemptionsLocked(promoCodeID, email)
+	return total, byEmail, nil
+}
+
+func (s *Store) ListPromoCodes() ([]db.PromoCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var promos []db.PromoCode
+	for _, promo := range s.promoCodes {
+		cp := *promo
+		for _, res := range s.reservations {
+			if res.PromoCodeID.Valid && int(res.PromoCodeID.Int64) == promo.ID && res.Status != "canceled" {
+				cp.Redemptions++
+				cp.DiscountGiven += res.DiscountAmount
+			}
+		}
+		promos = append(promos, cp)
+	}
+	sort.SliceStable(promos, func(i, j int) bool { return promos[i].ID > promos[j].ID })
+	return promos, nil
+}
+
+func (s *Store) CreatePromoCode(promo *db.PromoCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.promoCodes {
+		if existing.Code == promo.Code {
+			return fmt.Errorf("promo code '%s' already exists", promo.Code)
+		}
+	}
+	s.nextPromoCodeID++
+	promo.ID = s.nextPromoCodeID
+	promo.CreatedAt = time.Now().UTC()
+	cp := *promo
+	s.promoCodes = append(s.promoCodes, &cp)
+	return nil
+}
+
+func (s *Store) UpdatePromoCode(promo *db.PromoCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing := s.promoByIDLocked(promo.ID)
+	if existing == nil {
+		return notFound(fmt.Sprintf("promo code %d", promo.ID))
+	}
+	promo.CreatedAt = existing.CreatedAt
+	*existing = *promo
+	return nil
+}
+
+func (s *Store) DeletePromoCode(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, res := range s.reservations {
+		if res.PromoCodeID.Valid && int(res.PromoCodeID.Int64) == id {
+			return repository.ErrPromoCodeInUse
+		}
+	}
+	for i, promo := range s.promoCodes {
+		if promo.ID == id {
+			s.promoCodes = append(s.promoCodes[:i], s.promoCodes[i+1:]...)
+			return nil
+		}
+	}
+	return notFound(fmt.Sprintf("promo code %d", id))
+}
@@ -0,0 +1,47 @@
+package memory
+
+import (
+	"estacionamienti/internal/db"
+	"sort"
+)
+
+// defaultRefundTiers mirrors the policy seeded by the refund policy migration.
+func defaultRefundTiers() map[int][]db.RefundTier {
+	return map[int][]db.RefundTier{
+		1: {{ID: 1, PaymentMethodID: 1, MinHoursBefore: 48, RefundPercent: 100},
+			{ID: 2, PaymentMethodID: 1, MinHoursBefore: 12, RefundPercent: 50},
+			{ID: 3, PaymentMethodID: 1, MinHoursBefore: 0, RefundPercent: 0}},
+		2: {{ID: 4, PaymentMethodID: 2, MinHoursBefore: 48, RefundPercent: 100},
+			{ID: 5, PaymentMethodID: 2, MinHoursBefore: 12, RefundPercent: 70},
+			{ID: 6, PaymentMethodID: 2, MinHoursBefore: 0, RefundPercent: 0}},
+	}
+}
+
+func (s *Store) GetRefundPolicy(paymentMethodID int) ([]db.RefundTier, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]db.RefundTier(nil), s.refundTiers[paymentMethodID]...), nil
+}
+
+func (s *Store) ListRefundPolicy() ([]db.RefundTier, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tiers []db.RefundTier
+	for _, method := range []int{1, 2} {
+		tiers = append(tiers, s.refundTiers[method]...)
+	}
+	return tiers, nil
+}
+
+func (s *Store) ReplaceRefundPolicy(paymentMethodID int, tiers []db.RefundTier) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	replaced := make([]db.RefundTier, len(tiers))
+	for i, tier := range tiers {
+		tier.PaymentMethodID = paymentMethodID
+		replaced[i] = tier
+	}
+	sort.Slice(replaced, func(i, j int) bool { return replaced[i].MinHoursBefore > replaced[j].MinHoursBefore })
+	s.refundTiers[paymentMethodID] = replaced
+	return nil
+}
@@ -0,0 +1,136 @@
+package memory
+
+import (
+	"database/sql"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/repository"
+	"fmt"
+	"time"
+)
+
+func (s *Store) ApplyReservationChange(change *db.ReservationChange, holdSince time.Time, notifications []db.Notification) ([]repository.SlotOccupationInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	slots, err := s.availabilityLocked(change.StartTime, change.EndTime, change.VehicleTypeID, holdSince, change.ReservationID)
+	if err != nil {
+		return nil, err
+	}
+	var conflicts []repository.SlotOccupationInfo
+	for _, slot := range slots {
+		if slot.TotalSpaces-slot.BookedSpaces <= 0 {
+			conflicts = append(conflicts, slot)
+		}
+	}
+	if len(conflicts) > 0 {
+		return conflicts, nil
+	}
+
+	res := s.byIDLocked(change.ReservationID)
+	if res == nil || (res.Status != "active" && res.Status != "checked_in" && res.Status != "overstay") {
+		return nil, fmt.Errorf("active reservation %s not found: %w", change.ReservationCode, sql.ErrNoRows)
+	}
+	res.StartTime = change.StartTime
+	res.EndTime = change.EndTime
+	res.VehicleTypeID = change.VehicleTypeID
+	res.VehiclePlate = change.VehiclePlate
+	res.VehicleModel = change.VehicleModel
+	res.TotalPrice = change.NewTotalPrice
+	res.DepositPayment = change.NewDepositPayment
+	res.DiscountAmount = change.NewDiscount
+	if res.Status == "overstay" && res.CheckedInAt.Valid {
+		res.Status = "checked_in"
+	} else if res.Status == "overstay" {
+		res.Status = "active"
+	}
+	res.UpdatedAt = time.Now().UTC()
+
+	change.Status = "applied"
+	if change.AmountDue < 0 {
+		change.Status = "refund_pending"
+	}
+	if stored := s.changeLocked(change.ID); stored != nil {
+		stored.Status = change.Status
+		stored.UpdatedAt = res.UpdatedAt
+	} else {
+		s.insertChangeLocked(change)
+	}
+	s.queueLocked(res.ID, notifications)
+	return nil, nil
+}
+
+func (s *Store) CreateReservationChange(change *db.ReservationChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.changes {
+		if c.ReservationID == change.ReservationID && c.Status == "awaiting_payment" {
+			c.Status = "superseded"
+			c.UpdatedAt = time.Now().UTC()
+		}
+	}
+	s.insertChangeLocked(change)
+	return nil
+}
+
+func (s *Store) insertChangeLocked(change *db.ReservationChange) {
+	change.ID = len(s.changes) + 1
+	change.CreatedAt = time.Now().UTC()
+	change.UpdatedAt = change.CreatedAt
+	cp := *change
+	s.changes = append(s.changes, &cp)
+}
+
+func (s *Store) changeLocked(id int) *db.ReservationChange {
+	for _, c := range s.changes {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetReservationChangeByStripeSessionID(sessionID string) (*db.ReservationChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.changes {
+		if c.StripeSessionID.Valid && c.StripeSessionID.String == sessionID {
+			cp := *c
+			return &cp, nil
+		}
+	}
+	return nil, notFound(fmt.Sprintf("reservation change with sessionID '%s'", sessionID))
+}
+
+func (s *Store) ListReservationChangesByStatus(status string) ([]db.ReservationChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []db.ReservationChange
+	for _, c := range s.changes {
+		if c.Status == status {
+			out = append(out, *c)
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) UpdateReservationChangeStatus(changeID int, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c := s.changeLocked(changeID); c != nil {
+		c.Status = status
+		c.UpdatedAt = time.Now().UTC()
+	}
+	return nil
+}
+
+// ReservationChanges returns a copy of every change requested for the reservation code, oldest first.
+func (s *Store) ReservationChanges(code string) []db.ReservationChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []db.ReservationChange
+	for _, c := range s.changes {
+		if c.ReservationCode == code {
+			out = append(out, *c)
+		}
+	}
+	return out
+}
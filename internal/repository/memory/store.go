@@ -0,0 +1,775 @@
+// Package memory implements the repository interfaces on top of in-process maps, so services can be exercised
+// without Postgres. A single Store backs every repository, mirroring how they all share one database.
+package memory
+
+import (
+	"database/sql"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/money"
+	"estacionamienti/internal/repository"
+	"estacionamienti/internal/reservationcode"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	_ repository.ReservationRepository  = (*Store)(nil)
+	_ repository.AdminRepository        = (*Store)(nil)
+	_ repository.JobRepository          = (*Store)(nil)
+	_ repository.NotificationRepository = (*Store)(nil)
+	_ repository.StripeEventRepository  = (*Store)(nil)
+	_ repository.PaymentRepository      = (*Store)(nil)
+	_ repository.PricingRepository      = (*Store)(nil)
+	_ repository.PromoCodeRepository    = (*Store)(nil)
+	_ repository.RefundPolicyRepository = (*Store)(nil)
+	_ repository.CustomerAuthRepository = (*Store)(nil)
+	_ repository.AdminAuthRepository    = (*Store)(nil)
+)
+
+type vehicleType struct {
+	ID     int
+	Name   string
+	PoolID int
+}
+
+type priceKey struct {
+	VehicleTypeID     int
+	ReservationTimeID int
+}
+
+// Store keeps the whole parking state in memory. It is safe for concurrent use.
+type Store struct {
+	mu sync.Mutex
+
+	vehicleTypes     []vehicleType
+	reservationTimes map[int]string
+	paymentMethods   map[int]string
+	pools            map[int]*db.SpacePool
+	prices           map[priceKey]money.Amount
+	reservations     []*db.Reservation
+	notifications    []*db.Notification
+	stripeEvents     []*stripeEvent
+	refundTiers      map[int][]db.RefundTier
+	payments         []db.Payment
+	changes          []*db.ReservationChange
+	pricingRules     []db.PricingRule
+	promoCodes       []*db.PromoCode
+	loginCodes       []*db.CustomerLoginCode
+	admins           []*repository.Admin
+	refreshTokens    []*db.AdminRefreshToken
+
+	nextVehicleTypeID  int
+	nextPoolID         int
+	nextReservationID  int
+	nextNotificationID int
+	nextPricingRuleID  int
+	nextPromoCodeID    int
+	nextLoginCodeID    int
+	nextAdminID        int
+	nextRefreshTokenID int
+}
+
+// NewStore returns an empty store with the fixed reservation times, payment methods and refund policy of the real
+// schema.
+func NewStore() *Store {
+	return &Store{
+		reservationTimes:   map[int]string{1: "hour", 2: "daily", 3: "weekly", 4: "monthly"},
+		paymentMethods:     map[int]string{1: "onsite", 2: "online"},
+		pools:              map[int]*db.SpacePool{},
+		prices:             map[priceKey]money.Amount{},
+		refundTiers:        defaultRefundTiers(),
+		nextVehicleTypeID:  1,
+		nextPoolID:         1,
+		nextReservationID:  1,
+		nextNotificationID: 1,
+	}
+}
+
+// NewSeededStore returns a store with the same vehicle types, prices and pools the migrations seed:
+// car (1) and suv (3) share the 20-space "car" pool, motorcycle (2) has its own 20 spaces.
+func NewSeededStore() *Store {
+	s := NewStore()
+	carPool := s.AddSpacePool("car", 20)
+	motorcyclePool := s.AddSpacePool("motorcycle", 20)
+	car := s.AddVehicleType("car", carPool)
+	motorcycle := s.AddVehicleType("motorcycle", motorcyclePool)
+	suv := s.AddVehicleType("suv", carPool)
+	for vt, prices := range map[int][4]money.Amount{
+		car:        {400, 1000, 2000, 4000},
+		motorcycle: {200, 800, 1500, 3000},
+		suv:        {600, 1200, 2500, 5000},
+	} {
+		for i, price := range prices {
+			s.SetPrice(vt, i+1, price)
+		}
+	}
+	return s
+}
+
+// AddSpacePool creates a pool and returns its ID.
+func (s *Store) AddSpacePool(name string, spaces int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addPoolLocked(name, spaces)
+}
+
+func (s *Store) addPoolLocked(name string, spaces int) int {
+	id := s.nextPoolID
+	s.nextPoolID++
+	s.pools[id] = &db.SpacePool{ID: id, Name: name, Spaces: spaces}
+	return id
+}
+
+// AddVehicleType creates a vehicle type in the given pool (0 for none) and returns its ID.
+func (s *Store) AddVehicleType(name string, poolID int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextVehicleTypeID
+	s.nextVehicleTypeID++
+	s.vehicleTypes = append(s.vehicleTypes, vehicleType{ID: id, Name: name, PoolID: poolID})
+	return id
+}
+
+// SetPrice sets the price, in cents, of one reservation time unit for a vehicle type.
+func (s *Store) SetPrice(vehicleTypeID, reservationTimeID int, price money.Amount) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prices[priceKey{vehicleTypeID, reservationTimeID}] = price
+}
+
+// InsertReservation stores a reservation as is, skipping availability checks. Useful to arrange test fixtures.
+func (s *Store) InsertReservation(res *db.Reservation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.insertLocked(res)
+}
+
+// Reservation returns a copy of the stored reservation with the given code, or nil.
+func (s *Store) Reservation(code string) *db.Reservation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := s.byCodeLocked(code)
+	if res == nil {
+		return nil
+	}
+	cp := *res
+	return &cp
+}
+
+func (s *Store) insertLocked(res *db.Reservation) {
+	res.ID = s.nextReservationID
+	s.nextReservationID++
+	now := time.Now().UTC()
+	if res.CreatedAt.IsZero() {
+		res.CreatedAt = now
+	}
+	if res.UpdatedAt.IsZero() {
+		res.UpdatedAt = now
+	}
+	if res.Status == "" {
+		res.Status = "active"
+	}
+	cp := *res
+	s.reservations = append(s.reservations, &cp)
+}
+
+func (s *Store) byCodeLocked(code string) *db.Reservation {
+	for _, res := range s.reservations {
+		if res.Code == code {
+			return res
+		}
+	}
+	return nil
+}
+
+func (s *Store) byIDLocked(id int) *db.Reservation {
+	for _, res := range s.reservations {
+		if res.ID == id {
+			return res
+		}
+	}
+	return nil
+}
+
+func (s *Store) vehicleTypeLocked(id int) (vehicleType, bool) {
+	for _, vt := range s.vehicleTypes {
+		if vt.ID == id {
+			return vt, true
+		}
+	}
+	return vehicleType{}, false
+}
+
+func (s *Store) vehicleTypeByNameLocked(name string) (*vehicleType, bool) {
+	for i := range s.vehicleTypes {
+		if s.vehicleTypes[i].Name == name {
+			return &s.vehicleTypes[i], true
+		}
+	}
+	return nil, false
+}
+
+func (s *Store) poolByNameLocked(name string) *db.SpacePool {
+	for _, pool := range s.pools {
+		if pool.Name == name {
+			return pool
+		}
+	}
+	return nil
+}
+
+func notFound(what string) error {
+	return fmt.Errorf("%s not found: %w", what, sql.ErrNoRows)
+}
+
+// ReservationRepository
+
+func (s *Store) GetPrices() ([]entities.PriceResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var prices []entities.PriceResponse
+	for key, price := range s.prices {
+		vt, ok := s.vehicleTypeLocked(key.VehicleTypeID)
+		if !ok {
+			continue
+		}
+		prices = append(prices, entities.PriceResponse{
+			VehicleType:     vt.Name,
+			ReservationTime: s.reservationTimes[key.ReservationTimeID],
+			Price:           price,
+		})
+	}
+	sort.Slice(prices, func(i, j int) bool {
+		if prices[i].VehicleType != prices[j].VehicleType {
+			return prices[i].VehicleType < prices[j].VehicleType
+		}
+		return prices[i].ReservationTime < prices[j].ReservationTime
+	})
+	return prices, nil
+}
+
+func (s *Store) GetVehicleTypes() ([]db.VehicleType, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var types []db.VehicleType
+	for _, vt := range s.vehicleTypes {
+		types = append(types, db.VehicleType{ID: vt.ID, Name: vt.Name})
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return types, nil
+}
+
+func (s *Store) GetHourlyAvailabilityDetails(startTime, endTime time.Time, vehicleTypeID int, holdSince time.Time, excludeReservationID int) ([]repository.SlotOccupationInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.availabilityLocked(startTime, endTime, vehicleTypeID, holdSince, excludeReservationID)
+}
+
+// availabilityLocked mirrors the hourly availability query: one slot per hour, counting active, checked-in and
+// overstaying reservations and pending ones created after holdSince or with a payment in progress, of every vehicle type in the
+// same pool.
+func (s *Store) availabilityLocked(startTime, endTime time.Time, vehicleTypeID int, holdSince time.Time, excludeReservationID int) ([]repository.SlotOccupationInfo, error) {
+	if !endTime.After(startTime) {
+		return nil, fmt.Errorf("end time must be after start time")
+	}
+	vt, ok := s.vehicleTypeLocked(vehicleTypeID)
+	pool := s.pools[vt.PoolID]
+	if !ok || pool == nil {
+		return nil, fmt.Errorf("vehicle type %d is not assigned to a space pool", vehicleTypeID)
+	}
+
+	now := time.Now().UTC()
+	var slots []repository.SlotOccupationInfo
+	for slotStart := startTime; !slotStart.After(endTime.Add(-time.Hour)); slotStart = slotStart.Add(time.Hour) {
+		slot := repository.SlotOccupationInfo{
+			SlotStart:   slotStart,
+			SlotEnd:     slotStart.Add(time.Hour),
+			TotalSpaces: pool.Spaces,
+		}
+		for _, res := range s.reservations {
+			resType, _ := s.vehicleTypeLocked(res.VehicleTypeID)
+			if res.ID == excludeReservationID || resType.PoolID != pool.ID || !holdsSpace(res, holdSince) {
+				continue
+			}
+			stillParked := (res.Status == "checked_in" || res.Status == "overstay") && slot.SlotStart.Before(now)
+			if res.StartTime.Before(slot.SlotEnd) && (res.EndTime.After(slot.SlotStart) || stillParked) {
+				slot.BookedSpaces++
+			}
+		}
+		slots = append(slots, slot)
+	}
+	return slots, nil
+}
+
+func holdsSpace(res *db.Reservation, holdSince time.Time) bool {
+	return res.Status == "active" || res.Status == "checked_in" || res.Status == "overstay" || res.Status == "canceling" ||
+		(res.Status == "pending" && (res.CreatedAt.After(holdSince) || res.PaymentStatus.String == "processing"))
+}
+
+func (s *Store) GetPriceForUnit(vehicleTypeID int, reservationTimeID int) (money.Amount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	price, ok := s.prices[priceKey{vehicleTypeID, reservationTimeID}]
+	if !ok {
+		return 0, fmt.Errorf("no price configured for vehicle_type_id %d and reservation_time_id %d", vehicleTypeID, reservationTimeID)
+	}
+	return price, nil
+}
+
+func (s *Store) CreateReservationIfAvailable(res *db.Reservation, holdSince time.Time, notify func(*db.Reservation) []db.Notification) ([]repository.SlotOccupationInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for res.Code == "" || s.byCodeLocked(res.Code) != nil {
+		code, err := reservationcode.New()
+		if err != nil {
+			return nil, err
+		}
+		res.Code = code
+	}
+	end := res.EndTime
+	if end.IsZero() {
+		end = res.StartTime.Add(time.Hour)
+	}
+	slots, err := s.availabilityLocked(res.StartTime, end, res.VehicleTypeID, holdSince, 0)
+	if err != nil {
+		return nil, err
+	}
+	var conflicts []repository.SlotOccupationInfo
+	for _, slot := range slots {
+		if slot.TotalSpaces-slot.BookedSpaces <= 0 {
+			conflicts = append(conflicts, slot)
+		}
+	}
+	if len(conflicts) > 0 {
+		return conflicts, nil
+	}
+	if res.PromoCodeID.Valid {
+		if err := s.checkPromoRedemptionsLocked(res); err != nil {
+			return nil, err
+		}
+	}
+	s.insertLocked(res)
+	if notify != nil {
+		s.queueLocked(res.ID, notify(res))
+	}
+	return nil, nil
+}
+
+func (s *Store) GetReservationByCode(code, email string) (*entities.ReservationResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := s.byCodeLocked(code)
+	if res == nil || !strings.EqualFold(res.UserEmail, email) {
+		return nil, notFound(fmt.Sprintf("reservation with code '%s' and email '%s'", code, email))
+	}
+	return s.toResponseLocked(res), nil
+}
+
+func (s *Store) ListReservationsByEmail(email string) ([]entities.ReservationResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var matched []*db.Reservation
+	for _, res := range s.reservations {
+		if strings.EqualFold(res.UserEmail, email) {
+			matched = append(matched, res)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].StartTime.Equal(matched[j].StartTime) {
+			return matched[i].StartTime.After(matched[j].StartTime)
+		}
+		return matched[i].ID > matched[j].ID
+	})
+	reservations := []entities.ReservationResponse{}
+	for _, res := range matched {
+		reservations = append(reservations, *s.toResponseLocked(res))
+	}
+	return reservations, nil
+}
+
+func (s *Store) ClaimCancellation(code string, refundAmount money.Amount) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := s.byCodeLocked(code)
+	if res == nil || res.Status == "canceled" || res.Status == "canceling" {
+		return "", repository.ErrNotCancelable
+	}
+	previous := res.Status
+	res.Status = "canceling"
+	res.RefundedAmount += refundAmount
+	res.UpdatedAt = time.Now().UTC()
+	return previous, nil
+}
+
+func (s *Store) SettleCancellation(code, status string, unrefunded money.Amount, notifications []db.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := s.byCodeLocked(code)
+	if res == nil || res.Status != "canceling" {
+		return nil
+	}
+	res.Status = status
+	res.RefundedAmount -= unrefunded
+	res.UpdatedAt = time.Now().UTC()
+	s.queueLocked(res.ID, notifications)
+	return nil
+}
+
+func (s *Store) GetReservationByCodeOnly(code string) (*db.Reservation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := s.byCodeLocked(code)
+	if res == nil {
+		return nil, notFound(fmt.Sprintf("reservation with code '%s'", code))
+	}
+	cp := *res
+	return &cp, nil
+}
+
+func (s *Store) GetReservationByStripeSessionID(sessionID string) (*db.Reservation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, res := range s.reservations {
+		if res.StripeSessionID.Valid && res.StripeSessionID.String == sessionID {
+			cp := *res
+			return &cp, nil
+		}
+	}
+	return nil, notFound(fmt.Sprintf("reservation with sessionID '%s'", sessionID))
+}
+
+func (s *Store) UpdateReservationAndPaymentStatus(reservationID int, reservationStatus, paymentStatus string, notifications []db.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := s.byIDLocked(reservationID)
+	if res == nil {
+		return nil
+	}
+	res.Status = reservationStatus
+	res.PaymentStatus = sql.NullString{String: paymentStatus, Valid: true}
+	res.UpdatedAt = time.Now().UTC()
+	s.queueLocked(res.ID, notifications)
+	return nil
+}
+
+func (s *Store) UpdatePaymentStatus(reservationID int, paymentStatus string, notifications []db.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := s.byIDLocked(reservationID)
+	if res == nil {
+		return nil
+	}
+	res.PaymentStatus = sql.NullString{String: paymentStatus, Valid: true}
+	res.UpdatedAt = time.Now().UTC()
+	s.queueLocked(res.ID, notifications)
+	return nil
+}
+
+func (s *Store) UpdateReservationStatusPaymentAndIntent(reservationID int, reservationStatus, paymentStatus, paymentIntentID string, notifications []db.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := s.byIDLocked(reservationID)
+	if res == nil {
+		return nil
+	}
+	res.Status = reservationStatus
+	res.PaymentStatus = sql.NullString{String: paymentStatus, Valid: true}
+	res.StripePaymentIntentID = sql.NullString{String: paymentIntentID, Valid: true}
+	res.UpdatedAt = time.Now().UTC()
+	s.queueLocked(res.ID, notifications)
+	return nil
+}
+
+func (s *Store) UpdateReservationStripeSession(reservationID int, sessionID, paymentStatus string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := s.byIDLocked(reservationID)
+	if res == nil {
+		return nil
+	}
+	res.StripeSessionID = sql.NullString{String: sessionID, Valid: true}
+	res.PaymentStatus = sql.NullString{String: paymentStatus, Valid: true}
+	res.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+func (s *Store) toResponseLocked(res *db.Reservation) *entities.ReservationResponse {
+	vt, _ := s.vehicleTypeLocked(res.VehicleTypeID)
+	resp := &entities.ReservationResponse{
+		Code:              res.Code,
+		UserName:          res.UserName,
+		UserEmail:         res.UserEmail,
+		UserPhone:         res.UserPhone.String,
+		VehicleTypeID:     res.VehicleTypeID,
+		VehicleTypeName:   vt.Name,
+		VehiclePlate:      res.VehiclePlate.String,
+		VehicleModel:      res.VehicleModel.String,
+		PaymentMethodID:   res.PaymentMethodID,
+		PaymentMethodName: s.paymentMethods[res.PaymentMethodID],
+		StripeSessionID:   res.StripeSessionID.String,
+		PaymentStatus:     res.PaymentStatus.String,
+		Status:            res.Status,
+		Language:          res.Language,
+		StartTime:         res.StartTime,
+		WalkIn:            res.WalkIn,
+		CreatedAt:         res.CreatedAt,
+		UpdatedAt:         res.UpdatedAt,
+		TotalPrice:        res.TotalPrice,
+		DepositPayment:    res.DepositPayment,
+		RefundedAmount:    res.RefundedAmount,
+		OverstayFee:       res.OverstayFee,
+		DiscountAmount:    res.DiscountAmount,
+	}
+	if promo := s.promoByIDLocked(int(res.PromoCodeID.Int64)); res.PromoCodeID.Valid && promo != nil {
+		resp.PromoCode = promo.Code
+	}
+	if !res.EndTime.IsZero() {
+		end := res.EndTime
+		resp.EndTime = &end
+	}
+	if res.CheckedInAt.Valid {
+		resp.CheckedInAt = &res.CheckedInAt.Time
+	}
+	if res.CheckedOutAt.Valid {
+		resp.CheckedOutAt = &res.CheckedOutAt.Time
+	}
+	resp.SetAmountPaid(s.netPaidLocked(res.ID))
+	return resp
+}
+
+// AdminRepository
+
+func (s *Store) ListReservationsWithFilters(startTime, endTime, code, vehicleType, status, limit, offset string) (entities.ReservationsList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list entities.ReservationsList
+	loc, _ := time.LoadLocation("Europe/Rome")
+
+	var startFrom, startTo, endFrom, endTo time.Time
+	if startTime != "" {
+		day, err := time.ParseInLocation("2006-01-02", startTime, loc)
+		if err != nil {
+			return list, err
+		}
+		startFrom, startTo = day.UTC(), day.Add(24*time.Hour).UTC()
+	}
+	if endTime != "" {
+		day, err := time.ParseInLocation("2006-01-02", endTime, loc)
+		if err != nil {
+			return list, err
+		}
+		endFrom, endTo = day.UTC(), day.Add(24*time.Hour).UTC()
+	}
+
+	var matches []*db.Reservation
+	for _, res := range s.reservations {
+		switch {
+		case startTime != "" && endTime != "":
+			if res.StartTime.Before(startFrom) || !res.EndTime.Before(endTo) {
+				continue
+			}
+		case startTime != "":
+			if res.StartTime.Before(startFrom) || !res.StartTime.Before(startTo) {
+				continue
+			}
+		case endTime != "":
+			if res.EndTime.Before(endFrom) || !res.EndTime.Before(endTo) {
+				continue
+			}
+		}
+		if code != "" && !strings.Contains(res.Code, code) {
+			continue
+		}
+		if vehicleType != "" {
+			vt, _ := s.vehicleTypeLocked(res.VehicleTypeID)
+			if vt.Name != vehicleType {
+				continue
+			}
+		}
+		if status != "" && res.Status != status {
+			continue
+		}
+		matches = append(matches, res)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		switch {
+		case startTime != "":
+			return matches[i].StartTime.After(matches[j].StartTime)
+		case endTime != "":
+			return matches[i].EndTime.After(matches[j].EndTime)
+		default:
+			return matches[i].CreatedAt.After(matches[j].CreatedAt)
+		}
+	})
+
+	list.Total = int64(len(matches))
+	list.Limit, _ = strconv.Atoi(limit)
+	list.Offset, _ = strconv.Atoi(offset)
+	if list.Offset < len(matches) {
+		matches = matches[list.Offset:]
+	} else {
+		matches = nil
+	}
+	if limit != "" && list.Limit < len(matches) {
+		matches = matches[:list.Limit]
+	}
+	for _, res := range matches {
+		list.Reservations = append(list.Reservations, *s.toResponseLocked(res))
+	}
+	return list, nil
+}
+
+func (s *Store) FindReservationByCode(code string) (*entities.ReservationResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := s.byCodeLocked(code)
+	if res == nil {
+		return nil, notFound(fmt.Sprintf("reservation with code '%s'", code))
+	}
+	return s.toResponseLocked(res), nil
+}
+
+func (s *Store) ListVehicleSpaces() ([]db.VehicleSpaceWithPrices, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []db.VehicleSpaceWithPrices
+	for _, vt := range s.vehicleTypes {
+		pool := s.pools[vt.PoolID]
+		if pool == nil {
+			continue
+		}
+		prices := map[string]money.Amount{}
+		for key, price := range s.prices {
+			if key.VehicleTypeID == vt.ID {
+				prices[s.reservationTimes[key.ReservationTimeID]] = price
+			}
+		}
+		result = append(result, db.VehicleSpaceWithPrices{
+			VehicleType: vt.Name,
+			SpacePool:   pool.Name,
+			Spaces:      pool.Spaces,
+			Prices:      prices,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].VehicleType < result[j].VehicleType })
+	return result, nil
+}
+
+func (s *Store) UpdateVehicleSpaces(vehicleType string, spaces int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vt, ok := s.vehicleTypeByNameLocked(vehicleType)
+	if !ok || s.pools[vt.PoolID] == nil {
+		return notFound(fmt.Sprintf("vehicle type '%s'", vehicleType))
+	}
+	s.pools[vt.PoolID].Spaces = spaces
+	return nil
+}
+
+func (s *Store) UpdateVehiclePrice(vehicleType string, timeName string, price money.Amount) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vt, ok := s.vehicleTypeByNameLocked(vehicleType)
+	if !ok {
+		return notFound(fmt.Sprintf("vehicle type '%s'", vehicleType))
+	}
+	for id, name := range s.reservationTimes {
+		if name == timeName {
+			s.prices[priceKey{vt.ID, id}] = price
+			return nil
+		}
+	}
+	return notFound(fmt.Sprintf("reservation time '%s'", timeName))
+}
+
+func (s *Store) ListSpacePools() ([]db.SpacePool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pools []db.SpacePool
+	for _, pool := range s.pools {
+		cp := *pool
+		cp.VehicleTypes = []string{}
+		for _, vt := range s.vehicleTypes {
+			if vt.PoolID == pool.ID {
+				cp.VehicleTypes = append(cp.VehicleTypes, vt.Name)
+			}
+		}
+		sort.Strings(cp.VehicleTypes)
+		pools = append(pools, cp)
+	}
+	sort.Slice(pools, func(i, j int) bool { return pools[i].Name < pools[j].Name })
+	return pools, nil
+}
+
+func (s *Store) CreateSpacePool(name string, spaces int) (*db.SpacePool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.poolByNameLocked(name) != nil {
+		return nil, fmt.Errorf("space pool '%s' already exists", name)
+	}
+	id := s.addPoolLocked(name, spaces)
+	return &db.SpacePool{ID: id, Name: name, Spaces: spaces, VehicleTypes: []string{}}, nil
+}
+
+func (s *Store) AssignVehicleTypeToPool(vehicleType, poolName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vt, ok := s.vehicleTypeByNameLocked(vehicleType)
+	pool := s.poolByNameLocked(poolName)
+	if !ok || pool == nil {
+		return notFound(fmt.Sprintf("vehicle type '%s' or space pool '%s'", vehicleType, poolName))
+	}
+	vt.PoolID = pool.ID
+	return nil
+}
+
+// JobRepository
+
+func (s *Store) GetReservationIDsPastEndTime(status string) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	var ids []int
+	for _, res := range s.reservations {
+		if res.Status == status && !res.EndTime.IsZero() && res.EndTime.Before(now) && !res.CheckedOutAt.Valid {
+			ids = append(ids, res.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (s *Store) UpdateReservationStatuses(ids []int, newStatus string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	for _, id := range ids {
+		if res := s.byIDLocked(id); res != nil {
+			res.Status = newStatus
+			res.UpdatedAt = now
+		}
+	}
+	return nil
+}
+
+func (s *Store) DeletePendingReservationsOlderThan(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var kept []*db.Reservation
+	var deleted int64
+	for _, res := range s.reservations {
+		if res.Status == "pending" && res.CreatedAt.Before(before) && res.PaymentStatus.String != "processing" &&
+			!s.hasPaymentsLocked(res.ID) {
+			deleted++
+			continue
+		}
+		kept = append(kept, res)
+	}
+	s.reservations = kept
+	return deleted, nil
+}
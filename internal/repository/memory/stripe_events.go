@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"database/sql"
+	"estacionamienti/internal/db"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type stripeEvent struct {
+	db.StripeEvent
+	updatedAt time.Time
+}
+
+// stripeEventStaleAfter mirrors the repository: a processing event older than this may be taken over.
+const stripeEventStaleAfter = 5 * time.Minute
+
+func (s *Store) stripeEventLocked(id string) *stripeEvent {
+	for _, evt := range s.stripeEvents {
+		if evt.ID == id {
+			return evt
+		}
+	}
+	return nil
+}
+
+func (s *Store) ClaimStripeEvent(evt *db.StripeEvent) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	existing := s.stripeEventLocked(evt.ID)
+	if existing == nil {
+		stored := &stripeEvent{StripeEvent: *evt, updatedAt: now}
+		stored.Status = "processing"
+		stored.Attempts = 1
+		stored.ReceivedAt = now
+		s.stripeEvents = append(s.stripeEvents, stored)
+		evt.Attempts = 1
+		return true, nil
+	}
+	stale := existing.Status == "processing" && existing.updatedAt.Before(now.Add(-stripeEventStaleAfter))
+	if existing.Status != "failed" && !stale {
+		return false, nil
+	}
+	existing.Status = "processing"
+	existing.Attempts++
+	existing.updatedAt = now
+	evt.Attempts = existing.Attempts
+	return true, nil
+}
+
+func (s *Store) FinishStripeEvent(id, status, result, reservationCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	evt := s.stripeEventLocked(id)
+	if evt == nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	evt.Status = status
+	evt.Result = sql.NullString{String: result, Valid: true}
+	if reservationCode != "" {
+		evt.ReservationCode = sql.NullString{String: reservationCode, Valid: true}
+	}
+	evt.ProcessedAt = sql.NullTime{Time: now, Valid: true}
+	evt.updatedAt = now
+	return nil
+}
+
+func (s *Store) GetStripeEvent(id string) (*db.StripeEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	evt := s.stripeEventLocked(id)
+	if evt == nil {
+		return nil, notFound(fmt.Sprintf("stripe event '%s'", id))
+	}
+	cp := evt.StripeEvent
+	return &cp, nil
+}
+
+func (s *Store) ListStripeEventsByReservation(code string) ([]db.StripeEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []db.StripeEvent
+	for _, evt := range s.stripeEvents {
+		if evt.ReservationCode.String == code {
+			out = append(out, evt.StripeEvent)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].StripeCreatedAt.Before(out[j].StripeCreatedAt) })
+	return out, nil
+}
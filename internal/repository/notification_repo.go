@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"database/sql"
+	"estacionamienti/internal/db"
+	"fmt"
+	"time"
+)
+
+type NotificationRepository interface {
+	ClaimDueNotifications(now time.Time, lease time.Duration, limit int) ([]db.Notification, error)
+	MarkNotificationSent(id int, sentAt time.Time) error
+	MarkNotificationRetry(id int, attempts int, nextAttemptAt time.Time, lastError string) error
+	MarkNotificationFailed(id int, attempts int, lastError string) error
+	ListFailedNotifications(code string) ([]db.Notification, error)
+	RequeueFailedNotifications(code string) (int64, error)
+}
+
+type notificationRepository struct {
+	DB *sql.DB
+}
+
+func NewNotificationRepository(db *sql.DB) NotificationRepository {
+	return &notificationRepository{DB: db}
+}
+
+const notificationColumns = `id, reservation_id, reservation_code, channel, recipient, recipient_name, subject, body, html_body,
+	status, attempts, next_attempt_at, last_error, sent_at, created_at, updated_at`
+
+// insertNotifications queues notifications for a reservation, inside the caller's transaction.
+func insertNotifications(q queryer, reservationID int, notifications []db.Notification) error {
+	query := `
+		INSERT INTO notifications
+		(reservation_id, reservation_code, channel, recipient, recipient_name, subject, body, html_body)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	for _, n := range notifications {
+		_, err := q.Exec(query, reservationID, n.ReservationCode, n.Channel, n.Recipient, n.RecipientName, n.Subject, n.Body, n.HTMLBody)
+		if err != nil {
+			return fmt.Errorf("error queuing %s notification for reservation %s: %w", n.Channel, n.ReservationCode, err)
+		}
+	}
+	return nil
+}
+
+// ClaimDueNotifications picks pending notifications whose next attempt is due and pushes that attempt lease into the
+// future, so another worker instance won't pick them up while they are being delivered.
+func (r *notificationRepository) ClaimDueNotifications(now time.Time, lease time.Duration, limit int) ([]db.Notification, error) {
+	query := `
+		UPDATE notifications
+		SET next_attempt_at = $2, updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM notifications
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + notificationColumns
+	rows, err := r.DB.Query(query, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming notifications: %w", err)
+	}
+	return scanNotifications(rows)
+}
+
+func (r *notificationRepository) MarkNotificationSent(id int, sentAt time.Time) error {
+	query := `
+		UPDATE notifications
+		SET status = 'sent', attempts = attempts + 1, sent_at = $2, last_error = NULL, updated_at = NOW()
+		WHERE id = $1`
+	_, err := r.DB.Exec(query, id, sentAt)
+	return err
+}
+
+func (r *notificationRepository) MarkNotificationRetry(id int, attempts int, nextAttemptAt time.Time, lastError string) error {
+	query := `
+		UPDATE notifications
+		SET attempts = $2, next_attempt_at = $3, last_error = $4, updated_at = NOW()
+		WHERE id = $1`
+	_, err := r.DB.Exec(query, id, attempts, nextAttemptAt, lastError)
+	return err
+}
+
+// MarkNotificationFailed dead-letters a notification; it is only retried again if an admin requeues it.
+func (r *notificationRepository) MarkNotificationFailed(id int, attempts int, lastError string) error {
+	query := `
+		UPDATE notifications
+		SET status = 'failed', attempts = $2, last_error = $3, updated_at = NOW()
+		WHERE id = $1`
+	_, err := r.DB.Exec(query, id, attempts, lastError)
+	return err
+}
+
+// ListFailedNotifications returns dead-lettered notifications, newest first, optionally for one reservation code.
+func (r *notificationRepository) ListFailedNotifications(code string) ([]db.Notification, error) {
+	query := `SELECT ` + notificationColumns + ` FROM notifications
+		WHERE status = 'failed' AND ($1 = '' OR reservation_code = $1)
+		ORDER BY updated_at DESC`
+	rows, err := r.DB.Query(query, code)
+	if err != nil {
+		return nil, fmt.Errorf("error listing failed notifications: %w", err)
+	}
+	return scanNotifications(rows)
+}
+
+// RequeueFailedNotifications puts the failed notifications of a reservation back in the queue with fresh attempts.
+func (r *notificationRepository) RequeueFailedNotifications(code string) (int64, error) {
+	query := `
+		UPDATE notifications
+		SET status = 'pending', attempts = 0, next_attempt_at = NOW(), updated_at = NOW()
+		WHERE status = 'failed' AND reservation_code = $1`
+	result, err := r.DB.Exec(query, code)
+	if err != nil {
+		return 0, fmt.Errorf("error requeuing notifications for reservation %s: %w", code, err)
+	}
+	return result.RowsAffected()
+}
+
+func scanNotifications(rows *sql.Rows) ([]db.Notification, error) {
+	defer rows.Close()
+	var notifications []db.Notification
+	for rows.Next() {
+		var n db.Notification
+		err := rows.Scan(&n.ID, &n.ReservationID, &n.ReservationCode, &n.Channel, &n.Recipient, &n.RecipientName, &n.Subject,
+			&n.Body, &n.HTMLBody, &n.Status, &n.Attempts, &n.NextAttemptAt, &n.LastError, &n.SentAt, &n.CreatedAt, &n.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning notification: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
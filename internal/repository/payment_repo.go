@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"estacionamienti/internal/db"
+	"fmt"
+)
+
+type PaymentRepository interface {
+	RecordPayment(p *db.Payment) (bool, error)
+	ListPaymentsByReservation(reservationID int) ([]db.Payment, error)
+}
+
+type paymentRepository struct {
+	DB *sql.DB
+}
+
+func NewPaymentRepository(db *sql.DB) PaymentRepository {
+	return &paymentRepository{DB: db}
+}
+
+// paymentsNetPaidSQL is what a reservation r has paid so far according to its ledger.
+const paymentsNetPaidSQL = `COALESCE((SELECT SUM(CASE WHEN p.kind = 'refund' THEN -p.amount ELSE p.amount END)
+		FROM payments p WHERE p.reservation_id = r.id), 0)`
+
+// RecordPayment adds an entry to the ledger and reports whether it was new. Entries with an ExternalID already in
+// the ledger, such as a Stripe refund seen both by the cancellation and by its webhook, are skipped.
+func (r *paymentRepository) RecordPayment(p *db.Payment) (bool, error) {
+	return insertPayment(r.DB, p)
+}
+
+func insertPayment(q queryer, p *db.Payment) (bool, error) {
+	query := `
+		INSERT INTO payments (reservation_id, reservation_code, kind, amount, method, external_id, note, recorded_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (external_id) DO NOTHING
+		RETURNING id, created_at`
+	err := q.QueryRow(query, p.ReservationID, p.ReservationCode, p.Kind, p.Amount, p.Method, p.ExternalID, p.Note, p.RecordedBy).
+		Scan(&p.ID, &p.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error recording %s for reservation %s: %w", p.Kind, p.ReservationCode, err)
+	}
+	return true, nil
+}
+
+// ListPaymentsByReservation returns the ledger of a reservation, oldest first.
+func (r *paymentRepository) ListPaymentsByReservation(reservationID int) ([]db.Payment, error) {
+	query := `
+		SELECT id, reservation_id, reservation_code, kind, amount, method, external_id, note, recorded_by, created_at
+		FROM payments
+		WHERE reservation_id = $1
+		ORDER BY created_at, id`
+	rows, err := r.DB.Query(query, reservationID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing payments: %w", err)
+	}
+	defer rows.Close()
+
+	var payments []db.Payment
+	for rows.Next() {
+		var p db.Payment
+		err := rows.Scan(&p.ID, &p.ReservationID, &p.ReservationCode, &p.Kind, &p.Amount, &p.Method, &p.ExternalID, &p.Note,
+			&p.RecordedBy, &p.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning payment: %w", err)
+		}
+		payments = append(payments, p)
+	}
+	return payments, rows.Err()
+}
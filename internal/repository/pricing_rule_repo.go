@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/money"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+const pricingRuleColumns = `id, name, vehicle_type_id, COALESCE(to_char(start_date, 'YYYY-MM-DD'), ''),
+	COALESCE(to_char(end_date, 'YYYY-MM-DD'), ''), weekdays, start_hour, end_hour, multiplier, hourly_price, priority`
+
+type PricingRepository interface {
+	GetPrices() ([]entities.PriceResponse, error)
+	GetPriceForUnit(vehicleTypeID int, reservationTimeID int) (money.Amount, error)
+	GetPricingRules(vehicleTypeID int) ([]db.PricingRule, error)
+}
+
+type pricingRepository struct {
+	DB *sql.DB
+}
+
+func NewPricingRepository(db *sql.DB) PricingRepository {
+	return &pricingRepository{DB: db}
+}
+
+func (r *pricingRepository) GetPrices() ([]entities.PriceResponse, error) {
+	query := `
+	SELECT vt.name as vehicle_type, rt.name as reservation_time, vp.price
+	FROM vehicle_prices vp
+	JOIN vehicle_types vt ON vp.vehicle_type_id = vt.id
+	JOIN reservation_times rt ON vp.reservation_time_id = rt.id
+	ORDER BY vt.name, rt.name
+	`
+
+	rows, err := r.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prices []entities.PriceResponse
+	for rows.Next() {
+		var p entities.PriceResponse
+		if err := rows.Scan(&p.VehicleType, &p.ReservationTime, &p.Price); err != nil {
+			return nil, err
+		}
+		prices = append(prices, p)
+	}
+
+	return prices, nil
+}
+
+func (r *pricingRepository) GetPriceForUnit(vehicleTypeID int, reservationTimeID int) (money.Amount, error) {
+	var price money.Amount
+	err := r.DB.QueryRow(`SELECT price FROM vehicle_prices WHERE vehicle_type_id = $1 AND reservation_time_id = $2`, vehicleTypeID, reservationTimeID).Scan(&price)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("no price configured for vehicle_type_id %d and reservation_time_id %d", vehicleTypeID, reservationTimeID)
+		}
+		return 0, err
+	}
+	return price, nil
+}
+
+// GetPricingRules returns the rules that apply to the vehicle type, including those for every type.
+func (r *pricingRepository) GetPricingRules(vehicleTypeID int) ([]db.PricingRule, error) {
+	rows, err := r.DB.Query(`SELECT `+pricingRuleColumns+` FROM pricing_rules
+		WHERE vehicle_type_id IS NULL OR vehicle_type_id = $1 ORDER BY id`, vehicleTypeID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying pricing rules: %w", err)
+	}
+	return scanPricingRules(rows)
+}
+
+// ListPricingRules returns every pricing rule, the highest priority first.
+func (r *adminRepository) ListPricingRules() ([]db.PricingRule, error) {
+	rows, err := r.DB.Query(`SELECT ` + pricingRuleColumns + ` FROM pricing_rules ORDER BY priority DESC, id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanPricingRules(rows)
+}
+
+func (r *adminRepository) CreatePricingRule(rule *db.PricingRule) error {
+	weekdays := make([]int64, len(rule.Weekdays))
+	for i, day := range rule.Weekdays {
+		weekdays[i] = int64(day)
+	}
+	query := `
+		INSERT INTO pricing_rules (name, vehicle_type_id, start_date, end_date, weekdays, start_hour, end_hour,
+		                           multiplier, hourly_price, priority)
+		VALUES ($1, $2, NULLIF($3, '')::date, NULLIF($4, '')::date, $5, $6, $7, $8, $9, $10)
+		RETURNING id`
+	return r.DB.QueryRow(query, rule.Name, rule.VehicleTypeID, rule.StartDate, rule.EndDate, pq.Array(weekdays),
+		rule.StartHour, rule.EndHour, rule.Multiplier, rule.HourlyPrice, rule.Priority).Scan(&rule.ID)
+}
+
+// DeletePricingRule removes the rule, reporting sql.ErrNoRows when it does not exist.
+func (r *adminRepository) DeletePricingRule(id int) error {
+	result, err := r.DB.Exec(`DELETE FROM pricing_rules WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("error deleting pricing rule %d: %w", id, err)
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return fmt.Errorf("pricing rule %d not found: %w", id, sql.ErrNoRows)
+	}
+	return nil
+}
+
+func scanPricingRules(rows *sql.Rows) ([]db.PricingRule, error) {
+	defer rows.Close()
+	var rules []db.PricingRule
+	for rows.Next() {
+		var rule db.PricingRule
+		var weekdays []int64
+		if err := rows.Scan(&rule.ID, &rule.Name, &rule.VehicleTypeID, &rule.StartDate, &rule.EndDate, pq.Array(&weekdays),
+			&rule.StartHour, &rule.EndHour, &rule.Multiplier, &rule.HourlyPrice, &rule.Priority); err != nil {
+			return nil, fmt.Errorf("error scanning pricing rule: %w", err)
+		}
+		for _, day := range weekdays {
+			rule.Weekdays = append(rule.Weekdays, int(day))
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"estacionamienti/internal/db"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrPromoCodeExhausted is returned when booking with a promo code that has no redemptions left, in total or for
+	// the reservation's email.
+	ErrPromoCodeExhausted = errors.New("promo code redemption limit reached")
+	// ErrPromoCodeInUse is returned when deleting a promo code some reservation was booked with.
+	ErrPromoCodeInUse = errors.New("promo code has been redeemed")
+)
+
+const promoCodeColumns = `id, code, description, percent_off, amount_off, valid_from, valid_until, vehicle_type_ids,
+	min_duration_hours, max_redemptions, max_redemptions_per_email, active, created_at`
+
+// promoRedemptionsSQL counts the reservations not canceled booked with promo code $1, and those of them made with
+// email $2.
+const promoRedemptionsSQL = `
+	SELECT COUNT(*), COUNT(*) FILTER (WHERE LOWER(user_email) = LOWER($2))
+	FROM reservations WHERE promo_code_id = $1 AND status <> 'canceled'`
+
+type PromoCodeRepository interface {
+	GetPromoCodeByCode(code string) (*db.PromoCode, error)
+	GetPromoCodeByID(id int) (*db.PromoCode, error)
+	CountPromoRedemptions(promoCodeID int, email string) (int, int, error)
+}
+
+type promoCodeRepository struct {
+	DB *sql.DB
+}
+
+func NewPromoCodeRepository(db *sql.DB) PromoCodeRepository {
+	return &promoCodeRepository{DB: db}
+}
+
+func (r *promoCodeRepository) GetPromoCodeByCode(code string) (*db.PromoCode, error) {
+	promo, err := scanPromoCode(r.DB.QueryRow(`SELECT `+promoCodeColumns+` FROM promo_codes WHERE code = $1`, code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("promo code '%s' not found: %w", code, err)
+		}
+		return nil, fmt.Errorf("error querying promo code: %w", err)
+	}
+	return promo, nil
+}
+
+func (r *promoCodeRepository) GetPromoCodeByID(id int) (*db.PromoCode, error) {
+	promo, err := scanPromoCode(r.DB.QueryRow(`SELECT `+promoCodeColumns+` FROM promo_codes WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("promo code %d not found: %w", id, err)
+		}
+		return nil, fmt.Errorf("error querying promo code: %w", err)
+	}
+	return promo, nil
+}
+
+// CountPromoRedemptions returns how many reservations not canceled were booked with the promo code, in total and with
+// the given email.
+func (r *promoCodeRepository) CountPromoRedemptions(promoCodeID int, email string) (int, int, error) {
+	var total, byEmail int
+	if err := r.DB.QueryRow(promoRedemptionsSQL, promoCodeID, email).Scan(&total, &byEmail); err != nil {
+		return 0, 0, fmt.Errorf("error counting redemptions of promo code %d: %w", promoCodeID, err)
+	}
+	return total, byEmail, nil
+}
+
+// checkPromoRedemptions locks the promo code of the reservation for the rest of the transaction, so concurrent
+// bookings with it are serialized, and returns ErrPromoCodeExhausted when it has no redemptions left.
+func checkPromoRedemptions(tx *sql.Tx, res *db.Reservation) error {
+	var maxRedemptions, maxPerEmail sql.NullInt64
+	err := tx.QueryRow(`SELECT max_redemptions, max_redemptions_per_email FROM promo_codes WHERE id = $1 FOR UPDATE`,
+		res.PromoCodeID.Int64).Scan(&maxRedemptions, &maxPerEmail)
+	if err != nil {
+		return fmt.Errorf("error locking promo code %d: %w", res.PromoCodeID.Int64, err)
+	}
+	var total, byEmail int64
+	if err := tx.QueryRow(promoRedemptionsSQL, res.PromoCodeID.Int64, res.UserEmail).Scan(&total, &byEmail); err != nil {
+		return fmt.Errorf("error counting redemptions of promo code %d: %w", res.PromoCodeID.Int64, err)
+	}
+	if (maxRedemptions.Valid && total >= maxRedemptions.Int64) || (maxPerEmail.Valid && byEmail >= maxPerEmail.Int64) {
+		return ErrPromoCodeExhausted
+	}
+	return nil
+}
+
+// ListPromoCodes returns every promo code with its redemptions and the discount given so far, the newest first.
+func (r *adminRepository) ListPromoCodes() ([]db.PromoCode, error) {
+	query := `
+		SELECT ` + promoCodeColumns + `,
+		       (SELECT COUNT(*) FROM reservations r WHERE r.promo_code_id = promo_codes.id AND r.status <> 'canceled'),
+		       (SELECT COALESCE(SUM(r.discount_amount), 0) FROM reservations r WHERE r.promo_code_id = promo_codes.id AND r.status <> 'canceled')
+		FROM promo_codes ORDER BY created_at DESC, id DESC`
+	rows, err := r.DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying promo codes: %w", err)
+	}
+	defer rows.Close()
+	var promos []db.PromoCode
+	for rows.Next() {
+		var promo db.PromoCode
+		if err := rows.Scan(append(promoCodeFields(&promo), &promo.Redemptions, &promo.DiscountGiven)...); err != nil {
+			return nil, fmt.Errorf("error scanning promo code: %w", err)
+		}
+		promos = append(promos, promo)
+	}
+	return promos, rows.Err()
+}
+
+func (r *adminRepository) CreatePromoCode(promo *db.PromoCode) error {
+	query := `
+		INSERT INTO promo_codes (code, description, percent_off, amount_off, valid_from, valid_until, vehicle_type_ids,
+		                         min_duration_hours, max_redemptions, max_redemptions_per_email, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, created_at`
+	return r.DB.QueryRow(query, promo.Code, promo.Description, promo.PercentOff, promo.AmountOff, promo.ValidFrom,
+		promo.ValidUntil, pq.Array(int64s(promo.VehicleTypeIDs)), promo.MinDurationHours, promo.MaxRedemptions,
+		promo.MaxRedemptionsPerEmail, promo.Active).Scan(&promo.ID, &promo.CreatedAt)
+}
+
+// UpdatePromoCode replaces every field of the promo code, reporting sql.ErrNoRows when it does not exist.
+// Reservations already booked with it keep their discount.
+func (r *adminRepository) UpdatePromoCode(promo *db.PromoCode) error {
+	query := `
+		UPDATE promo_codes
+		SET code = $2, description = $3, percent_off = $4, amount_off = $5, valid_from = $6, valid_until = $7,
+		    vehicle_type_ids = $8, min_duration_hours = $9, max_redemptions = $10, max_redemptions_per_email = $11, active = $12
+		WHERE id = $1
+		RETURNING created_at`
+	err := r.DB.QueryRow(query, promo.ID, promo.Code, promo.Description, promo.PercentOff, promo.AmountOff,
+		promo.ValidFrom, promo.ValidUntil, pq.Array(int64s(promo.VehicleTypeIDs)), promo.MinDurationHours,
+		promo.MaxRedemptions, promo.MaxRedemptionsPerEmail, promo.Active).Scan(&promo.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("promo code %d not found: %w", promo.ID, err)
+	}
+	return err
+}
+
+// DeletePromoCode removes a promo code no reservation was booked with. It reports sql.ErrNoRows when it does not
+// exist and ErrPromoCodeInUse when it was redeemed; those can only be deactivated.
+func (r *adminRepository) DeletePromoCode(id int) error {
+	var redeemed bool
+	err := r.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM reservations WHERE promo_code_id = $1)`, id).Scan(&redeemed)
+	if err != nil {
+		return fmt.Errorf("error checking redemptions of promo code %d: %w", id, err)
+	}
+	if redeemed {
+		return ErrPromoCodeInUse
+	}
+	result, err := r.DB.Exec(`DELETE FROM promo_codes WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("error deleting promo code %d: %w", id, err)
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return fmt.Errorf("promo code %d not found: %w", id, sql.ErrNoRows)
+	}
+	return nil
+}
+
+func scanPromoCode(row *sql.Row) (*db.PromoCode, error) {
+	var promo db.PromoCode
+	if err := row.Scan(promoCodeFields(&promo)...); err != nil {
+		return nil, err
+	}
+	return &promo, nil
+}
+
+// promoCodeFields are the scan destinations of promoCodeColumns.
+func promoCodeFields(promo *db.PromoCode) []interface{} {
+	return []interface{}{&promo.ID, &promo.Code, &promo.Description, &promo.PercentOff, &promo.AmountOff,
+		&promo.ValidFrom, &promo.ValidUntil, (*intArray)(&promo.VehicleTypeIDs), &promo.MinDurationHours,
+		&promo.MaxRedemptions, &promo.MaxRedemptionsPerEmail, &promo.Active, &promo.CreatedAt}
+}
+
+// intArray scans a Postgres INT[] into a []int.
+type intArray []int
+
+func (a *intArray) Scan(src interface{}) error {
+	var values pq.Int64Array
+	if err := values.Scan(src); err != nil {
+		return err
+	}
+	*a = nil
+	for _, v := range values {
+		*a = append(*a, int(v))
+	}
+	return nil
+}
+
+func int64s(values []int) []int64 {
+	out := make([]int64, len(values))
+	for i, v := range values {
+		out[i] = int64(v)
+	}
+	return out
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"database/sql"
+	"estacionamienti/internal/db"
+	"fmt"
+)
+
+type RefundPolicyRepository interface {
+	GetRefundPolicy(paymentMethodID int) ([]db.RefundTier, error)
+	ListRefundPolicy() ([]db.RefundTier, error)
+	ReplaceRefundPolicy(paymentMethodID int, tiers []db.RefundTier) error
+}
+
+type refundPolicyRepository struct {
+	DB *sql.DB
+}
+
+func NewRefundPolicyRepository(db *sql.DB) RefundPolicyRepository {
+	return &refundPolicyRepository{DB: db}
+}
+
+// GetRefundPolicy returns the refund tiers of a payment method, the longest notice first.
+func (r *refundPolicyRepository) GetRefundPolicy(paymentMethodID int) ([]db.RefundTier, error) {
+	query := `
+		SELECT id, payment_method_id, min_hours_before, refund_percent
+		FROM refund_policy_tiers
+		WHERE payment_method_id = $1
+		ORDER BY min_hours_before DESC`
+	rows, err := r.DB.Query(query, paymentMethodID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying refund policy: %w", err)
+	}
+	return scanRefundTiers(rows)
+}
+
+// ListRefundPolicy returns the refund tiers of every payment method.
+func (r *refundPolicyRepository) ListRefundPolicy() ([]db.RefundTier, error) {
+	query := `
+		SELECT id, payment_method_id, min_hours_before, refund_percent
+		FROM refund_policy_tiers
+		ORDER BY payment_method_id, min_hours_before DESC`
+	rows, err := r.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	return scanRefundTiers(rows)
+}
+
+// ReplaceRefundPolicy swaps the tiers of a payment method in one transaction.
+func (r *refundPolicyRepository) ReplaceRefundPolicy(paymentMethodID int, tiers []db.RefundTier) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM refund_policy_tiers WHERE payment_method_id = $1`, paymentMethodID); err != nil {
+		return err
+	}
+	for _, tier := range tiers {
+		_, err := tx.Exec(`INSERT INTO refund_policy_tiers (payment_method_id, min_hours_before, refund_percent) VALUES ($1, $2, $3)`,
+			paymentMethodID, tier.MinHoursBefore, tier.RefundPercent)
+		if err != nil {
+			return fmt.Errorf("error inserting refund tier: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func scanRefundTiers(rows *sql.Rows) ([]db.RefundTier, error) {
+	defer rows.Close()
+	var tiers []db.RefundTier
+	for rows.Next() {
+		var tier db.RefundTier
+		if err := rows.Scan(&tier.ID, &tier.PaymentMethodID, &tier.MinHoursBefore, &tier.RefundPercent); err != nil {
+			return nil, fmt.Errorf("error scanning refund tier: %w", err)
+		}
+		tiers = append(tiers, tier)
+	}
+	return tiers, rows.Err()
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"estacionamienti/internal/db"
+	"fmt"
+	"time"
+)
+
+const reservationChangeColumns = `id, reservation_id, reservation_code, start_time, end_time, vehicle_type_id, vehicle_plate, vehicle_model,
+	old_total_price, new_total_price, new_deposit_payment, new_discount_amount, amount_due, status, stripe_session_id, requested_by, created_at, updated_at`
+
+// ApplyReservationChange moves the reservation to the change's window and vehicle if every hour of it still has a
+// free space, not counting the reservation itself, and records the change as applied, or as refund_pending when it
+// owes the customer a refund (a negative AmountDue) until the refund is issued. The check runs under the same
+// per-pool lock as new bookings. An overstaying reservation goes back to checked in, or active if it never was. When the pool is full nothing
+// changes and the slots without free spaces are returned; a reservation that is no longer active is reported as
+// sql.ErrNoRows. The given notifications are queued in the same transaction.
+func (r *reservationRepository) ApplyReservationChange(change *db.ReservationChange, holdSince time.Time, notifications []db.Notification) ([]SlotOccupationInfo, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting reservation change transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	conflicts, err := lockPoolAndFindConflicts(tx, change.VehicleTypeID, change.StartTime, change.EndTime, holdSince, change.ReservationID)
+	if err != nil || len(conflicts) > 0 {
+		return conflicts, err
+	}
+
+	query := `
+		UPDATE reservations
+		SET start_time = $2, end_time = $3, vehicle_type_id = $4, vehicle_plate = $5, vehicle_model = $6,
+		    total_price = $7, deposit_payment = $8, discount_amount = $9, updated_at = NOW(),
+		    status = CASE WHEN status = 'overstay' AND checked_in_at IS NOT NULL THEN 'checked_in'
+		                  WHEN status = 'overstay' THEN 'active' ELSE status END
+		WHERE id = $1 AND status IN ('active', 'checked_in', 'overstay')`
+	result, err := tx.Exec(query, change.ReservationID, change.StartTime, change.EndTime, change.VehicleTypeID,
+		change.VehiclePlate, change.VehicleModel, change.NewTotalPrice, change.NewDepositPayment, change.NewDiscount)
+	if err != nil {
+		return nil, fmt.Errorf("error updating reservation %s: %w", change.ReservationCode, err)
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if updated == 0 {
+		return nil, fmt.Errorf("active reservation %s not found: %w", change.ReservationCode, sql.ErrNoRows)
+	}
+
+	change.Status = "applied"
+	if change.AmountDue < 0 {
+		change.Status = "refund_pending"
+	}
+	if change.ID == 0 {
+		err = insertReservationChange(tx, change)
+	} else {
+		_, err = tx.Exec(`UPDATE reservation_changes SET status = $2, updated_at = NOW() WHERE id = $1`, change.ID, change.Status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error recording change of reservation %s: %w", change.ReservationCode, err)
+	}
+	if err := insertNotifications(tx, change.ReservationID, notifications); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing reservation change: %w", err)
+	}
+	return nil, nil
+}
+
+// CreateReservationChange stores a change waiting for its payment. Earlier changes of the reservation still waiting
+// for theirs are superseded, so only the latest one can apply.
+func (r *reservationRepository) CreateReservationChange(change *db.ReservationChange) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE reservation_changes SET status = 'superseded', updated_at = NOW()
+		WHERE reservation_id = $1 AND status = 'awaiting_payment'`, change.ReservationID)
+	if err != nil {
+		return fmt.Errorf("error superseding changes of reservation %s: %w", change.ReservationCode, err)
+	}
+	if err := insertReservationChange(tx, change); err != nil {
+		return fmt.Errorf("error recording change of reservation %s: %w", change.ReservationCode, err)
+	}
+	return tx.Commit()
+}
+
+func insertReservationChange(q queryer, change *db.ReservationChange) error {
+	query := `
+		INSERT INTO reservation_changes
+		(reservation_id, reservation_code, start_time, end_time, vehicle_type_id, vehicle_plate, vehicle_model,
+		 old_total_price, new_total_price, new_deposit_payment, new_discount_amount, amount_due, status, stripe_session_id, requested_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING id, created_at, updated_at`
+	return q.QueryRow(query, change.ReservationID, change.ReservationCode, change.StartTime, change.EndTime,
+		change.VehicleTypeID, change.VehiclePlate, change.VehicleModel, change.OldTotalPrice, change.NewTotalPrice,
+		change.NewDepositPayment, change.NewDiscount, change.AmountDue, change.Status, change.StripeSessionID, change.RequestedBy,
+	).Scan(&change.ID, &change.CreatedAt, &change.UpdatedAt)
+}
+
+func (r *reservationRepository) GetReservationChangeByStripeSessionID(sessionID string) (*db.ReservationChange, error) {
+	query := `SELECT ` + reservationChangeColumns + ` FROM reservation_changes WHERE stripe_session_id = $1`
+	change, err := scanReservationChange(r.DB.QueryRow(query, sessionID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("reservation change with sessionID '%s' not found: %w", sessionID, err)
+		}
+		return nil, fmt.Errorf("error querying reservation change: %w", err)
+	}
+	return change, nil
+}
+
+func scanReservationChange(row interface{ Scan(...interface{}) error }) (*db.ReservationChange, error) {
+	var change db.ReservationChange
+	err := row.Scan(&change.ID, &change.ReservationID, &change.ReservationCode,
+		&change.StartTime, &change.EndTime, &change.VehicleTypeID, &change.VehiclePlate, &change.VehicleModel,
+		&change.OldTotalPrice, &change.NewTotalPrice, &change.NewDepositPayment, &change.NewDiscount, &change.AmountDue, &change.Status,
+		&change.StripeSessionID, &change.RequestedBy, &change.CreatedAt, &change.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// ListReservationChangesByStatus returns the changes in the status, oldest first.
+func (r *reservationRepository) ListReservationChangesByStatus(status string) ([]db.ReservationChange, error) {
+	query := `SELECT ` + reservationChangeColumns + ` FROM reservation_changes WHERE status = $1 ORDER BY created_at, id`
+	rows, err := r.DB.Query(query, status)
+	if err != nil {
+		return nil, fmt.Errorf("error querying %s reservation changes: %w", status, err)
+	}
+	defer rows.Close()
+
+	var changes []db.ReservationChange
+	for rows.Next() {
+		change, err := scanReservationChange(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning reservation change: %w", err)
+		}
+		changes = append(changes, *change)
+	}
+	return changes, rows.Err()
+}
+
+func (r *reservationRepository) UpdateReservationChangeStatus(changeID int, status string) error {
+	_, err := r.DB.Exec(`UPDATE reservation_changes SET status = $2, updated_at = NOW() WHERE id = $1`, changeID, status)
+	return err
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"database/sql"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/money"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// normalizedPlateSQL compares plates the way attendants type them: uppercase, without spaces or dashes.
+const normalizedPlateSQL = `UPPER(REPLACE(REPLACE(vehicle_plate, ' ', ''), '-', ''))`
+
+// FindReservationCodesByPlate returns the codes of the reservations in one of the given statuses whose plate matches
+// the normalized plate, by start time.
+func (r *reservationRepository) FindReservationCodesByPlate(plate string, statuses []string) ([]string, error) {
+	query := `SELECT code FROM reservations WHERE ` + normalizedPlateSQL + ` = $1 AND status = ANY($2) ORDER BY start_time`
+	rows, err := r.DB.Query(query, plate, pq.Array(statuses))
+	if err != nil {
+		return nil, fmt.Errorf("error querying reservations by plate: %w", err)
+	}
+	defer rows.Close()
+
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, fmt.Errorf("error scanning reservation code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
+
+// CheckInReservation records the car of an active reservation entering the parking. A reservation in any other status
+// is reported as sql.ErrNoRows.
+func (r *reservationRepository) CheckInReservation(reservationID int, checkedInAt time.Time) error {
+	query := `
+		UPDATE reservations SET status = 'checked_in', checked_in_at = $2, updated_at = NOW()
+		WHERE id = $1 AND status = 'active'`
+	return updateOneReservation(r.DB, query, reservationID, checkedInAt)
+}
+
+// CheckOutReservation finishes a reservation whose car leaves, adding charge, the overstay fee or the price of a
+// walk-in, to its total price and recording the payment collected at the gate, if any, in the same transaction. An
+// open walk-in ends at checkedOutAt. A reservation that is not active, checked in, overstaying or a no-show is
+// reported as sql.ErrNoRows.
+func (r *reservationRepository) CheckOutReservation(reservationID int, checkedOutAt time.Time, charge, overstayFee money.Amount, payment *db.Payment) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting check-out transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE reservations
+		SET status = 'finished', checked_out_at = $2, end_time = COALESCE(end_time, $2), total_price = COALESCE(total_price, 0) + $3,
+		    overstay_fee = $4, updated_at = NOW()
+		WHERE id = $1 AND status IN ('active', 'checked_in', 'overstay', 'no_show')`
+	if err := updateOneReservation(tx, query, reservationID, checkedOutAt, charge, overstayFee); err != nil {
+		return err
+	}
+	if payment != nil {
+		if _, err := insertPayment(tx, payment); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// MarkReservationNoShow records that the car of an active reservation never came, releasing its space. A reservation
+// in any other status is reported as sql.ErrNoRows.
+func (r *reservationRepository) MarkReservationNoShow(reservationID int) error {
+	query := `UPDATE reservations SET status = 'no_show', updated_at = NOW() WHERE id = $1 AND status = 'active'`
+	return updateOneReservation(r.DB, query, reservationID)
+}
+
+// updateOneReservation runs an update of the reservation whose ID is the first argument, reporting sql.ErrNoRows
+// when its WHERE clause matched nothing.
+func updateOneReservation(q queryer, query string, args ...interface{}) error {
+	result, err := q.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("error updating reservation %v: %w", args[0], err)
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return fmt.Errorf("reservation %v not found in the expected status: %w", args[0], sql.ErrNoRows)
+	}
+	return nil
+}
@@ -5,9 +5,9 @@ import (
 	"errors"
 	"estacionamienti/internal/db"
 	"estacionamienti/internal/entities"
-	"estacionamienti/internal/utils"
+	"estacionamienti/internal/money"
+	"estacionamienti/internal/reservationcode"
 	"fmt"
-	"github.com/lib/pq"
 	"time"
 )
 
@@ -18,42 +18,53 @@ type SlotOccupationInfo struct {
 	BookedSpaces int
 }
 
-type ReservationRepository struct {
-	DB *sql.DB
-}
+// spacePoolLockNamespace is the first key of the advisory locks taken per space pool while booking.
+const spacePoolLockNamespace = 7301
 
-func NewReservationRepository(db *sql.DB) *ReservationRepository {
-	return &ReservationRepository{DB: db}
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
-func (r *ReservationRepository) GetPrices() ([]entities.PriceResponse, error) {
-	query := `
-	SELECT vt.name as vehicle_type, rt.name as reservation_time, vp.price
-	FROM vehicle_prices vp
-	JOIN vehicle_types vt ON vp.vehicle_type_id = vt.id
-	JOIN reservation_times rt ON vp.reservation_time_id = rt.id
-	ORDER BY vt.name, rt.name
-	`
-
-	rows, err := r.DB.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+// ErrNotCancelable is returned by ClaimCancellation when the reservation is canceled or being canceled already.
+var ErrNotCancelable = errors.New("reservation is already canceled or being canceled")
+
+type ReservationRepository interface {
+	GetVehicleTypes() ([]db.VehicleType, error)
+	GetHourlyAvailabilityDetails(startTime, endTime time.Time, vehicleTypeID int, holdSince time.Time, excludeReservationID int) ([]SlotOccupationInfo, error)
+	CreateReservationIfAvailable(res *db.Reservation, holdSince time.Time, notify func(*db.Reservation) []db.Notification) ([]SlotOccupationInfo, error)
+	GetReservationByCode(code, email string) (*entities.ReservationResponse, error)
+	ListReservationsByEmail(email string) ([]entities.ReservationResponse, error)
+	ClaimCancellation(code string, refundAmount money.Amount) (string, error)
+	SettleCancellation(code, status string, unrefunded money.Amount, notifications []db.Notification) error
+	GetReservationByCodeOnly(code string) (*db.Reservation, error)
+	GetReservationByStripeSessionID(sessionID string) (*db.Reservation, error)
+	UpdateReservationAndPaymentStatus(reservationID int, reservationStatus, paymentStatus string, notifications []db.Notification) error
+	UpdateReservationStatusPaymentAndIntent(reservationID int, reservationStatus, paymentStatus, paymentIntentID string, notifications []db.Notification) error
+	UpdateReservationStripeSession(reservationID int, sessionID, paymentStatus string) error
+	ApplyReservationChange(change *db.ReservationChange, holdSince time.Time, notifications []db.Notification) ([]SlotOccupationInfo, error)
+	CreateReservationChange(change *db.ReservationChange) error
+	GetReservationChangeByStripeSessionID(sessionID string) (*db.ReservationChange, error)
+	UpdateReservationChangeStatus(changeID int, status string) error
+	ListReservationChangesByStatus(status string) ([]db.ReservationChange, error)
+	UpdatePaymentStatus(reservationID int, paymentStatus string, notifications []db.Notification) error
+	FindReservationCodesByPlate(plate string, statuses []string) ([]string, error)
+	CheckInReservation(reservationID int, checkedInAt time.Time) error
+	CheckOutReservation(reservationID int, checkedOutAt time.Time, charge, overstayFee money.Amount, payment *db.Payment) error
+	MarkReservationNoShow(reservationID int) error
+}
 
-	var prices []entities.PriceResponse
-	for rows.Next() {
-		var p entities.PriceResponse
-		if err := rows.Scan(&p.VehicleType, &p.ReservationTime, &p.Price); err != nil {
-			return nil, err
-		}
-		prices = append(prices, p)
-	}
+type reservationRepository struct {
+	DB *sql.DB
+}
 
-	return prices, nil
+func NewReservationRepository(db *sql.DB) ReservationRepository {
+	return &reservationRepository{DB: db}
 }
 
-func (r *ReservationRepository) GetVehicleTypes() ([]db.VehicleType, error) {
+func (r *reservationRepository) GetVehicleTypes() ([]db.VehicleType, error) {
 	query := `SELECT id, name FROM vehicle_types ORDER BY name`
 
 	rows, err := r.DB.Query(query)
@@ -74,29 +85,40 @@ func (r *ReservationRepository) GetVehicleTypes() ([]db.VehicleType, error) {
 	return types, nil
 }
 
-func (r *ReservationRepository) GetHourlyAvailabilityDetails(startTime, endTime time.Time, vehicleTypeID int, vehicleTypeName string) ([]SlotOccupationInfo, error) {
-	if !endTime.After(startTime) {
-		return nil, fmt.Errorf("end time must be after start time")
+// GetHourlyAvailabilityDetails returns the occupation of the vehicle type's space pool for every hour between startTime
+// and endTime. Reservations of every vehicle type in the pool are counted, and a checked-in car staying past its end
+// time still takes its space until the current hour ends. No-shows release theirs. Pending reservations created after holdSince
+// still count as booked, so capacity is held while the customer pays. The reservation with ID excludeReservationID, if
+// any, is left out so a reservation being modified doesn't compete with itself. A reservation being canceled keeps its
+// space until the cancellation is settled, since it stays when its refund fails.
+func (r *reservationRepository) GetHourlyAvailabilityDetails(startTime, endTime time.Time, vehicleTypeID int, holdSince time.Time, excludeReservationID int) ([]SlotOccupationInfo, error) {
+	pool, err := spacePoolForVehicleType(r.DB, vehicleTypeID)
+	if err != nil {
+		return nil, err
 	}
+	return hourlyAvailabilityDetails(r.DB, startTime, endTime, pool, holdSince, excludeReservationID)
+}
 
-	vehicleTypes, err := r.GetVehicleTypes()
+// spacePoolForVehicleType returns the pool a vehicle type takes its spaces from.
+func spacePoolForVehicleType(q queryer, vehicleTypeID int) (*db.SpacePool, error) {
+	var pool db.SpacePool
+	err := q.QueryRow(`
+		SELECT sp.id, sp.name, sp.spaces
+		FROM vehicle_types vt
+		JOIN space_pools sp ON sp.id = vt.space_pool_id
+		WHERE vt.id = $1`, vehicleTypeID).Scan(&pool.ID, &pool.Name, &pool.Spaces)
 	if err != nil {
-		return nil, fmt.Errorf("could not fetch vehicle types: %w", err)
-	}
-	// Compose slice of IDs sharing the pool
-	var vtList []struct {
-		ID   int
-		Name string
-	}
-	for _, vt := range vehicleTypes {
-		vtList = append(vtList, struct {
-			ID   int
-			Name string
-		}{vt.ID, vt.Name})
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("vehicle type %d is not assigned to a space pool", vehicleTypeID)
+		}
+		return nil, fmt.Errorf("error fetching space pool for vehicle type %d: %w", vehicleTypeID, err)
 	}
-	idsForPool := utils.VehicleTypeIDsForSpace(vtList, vehicleTypeName)
-	if len(idsForPool) == 0 {
-		return nil, fmt.Errorf("no vehicle type ids found for pool")
+	return &pool, nil
+}
+
+func hourlyAvailabilityDetails(q queryer, startTime, endTime time.Time, pool *db.SpacePool, holdSince time.Time, excludeReservationID int) ([]SlotOccupationInfo, error) {
+	if !endTime.After(startTime) {
+		return nil, fmt.Errorf("end time must be after start time")
 	}
 
 	query := `
@@ -109,86 +131,155 @@ func (r *ReservationRepository) GetHourlyAvailabilityDetails(startTime, endTime
 				$2::timestamptz - interval '1 hour', -- endTime
 				interval '1 hour'
 			) AS gs(slot_hour_start)
-		),
-		total_spaces_for_type AS (
-		  SELECT COALESCE(spaces, 0) AS spaces
-		  FROM vehicle_spaces
-		  WHERE vehicle_type_id = $3
 		)
 		SELECT
 			rs.slot_hour_start,
 			rs.slot_hour_end,
-			COALESCE((SELECT spaces FROM total_spaces_for_type), 0) AS total_spaces,
 			COUNT(r.id) AS booked_spaces
 		FROM requested_slots rs
 		LEFT JOIN reservations r
-			ON r.vehicle_type_id = ANY($4)
-			AND r.status = 'active'
+			ON r.vehicle_type_id IN (SELECT id FROM vehicle_types WHERE space_pool_id = $3)
+			AND (r.status IN ('active', 'checked_in', 'overstay', 'canceling') OR (r.status = 'pending' AND (r.created_at > $4 OR r.payment_status = 'processing')))
 			AND r.start_time < rs.slot_hour_end
-			AND r.end_time > rs.slot_hour_start
+			AND (r.end_time > rs.slot_hour_start OR (r.status IN ('checked_in', 'overstay') AND rs.slot_hour_start < NOW()))
+			AND r.id <> $5
 		GROUP BY rs.slot_hour_start, rs.slot_hour_end
 		ORDER BY rs.slot_hour_start;
     `
 
-	// $3 is the mapped vehicle_type_id for vehicle_spaces, $4 is the array of ids for reservations
-	mappedVehicleTypeID := utils.MapVehicleTypeIDForSpace(vehicleTypeID, vehicleTypeName)
-	rows, err := r.DB.Query(query, startTime, endTime, mappedVehicleTypeID, pq.Array(idsForPool))
+	rows, err := q.Query(query, startTime, endTime, pool.ID, holdSince, excludeReservationID)
 	if err != nil {
 		return nil, fmt.Errorf("error querying hourly availability: %w", err)
 	}
 	defer rows.Close()
 
 	var results []SlotOccupationInfo
-	var hasTotalSpacesEntry bool
-
 	for rows.Next() {
-		var soi SlotOccupationInfo
-		err := rows.Scan(&soi.SlotStart, &soi.SlotEnd, &soi.TotalSpaces, &soi.BookedSpaces)
+		soi := SlotOccupationInfo{TotalSpaces: pool.Spaces}
+		err := rows.Scan(&soi.SlotStart, &soi.SlotEnd, &soi.BookedSpaces)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning hourly availability slot: %w", err)
 		}
 		results = append(results, soi)
-		if !hasTotalSpacesEntry && soi.TotalSpaces > 0 {
-			hasTotalSpacesEntry = true
-		}
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("error after iterating hourly availability rows: %w", err)
 	}
+	return results, nil
+}
 
-	// Una verificación más robusta para "tipo de vehículo no configurado":
-	var configuredSpaces sql.NullInt64
-	err = r.DB.QueryRow("SELECT spaces FROM vehicle_spaces WHERE vehicle_type_id = $1", mappedVehicleTypeID).Scan(&configuredSpaces)
+// CreateReservationIfAvailable inserts the reservation only if every hour of its window still has a free space in
+// the vehicle's space pool. The check and the insert run in one transaction holding a per-pool advisory lock, so
+// concurrent bookings for the same pool are serialized. An open walk-in, without end time, needs a free space in the
+// hour starting when it does. When the pool is full nothing is inserted and the slots without free spaces are
+// returned. A reservation booked with a promo code is only inserted if the code has redemptions left, otherwise
+// ErrPromoCodeExhausted is returned. A reservation without code gets a random one, and another one if it is already
+// taken. notify, when not nil, renders the notifications queued in the same transaction once the code is final.
+func (r *reservationRepository) CreateReservationIfAvailable(res *db.Reservation, holdSince time.Time, notify func(*db.Reservation) []db.Notification) ([]SlotOccupationInfo, error) {
+	tx, err := r.DB.Begin()
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return []SlotOccupationInfo{}, fmt.Errorf("vehicle type %d not configured in vehicle_spaces", mappedVehicleTypeID)
+		return nil, fmt.Errorf("error starting reservation transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	conflicts, err := lockPoolAndFindConflicts(tx, res.VehicleTypeID, res.StartTime, checkedWindowEnd(res), holdSince, 0)
+	if err != nil || len(conflicts) > 0 {
+		return conflicts, err
+	}
+	if res.PromoCodeID.Valid {
+		if err := checkPromoRedemptions(tx, res); err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("error checking vehicle space configuration: %w", err)
 	}
 
-	return results, nil
+	if err := insertReservation(tx, res); err != nil {
+		return nil, err
+	}
+	if notify != nil {
+		if err := insertNotifications(tx, res.ID, notify(res)); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing reservation: %w", err)
+	}
+	return nil, nil
 }
 
-func (r *ReservationRepository) GetPriceForUnit(vehicleTypeID int, reservationTimeID int) (float32, error) {
-	var price float32
-	err := r.DB.QueryRow(`SELECT price FROM vehicle_prices WHERE vehicle_type_id = $1 AND reservation_time_id = $2`, vehicleTypeID, reservationTimeID).Scan(&price)
+// checkedWindowEnd is the end of the window checked for free spaces when inserting the reservation.
+func checkedWindowEnd(res *db.Reservation) time.Time {
+	if res.EndTime.IsZero() {
+		return res.StartTime.Add(time.Hour)
+	}
+	return res.EndTime
+}
+
+// lockPoolAndFindConflicts takes the advisory lock of the vehicle type's space pool for the rest of the transaction
+// and returns the hours of the window without a free space, ignoring the reservation excludeReservationID.
+func lockPoolAndFindConflicts(tx *sql.Tx, vehicleTypeID int, startTime, endTime, holdSince time.Time, excludeReservationID int) ([]SlotOccupationInfo, error) {
+	pool, err := spacePoolForVehicleType(tx, vehicleTypeID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return 0, fmt.Errorf("no price configured for vehicle_type_id %d and reservation_time_id %d", vehicleTypeID, reservationTimeID)
+		return nil, err
+	}
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1, $2)`, spacePoolLockNamespace, pool.ID); err != nil {
+		return nil, fmt.Errorf("error locking space pool %d: %w", pool.ID, err)
+	}
+
+	slots, err := hourlyAvailabilityDetails(tx, startTime, endTime, pool, holdSince, excludeReservationID)
+	if err != nil {
+		return nil, err
+	}
+	if len(slots) == 0 {
+		return nil, fmt.Errorf("no availability slots found for the requested window")
+	}
+	var conflicts []SlotOccupationInfo
+	for _, slot := range slots {
+		if slot.TotalSpaces-slot.BookedSpaces <= 0 {
+			conflicts = append(conflicts, slot)
 		}
-		return 0, err
 	}
-	return price, nil
+	return conflicts, nil
 }
 
-func (r *ReservationRepository) CreateReservation(res *db.Reservation) error {
+// reservationCodeAttempts is how many random codes are tried before giving up on inserting a reservation.
+const reservationCodeAttempts = 5
+
+// insertReservation inserts the reservation with its code, or a random one when it has none. A code already taken
+// is replaced by another random one; ON CONFLICT keeps the transaction usable for the retry.
+func insertReservation(q queryer, res *db.Reservation) error {
+	if res.Code == "" {
+		code, err := reservationcode.New()
+		if err != nil {
+			return fmt.Errorf("error generating reservation code: %w", err)
+		}
+		res.Code = code
+	}
+	for attempt := 1; ; attempt++ {
+		err := insertReservationWithCode(q, res)
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if attempt == reservationCodeAttempts {
+			return fmt.Errorf("no free reservation code after %d attempts", attempt)
+		}
+		code, err := reservationcode.New()
+		if err != nil {
+			return fmt.Errorf("error generating reservation code: %w", err)
+		}
+		res.Code = code
+	}
+}
+
+// insertReservationWithCode returns sql.ErrNoRows when the code of the reservation is already taken.
+func insertReservationWithCode(q queryer, res *db.Reservation) error {
 	query := `
 		INSERT INTO reservations
-		(code, user_name, user_email, user_phone, vehicle_type_id, vehicle_plate, vehicle_model, payment_method_id, status, start_time, end_time, created_at, updated_at, stripe_session_id, payment_status, language, total_price, deposit_payment)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+		(code, user_name, user_email, user_phone, vehicle_type_id, vehicle_plate, vehicle_model, payment_method_id, status, start_time, end_time, created_at, updated_at, stripe_session_id, payment_status, language, total_price, deposit_payment, walk_in, checked_in_at, promo_code_id, discount_amount)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)
+		ON CONFLICT (code) DO NOTHING
 		RETURNING id, created_at, updated_at`
-	return r.DB.QueryRow(query,
+	return q.QueryRow(query,
 		res.Code,
 		res.UserName,
 		res.UserEmail,
@@ -199,7 +290,7 @@ func (r *ReservationRepository) CreateReservation(res *db.Reservation) error {
 		res.PaymentMethodID,
 		res.Status,
 		res.StartTime,
-		res.EndTime,
+		sql.NullTime{Time: res.EndTime, Valid: !res.EndTime.IsZero()},
 		res.CreatedAt,
 		res.UpdatedAt,
 		res.StripeSessionID,
@@ -207,90 +298,153 @@ func (r *ReservationRepository) CreateReservation(res *db.Reservation) error {
 		res.Language,
 		res.TotalPrice,
 		res.DepositPayment,
+		res.WalkIn,
+		res.CheckedInAt,
+		res.PromoCodeID,
+		res.DiscountAmount,
 	).Scan(&res.ID, &res.CreatedAt, &res.UpdatedAt)
 }
 
-func (r *ReservationRepository) GetReservationByCode(code, email string) (*entities.ReservationResponse, error) {
-	var res entities.ReservationResponse
-
-	query := `
+// reservationResponseSQL selects what scanReservationResponse reads, for the WHERE clause appended by the caller.
+const reservationResponseSQL = `
         SELECT
-            r.code, r.user_name, r.user_email, r.user_phone,
+            r.code, r.user_name, r.user_email, COALESCE(r.user_phone, ''),
             r.vehicle_type_id, vt.name AS vehicle_type_name,
-            r.vehicle_plate, r.vehicle_model,
+            COALESCE(r.vehicle_plate, ''), COALESCE(r.vehicle_model, ''),
             r.payment_method_id, pm.name AS payment_method_name, r.stripe_session_id, r.payment_status,
-            r.status, r.start_time, r.end_time, r.created_at, r.updated_at, r.language, r.total_price, r.deposit_payment
+            r.status, r.start_time, r.end_time, r.created_at, r.updated_at, r.language, r.total_price, r.deposit_payment,
+            r.refunded_amount, r.checked_in_at, r.checked_out_at, r.overstay_fee, r.walk_in, COALESCE(pc.code, ''), r.discount_amount,
+            ` + paymentsNetPaidSQL + `
         FROM reservations r
         JOIN vehicle_types vt ON r.vehicle_type_id = vt.id
         JOIN payment_method pm ON r.payment_method_id = pm.id
-        WHERE r.code = $1 AND r.user_email = $2
-    `
+        LEFT JOIN promo_codes pc ON pc.id = r.promo_code_id
+`
+
+// GetReservationByCode returns the reservation if it was booked with the email, in any letter case.
+func (r *reservationRepository) GetReservationByCode(code, email string) (*entities.ReservationResponse, error) {
+	query := reservationResponseSQL + `WHERE r.code = $1 AND LOWER(r.user_email) = LOWER($2)`
+	res, err := scanReservationResponse(r.DB.QueryRow(query, code, email))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("reservation with code '%s' and email '%s' not found: %w", code, email, err)
+		}
+		return nil, fmt.Errorf("error querying or scanning reservation: %w", err)
+	}
+	return res, nil
+}
+
+// ListReservationsByEmail returns every reservation booked with the email, in any letter case, the latest first.
+func (r *reservationRepository) ListReservationsByEmail(email string) ([]entities.ReservationResponse, error) {
+	query := reservationResponseSQL + `WHERE LOWER(r.user_email) = LOWER($1) ORDER BY r.start_time DESC, r.id DESC`
+	rows, err := r.DB.Query(query, email)
+	if err != nil {
+		return nil, fmt.Errorf("error querying reservations of '%s': %w", email, err)
+	}
+	defer rows.Close()
+	reservations := []entities.ReservationResponse{}
+	for rows.Next() {
+		res, err := scanReservationResponse(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning reservation: %w", err)
+		}
+		reservations = append(reservations, *res)
+	}
+	return reservations, rows.Err()
+}
 
-	var totalPrice sql.NullFloat64
+func scanReservationResponse(row interface{ Scan(...interface{}) error }) (*entities.ReservationResponse, error) {
+	var res entities.ReservationResponse
 	var stripeSessionID sql.NullString
 	var paymentStatus sql.NullString
-	var depositPayment sql.NullFloat64
-	err := r.DB.QueryRow(query, code, email).Scan(
+	var amountPaid money.Amount
+	var checkedInAt, checkedOutAt sql.NullTime
+	err := row.Scan(
 		&res.Code, &res.UserName, &res.UserEmail, &res.UserPhone,
 		&res.VehicleTypeID, &res.VehicleTypeName,
 		&res.VehiclePlate, &res.VehicleModel,
 		&res.PaymentMethodID, &res.PaymentMethodName, &stripeSessionID, &paymentStatus,
-		&res.Status, &res.StartTime, &res.EndTime, &res.CreatedAt, &res.UpdatedAt, &res.Language, &totalPrice, &depositPayment,
+		&res.Status, &res.StartTime, &res.EndTime, &res.CreatedAt, &res.UpdatedAt, &res.Language, &res.TotalPrice, &res.DepositPayment,
+		&res.RefundedAmount, &checkedInAt, &checkedOutAt, &res.OverstayFee, &res.WalkIn, &res.PromoCode, &res.DiscountAmount,
+		&amountPaid,
 	)
-
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("reservation with code '%s' and email '%s' not found: %w", code, email, err)
-		}
-		return nil, fmt.Errorf("error querying or scanning reservation: %w", err)
-	}
-	if stripeSessionID.Valid {
-		res.StripeSessionID = stripeSessionID.String
-	} else {
-		res.StripeSessionID = ""
-	}
-	if paymentStatus.Valid {
-		res.PaymentStatus = paymentStatus.String
-	} else {
-		res.PaymentStatus = ""
+		return nil, err
 	}
-	if totalPrice.Valid {
-		res.TotalPrice = float32(totalPrice.Float64)
-	} else {
-		res.TotalPrice = 0
+	res.StripeSessionID = stripeSessionID.String
+	res.PaymentStatus = paymentStatus.String
+	if checkedInAt.Valid {
+		res.CheckedInAt = &checkedInAt.Time
 	}
-	if depositPayment.Valid {
-		res.DepositPayment = float32(depositPayment.Float64)
-	} else {
-		res.DepositPayment = 0
+	if checkedOutAt.Valid {
+		res.CheckedOutAt = &checkedOutAt.Time
 	}
+	res.SetAmountPaid(amountPaid)
 	return &res, nil
 }
 
-func (r *ReservationRepository) CancelReservation(code string) (string, error) {
-	timeUpdated := time.Now().UTC()
+// ClaimCancellation marks the reservation as being canceled and adds refundAmount, the refund about to be issued, to
+// what was already refunded, so a concurrent or repeated cancellation can't refund it again. It returns the status the
+// reservation had, to give the claim up with, or ErrNotCancelable when it is canceled or being canceled already.
+func (r *reservationRepository) ClaimCancellation(code string, refundAmount money.Amount) (string, error) {
+	// El FOR UPDATE serializa las cancelaciones simultáneas: la segunda ve la reserva ya en 'canceling'.
 	query := `
-		UPDATE reservations 
-		SET status = 'canceled', updated_at = $2 
-		WHERE code = $1 
-		RETURNING status`
+		UPDATE reservations r
+		SET status = 'canceling', refunded_amount = r.refunded_amount + $2, updated_at = NOW()
+		FROM (SELECT id, status FROM reservations WHERE code = $1 FOR UPDATE) prev
+		WHERE r.id = prev.id AND prev.status NOT IN ('canceled', 'canceling')
+		RETURNING prev.status`
 	var status string
-	err := r.DB.QueryRow(query, code, timeUpdated).Scan(&status)
+	err := r.DB.QueryRow(query, code, refundAmount).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotCancelable
+	}
+	return status, err
+}
+
+// SettleCancellation ends a cancellation claimed with ClaimCancellation, setting the reservation to status: canceled
+// once the refund was issued, or the status returned by the claim to give it up. unrefunded, the part of the claimed
+// refund that was not issued, is taken off the refunded amount, and the notifications are queued in the same
+// transaction. A cancellation already settled, e.g. by the refund webhook, is left as it is.
+func (r *reservationRepository) SettleCancellation(code, status string, unrefunded money.Amount, notifications []db.Notification) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE reservations
+		SET status = $2, refunded_amount = refunded_amount - $3, updated_at = NOW()
+		WHERE code = $1 AND status = 'canceling'
+		RETURNING id`
+	var id int
+	err = tx.QueryRow(query, code, status, unrefunded).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
 	if err != nil {
-		return "", err
+		return err
 	}
-	return status, nil
+	if err := insertNotifications(tx, id, notifications); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (r *ReservationRepository) GetReservationByCodeOnly(code string) (*db.Reservation, error) {
+func (r *reservationRepository) GetReservationByCodeOnly(code string) (*db.Reservation, error) {
 	var res db.Reservation
 	query := `
-		SELECT id, code, user_name, user_email, user_phone, vehicle_type_id, vehicle_plate, vehicle_model, payment_method_id, status, start_time, end_time, created_at, updated_at, stripe_session_id, payment_status, language, total_price
+		SELECT id, code, user_name, user_email, user_phone, vehicle_type_id, vehicle_plate, vehicle_model, payment_method_id, status, start_time, end_time, created_at, updated_at, stripe_session_id, payment_status, language, total_price,
+		       deposit_payment, stripe_payment_intent_id, refunded_amount, checked_in_at, checked_out_at, overstay_fee, walk_in,
+		       promo_code_id, discount_amount
 		FROM reservations WHERE code = $1`
-	var totalPrice sql.NullFloat64
+	var endTime sql.NullTime
 	err := r.DB.QueryRow(query, code).Scan(
-		&res.ID, &res.Code, &res.UserName, &res.UserEmail, &res.UserPhone, &res.VehicleTypeID, &res.VehiclePlate, &res.VehicleModel, &res.PaymentMethodID, &res.Status, &res.StartTime, &res.EndTime, &res.CreatedAt, &res.UpdatedAt,
-		&res.StripeSessionID, &res.PaymentStatus, &res.Language, &totalPrice,
+		&res.ID, &res.Code, &res.UserName, &res.UserEmail, &res.UserPhone, &res.VehicleTypeID, &res.VehiclePlate, &res.VehicleModel, &res.PaymentMethodID, &res.Status, &res.StartTime, &endTime, &res.CreatedAt, &res.UpdatedAt,
+		&res.StripeSessionID, &res.PaymentStatus, &res.Language, &res.TotalPrice,
+		&res.DepositPayment, &res.StripePaymentIntentID, &res.RefundedAmount, &res.CheckedInAt, &res.CheckedOutAt, &res.OverstayFee, &res.WalkIn,
+		&res.PromoCodeID, &res.DiscountAmount,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -298,64 +452,103 @@ func (r *ReservationRepository) GetReservationByCodeOnly(code string) (*db.Reser
 		}
 		return nil, fmt.Errorf("error querying reservation: %w", err)
 	}
-	if totalPrice.Valid {
-		res.TotalPrice = totalPrice
-	} else {
-		res.TotalPrice = sql.NullFloat64{Float64: 0, Valid: false}
-	}
+	res.EndTime = endTime.Time
 	return &res, nil
 }
 
-func (r *ReservationRepository) GetReservationByStripeSessionID(sessionID string) (*db.Reservation, error) {
+func (r *reservationRepository) GetReservationByStripeSessionID(sessionID string) (*db.Reservation, error) {
 	var res db.Reservation
 	var paymentIntentID sql.NullString
-	var totalPrice sql.NullFloat64
-	var depositPayment sql.NullFloat64
+	var endTime sql.NullTime
 	query := `
 		SELECT id, code, user_name, user_email, user_phone, vehicle_type_id, vehicle_plate, vehicle_model, payment_method_id, status, start_time, end_time, created_at, 
-		       updated_at, stripe_session_id, payment_status, language, stripe_payment_intent_id, total_price, deposit_payment
+		       updated_at, stripe_session_id, payment_status, language, stripe_payment_intent_id, total_price, deposit_payment, refunded_amount
 		FROM reservations WHERE stripe_session_id = $1`
 	err := r.DB.QueryRow(query, sessionID).Scan(
-		&res.ID, &res.Code, &res.UserName, &res.UserEmail, &res.UserPhone, &res.VehicleTypeID, &res.VehiclePlate, &res.VehicleModel, &res.PaymentMethodID, &res.Status, &res.StartTime, &res.EndTime, &res.CreatedAt,
-		&res.UpdatedAt, &res.StripeSessionID, &res.PaymentStatus, &res.Language, &paymentIntentID, &totalPrice, &depositPayment)
+		&res.ID, &res.Code, &res.UserName, &res.UserEmail, &res.UserPhone, &res.VehicleTypeID, &res.VehiclePlate, &res.VehicleModel, &res.PaymentMethodID, &res.Status, &res.StartTime, &endTime, &res.CreatedAt,
+		&res.UpdatedAt, &res.StripeSessionID, &res.PaymentStatus, &res.Language, &paymentIntentID, &res.TotalPrice, &res.DepositPayment, &res.RefundedAmount)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("reservation with sessionID '%s' not found: %w", sessionID, err)
 		}
 		return nil, fmt.Errorf("error querying reservation: %w", err)
 	}
+	res.EndTime = endTime.Time
 	if paymentIntentID.Valid {
 		res.StripePaymentIntentID = paymentIntentID
 	} else {
 		res.StripePaymentIntentID = sql.NullString{String: "", Valid: false}
 	}
-	if totalPrice.Valid {
-		res.TotalPrice = totalPrice
-	} else {
-		res.TotalPrice = sql.NullFloat64{Float64: 0, Valid: false}
-	}
-	if depositPayment.Valid {
-		res.DepositPayment = depositPayment
-	} else {
-		res.DepositPayment = sql.NullFloat64{Float64: 0, Valid: false}
-	}
 	return &res, nil
 }
 
-func (r *ReservationRepository) UpdateReservationAndPaymentStatus(reservationID int, reservationStatus, paymentStatus string) error {
+// UpdateReservationAndPaymentStatus changes both statuses and queues the given notifications in the same transaction.
+func (r *reservationRepository) UpdateReservationAndPaymentStatus(reservationID int, reservationStatus, paymentStatus string, notifications []db.Notification) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
 		UPDATE reservations
 		SET payment_status = $1, status = $2, updated_at = NOW()
 		WHERE id = $3`
-	_, err := r.DB.Exec(query, paymentStatus, reservationStatus, reservationID)
-	return err
+	if _, err := tx.Exec(query, paymentStatus, reservationStatus, reservationID); err != nil {
+		return err
+	}
+	if err := insertNotifications(tx, reservationID, notifications); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (r *ReservationRepository) UpdateReservationStatusPaymentAndIntent(reservationID int, reservationStatus, paymentStatus, paymentIntentID string) error {
+// UpdatePaymentStatus changes only the payment status of the reservation, keeping its status, and queues the given
+// notifications in the same transaction.
+func (r *reservationRepository) UpdatePaymentStatus(reservationID int, paymentStatus string, notifications []db.Notification) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE reservations SET payment_status = $1, updated_at = NOW() WHERE id = $2`
+	if _, err := tx.Exec(query, paymentStatus, reservationID); err != nil {
+		return err
+	}
+	if err := insertNotifications(tx, reservationID, notifications); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateReservationStatusPaymentAndIntent records a payment and queues the given notifications in the same transaction.
+func (r *reservationRepository) UpdateReservationStatusPaymentAndIntent(reservationID int, reservationStatus, paymentStatus, paymentIntentID string, notifications []db.Notification) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
 		UPDATE reservations
 		SET payment_status = $1, status = $2, stripe_payment_intent_id = $3, updated_at = NOW()
 		WHERE id = $4`
-	_, err := r.DB.Exec(query, paymentStatus, reservationStatus, paymentIntentID, reservationID)
+	if _, err := tx.Exec(query, paymentStatus, reservationStatus, paymentIntentID, reservationID); err != nil {
+		return err
+	}
+	if err := insertNotifications(tx, reservationID, notifications); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateReservationStripeSession stores the checkout session created for a reservation that is already persisted.
+func (r *reservationRepository) UpdateReservationStripeSession(reservationID int, sessionID, paymentStatus string) error {
+	query := `
+		UPDATE reservations
+		SET stripe_session_id = $1, payment_status = $2, updated_at = NOW()
+		WHERE id = $3`
+	_, err := r.DB.Exec(query, sessionID, paymentStatus, reservationID)
 	return err
 }
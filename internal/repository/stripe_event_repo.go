@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"estacionamienti/internal/db"
+	"fmt"
+	"time"
+)
+
+// stripeEventStaleAfter is how long an event may stay in processing before another delivery may take it over,
+// e.g. after the instance processing it crashed.
+const stripeEventStaleAfter = 5 * time.Minute
+
+type StripeEventRepository interface {
+	ClaimStripeEvent(evt *db.StripeEvent) (bool, error)
+	FinishStripeEvent(id, status, result, reservationCode string) error
+	GetStripeEvent(id string) (*db.StripeEvent, error)
+	ListStripeEventsByReservation(code string) ([]db.StripeEvent, error)
+}
+
+type stripeEventRepository struct {
+	DB *sql.DB
+}
+
+func NewStripeEventRepository(db *sql.DB) StripeEventRepository {
+	return &stripeEventRepository{DB: db}
+}
+
+const stripeEventColumns = `id, type, reservation_code, payload, status, result, attempts, stripe_created_at, received_at, processed_at`
+
+// ClaimStripeEvent records the event as processing and reports whether the caller should process it. Events seen for
+// the first time, failed ones and ones stuck in processing are claimed; processed and ignored events are not.
+func (r *stripeEventRepository) ClaimStripeEvent(evt *db.StripeEvent) (bool, error) {
+	query := `
+		INSERT INTO stripe_events (id, type, payload, status, stripe_created_at)
+		VALUES ($1, $2, $3, 'processing', $4)
+		ON CONFLICT (id) DO UPDATE
+		SET status = 'processing', attempts = stripe_events.attempts + 1, updated_at = NOW()
+		WHERE stripe_events.status = 'failed'
+		   OR (stripe_events.status = 'processing' AND stripe_events.updated_at < $5)
+		RETURNING attempts`
+	err := r.DB.QueryRow(query, evt.ID, evt.Type, []byte(evt.Payload), evt.StripeCreatedAt, time.Now().Add(-stripeEventStaleAfter)).Scan(&evt.Attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error recording stripe event %s: %w", evt.ID, err)
+	}
+	return true, nil
+}
+
+// FinishStripeEvent stores the outcome of processing an event and the reservation it was about, if known.
+func (r *stripeEventRepository) FinishStripeEvent(id, status, result, reservationCode string) error {
+	query := `
+		UPDATE stripe_events
+		SET status = $2, result = $3, reservation_code = COALESCE(NULLIF($4, ''), reservation_code),
+		    processed_at = NOW(), updated_at = NOW()
+		WHERE id = $1`
+	_, err := r.DB.Exec(query, id, status, result, reservationCode)
+	if err != nil {
+		return fmt.Errorf("error updating stripe event %s: %w", id, err)
+	}
+	return nil
+}
+
+func (r *stripeEventRepository) GetStripeEvent(id string) (*db.StripeEvent, error) {
+	rows, err := r.DB.Query(`SELECT `+stripeEventColumns+` FROM stripe_events WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error querying stripe event %s: %w", id, err)
+	}
+	events, err := scanStripeEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("stripe event '%s' not found: %w", id, sql.ErrNoRows)
+	}
+	return &events[0], nil
+}
+
+// ListStripeEventsByReservation returns the events of a reservation in the order Stripe created them.
+func (r *stripeEventRepository) ListStripeEventsByReservation(code string) ([]db.StripeEvent, error) {
+	query := `SELECT ` + stripeEventColumns + ` FROM stripe_events
+		WHERE reservation_code = $1
+		ORDER BY stripe_created_at, received_at`
+	rows, err := r.DB.Query(query, code)
+	if err != nil {
+		return nil, fmt.Errorf("error listing stripe events for reservation %s: %w", code, err)
+	}
+	return scanStripeEvents(rows)
+}
+
+func scanStripeEvents(rows *sql.Rows) ([]db.StripeEvent, error) {
+	defer rows.Close()
+	var events []db.StripeEvent
+	for rows.Next() {
+		var evt db.StripeEvent
+		var payload []byte
+		err := rows.Scan(&evt.ID, &evt.Type, &evt.ReservationCode, &payload, &evt.Status, &evt.Result, &evt.Attempts,
+			&evt.StripeCreatedAt, &evt.ReceivedAt, &evt.ProcessedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning stripe event: %w", err)
+		}
+		evt.Payload = payload
+		events = append(events, evt)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,88 @@
+// Package reservationcode generates and checks reservation codes: seven random symbols of Crockford's base32 alphabet,
+// which has no I, L, O or U to misread, and a check symbol that catches a mistyped symbol or two swapped ones.
+package reservationcode
+
+import (
+	"crypto/rand"
+	"strings"
+)
+
+const (
+	// Length is the length of a reservation code, check symbol included.
+	Length = 8
+
+	alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+// New returns a random reservation code, like "7KQ2M9XH".
+func New() (string, error) {
+	random := make([]byte, Length-1)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	code := make([]byte, 0, Length)
+	for _, b := range random {
+		// The alphabet has 32 symbols, so the low 5 bits pick one without bias.
+		code = append(code, alphabet[b&31])
+	}
+	return string(append(code, checkSymbol(code))), nil
+}
+
+// Normalize writes a code the way it is stored: in upper case, without spaces or dashes, and with the letters
+// people mistake for digits (O, I and L) read as those digits.
+func Normalize(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-':
+			return -1
+		case 'O', 'o':
+			return '0'
+		case 'I', 'i', 'L', 'l':
+			return '1'
+		}
+		if 'a' <= r && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		return r
+	}, code)
+}
+
+// Valid reports whether the normalized code is one New can return, with its check symbol right.
+func Valid(code string) bool {
+	if len(code) != Length {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if strings.IndexByte(alphabet, code[i]) < 0 {
+			return false
+		}
+	}
+	return checkSymbol([]byte(code[:Length-1])) == code[Length-1]
+}
+
+// ValidLegacy reports whether the normalized code has the format of those derived from the clock before codes were
+// random: 8 hexadecimal digits. They have no check symbol, so it only applies to looking up reservations booked back
+// then, never to new codes.
+func ValidLegacy(code string) bool {
+	if len(code) != Length {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if !strings.ContainsRune("0123456789ABCDEF", rune(code[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkSymbol is the Luhn mod 32 check symbol of the payload.
+func checkSymbol(payload []byte) byte {
+	n := len(alphabet)
+	sum, factor := 0, 2
+	for i := len(payload) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(alphabet, payload[i])
+		sum += addend/n + addend%n
+		factor = 3 - factor
+	}
+	return alphabet[(n-sum%n)%n]
+}
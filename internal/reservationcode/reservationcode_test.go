@@ -0,0 +1,81 @@
+package reservationcode
+
+import "testing"
+
+func TestNewCodesAreValid(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		code, err := New()
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		if len(code) != Length || !Valid(code) || Normalize(code) != code {
+			t.Fatalf("New returned %q, which is not a normalized valid code", code)
+		}
+		if seen[code] {
+			t.Fatalf("New returned %q twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestCheckSymbolCatchesTypos(t *testing.T) {
+	code, err := New()
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for i := 0; i < Length; i++ {
+		for j := 0; j < len(alphabet); j++ {
+			typo := []byte(code)
+			if typo[i] == alphabet[j] {
+				continue
+			}
+			typo[i] = alphabet[j]
+			if Valid(string(typo)) {
+				t.Fatalf("%q with symbol %d changed to %q passes the check", code, i, typo)
+			}
+		}
+	}
+	for i := 0; i+1 < Length; i++ {
+		swapped := []byte(code)
+		if swapped[i] == swapped[i+1] {
+			continue
+		}
+		swapped[i], swapped[i+1] = swapped[i+1], swapped[i]
+		if Valid(string(swapped)) {
+			t.Fatalf("%q with symbols %d and %d swapped passes the check", code, i, i+1)
+		}
+	}
+}
+
+func TestNormalizeAndValid(t *testing.T) {
+	code, err := New()
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	messy := " " + code[:4] + "-" + code[4:] + " "
+	for _, tt := range []struct {
+		code  string
+		valid bool
+	}{
+		{messy, true},
+		{"00b09b2f", false}, // issued before random codes, see ValidLegacy
+		{"UUUUUUUU", false}, // U is not in the alphabet
+		{"CHANGE01", false},
+		{code[:Length-1], false},
+		{code + "0", false},
+		{"", false},
+	} {
+		if got := Valid(Normalize(tt.code)); got != tt.valid {
+			t.Errorf("Valid(Normalize(%q)) = %v, want %v", tt.code, got, tt.valid)
+		}
+	}
+	for legacy, valid := range map[string]bool{"00b09b2f": true, "00B0-9B2F": true, "00B09B2G": false, "00B09B2": false} {
+		if got := ValidLegacy(Normalize(legacy)); got != valid {
+			t.Errorf("ValidLegacy(Normalize(%q)) = %v, want %v", legacy, got, valid)
+		}
+	}
+	if got := Normalize("ab-cd oil"); got != "ABCD011" {
+		t.Fatalf("Normalize = %q", got)
+	}
+}
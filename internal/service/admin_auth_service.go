@@ -1,19 +1,40 @@
 package service
 
 import (
-	"errors"
+	"database/sql"
+	stdErrors "errors"
+	"estacionamienti/internal/auth"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
 	"estacionamienti/internal/repository"
+	"fmt"
 	"log"
-	"os"
+	"net/http"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	// minAdminPasswordLength is the shortest password admins can have.
+	minAdminPasswordLength = 12
+	// adminRefreshTokenTTL is how long an admin stays signed in without using the session.
+	adminRefreshTokenTTL = 7 * 24 * time.Hour
+)
+
 type AdminAuthService interface {
-	Login(user, password string) (string, error)
-	CreateAdmin(user, password string) error
+	Login(user, password string) (*entities.AdminSession, error)
+	Refresh(refreshToken string) (*entities.AdminSession, error)
+	Logout(refreshToken string) error
+	LogoutAll(adminID int) error
+	CreateAdmin(req entities.AdminUserRequest) (*entities.AdminUser, error)
+	BootstrapOwner(user, password string) (*entities.AdminUser, error)
+	ListAdmins() ([]entities.AdminUser, error)
+	UpdateAdmin(id int, update entities.AdminUserUpdate) (*entities.AdminUser, error)
 }
 
 type adminAuthService struct {
@@ -24,51 +45,307 @@ func NewAdminAuthService(repo repository.AdminAuthRepository) AdminAuthService {
 	return &adminAuthService{repo: repo}
 }
 
-func (s *adminAuthService) Login(user, password string) (string, error) {
+// Login starts a session: an access token and the first refresh token of a new family.
+func (s *adminAuthService) Login(user, password string) (*entities.AdminSession, error) {
 	admin, err := s.repo.GetByEmail(user)
 	if err != nil {
 		log.Printf("Error from GetByEmail: %v", err)
-		return "", err
+		return nil, err
 	}
 	if admin == nil {
 		log.Printf("User %s not found", user)
-		return "", errors.New("invalid credentials")
+		return nil, errInvalidCredentials()
 	}
 
 	// Comparamos el password hasheado
 	err = bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(password))
 	if err != nil {
 		log.Printf("Error from CompareHashAndPassword: %v", err)
-		return "", errors.New("invalid credentials")
+		return nil, errInvalidCredentials()
+	}
+	if !admin.Active {
+		log.Printf("Admin %s deshabilitado, login rechazado", user)
+		return nil, errInvalidCredentials()
+	}
+
+	familyID, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	refresh, secret, err := newAdminRefreshToken(admin.ID, familyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateRefreshToken(refresh); err != nil {
+		log.Printf("Error storing refresh token of %s: %v", admin.User, err)
+		return nil, err
+	}
+	return newAdminSession(admin, refresh, secret)
+}
+
+// Refresh exchanges a refresh token for a new access token and the next refresh token, with the current role of the
+// admin. A refresh token used twice means it leaked: its whole family is revoked.
+func (s *adminAuthService) Refresh(refreshToken string) (*entities.AdminSession, error) {
+	now := time.Now().UTC()
+	stored, err := s.repo.GetRefreshTokenByHash(hashSecret(refreshToken))
+	if err != nil {
+		log.Printf("Error getting refresh token: %v", err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return nil, errInvalidRefreshToken()
+		}
+		return nil, err
+	}
+	if stored.RevokedAt.Valid {
+		log.Printf("Refresh token revocado reutilizado (admin %d): se revoca la sesión", stored.AdminID)
+		return nil, s.revokeFamily(stored.FamilyID, now)
+	}
+	if !now.Before(stored.ExpiresAt) {
+		return nil, errInvalidRefreshToken()
 	}
 
-	// Creamos un JWT
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		log.Println("JWT_SECRET not set")
-		return "", errors.New("JWT_SECRET not set")
+	admin, err := s.repo.GetAdminByID(stored.AdminID)
+	if err != nil {
+		log.Printf("Error getting admin %d: %v", stored.AdminID, err)
+		return nil, err
+	}
+	if !admin.Active {
+		log.Printf("Admin %s deshabilitado, refresh rechazado", admin.User)
+		return nil, s.revokeFamily(stored.FamilyID, now)
 	}
 
-	claims := jwt.MapClaims{
-		"admin_id": admin.ID,
-		"user":     admin.User,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(), // Token expira en 1 hora
+	next, secret, err := newAdminRefreshToken(admin.ID, stored.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := s.repo.RotateRefreshToken(stored.ID, next, now)
+	if err != nil {
+		log.Printf("Error rotating refresh token of %s: %v", admin.User, err)
+		return nil, err
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	if !rotated {
+		log.Printf("Refresh token de %s usado dos veces a la vez: se revoca la sesión", admin.User)
+		return nil, s.revokeFamily(stored.FamilyID, now)
+	}
+	return newAdminSession(admin, next, secret)
 }
 
-func (s *adminAuthService) CreateAdmin(user, password string) error {
-	if user == "" || password == "" {
-		log.Println("user and password cannot be empty")
-		return errors.New("user and password cannot be empty")
+// Logout ends the session of the refresh token. Unknown tokens are ignored.
+func (s *adminAuthService) Logout(refreshToken string) error {
+	stored, err := s.repo.GetRefreshTokenByHash(hashSecret(refreshToken))
+	if err != nil {
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		log.Printf("Error getting refresh token: %v", err)
+		return err
+	}
+	if err := s.repo.RevokeRefreshTokenFamily(stored.FamilyID, time.Now().UTC()); err != nil {
+		log.Printf("Error revoking session of admin %d: %v", stored.AdminID, err)
+		return err
+	}
+	return nil
+}
+
+// LogoutAll ends every session of the admin. Their access tokens keep working until they expire.
+func (s *adminAuthService) LogoutAll(adminID int) error {
+	if err := s.repo.RevokeAdminRefreshTokens(adminID, time.Now().UTC()); err != nil {
+		log.Printf("Error revoking sessions of admin %d: %v", adminID, err)
+		return err
+	}
+	log.Printf("Sesiones del admin %d cerradas", adminID)
+	return nil
+}
+
+// revokeFamily revokes a session and returns the error for its refresh token.
+func (s *adminAuthService) revokeFamily(familyID string, now time.Time) error {
+	if err := s.repo.RevokeRefreshTokenFamily(familyID, now); err != nil {
+		log.Printf("Error revoking refresh token family: %v", err)
+		return err
+	}
+	return errInvalidRefreshToken()
+}
+
+// newAdminRefreshToken returns a refresh token of the family to store, and the secret to hand out.
+func newAdminRefreshToken(adminID int, familyID string) (*db.AdminRefreshToken, string, error) {
+	secret, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	return &db.AdminRefreshToken{
+		AdminID:   adminID,
+		FamilyID:  familyID,
+		TokenHash: hashSecret(secret),
+		ExpiresAt: time.Now().UTC().Add(adminRefreshTokenTTL),
+	}, secret, nil
+}
+
+func newAdminSession(admin *repository.Admin, refresh *db.AdminRefreshToken, secret string) (*entities.AdminSession, error) {
+	// Creamos un JWT con el rol del admin
+	token, expiresAt, err := auth.NewAdminToken(admin.ID, admin.User, admin.Role)
+	if err != nil {
+		log.Printf("Error signing admin token: %v", err)
+		return nil, err
+	}
+	return &entities.AdminSession{
+		Token:            token,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     secret,
+		RefreshExpiresAt: refresh.ExpiresAt,
+	}, nil
+}
+
+// CreateAdmin creates an active admin account. Accounts are read-only unless the request gives another role.
+func (s *adminAuthService) CreateAdmin(req entities.AdminUserRequest) (*entities.AdminUser, error) {
+	req.User = strings.TrimSpace(req.User)
+	if err := validateAdminCredentials(req.User, req.Password); err != nil {
+		return nil, err
+	}
+	if req.Role == "" {
+		req.Role = auth.RoleReadOnly
+	}
+	if !auth.ValidRole(req.Role) {
+		return nil, errInvalidRole(req.Role)
 	}
 
-	err := s.repo.CreateNewUser(user, password)
+	admin, err := s.repo.CreateNewUser(req.User, req.Password, req.Role)
 	if err != nil {
 		log.Printf("Error from CreateNewUser: %v", err)
-		return err
+		if stdErrors.Is(err, repository.ErrAdminExists) {
+			return nil, errors.NewHTTPError(http.StatusConflict, "User name '"+req.User+"' is already taken")
+		}
+		return nil, err
+	}
+	log.Printf("Admin %s creado con rol %s", admin.User, admin.Role)
+	return adminUser(admin), nil
+}
+
+// BootstrapOwner creates the first owner of a new installation. It fails once any admin exists: from then on owners
+// create accounts with CreateAdmin.
+func (s *adminAuthService) BootstrapOwner(user, password string) (*entities.AdminUser, error) {
+	user = strings.TrimSpace(user)
+	if err := validateAdminCredentials(user, password); err != nil {
+		return nil, err
+	}
+	admin, err := s.repo.CreateFirstOwner(user, password)
+	if err != nil {
+		log.Printf("Error from CreateFirstOwner: %v", err)
+		if stdErrors.Is(err, repository.ErrAdminsExist) {
+			return nil, errors.NewHTTPError(http.StatusConflict, "Admins already exist: owners create new accounts")
+		}
+		return nil, err
+	}
+	log.Printf("Primer owner %s creado", admin.User)
+	return adminUser(admin), nil
+}
+
+func (s *adminAuthService) ListAdmins() ([]entities.AdminUser, error) {
+	admins, err := s.repo.ListAdmins()
+	if err != nil {
+		log.Printf("Error listing admins: %v", err)
+		return nil, err
+	}
+	users := make([]entities.AdminUser, 0, len(admins))
+	for i := range admins {
+		users = append(users, *adminUser(&admins[i]))
+	}
+	return users, nil
+}
+
+// UpdateAdmin changes the role of an admin or disables them. There is always at least one active owner left.
+// Disabling an admin ends their sessions; a new role applies from their next refresh.
+func (s *adminAuthService) UpdateAdmin(id int, update entities.AdminUserUpdate) (*entities.AdminUser, error) {
+	admin, err := s.repo.GetAdminByID(id)
+	if err != nil {
+		log.Printf("Error getting admin %d: %v", id, err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NewHTTPError(http.StatusNotFound, "Admin not found")
+		}
+		return nil, err
+	}
+	if update.Role != nil {
+		if !auth.ValidRole(*update.Role) {
+			return nil, errInvalidRole(*update.Role)
+		}
+		admin.Role = *update.Role
+	}
+	if update.Active != nil {
+		admin.Active = *update.Active
 	}
 
+	if err := s.repo.UpdateAdmin(admin.ID, admin.Role, admin.Active); err != nil {
+		log.Printf("Error updating admin %d: %v", id, err)
+		switch {
+		case stdErrors.Is(err, repository.ErrLastOwner):
+			return nil, errors.NewHTTPError(http.StatusConflict, "At least one active owner is required")
+		case stdErrors.Is(err, sql.ErrNoRows):
+			return nil, errors.NewHTTPError(http.StatusNotFound, "Admin not found")
+		}
+		return nil, err
+	}
+	if !admin.Active {
+		// Un admin deshabilitado pierde sus sesiones; su access token caduca en pocos minutos.
+		if err := s.repo.RevokeAdminRefreshTokens(admin.ID, time.Now().UTC()); err != nil {
+			log.Printf("Error revoking sessions of admin %d: %v", id, err)
+			return nil, err
+		}
+	}
+	log.Printf("Admin %s actualizado: rol %s, activo %t", admin.User, admin.Role, admin.Active)
+	return adminUser(admin), nil
+}
+
+// validateAdminCredentials checks the user name and the strength of the password: at least minAdminPasswordLength
+// characters, letters mixed with digits or symbols, and not the user name.
+func validateAdminCredentials(user, password string) error {
+	if user == "" || password == "" {
+		return errors.NewHTTPError(http.StatusBadRequest, "user and password cannot be empty")
+	}
+
+	var problems []string
+	if utf8.RuneCountInString(password) < minAdminPasswordLength {
+		problems = append(problems, fmt.Sprintf("use at least %d characters", minAdminPasswordLength))
+	}
+	// bcrypt only hashes the first 72 bytes.
+	if len(password) > 72 {
+		problems = append(problems, "use at most 72 bytes")
+	}
+	var letters, others bool
+	for _, r := range password {
+		if unicode.IsLetter(r) {
+			letters = true
+		} else {
+			others = true
+		}
+	}
+	if !letters || !others {
+		problems = append(problems, "mix letters with digits or symbols")
+	}
+	if strings.Contains(strings.ToLower(password), strings.ToLower(user)) {
+		problems = append(problems, "leave out the user name")
+	}
+	if len(problems) > 0 {
+		return errors.NewHTTPError(http.StatusBadRequest, "Password too weak: "+strings.Join(problems, "; "))
+	}
 	return nil
 }
+
+func errInvalidCredentials() *errors.HTTPError {
+	return errors.NewHTTPError(http.StatusUnauthorized, "Invalid credentials")
+}
+
+func errInvalidRefreshToken() *errors.HTTPError {
+	return errors.NewHTTPError(http.StatusUnauthorized, "Invalid or expired refresh token")
+}
+
+func errInvalidRole(role string) *errors.HTTPError {
+	return errors.NewHTTPError(http.StatusBadRequest, "Invalid role '"+role+"': use owner, manager, attendant or read_only")
+}
+
+func adminUser(admin *repository.Admin) *entities.AdminUser {
+	return &entities.AdminUser{
+		ID:        admin.ID,
+		User:      admin.User,
+		Role:      admin.Role,
+		Active:    admin.Active,
+		CreatedAt: admin.CreatedAt,
+	}
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"estacionamienti/internal/auth"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/repository/memory"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func createAdmin(t *testing.T, svc AdminAuthService, user, role string) *entities.AdminUser {
+	t.Helper()
+	admin, err := svc.CreateAdmin(entities.AdminUserRequest{User: user, Password: "correct horse", Role: role})
+	if err != nil {
+		t.Fatalf("CreateAdmin %s: %v", user, err)
+	}
+	return admin
+}
+
+func expectHTTPError(t *testing.T, err error, code int) {
+	t.Helper()
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != code {
+		t.Fatalf("expected %d, got %v", code, err)
+	}
+}
+
+func TestAdminLoginCarriesRole(t *testing.T) {
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	svc := NewAdminAuthService(memory.NewStore())
+	createAdmin(t, svc, "owner", auth.RoleOwner)
+	manager := createAdmin(t, svc, "giulia", auth.RoleManager)
+
+	session, err := svc.Login("giulia", "correct horse")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	var claims auth.AdminClaims
+	if _, err := jwt.ParseWithClaims(session.Token, &claims, func(*jwt.Token) (interface{}, error) { return []byte("jwt-secret"), nil }); err != nil {
+		t.Fatalf("parsing token: %v", err)
+	}
+	if claims.AdminID != manager.ID || claims.User != "giulia" || claims.Role != auth.RoleManager {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	if _, err := svc.Login("giulia", "wrong"); err == nil {
+		t.Fatalf("expected a wrong password to fail")
+	}
+	disabled := false
+	if _, err := svc.UpdateAdmin(manager.ID, entities.AdminUserUpdate{Active: &disabled}); err != nil {
+		t.Fatalf("UpdateAdmin: %v", err)
+	}
+	if _, err := svc.Login("giulia", "correct horse"); err == nil {
+		t.Fatalf("expected a disabled admin not to log in")
+	}
+}
+
+func TestAdminUserManagement(t *testing.T) {
+	svc := NewAdminAuthService(memory.NewStore())
+	owner := createAdmin(t, svc, "owner", auth.RoleOwner)
+	if admin := createAdmin(t, svc, "marco", ""); admin.Role != auth.RoleReadOnly || !admin.Active {
+		t.Fatalf("expected an active read-only admin by default, got %+v", admin)
+	}
+	_, err := svc.CreateAdmin(entities.AdminUserRequest{User: "x", Password: "correct horse", Role: "superuser"})
+	expectHTTPError(t, err, http.StatusBadRequest)
+
+	// The only owner can't be demoted nor disabled.
+	attendant, disabled := auth.RoleAttendant, false
+	_, err = svc.UpdateAdmin(owner.ID, entities.AdminUserUpdate{Role: &attendant})
+	expectHTTPError(t, err, http.StatusConflict)
+	_, err = svc.UpdateAdmin(owner.ID, entities.AdminUserUpdate{Active: &disabled})
+	expectHTTPError(t, err, http.StatusConflict)
+	_, err = svc.UpdateAdmin(99, entities.AdminUserUpdate{Active: &disabled})
+	expectHTTPError(t, err, http.StatusNotFound)
+
+	// With a second owner, the first one can step down.
+	promoted := auth.RoleOwner
+	second := createAdmin(t, svc, "anna", auth.RoleManager)
+	if _, err := svc.UpdateAdmin(second.ID, entities.AdminUserUpdate{Role: &promoted}); err != nil {
+		t.Fatalf("UpdateAdmin: %v", err)
+	}
+	updated, err := svc.UpdateAdmin(owner.ID, entities.AdminUserUpdate{Role: &attendant})
+	if err != nil {
+		t.Fatalf("UpdateAdmin: %v", err)
+	}
+	if updated.Role != auth.RoleAttendant || !updated.Active {
+		t.Fatalf("unexpected admin %+v", updated)
+	}
+
+	admins, err := svc.ListAdmins()
+	if err != nil {
+		t.Fatalf("ListAdmins: %v", err)
+	}
+	if len(admins) != 3 || admins[0].User != "anna" || admins[0].Role != auth.RoleOwner {
+		t.Fatalf("unexpected admins %+v", admins)
+	}
+}
+
+func TestAdminPasswordStrength(t *testing.T) {
+	svc := NewAdminAuthService(memory.NewStore())
+	for _, password := range []string{"", "short1!", "onlylettershere", "123456789012345", "xxgiuliaxx2024", strings.Repeat("a1", 40)} {
+		_, err := svc.CreateAdmin(entities.AdminUserRequest{User: "giulia", Password: password})
+		expectHTTPError(t, err, http.StatusBadRequest)
+	}
+	createAdmin(t, svc, "giulia", auth.RoleAttendant)
+
+	// User names are unique.
+	_, err := svc.CreateAdmin(entities.AdminUserRequest{User: " giulia ", Password: "another horse"})
+	expectHTTPError(t, err, http.StatusConflict)
+}
+
+func TestBootstrapOwnerOnlyOnce(t *testing.T) {
+	svc := NewAdminAuthService(memory.NewStore())
+	_, err := svc.BootstrapOwner("owner", "password")
+	expectHTTPError(t, err, http.StatusBadRequest)
+
+	owner, err := svc.BootstrapOwner("owner", "correct horse")
+	if err != nil {
+		t.Fatalf("BootstrapOwner: %v", err)
+	}
+	if owner.Role != auth.RoleOwner || !owner.Active {
+		t.Fatalf("expected an active owner, got %+v", owner)
+	}
+	_, err = svc.BootstrapOwner("intruder", "correct horse")
+	expectHTTPError(t, err, http.StatusConflict)
+}
+
+func expectRefreshFails(t *testing.T, svc AdminAuthService, refreshToken string) {
+	t.Helper()
+	_, err := svc.Refresh(refreshToken)
+	expectHTTPError(t, err, http.StatusUnauthorized)
+}
+
+func TestAdminRefreshTokensRotate(t *testing.T) {
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	svc := NewAdminAuthService(memory.NewStore())
+	createAdmin(t, svc, "owner", auth.RoleOwner)
+	login, err := svc.Login("owner", "correct horse")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	refreshed, err := svc.Refresh(login.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if refreshed.Token == "" || refreshed.RefreshToken == login.RefreshToken {
+		t.Fatalf("expected a new access token and refresh token, got %+v", refreshed)
+	}
+
+	// Using the first refresh token again revokes the whole session, the token that replaced it too.
+	expectRefreshFails(t, svc, login.RefreshToken)
+	expectRefreshFails(t, svc, refreshed.RefreshToken)
+	expectRefreshFails(t, svc, "made-up")
+}
+
+func TestAdminLogoutAndRevocation(t *testing.T) {
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	svc := NewAdminAuthService(memory.NewStore())
+	createAdmin(t, svc, "owner", auth.RoleOwner)
+	giulia := createAdmin(t, svc, "giulia", auth.RoleAttendant)
+	login := func(user string) *entities.AdminSession {
+		t.Helper()
+		session, err := svc.Login(user, "correct horse")
+		if err != nil {
+			t.Fatalf("Login %s: %v", user, err)
+		}
+		return session
+	}
+
+	laptop, phone := login("owner"), login("owner")
+	if err := svc.Logout(laptop.RefreshToken); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	expectRefreshFails(t, svc, laptop.RefreshToken)
+	if _, err := svc.Refresh(phone.RefreshToken); err != nil {
+		t.Fatalf("expected the other session to keep working: %v", err)
+	}
+
+	first, second := login("giulia"), login("giulia")
+	if err := svc.LogoutAll(giulia.ID); err != nil {
+		t.Fatalf("LogoutAll: %v", err)
+	}
+	expectRefreshFails(t, svc, first.RefreshToken)
+	expectRefreshFails(t, svc, second.RefreshToken)
+
+	// A new role applies on refresh; disabling ends the sessions.
+	session := login("giulia")
+	manager, disabled := auth.RoleManager, false
+	if _, err := svc.UpdateAdmin(giulia.ID, entities.AdminUserUpdate{Role: &manager}); err != nil {
+		t.Fatalf("UpdateAdmin: %v", err)
+	}
+	session, err := svc.Refresh(session.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	var claims auth.AdminClaims
+	jwt.ParseWithClaims(session.Token, &claims, func(*jwt.Token) (interface{}, error) { return []byte("jwt-secret"), nil })
+	if claims.Role != auth.RoleManager {
+		t.Fatalf("expected the new role in the refreshed token, got %q", claims.Role)
+	}
+	if _, err := svc.UpdateAdmin(giulia.ID, entities.AdminUserUpdate{Active: &disabled}); err != nil {
+		t.Fatalf("UpdateAdmin: %v", err)
+	}
+	expectRefreshFails(t, svc, session.RefreshToken)
+}
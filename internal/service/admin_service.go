@@ -1,27 +1,37 @@
 package service
 
 import (
+	stdErrors "errors"
 	"estacionamienti/internal/db"
 	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/money"
 	"estacionamienti/internal/repository"
-	"fmt"
 	"log"
+	"net/http"
+	"strings"
 	"time"
 
 	"database/sql"
 )
 
 type AdminService struct {
-	adminRepo       *repository.AdminRepository
-	reservationRepo *repository.ReservationRepository
+	adminRepo       repository.AdminRepository
+	reservationRepo repository.ReservationRepository
+	pricing         pricingRepos
+	refundPolicy    repository.RefundPolicyRepository
 	stripeService   *StripeService
 	senderService   *SenderService
 }
 
-func NewAdminService(adminRepo *repository.AdminRepository, reservationRepo *repository.ReservationRepository, stripeService *StripeService, senderService *SenderService) *AdminService {
+func NewAdminService(adminRepo repository.AdminRepository, reservationRepo repository.ReservationRepository, pricingRepo repository.PricingRepository,
+	promoCodeRepo repository.PromoCodeRepository, refundPolicyRepo repository.RefundPolicyRepository, stripeService *StripeService,
+	senderService *SenderService) *AdminService {
 	return &AdminService{adminRepo: adminRepo,
 		stripeService:   stripeService,
 		reservationRepo: reservationRepo,
+		pricing:         pricingRepos{pricingRepo, promoCodeRepo},
+		refundPolicy:    refundPolicyRepo,
 		senderService:   senderService}
 }
 
@@ -34,11 +44,30 @@ func (s *AdminService) ListReservations(startTime, endTime, code, vehicleType, s
 	return reservationList, nil
 }
 
+// CreateReservation books an active reservation for a customer at the desk. Nothing is paid when booking it, so its
+// deposit is 0 and the whole price is left as balance due, to collect on site or record as an admin payment.
 func (s *AdminService) CreateReservation(reservationReq *entities.ReservationRequest) (reservationResponse *entities.ReservationResponse, err error) {
-	code := fmt.Sprintf("%08X", time.Now().UnixNano()%100000000)
+	if reservationReq.PaymentMethodID != paymentMethodOnsite && reservationReq.PaymentMethodID != paymentMethodOnline {
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "Método de pago no soportado")
+	}
+	if err = checkVehicleType(s.reservationRepo, reservationReq.VehicleTypeID); err != nil {
+		log.Printf("Error checking vehicle type: %v", err)
+		return nil, err
+	}
+
+	// Admins may leave total_price empty; a declared total must still match the computed one.
+	var price *reservationPrice
+	if reservationReq.TotalPrice == 0 {
+		price, err = priceRequest(s.pricing, reservationReq)
+	} else {
+		price, err = checkDeclaredPrice(s.pricing, reservationReq)
+	}
+	if err != nil {
+		log.Printf("[AdminService] Error pricing reservation: %v", err)
+		return nil, err
+	}
 
 	reservation := &db.Reservation{
-		Code:            code,
 		UserName:        reservationReq.UserName,
 		UserEmail:       reservationReq.UserEmail,
 		UserPhone:       sql.NullString{String: reservationReq.UserPhone, Valid: reservationReq.UserPhone != ""},
@@ -47,29 +76,36 @@ func (s *AdminService) CreateReservation(reservationReq *entities.ReservationReq
 		VehicleModel:    sql.NullString{String: reservationReq.VehicleModel, Valid: reservationReq.VehicleModel != ""},
 		PaymentMethodID: reservationReq.PaymentMethodID,
 		Status:          statusActive,
-		TotalPrice:      sql.NullFloat64{Float64: float64(reservationReq.TotalPrice), Valid: reservationReq.TotalPrice != 0},
+		TotalPrice:      price.total,
 		StartTime:       reservationReq.StartTime,
 		EndTime:         reservationReq.EndTime,
 		Language:        reservationReq.Language,
 		CreatedAt:       time.Now().UTC(),
 		UpdatedAt:       time.Now().UTC(),
 	}
+	price.applyTo(reservation)
 
-	err = s.reservationRepo.CreateReservation(reservation)
+	notify := func(res *db.Reservation) []db.Notification {
+		return s.senderService.ReservationNotifications(res, statusActive)
+	}
+	conflicts, err := s.reservationRepo.CreateReservationIfAvailable(reservation, reservation.CreatedAt.Add(-pendingHoldWindow), notify)
 	if err != nil {
 		log.Printf("Error creating reservation in repository: %v", err)
+		if stdErrors.Is(err, repository.ErrPromoCodeExhausted) {
+			return nil, errPromoCodeExhausted()
+		}
 		return nil, err
 	}
+	if len(conflicts) > 0 {
+		log.Printf("[AdminService] Reservation rejected, no spaces left for vehicle type %d in %d slots", reservationReq.VehicleTypeID, len(conflicts))
+		return nil, errNoAvailability(conflicts)
+	}
 
-	reservationResponse, err = s.adminRepo.FindReservationByCode(code)
+	reservationResponse, err = s.adminRepo.FindReservationByCode(reservation.Code)
 	if err != nil {
 		log.Printf("Error getting reservation from repository: %v", err)
 		return nil, err
 	}
-	statusTraducido := s.senderService.StatusTranslation(statusActive, reservation.Language)
-	s.senderService.SendReservationSMS(*reservationResponse, statusTraducido)
-	s.senderService.SendReservationEmail(*reservationResponse, statusTraducido)
-
 	return reservationResponse, nil
 }
 
@@ -79,29 +115,34 @@ func (s *AdminService) CancelReservation(code string, refund bool) error {
 		log.Printf("Error canceling reservation: %v", err)
 		return err
 	}
-	sessionID := reservation.StripeSessionID
-	// Si la session de stripe no está, se puede cancelar (Quiere decir que nunca hubo pago por stripe)
-	if sessionID.String == "" {
-		_, err = s.reservationRepo.CancelReservation(code)
-		if err != nil {
-			log.Printf("Error canceling reservation: %v", err)
-			return err
-		}
-		return nil
-	}
+	// Admins override the refund policy: refunding gives back everything paid through Stripe and not refunded yet.
+	var refundAmount money.Amount
 	if refund {
-		err = s.stripeService.RefundPaymentBySessionID(sessionID.String)
+		paid, refunded, err := s.stripeService.payments.stripePaid(reservation)
 		if err != nil {
-			log.Printf("Error refunding payment: %v", err)
 			return err
 		}
+		refundAmount = max(paid-refunded, 0)
 	}
-	_, err = s.reservationRepo.CancelReservation(code)
-	if err != nil {
+	if _, err := cancelReservation(s.reservationRepo, s.stripeService, reservation, refundAmount, "admin cancellation", nil); err != nil {
 		log.Printf("Error canceling reservation: %v", err)
 		return err
 	}
-	return err
+	return nil
+}
+
+// ModifyReservation changes the window or vehicle of a reservation, even one already started. Price decreases are
+// refunded in full, regardless of the refund policy; increases are left as balance due to collect on site.
+func (s *AdminService) ModifyReservation(code string, req entities.ReservationChangeRequest, adminUser string) (*entities.ReservationChangeResponse, error) {
+	reservation, err := s.reservationRepo.GetReservationByCodeOnly(code)
+	if err != nil {
+		log.Printf("[AdminService] Error getting reservation %s to modify: %v", code, err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NewHTTPError(http.StatusNotFound, "Reservation not found")
+		}
+		return nil, err
+	}
+	return modifyReservation(s.reservationRepo, s.pricing, s.refundPolicy, s.stripeService, s.senderService, reservation, req, adminUser, true)
 }
 
 func (s *AdminService) ListVehicleSpaces() ([]db.VehicleSpaceWithPrices, error) {
@@ -113,10 +154,16 @@ func (s *AdminService) ListVehicleSpaces() ([]db.VehicleSpaceWithPrices, error)
 	return spaces, nil
 }
 
-func (s *AdminService) UpdateVehicleSpacesAndPrices(vehicleType string, spaces int, prices map[string]float32) error {
+func (s *AdminService) UpdateVehicleSpacesAndPrices(vehicleType string, spaces int, prices map[string]money.Amount) error {
+	if spaces < 0 {
+		return errors.NewHTTPError(http.StatusBadRequest, "spaces cannot be negative")
+	}
 	err := s.adminRepo.UpdateVehicleSpaces(vehicleType, spaces)
 	if err != nil {
 		log.Printf("[AdminService] Error updating spaces for vehicleType '%s': %v", vehicleType, err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return errors.NewHTTPError(http.StatusNotFound, "Vehicle type not found or not assigned to a space pool")
+		}
 		return err
 	}
 	for timeName, price := range prices {
@@ -128,3 +175,65 @@ func (s *AdminService) UpdateVehicleSpacesAndPrices(vehicleType string, spaces i
 	}
 	return nil
 }
+
+func (s *AdminService) ListSpacePools() ([]db.SpacePool, error) {
+	pools, err := s.adminRepo.ListSpacePools()
+	if err != nil {
+		log.Printf("[AdminService] Error listing space pools: %v", err)
+		return nil, err
+	}
+	return pools, nil
+}
+
+func (s *AdminService) CreateSpacePool(name string, spaces int) (*db.SpacePool, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "name is required")
+	}
+	if spaces < 0 {
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "spaces cannot be negative")
+	}
+	pool, err := s.adminRepo.CreateSpacePool(name, spaces)
+	if err != nil {
+		log.Printf("[AdminService] Error creating space pool '%s': %v", name, err)
+		return nil, err
+	}
+	return pool, nil
+}
+
+// AssignVehicleTypeToPool moves a vehicle type to the given pool, so its reservations share that pool's spaces.
+func (s *AdminService) AssignVehicleTypeToPool(vehicleType, poolName string) error {
+	err := s.adminRepo.AssignVehicleTypeToPool(vehicleType, poolName)
+	if err != nil {
+		log.Printf("[AdminService] Error moving vehicleType '%s' to pool '%s': %v", vehicleType, poolName, err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return errors.NewHTTPError(http.StatusNotFound, "Vehicle type or space pool not found")
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *AdminService) ListRefundPolicy() ([]db.RefundTier, error) {
+	tiers, err := s.refundPolicy.ListRefundPolicy()
+	if err != nil {
+		log.Printf("[AdminService] Error listing refund policy: %v", err)
+		return nil, err
+	}
+	return tiers, nil
+}
+
+// UpdateRefundPolicy replaces the refund tiers of a payment method. It applies to cancellations from now on.
+func (s *AdminService) UpdateRefundPolicy(paymentMethodID int, tiers []db.RefundTier) error {
+	if paymentMethodID != paymentMethodOnsite && paymentMethodID != paymentMethodOnline {
+		return errors.NewHTTPError(http.StatusNotFound, "Payment method not found")
+	}
+	if err := validateRefundTiers(tiers); err != nil {
+		return err
+	}
+	if err := s.refundPolicy.ReplaceRefundPolicy(paymentMethodID, tiers); err != nil {
+		log.Printf("[AdminService] Error updating refund policy of payment method %d: %v", paymentMethodID, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/repository/memory"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestAdminService(store *memory.Store) *AdminService {
+	return NewAdminService(store, store, store, store, store, newTestStripeService(store), newTestSenderService())
+}
+
+func adminRequest(vehicleTypeID int, start, end time.Time) *entities.ReservationRequest {
+	return &entities.ReservationRequest{
+		VehicleTypeID:   vehicleTypeID,
+		UserName:        "Giulia Bianchi",
+		UserEmail:       "giulia@example.com",
+		VehiclePlate:    "CD456EF",
+		PaymentMethodID: paymentMethodOnsite,
+		StartTime:       start,
+		EndTime:         end,
+		Language:        "it",
+	}
+}
+
+func TestAdminCreateReservationComputesPrice(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := newTestAdminService(store)
+	start := futureHour(48)
+
+	res, err := svc.CreateReservation(adminRequest(motorcycleTypeID, start, start.Add(26*time.Hour)))
+	if err != nil {
+		t.Fatalf("CreateReservation: %v", err)
+	}
+	if res.Status != statusActive {
+		t.Fatalf("admin reservations start active, got %q", res.Status)
+	}
+	if res.TotalPrice != 1200 {
+		t.Fatalf("expected server price 1200, got %v", res.TotalPrice)
+	}
+	// Nothing is paid when an admin books, so the whole price is due.
+	if got := store.Reservation(res.Code).DepositPayment; got != 0 {
+		t.Fatalf("expected no deposit, got %v", got)
+	}
+	if res.AmountPaid != 0 || res.BalanceDue != 1200 {
+		t.Fatalf("expected nothing paid and 1200 due, got %v paid and %v due", res.AmountPaid, res.BalanceDue)
+	}
+}
+
+func TestAdminCreateReservationRejectsUnknownPaymentMethod(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := newTestAdminService(store)
+	start := futureHour(48)
+	req := adminRequest(motorcycleTypeID, start, start.Add(2*time.Hour))
+	req.PaymentMethodID = 7
+
+	_, err := svc.CreateReservation(req)
+	herr, ok := err.(*errors.HTTPError)
+	if !ok || herr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a 400 HTTPError, got %v", err)
+	}
+}
+
+func TestAdminCreateReservationRejectsOverbooking(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := newTestAdminService(store)
+	start, end := futureHour(48), futureHour(50)
+	if err := svc.UpdateVehicleSpacesAndPrices("motorcycle", 1, nil); err != nil {
+		t.Fatalf("UpdateVehicleSpacesAndPrices: %v", err)
+	}
+
+	if _, err := svc.CreateReservation(adminRequest(motorcycleTypeID, start, end)); err != nil {
+		t.Fatalf("first reservation: %v", err)
+	}
+	_, err := svc.CreateReservation(adminRequest(motorcycleTypeID, start.Add(time.Hour), end.Add(time.Hour)))
+	herr, ok := err.(*errors.HTTPError)
+	if !ok || herr.Code != http.StatusConflict {
+		t.Fatalf("expected a 409 HTTPError, got %v", err)
+	}
+}
+
+func TestAdminCancelReservation(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := newTestAdminService(store)
+	store.InsertReservation(newReservation("ADMCAN01", carTypeID, statusActive, futureHour(1), futureHour(3)))
+
+	// Admins are not bound by the refund policy windows.
+	if err := svc.CancelReservation("ADMCAN01", false); err != nil {
+		t.Fatalf("CancelReservation: %v", err)
+	}
+	if got := store.Reservation("ADMCAN01").Status; got != statusCancel {
+		t.Fatalf("expected status %q, got %q", statusCancel, got)
+	}
+}
+
+func TestAdminSpacePools(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := newTestAdminService(store)
+	start, end := futureHour(48), futureHour(49)
+
+	if _, err := svc.CreateSpacePool("ev", 1); err != nil {
+		t.Fatalf("CreateSpacePool: %v", err)
+	}
+	if _, err := svc.CreateSpacePool(" ", 1); err == nil {
+		t.Fatal("expected an error for an empty pool name")
+	}
+	if err := svc.AssignVehicleTypeToPool("suv", "ev"); err != nil {
+		t.Fatalf("AssignVehicleTypeToPool: %v", err)
+	}
+	err := svc.AssignVehicleTypeToPool("suv", "missing")
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusNotFound {
+		t.Fatalf("expected a 404 HTTPError, got %v", err)
+	}
+
+	// SUVs no longer compete with cars once they have their own pool.
+	fillPool(store, carTypeID, 20, start, end)
+	if _, err := svc.CreateReservation(adminRequest(suvTypeID, start, end)); err != nil {
+		t.Fatalf("SUV reservation in its own pool: %v", err)
+	}
+	if _, err := svc.CreateReservation(adminRequest(suvTypeID, start, end)); err == nil {
+		t.Fatal("expected the single-space ev pool to be full")
+	}
+
+	spaces, err := svc.ListVehicleSpaces()
+	if err != nil {
+		t.Fatalf("ListVehicleSpaces: %v", err)
+	}
+	for _, vs := range spaces {
+		if vs.VehicleType == "suv" && (vs.SpacePool != "ev" || vs.Spaces != 1) {
+			t.Fatalf("unexpected suv configuration %+v", vs)
+		}
+	}
+}
+
+func TestAdminListReservationsFilters(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := newTestAdminService(store)
+	store.InsertReservation(newReservation("LIST0001", carTypeID, statusActive, futureHour(48), futureHour(50)))
+	store.InsertReservation(newReservation("LIST0002", motorcycleTypeID, statusCancel, futureHour(48), futureHour(50)))
+	store.InsertReservation(newReservation("LIST0003", carTypeID, statusActive, futureHour(60), futureHour(62)))
+
+	list, err := svc.ListReservations("", "", "", "car", statusActive, "1", "0")
+	if err != nil {
+		t.Fatalf("ListReservations: %v", err)
+	}
+	if list.Total != 2 || len(list.Reservations) != 1 {
+		t.Fatalf("expected 2 matches and a page of 1, got total %d page %d", list.Total, len(list.Reservations))
+	}
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	stdErrors "errors"
+	"estacionamienti/internal/auth"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/repository"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// loginCodeTTL is how long a magic link and its code can be used.
+	loginCodeTTL = 15 * time.Minute
+	// loginCodeMaxAttempts is how many times a code can be typed before it stops working.
+	loginCodeMaxAttempts = 5
+	// loginCodesPerHour caps the codes sent to one email, so the attempts limit can't be reset at will.
+	loginCodesPerHour = 5
+)
+
+// CustomerAuthService signs customers in by email: it sends them a magic link and a one-time code, and exchanges
+// either for a short-lived token scoped to their email.
+type CustomerAuthService struct {
+	repo            repository.CustomerAuthRepository
+	reservationRepo repository.ReservationRepository
+	senderService   *SenderService
+
+	// PortalURL is the customer portal page that signs in with the token of a magic link, passed as ?token=.
+	// Emails only carry the code when it is empty.
+	PortalURL string
+}
+
+func NewCustomerAuthService(repo repository.CustomerAuthRepository, reservationRepo repository.ReservationRepository, senderService *SenderService) *CustomerAuthService {
+	return &CustomerAuthService{repo: repo, reservationRepo: reservationRepo, senderService: senderService}
+}
+
+// RequestLogin queues an email with a magic link and a code to the customer, only if they have reservations. It succeeds either way
+// so it can't be used to find out which emails have booked.
+func (s *CustomerAuthService) RequestLogin(req entities.CustomerLoginRequest) error {
+	email := normalizeEmail(req.Email)
+	if email == "" || !strings.Contains(email, "@") {
+		return errors.NewHTTPError(http.StatusBadRequest, "A valid email is required")
+	}
+
+	reservations, err := s.reservationRepo.ListReservationsByEmail(email)
+	if err != nil {
+		log.Printf("Error listing reservations of %s: %v", email, err)
+		return err
+	}
+	if len(reservations) == 0 {
+		log.Printf("Login pedido para %s, sin reservas: no se envía código", email)
+		return nil
+	}
+	sent, err := s.repo.CountLoginCodesSince(email, time.Now().UTC().Add(-time.Hour))
+	if err != nil {
+		log.Printf("Error counting login codes of %s: %v", email, err)
+		return err
+	}
+	if sent >= loginCodesPerHour {
+		log.Printf("Login pedido para %s: ya se enviaron %d códigos en la última hora", email, sent)
+		return nil
+	}
+
+	code, err := randomLoginCode()
+	if err != nil {
+		return err
+	}
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	latest := reservations[0]
+	language := req.Language
+	if language == "" {
+		language = latest.Language
+	}
+	var link string
+	if s.PortalURL != "" {
+		link = s.PortalURL + "?token=" + url.QueryEscape(token)
+	}
+	loginCode := &db.CustomerLoginCode{
+		Email:     email,
+		CodeHash:  hashSecret(code),
+		TokenHash: hashSecret(token),
+		ExpiresAt: time.Now().UTC().Add(loginCodeTTL),
+	}
+	notification := s.senderService.LoginCodeNotification(latest.Code, latest.UserEmail, latest.UserName, language, code, link, loginCodeTTL)
+	if err := s.repo.CreateLoginCode(loginCode, []db.Notification{notification}); err != nil {
+		log.Printf("Error storing login code for %s: %v", email, err)
+		return err
+	}
+	return nil
+}
+
+// VerifyLogin exchanges the token of a magic link, or an email and its code, for a customer session. Each login code
+// works once.
+func (s *CustomerAuthService) VerifyLogin(req entities.CustomerVerifyRequest) (*entities.CustomerSession, error) {
+	now := time.Now().UTC()
+	var loginCode *db.CustomerLoginCode
+	var err error
+	switch {
+	case req.Token != "":
+		loginCode, err = s.repo.GetActiveLoginCodeByTokenHash(hashSecret(req.Token), now)
+	case req.Email != "" && req.Code != "":
+		loginCode, err = s.repo.GetActiveLoginCodeByEmail(normalizeEmail(req.Email), now)
+	default:
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "token, or email and code, are required")
+	}
+	if err != nil {
+		log.Printf("Error getting login code: %v", err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return nil, errInvalidLoginCode()
+		}
+		return nil, err
+	}
+
+	if req.Token == "" {
+		allowed, err := s.repo.RecordLoginCodeAttempt(loginCode.ID, loginCodeMaxAttempts)
+		if err != nil {
+			log.Printf("Error recording login attempt for %s: %v", loginCode.Email, err)
+			return nil, err
+		}
+		if !allowed {
+			log.Printf("Login code de %s bloqueado tras %d intentos", loginCode.Email, loginCodeMaxAttempts)
+			return nil, errInvalidLoginCode()
+		}
+		if subtle.ConstantTimeCompare([]byte(hashSecret(strings.TrimSpace(req.Code))), []byte(loginCode.CodeHash)) != 1 {
+			return nil, errInvalidLoginCode()
+		}
+	}
+
+	used, err := s.repo.MarkLoginCodeUsed(loginCode.ID, now)
+	if err != nil {
+		log.Printf("Error using login code of %s: %v", loginCode.Email, err)
+		return nil, err
+	}
+	if !used {
+		return nil, errInvalidLoginCode()
+	}
+
+	token, expiresAt, err := auth.NewCustomerToken(loginCode.Email)
+	if err != nil {
+		log.Printf("Error signing customer token: %v", err)
+		return nil, err
+	}
+	return &entities.CustomerSession{Token: token, Email: loginCode.Email, ExpiresAt: expiresAt}, nil
+}
+
+func errInvalidLoginCode() *errors.HTTPError {
+	return errors.NewHTTPError(http.StatusUnauthorized, "Invalid or expired login code")
+}
+
+// normalizeEmail is how customer emails are compared: trimmed and in lower case.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// randomLoginCode returns a random 6-digit code.
+func randomLoginCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// randomToken returns 32 random bytes encoded for URLs, for magic links and refresh tokens.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSecret is how login codes, magic links and refresh tokens are stored.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/repository/memory"
+	"io"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var (
+	loginCodePattern  = regexp.MustCompile(`\b(\d{6})\b`)
+	loginTokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+)
+
+// loginEnv is a customer auth service whose queued emails are delivered to outbox by notifier.
+type loginEnv struct {
+	svc      *CustomerAuthService
+	outbox   *OutboxSender
+	notifier *NotificationService
+}
+
+func newLoginEnv(store *memory.Store) *loginEnv {
+	outbox := NewOutboxWriter(io.Discard)
+	sender := NewSenderService(outbox, outbox)
+	svc := NewCustomerAuthService(store, store, sender)
+	svc.PortalURL = "https://portal.example.com/login"
+	return &loginEnv{svc: svc, outbox: outbox, notifier: NewNotificationService(store, store, sender)}
+}
+
+// deliver sends the queued emails to the outbox.
+func (e *loginEnv) deliver(t *testing.T) {
+	t.Helper()
+	if _, err := e.notifier.DeliverDue(time.Now().UTC()); err != nil {
+		t.Fatalf("DeliverDue: %v", err)
+	}
+}
+
+// requestLoginCode asks for a login email, delivers it and returns the code and magic link token in it.
+func requestLoginCode(t *testing.T, env *loginEnv, email string) (string, string) {
+	t.Helper()
+	before := len(env.outbox.Messages())
+	if err := env.svc.RequestLogin(entities.CustomerLoginRequest{Email: email}); err != nil {
+		t.Fatalf("RequestLogin: %v", err)
+	}
+	if len(env.outbox.Messages()) != before {
+		t.Fatalf("expected the login email queued, not sent right away")
+	}
+	env.deliver(t)
+	messages := env.outbox.Messages()
+	if len(messages) == 0 {
+		t.Fatalf("expected a login email")
+	}
+	body := messages[len(messages)-1].Body
+	code, token := loginCodePattern.FindStringSubmatch(body), loginTokenPattern.FindStringSubmatch(body)
+	if code == nil || token == nil {
+		t.Fatalf("expected a code and a link in %q", body)
+	}
+	return code[1], token[1]
+}
+
+func expectUnauthorized(t *testing.T, err error) {
+	t.Helper()
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %v", err)
+	}
+}
+
+func TestCustomerLoginWithCode(t *testing.T) {
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	store := memory.NewSeededStore()
+	store.InsertReservation(newReservation("LOGIN001", carTypeID, statusActive, futureHour(72), futureHour(74)))
+	env := newLoginEnv(store)
+
+	code, token := requestLoginCode(t, env, " Mario@Example.com ")
+	if to := env.outbox.Messages()[0].To; to != "Mario Rossi <mario@example.com>" {
+		t.Fatalf("expected the email sent to the customer, got %s", to)
+	}
+
+	_, err := env.svc.VerifyLogin(entities.CustomerVerifyRequest{Email: "mario@example.com", Code: "000000"})
+	expectUnauthorized(t, err)
+	session, err := env.svc.VerifyLogin(entities.CustomerVerifyRequest{Email: "MARIO@example.com", Code: code})
+	if err != nil {
+		t.Fatalf("VerifyLogin: %v", err)
+	}
+	if session.Email != "mario@example.com" || session.Token == "" {
+		t.Fatalf("unexpected session %+v", session)
+	}
+
+	// The code and its link work once.
+	_, err = env.svc.VerifyLogin(entities.CustomerVerifyRequest{Email: "mario@example.com", Code: code})
+	expectUnauthorized(t, err)
+	_, err = env.svc.VerifyLogin(entities.CustomerVerifyRequest{Token: token})
+	expectUnauthorized(t, err)
+}
+
+func TestCustomerLoginWithMagicLink(t *testing.T) {
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	store := memory.NewSeededStore()
+	store.InsertReservation(newReservation("LOGIN002", carTypeID, statusActive, futureHour(72), futureHour(74)))
+	env := newLoginEnv(store)
+
+	_, first := requestLoginCode(t, env, "mario@example.com")
+	_, second := requestLoginCode(t, env, "mario@example.com")
+
+	// Only the last link sent works.
+	_, err := env.svc.VerifyLogin(entities.CustomerVerifyRequest{Token: first})
+	expectUnauthorized(t, err)
+	if _, err := env.svc.VerifyLogin(entities.CustomerVerifyRequest{Token: second}); err != nil {
+		t.Fatalf("VerifyLogin: %v", err)
+	}
+}
+
+func TestCustomerLoginCodeLocksAfterTooManyAttempts(t *testing.T) {
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	store := memory.NewSeededStore()
+	store.InsertReservation(newReservation("LOGIN003", carTypeID, statusActive, futureHour(72), futureHour(74)))
+	env := newLoginEnv(store)
+
+	code, _ := requestLoginCode(t, env, "mario@example.com")
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for i := 0; i < loginCodeMaxAttempts; i++ {
+		_, err := env.svc.VerifyLogin(entities.CustomerVerifyRequest{Email: "mario@example.com", Code: wrong})
+		expectUnauthorized(t, err)
+	}
+	_, err := env.svc.VerifyLogin(entities.CustomerVerifyRequest{Email: "mario@example.com", Code: code})
+	expectUnauthorized(t, err)
+}
+
+func TestCustomerLoginSendsNothingWithoutReservations(t *testing.T) {
+	store := memory.NewSeededStore()
+	store.InsertReservation(newReservation("LOGIN004", carTypeID, statusActive, futureHour(72), futureHour(74)))
+	env := newLoginEnv(store)
+
+	if err := env.svc.RequestLogin(entities.CustomerLoginRequest{Email: "nobody@example.com"}); err != nil {
+		t.Fatalf("RequestLogin: %v", err)
+	}
+	// Past the hourly limit, requests succeed without sending anything either.
+	for i := 0; i < loginCodesPerHour+2; i++ {
+		if err := env.svc.RequestLogin(entities.CustomerLoginRequest{Email: "mario@example.com"}); err != nil {
+			t.Fatalf("RequestLogin: %v", err)
+		}
+	}
+	env.deliver(t)
+	if sent := len(env.outbox.Messages()); sent != loginCodesPerHour {
+		t.Fatalf("expected %d login emails, got %d", loginCodesPerHour, sent)
+	}
+}
+
+func TestCustomerOnlyReachesOwnReservations(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := newTestReservationService(store)
+	store.InsertReservation(newReservation("MINE0001", carTypeID, statusActive, futureHour(72), futureHour(74)))
+	store.InsertReservation(newReservation("MINE0002", carTypeID, statusActive, futureHour(96), futureHour(98)))
+	other := newReservation("OTHER001", carTypeID, statusActive, futureHour(72), futureHour(74))
+	other.UserEmail = "luigi@example.com"
+	store.InsertReservation(other)
+
+	_, err := svc.CancelReservation("OTHER001", "mario@example.com")
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 canceling someone else's reservation, got %v", err)
+	}
+	if got := store.Reservation("OTHER001").Status; got != statusActive {
+		t.Fatalf("reservation should still be active, got %q", got)
+	}
+	if _, err := svc.QuoteCancellation("OTHER001", "mario@example.com"); err == nil {
+		t.Fatalf("expected no cancellation quote for someone else's reservation")
+	}
+
+	mine, err := svc.ListCustomerReservations("MARIO@example.com")
+	if err != nil {
+		t.Fatalf("ListCustomerReservations: %v", err)
+	}
+	if len(mine) != 2 || mine[0].Code != "MINE0002" || mine[1].Code != "MINE0001" {
+		t.Fatalf("expected both reservations of mario, latest first, got %+v", mine)
+	}
+}
@@ -0,0 +1,384 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"estacionamienti/internal/money"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/webhook"
+)
+
+// FakeCheckoutSession is a checkout session issued by FakePaymentGateway.
+type FakeCheckoutSession struct {
+	ID              string
+	URL             string
+	PaymentIntentID string
+	Amount          int64
+	Discount        int64 // itemized on the page, already taken off Amount
+	DiscountName    string
+	Refunded        int64
+	Currency        string
+	CustomerEmail   string
+	SuccessURL      string
+	CancelURL       string
+	Status          string // open, complete or expired
+	ExpiresAt       time.Time
+}
+
+// FakeRefund is a refund recorded by FakePaymentGateway.
+type FakeRefund struct {
+	ID              string
+	PaymentIntentID string
+	Amount          int64
+}
+
+// FakeWebhook is a Stripe-signed webhook body, ready to be posted to the webhook handler.
+type FakeWebhook struct {
+	EventID   string
+	Payload   []byte
+	Signature string
+}
+
+// Request builds the POST Stripe would send to url.
+func (w *FakeWebhook) Request(url string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(w.Payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Stripe-Signature", w.Signature)
+	return req, nil
+}
+
+// FakePaymentGateway is an in-process stand-in for Stripe. It issues checkout sessions, records refunds and
+// produces webhook events signed with WebhookSecret, so the payment flow can run without network access.
+type FakePaymentGateway struct {
+	// WebhookSecret signs every emitted event; the webhook handler must be configured with the same secret.
+	WebhookSecret string
+	// CheckoutBaseURL prefixes the session ID to build the checkout URL returned to customers.
+	CheckoutBaseURL string
+	// Deliver, when set, receives the events the fake emits on its own, such as charge.refunded after a refund.
+	Deliver func(*FakeWebhook)
+	// RefundError, when set, makes every refund fail with it, to try out what happens when Stripe is down.
+	RefundError error
+
+	mu         sync.Mutex
+	sessions   map[string]*FakeCheckoutSession
+	refunds    []FakeRefund
+	idempotent map[string]fakeIdempotentRefund
+	seq        int
+}
+
+// fakeIdempotentRefund is a refund issued with an idempotency key, with the request that issued it.
+type fakeIdempotentRefund struct {
+	req    RefundRequest
+	refund Refund
+}
+
+func NewFakePaymentGateway(webhookSecret, checkoutBaseURL string) *FakePaymentGateway {
+	return &FakePaymentGateway{
+		WebhookSecret:   webhookSecret,
+		CheckoutBaseURL: strings.TrimSuffix(checkoutBaseURL, "/"),
+		sessions:        map[string]*FakeCheckoutSession{},
+		idempotent:      map[string]fakeIdempotentRefund{},
+	}
+}
+
+func (g *FakePaymentGateway) nextID(prefix string) string {
+	g.seq++
+	return fmt.Sprintf("%s_fake_%d", prefix, g.seq)
+}
+
+func (g *FakePaymentGateway) CreateCheckoutSession(req CheckoutRequest) (*CheckoutSession, error) {
+	if req.Price.Amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive, got %d", req.Price.Amount)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	id := g.nextID("cs")
+	sess := &FakeCheckoutSession{
+		ID:            id,
+		URL:           g.CheckoutBaseURL + "/" + id,
+		Amount:        req.Price.Amount.Cents(),
+		Currency:      req.Price.Currency,
+		CustomerEmail: req.CustomerEmail,
+		SuccessURL:    strings.ReplaceAll(req.SuccessURL, "{CHECKOUT_SESSION_ID}", id),
+		CancelURL:     req.CancelURL,
+		Status:        "open",
+		ExpiresAt:     req.ExpiresAt,
+	}
+	if req.Discount != nil {
+		sess.Discount, sess.DiscountName = req.Discount.Amount.Cents(), req.Discount.Name
+	}
+	g.sessions[id] = sess
+	return &CheckoutSession{ID: sess.ID, URL: sess.URL}, nil
+}
+
+func (g *FakePaymentGateway) Refund(req RefundRequest) (*Refund, error) {
+	if g.RefundError != nil {
+		return nil, g.RefundError
+	}
+	g.mu.Lock()
+	// Like Stripe, a repeated key returns the first refund, and reusing it for another request is an error.
+	if prev, ok := g.idempotent[req.IdempotencyKey]; ok && req.IdempotencyKey != "" {
+		g.mu.Unlock()
+		if prev.req != req {
+			return nil, fmt.Errorf("idempotency key '%s' was used for a different refund request", req.IdempotencyKey)
+		}
+		refund := prev.refund
+		return &refund, nil
+	}
+	sess := g.sessionByIntentLocked(req.PaymentIntentID)
+	if sess == nil {
+		g.mu.Unlock()
+		return nil, fmt.Errorf("no such payment_intent: '%s'", req.PaymentIntentID)
+	}
+	amount := req.Amount.Cents()
+	if amount == 0 {
+		amount = sess.Amount - sess.Refunded
+	}
+	if amount <= 0 || sess.Refunded+amount > sess.Amount {
+		g.mu.Unlock()
+		return nil, fmt.Errorf("refund of %d exceeds the %d left on payment_intent '%s'", amount, sess.Amount-sess.Refunded, req.PaymentIntentID)
+	}
+	sess.Refunded += amount
+	ref := FakeRefund{ID: g.nextID("re"), PaymentIntentID: req.PaymentIntentID, Amount: amount}
+	g.refunds = append(g.refunds, ref)
+	refund := Refund{ID: ref.ID, Amount: money.Amount(ref.Amount), Status: "succeeded"}
+	if req.IdempotencyKey != "" {
+		g.idempotent[req.IdempotencyKey] = fakeIdempotentRefund{req: req, refund: refund}
+	}
+	g.mu.Unlock()
+
+	if g.Deliver != nil {
+		evt, err := g.RefundedWebhook(req.PaymentIntentID)
+		if err != nil {
+			return nil, err
+		}
+		g.Deliver(evt)
+	}
+	return &refund, nil
+}
+
+func (g *FakePaymentGateway) ListRefunds(paymentIntentID string) ([]Refund, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var refunds []Refund
+	for _, ref := range g.refunds {
+		if ref.PaymentIntentID == paymentIntentID {
+			refunds = append(refunds, Refund{ID: ref.ID, Amount: money.Amount(ref.Amount), Status: "succeeded"})
+		}
+	}
+	return refunds, nil
+}
+
+func (g *FakePaymentGateway) SessionIDByPaymentIntent(paymentIntentID string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if sess := g.sessionByIntentLocked(paymentIntentID); sess != nil {
+		return sess.ID, nil
+	}
+	return "", fmt.Errorf("No session_id found for PaymentIntentID %s", paymentIntentID)
+}
+
+func (g *FakePaymentGateway) sessionByIntentLocked(paymentIntentID string) *FakeCheckoutSession {
+	if paymentIntentID == "" {
+		return nil
+	}
+	for _, sess := range g.sessions {
+		if sess.PaymentIntentID == paymentIntentID {
+			return sess
+		}
+	}
+	return nil
+}
+
+// Session returns a copy of the checkout session with the given ID.
+func (g *FakePaymentGateway) Session(sessionID string) (FakeCheckoutSession, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	sess, ok := g.sessions[sessionID]
+	if !ok {
+		return FakeCheckoutSession{}, false
+	}
+	return *sess, true
+}
+
+// Refunds returns every refund issued so far.
+func (g *FakePaymentGateway) Refunds() []FakeRefund {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]FakeRefund(nil), g.refunds...)
+}
+
+// CompleteCheckout simulates the customer paying: the session gets a payment intent and the
+// checkout.session.completed event is returned.
+func (g *FakePaymentGateway) CompleteCheckout(sessionID string) (*FakeWebhook, error) {
+	g.mu.Lock()
+	sess, err := g.openSessionLocked(sessionID)
+	if err != nil {
+		g.mu.Unlock()
+		return nil, err
+	}
+	sess.Status = "complete"
+	sess.PaymentIntentID = g.nextID("pi")
+	object := checkoutSessionObject(sess, "paid")
+	g.mu.Unlock()
+	return g.SignedEvent("checkout.session.completed", object)
+}
+
+// CompleteCheckoutDelayed simulates the customer paying with a delayed method such as SEPA debit: the session
+// completes unpaid and SettleDelayedPayment later reports the outcome.
+func (g *FakePaymentGateway) CompleteCheckoutDelayed(sessionID string) (*FakeWebhook, error) {
+	g.mu.Lock()
+	sess, err := g.openSessionLocked(sessionID)
+	if err != nil {
+		g.mu.Unlock()
+		return nil, err
+	}
+	sess.Status = "complete"
+	sess.PaymentIntentID = g.nextID("pi")
+	object := checkoutSessionObject(sess, "unpaid")
+	g.mu.Unlock()
+	return g.SignedEvent("checkout.session.completed", object)
+}
+
+// SettleDelayedPayment returns checkout.session.async_payment_succeeded or async_payment_failed for a session
+// completed with CompleteCheckoutDelayed.
+func (g *FakePaymentGateway) SettleDelayedPayment(sessionID string, succeeded bool) (*FakeWebhook, error) {
+	g.mu.Lock()
+	sess, ok := g.sessions[sessionID]
+	if !ok || sess.PaymentIntentID == "" {
+		g.mu.Unlock()
+		return nil, fmt.Errorf("no delayed payment for checkout session '%s'", sessionID)
+	}
+	eventType, paymentStatus := "checkout.session.async_payment_succeeded", "paid"
+	if !succeeded {
+		eventType, paymentStatus = "checkout.session.async_payment_failed", "unpaid"
+	}
+	object := checkoutSessionObject(sess, paymentStatus)
+	g.mu.Unlock()
+	return g.SignedEvent(eventType, object)
+}
+
+// ExpireCheckout simulates the customer abandoning checkout until the session expires.
+func (g *FakePaymentGateway) ExpireCheckout(sessionID string) (*FakeWebhook, error) {
+	g.mu.Lock()
+	sess, err := g.openSessionLocked(sessionID)
+	if err != nil {
+		g.mu.Unlock()
+		return nil, err
+	}
+	sess.Status = "expired"
+	object := checkoutSessionObject(sess, "unpaid")
+	g.mu.Unlock()
+	return g.SignedEvent("checkout.session.expired", object)
+}
+
+// DisputeWebhook returns charge.dispute.created for the full amount of the payment intent.
+func (g *FakePaymentGateway) DisputeWebhook(paymentIntentID, reason string) (*FakeWebhook, error) {
+	g.mu.Lock()
+	sess := g.sessionByIntentLocked(paymentIntentID)
+	if sess == nil {
+		g.mu.Unlock()
+		return nil, fmt.Errorf("no such payment_intent: '%s'", paymentIntentID)
+	}
+	object := map[string]interface{}{
+		"id":             g.nextID("dp"),
+		"object":         "dispute",
+		"amount":         sess.Amount,
+		"currency":       sess.Currency,
+		"charge":         "ch_" + strings.TrimPrefix(paymentIntentID, "pi_"),
+		"payment_intent": paymentIntentID,
+		"reason":         reason,
+		"status":         "needs_response",
+		"evidence_details": map[string]interface{}{
+			"due_by": time.Now().Add(7 * 24 * time.Hour).Unix(),
+		},
+	}
+	g.mu.Unlock()
+	return g.SignedEvent("charge.dispute.created", object)
+}
+
+func (g *FakePaymentGateway) openSessionLocked(sessionID string) (*FakeCheckoutSession, error) {
+	sess, ok := g.sessions[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("no such checkout session: '%s'", sessionID)
+	}
+	if sess.Status != "open" {
+		return nil, fmt.Errorf("checkout session '%s' is %s", sessionID, sess.Status)
+	}
+	return sess, nil
+}
+
+// RefundedWebhook returns the charge.refunded event for the payment intent's current refunded amount.
+func (g *FakePaymentGateway) RefundedWebhook(paymentIntentID string) (*FakeWebhook, error) {
+	g.mu.Lock()
+	sess := g.sessionByIntentLocked(paymentIntentID)
+	if sess == nil {
+		g.mu.Unlock()
+		return nil, fmt.Errorf("no such payment_intent: '%s'", paymentIntentID)
+	}
+	object := map[string]interface{}{
+		"id":              "ch_" + strings.TrimPrefix(paymentIntentID, "pi_"),
+		"object":          "charge",
+		"amount":          sess.Amount,
+		"amount_refunded": sess.Refunded,
+		"currency":        sess.Currency,
+		"payment_intent":  paymentIntentID,
+		"refunded":        sess.Refunded == sess.Amount,
+	}
+	g.mu.Unlock()
+	return g.SignedEvent("charge.refunded", object)
+}
+
+// SignedEvent wraps object in a Stripe event of the given type and signs it with WebhookSecret.
+func (g *FakePaymentGateway) SignedEvent(eventType string, object interface{}) (*FakeWebhook, error) {
+	rawObject, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	eventID := g.nextID("evt")
+	g.mu.Unlock()
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":          eventID,
+		"object":      "event",
+		"api_version": stripe.APIVersion,
+		"created":     time.Now().Unix(),
+		"type":        eventType,
+		"livemode":    false,
+		"data":        map[string]json.RawMessage{"object": rawObject},
+	})
+	if err != nil {
+		return nil, err
+	}
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload: payload,
+		Secret:  g.WebhookSecret,
+	})
+	return &FakeWebhook{EventID: eventID, Payload: payload, Signature: signed.Header}, nil
+}
+
+func checkoutSessionObject(sess *FakeCheckoutSession, paymentStatus string) map[string]interface{} {
+	object := map[string]interface{}{
+		"id":             sess.ID,
+		"object":         "checkout.session",
+		"amount_total":   sess.Amount,
+		"currency":       sess.Currency,
+		"customer_email": sess.CustomerEmail,
+		"payment_status": paymentStatus,
+		"status":         sess.Status,
+		"url":            sess.URL,
+	}
+	if sess.PaymentIntentID != "" {
+		object["payment_intent"] = sess.PaymentIntentID
+	}
+	return object
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"database/sql"
+	stdErrors "errors"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/money"
+	"estacionamienti/internal/repository"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	statusCheckedIn = "checked_in"
+	statusNoShow    = "no_show"
+
+	// earlyCheckIn is how long before its start a car may be let in.
+	earlyCheckIn = time.Hour
+)
+
+// CheckIn lets the car of an active reservation in. By plate, the reservation is the one whose window, opened
+// earlyCheckIn before its start, includes the check-in time.
+func (s *AdminService) CheckIn(req entities.CheckInRequest) (*entities.ReservationResponse, error) {
+	checkedInAt, err := gateTime(req.CheckedInAt, "checked_in_at")
+	if err != nil {
+		return nil, err
+	}
+	inWindow := func(r *db.Reservation) bool {
+		return !checkedInAt.Before(r.StartTime.Add(-earlyCheckIn)) && checkedInAt.Before(r.EndTime)
+	}
+	reservation, err := s.gateReservation(req.Code, req.Plate, []string{statusActive}, []string{statusActive}, inWindow)
+	if err != nil {
+		return nil, err
+	}
+	if checkedInAt.Before(reservation.StartTime.Add(-earlyCheckIn)) {
+		return nil, errors.NewHTTPError(http.StatusConflict, fmt.Sprintf("Reservation starts at %s", reservation.StartTime.Format(time.RFC3339)))
+	}
+	if !checkedInAt.Before(reservation.EndTime) {
+		return nil, errors.NewHTTPError(http.StatusConflict, fmt.Sprintf("Reservation ended at %s", reservation.EndTime.Format(time.RFC3339)))
+	}
+
+	if err := s.reservationRepo.CheckInReservation(reservation.ID, checkedInAt); err != nil {
+		log.Printf("[AdminService] Error checking in reservation %s: %v", reservation.Code, err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NewHTTPError(http.StatusConflict, "Reservation is no longer active")
+		}
+		return nil, err
+	}
+	log.Printf("Reserva %s: check-in a las %s", reservation.Code, checkedInAt.Format(time.RFC3339))
+	return s.adminRepo.FindReservationByCode(reservation.Code)
+}
+
+// CheckOut lets a car out and finishes its reservation. Leaving more than overstayGrace after the end adds the price
+// of the extra time to the total, and whatever the payments ledger says is still owed is collected at the gate. By
+// code, reservations never checked in or flagged as no-shows can be checked out too, for cars let in by hand.
+func (s *AdminService) CheckOut(req entities.CheckOutRequest, adminUser string) (*entities.CheckOutResponse, error) {
+	checkedOutAt, err := gateTime(req.CheckedOutAt, "checked_out_at")
+	if err != nil {
+		return nil, err
+	}
+	if req.PaymentMethod == "" {
+		req.PaymentMethod = "cash"
+	}
+	if req.PaymentMethod != "cash" && req.PaymentMethod != "card" {
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "payment_method must be cash or card")
+	}
+	reservation, err := s.gateReservation(req.Code, req.Plate,
+		[]string{statusActive, statusCheckedIn, statusOverstay, statusNoShow}, []string{statusCheckedIn, statusOverstay}, nil)
+	if err != nil {
+		return nil, err
+	}
+	entered := reservation.StartTime.Add(-earlyCheckIn)
+	if reservation.CheckedInAt.Valid {
+		entered = reservation.CheckedInAt.Time
+	}
+	if checkedOutAt.Before(entered) {
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "checked_out_at can't be before the car entered")
+	}
+
+	charge, fee, err := checkOutCharge(s.pricing, reservation, checkedOutAt)
+	if err != nil {
+		log.Printf("[AdminService] Error pricing check-out of reservation %s: %v", reservation.Code, err)
+		return nil, err
+	}
+	current, err := s.adminRepo.FindReservationByCode(reservation.Code)
+	if err != nil {
+		log.Printf("[AdminService] Error getting balance of reservation %s: %v", reservation.Code, err)
+		return nil, err
+	}
+	var payment *db.Payment
+	balance := current.TotalPrice + charge - current.AmountPaid
+	if balance > 0 {
+		payment = &db.Payment{
+			ReservationID:   reservation.ID,
+			ReservationCode: reservation.Code,
+			Kind:            paymentKindOnsite,
+			Amount:          balance,
+			Method:          req.PaymentMethod,
+			Note:            "check-out",
+			RecordedBy:      adminUser,
+		}
+	}
+
+	if err := s.reservationRepo.CheckOutReservation(reservation.ID, checkedOutAt, charge, fee, payment); err != nil {
+		log.Printf("[AdminService] Error checking out reservation %s: %v", reservation.Code, err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NewHTTPError(http.StatusConflict, "Reservation is no longer active")
+		}
+		return nil, err
+	}
+	if fee > 0 {
+		log.Printf("Reserva %s: check-out %s después del fin, recargo por exceso de %s", reservation.Code,
+			checkedOutAt.Sub(reservation.EndTime).Round(time.Minute), formatMoney(fee))
+	}
+
+	finished, err := s.adminRepo.FindReservationByCode(reservation.Code)
+	if err != nil {
+		return nil, err
+	}
+	response := &entities.CheckOutResponse{ReservationResponse: finished}
+	if payment != nil {
+		response.AmountCollected = payment.Amount
+		response.PaymentMethod = payment.Method
+	}
+	return response, nil
+}
+
+// MarkNoShow records that the car of an active reservation never came once it has started, releasing its space.
+// What was paid is kept and nothing more is owed.
+func (s *AdminService) MarkNoShow(code string) (*entities.ReservationResponse, error) {
+	reservation, err := s.gateReservation(code, "", []string{statusActive}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().UTC().Before(reservation.StartTime) {
+		return nil, errors.NewHTTPError(http.StatusConflict, "Reservation hasn't started yet")
+	}
+	if err := s.reservationRepo.MarkReservationNoShow(reservation.ID); err != nil {
+		log.Printf("[AdminService] Error marking reservation %s as no-show: %v", code, err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NewHTTPError(http.StatusConflict, "Reservation is no longer active")
+		}
+		return nil, err
+	}
+	return s.adminRepo.FindReservationByCode(code)
+}
+
+// checkOutCharge is what leaving at checkedOutAt adds to the total price: the whole stay for an open walk-in, at
+// least an hour, or else the overstay fee, which is also returned on its own.
+func checkOutCharge(repo repository.PricingRepository, reservation *db.Reservation, checkedOutAt time.Time) (charge, fee money.Amount, err error) {
+	if reservation.WalkIn && reservation.EndTime.IsZero() {
+		end := checkedOutAt
+		if !end.After(reservation.StartTime) {
+			end = reservation.StartTime.Add(time.Hour)
+		}
+		price, err := totalPriceForReservation(repo, reservation.VehicleTypeID, reservation.StartTime, end)
+		return price, 0, err
+	}
+	fee, err = overstayFee(repo, reservation, checkedOutAt)
+	return fee, fee, err
+}
+
+// gateReservation finds the reservation an attendant means, by code if given or else by plate. By code it must be in
+// one of byCode statuses; by plate exactly one reservation in one of byPlate statuses, and accepted by fits if given,
+// must match.
+func (s *AdminService) gateReservation(code, plate string, byCode, byPlate []string, fits func(*db.Reservation) bool) (*db.Reservation, error) {
+	code, plate = strings.TrimSpace(code), normalizePlate(plate)
+	if code != "" {
+		reservation, err := s.reservationRepo.GetReservationByCodeOnly(code)
+		if err != nil {
+			log.Printf("[AdminService] Error getting reservation %s at the gate: %v", code, err)
+			if stdErrors.Is(err, sql.ErrNoRows) {
+				return nil, errors.NewHTTPError(http.StatusNotFound, "Reservation not found")
+			}
+			return nil, err
+		}
+		if !hasStatus(reservation, byCode) {
+			return nil, errors.NewHTTPError(http.StatusConflict, fmt.Sprintf("Reservation is %s", reservation.Status))
+		}
+		return reservation, nil
+	}
+	if plate == "" {
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "code or plate is required")
+	}
+
+	codes, err := s.reservationRepo.FindReservationCodesByPlate(plate, byPlate)
+	if err != nil {
+		log.Printf("[AdminService] Error finding reservations of plate %s: %v", plate, err)
+		return nil, err
+	}
+	var matches []*db.Reservation
+	for _, c := range codes {
+		reservation, err := s.reservationRepo.GetReservationByCodeOnly(c)
+		if err != nil {
+			log.Printf("[AdminService] Error getting reservation %s of plate %s: %v", c, plate, err)
+			return nil, err
+		}
+		if fits == nil || fits(reservation) {
+			matches = append(matches, reservation)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, errors.NewHTTPError(http.StatusNotFound, fmt.Sprintf("No reservation found for plate %s", plate))
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, errors.NewHTTPError(http.StatusConflict, fmt.Sprintf("Several reservations match plate %s, use the reservation code", plate))
+	}
+}
+
+// gateTime is when a gate operation happened: now unless given, and never in the future.
+func gateTime(at *time.Time, field string) (time.Time, error) {
+	now := time.Now().UTC()
+	if at == nil {
+		return now, nil
+	}
+	if at.After(now.Add(time.Minute)) {
+		return time.Time{}, errors.NewHTTPError(http.StatusBadRequest, field+" can't be in the future")
+	}
+	return at.UTC(), nil
+}
+
+func hasStatus(reservation *db.Reservation, statuses []string) bool {
+	for _, status := range statuses {
+		if reservation.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizePlate writes a plate the way the repository compares them: uppercase, without spaces or dashes.
+func normalizePlate(plate string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(plate)))
+}
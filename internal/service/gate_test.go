@@ -0,0 +1,109 @@
+package service
+
+import (
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/repository/memory"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCheckInAndOutByPlateCollectsBalance(t *testing.T) {
+	store := memory.NewSeededStore()
+	admin := newTestAdminService(store)
+	res := newReservation("GATE0001", carTypeID, statusActive, futureHour(0).Add(30*time.Minute), futureHour(3))
+	res.TotalPrice = 1200
+	store.InsertReservation(res)
+	store.InsertReservation(newReservation("GATE0002", carTypeID, statusActive, futureHour(24), futureHour(26)))
+
+	in, err := admin.CheckIn(entities.CheckInRequest{Plate: "ab 123-cd"})
+	if err != nil {
+		t.Fatalf("CheckIn: %v", err)
+	}
+	if in.Code != "GATE0001" || in.Status != statusCheckedIn || in.CheckedInAt == nil {
+		t.Fatalf("expected GATE0001 checked in, got %+v", in)
+	}
+
+	out, err := admin.CheckOut(entities.CheckOutRequest{Plate: "AB123CD", PaymentMethod: "card"}, "gate")
+	if err != nil {
+		t.Fatalf("CheckOut: %v", err)
+	}
+	if out.Code != "GATE0001" || out.Status != "finished" || out.AmountCollected != 1200 || out.PaymentMethod != "card" || out.BalanceDue != 0 {
+		t.Fatalf("expected the 12 EUR balance collected by card, got %+v (%+v)", out, out.ReservationResponse)
+	}
+	payments, _ := store.ListPaymentsByReservation(store.Reservation("GATE0001").ID)
+	if len(payments) != 1 || payments[0].Kind != paymentKindOnsite || payments[0].Amount != 1200 || payments[0].RecordedBy != "gate" {
+		t.Fatalf("expected the collection in the ledger, got %+v", payments)
+	}
+
+	_, err = admin.CheckIn(entities.CheckInRequest{Code: "GATE0002"})
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 checking in a day early, got %v", err)
+	}
+}
+
+func TestCheckOutPaidOnlineCollectsNothing(t *testing.T) {
+	store := memory.NewSeededStore()
+	gateway := NewFakePaymentGateway("whsec_test", "http://localhost/dev/checkout")
+	admin := NewAdminService(store, store, store, store, store, NewStripeService(store, gateway, NewPaymentService(store, store)), newTestSenderService())
+	insertPaidReservation(t, store, gateway, "GATE0003", paymentMethodOnline, 1200, -1)
+	paid := store.Reservation("GATE0003")
+	paid.TotalPrice = 1200
+	if _, err := store.RecordPayment(&db.Payment{ReservationID: paid.ID, ReservationCode: paid.Code, Kind: paymentKindCharge,
+		Amount: 1200, Method: paymentMethodStripe}); err != nil {
+		t.Fatalf("RecordPayment: %v", err)
+	}
+
+	out, err := admin.CheckOut(entities.CheckOutRequest{Code: "GATE0003"}, "gate")
+	if err != nil {
+		t.Fatalf("CheckOut: %v", err)
+	}
+	if out.AmountCollected != 0 || out.BalanceDue != 0 || out.Status != "finished" {
+		t.Fatalf("expected nothing to collect, got %+v (%+v)", out, out.ReservationResponse)
+	}
+}
+
+func TestMarkNoShowReleasesSpace(t *testing.T) {
+	store := memory.NewSeededStore()
+	admin := newTestAdminService(store)
+	store.InsertReservation(newReservation("NOSHOW01", carTypeID, statusActive, futureHour(-1), futureHour(2)))
+	store.InsertReservation(newReservation("LATER001", carTypeID, statusActive, futureHour(5), futureHour(7)))
+
+	if _, err := admin.MarkNoShow("LATER001"); err == nil {
+		t.Fatal("expected an error marking a reservation not started yet as no-show")
+	}
+	res, err := admin.MarkNoShow("NOSHOW01")
+	if err != nil {
+		t.Fatalf("MarkNoShow: %v", err)
+	}
+	if res.Status != statusNoShow || res.BalanceDue != 0 {
+		t.Fatalf("expected a no-show owing nothing, got %+v", res)
+	}
+	slots, err := store.GetHourlyAvailabilityDetails(futureHour(0), futureHour(2), carTypeID, time.Now().UTC(), 0)
+	if err != nil {
+		t.Fatalf("GetHourlyAvailabilityDetails: %v", err)
+	}
+	for _, slot := range slots {
+		if slot.BookedSpaces != 0 {
+			t.Fatalf("a no-show must not hold its space, got %+v", slot)
+		}
+	}
+}
+
+func TestCheckInByPlateNeedsOneMatch(t *testing.T) {
+	store := memory.NewSeededStore()
+	admin := newTestAdminService(store)
+	store.InsertReservation(newReservation("TWIN0001", carTypeID, statusActive, futureHour(0), futureHour(2)))
+	store.InsertReservation(newReservation("TWIN0002", motorcycleTypeID, statusActive, futureHour(0), futureHour(3)))
+
+	_, err := admin.CheckIn(entities.CheckInRequest{Plate: "AB123CD"})
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 with two reservations for the plate, got %v", err)
+	}
+	_, err = admin.CheckIn(entities.CheckInRequest{Plate: "ZZ000ZZ"})
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown plate, got %v", err)
+	}
+}
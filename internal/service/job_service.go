@@ -8,35 +8,44 @@ import (
 )
 
 type JobService struct {
-	Repo *repository.JobRepository
+	Repo repository.JobRepository
 }
 
-func NewJobService(repo *repository.JobRepository) *JobService {
+func NewJobService(repo repository.JobRepository) *JobService {
 	return &JobService{Repo: repo}
 }
 
-// UpdateFinishedReservations busca reservas activas que han finalizado y actualiza su estado a "finished".
+// UpdateFinishedReservations revisa las reservas cuya fecha de fin ya pasó sin check-out: las que tienen el coche
+// dentro pasan a "overstay" hasta que salga, y las activas pasan a "finished" como siempre. Los "no_show" solo los
+// marca el personal de la puerta, porque no todos los sitios registran las entradas.
 func (s *JobService) UpdateFinishedReservations() error {
-	log.Println("Cron Job: Checking for reservations to mark as 'finished'...")
+	if err := s.updatePastEndTime(statusCheckedIn, statusOverstay); err != nil {
+		return err
+	}
+	return s.updatePastEndTime(statusActive, "finished")
+}
+
+func (s *JobService) updatePastEndTime(from, to string) error {
+	log.Printf("Cron Job: Checking for '%s' reservations past their end time...", from)
 
-	reservationIDs, err := s.Repo.GetActiveReservationIDsPastEndTime()
+	reservationIDs, err := s.Repo.GetReservationIDsPastEndTime(from)
 	if err != nil {
-		return fmt.Errorf("cron job: failed to get active reservations past end time: %w", err)
+		return fmt.Errorf("cron job: failed to get %s reservations past end time: %w", from, err)
 	}
 
 	if len(reservationIDs) == 0 {
-		log.Println("Cron Job: No active reservations found past their end time.")
+		log.Printf("Cron Job: No '%s' reservations found past their end time.", from)
 		return nil
 	}
 
-	log.Printf("Cron Job: Found %d reservations to mark as 'finished'. IDs: %v", len(reservationIDs), reservationIDs)
+	log.Printf("Cron Job: Found %d reservations to mark as '%s'. IDs: %v", len(reservationIDs), to, reservationIDs)
 
-	err = s.Repo.UpdateReservationStatuses(reservationIDs, "finished")
+	err = s.Repo.UpdateReservationStatuses(reservationIDs, to)
 	if err != nil {
 		return fmt.Errorf("cron job: failed to update reservation statuses: %w", err)
 	}
 
-	log.Printf("Cron Job: Successfully updated %d reservations to 'finished'.", len(reservationIDs))
+	log.Printf("Cron Job: Successfully updated %d reservations to '%s'.", len(reservationIDs), to)
 	return nil
 }
 
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"estacionamienti/internal/repository/memory"
+	"testing"
+	"time"
+)
+
+func TestUpdateFinishedReservations(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := NewJobService(store)
+	store.InsertReservation(newReservation("PAST0001", carTypeID, statusActive, futureHour(-5), futureHour(-2)))
+	store.InsertReservation(newReservation("NOW00001", carTypeID, statusActive, futureHour(-1), futureHour(2)))
+	store.InsertReservation(newReservation("CANC0001", carTypeID, statusCancel, futureHour(-5), futureHour(-2)))
+	store.InsertReservation(newReservation("INSIDE01", carTypeID, statusCheckedIn, futureHour(-5), futureHour(-2)))
+
+	if err := svc.UpdateFinishedReservations(); err != nil {
+		t.Fatalf("UpdateFinishedReservations: %v", err)
+	}
+	for code, want := range map[string]string{"PAST0001": "finished", "NOW00001": statusActive, "CANC0001": statusCancel, "INSIDE01": statusOverstay} {
+		if got := store.Reservation(code).Status; got != want {
+			t.Errorf("%s: expected status %q, got %q", code, want, got)
+		}
+	}
+}
+
+func TestDeleteOldPendingReservations(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := NewJobService(store)
+	old := newReservation("OLDPEND1", carTypeID, statusPending, futureHour(24), futureHour(26))
+	old.CreatedAt = time.Now().UTC().Add(-48 * time.Hour)
+	store.InsertReservation(old)
+	store.InsertReservation(newReservation("NEWPEND1", carTypeID, statusPending, futureHour(24), futureHour(26)))
+
+	deleted, err := svc.DeleteOldPendingReservations(time.Now().UTC().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatalf("DeleteOldPendingReservations: %v", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("expected 1 deleted reservation, got %d", deleted)
+	}
+	if store.Reservation("OLDPEND1") != nil || store.Reservation("NEWPEND1") == nil {
+		t.Fatal("only the old pending reservation should be deleted")
+	}
+}
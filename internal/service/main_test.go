@@ -0,0 +1,74 @@
+package service
+
+import (
+	"database/sql"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/repository/memory"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+const (
+	carTypeID        = 1
+	motorcycleTypeID = 2
+	suvTypeID        = 3
+)
+
+// TestMain runs the tests from the repository root, where the email templates are looked up.
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		fmt.Fprintf(os.Stderr, "could not change to repository root: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// futureHour returns a UTC hour far enough ahead to be outside every cancellation window.
+func futureHour(hoursFromNow int) time.Time {
+	return time.Now().UTC().Truncate(time.Hour).Add(time.Duration(hoursFromNow) * time.Hour)
+}
+
+// fillPool books n active reservations of the given type between start and end.
+func fillPool(store *memory.Store, vehicleTypeID, n int, start, end time.Time) {
+	for i := 0; i < n; i++ {
+		store.InsertReservation(&db.Reservation{
+			Code:            fmt.Sprintf("FILL%04d", i),
+			UserName:        "Filler",
+			UserEmail:       "filler@example.com",
+			VehicleTypeID:   vehicleTypeID,
+			PaymentMethodID: paymentMethodOnsite,
+			Status:          statusActive,
+			StartTime:       start,
+			EndTime:         end,
+		})
+	}
+}
+
+func newReservation(code string, vehicleTypeID int, status string, start, end time.Time) *db.Reservation {
+	return &db.Reservation{
+		Code:            code,
+		UserName:        "Mario Rossi",
+		UserEmail:       "mario@example.com",
+		UserPhone:       sql.NullString{String: "+390000000000", Valid: true},
+		VehicleTypeID:   vehicleTypeID,
+		VehiclePlate:    sql.NullString{String: "AB123CD", Valid: true},
+		VehicleModel:    sql.NullString{String: "Panda", Valid: true},
+		PaymentMethodID: paymentMethodOnsite,
+		Status:          status,
+		StartTime:       start,
+		EndTime:         end,
+		Language:        "en",
+	}
+}
+
+func newTestStripeService(store *memory.Store) *StripeService {
+	return NewStripeService(store, NewFakePaymentGateway("whsec_test", "http://localhost/dev/checkout"), NewPaymentService(store, store))
+}
+
+func newTestSenderService() *SenderService {
+	outbox := NewOutboxWriter(io.Discard)
+	return NewSenderService(outbox, outbox)
+}
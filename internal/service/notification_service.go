@@ -0,0 +1,116 @@
+package service
+
+import (
+	"database/sql"
+	stdErrors "errors"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/repository"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// notificationBatchSize is how many queued notifications one delivery run picks up.
+	notificationBatchSize = 50
+	// notificationLease keeps a claimed notification away from other workers while it is being delivered.
+	notificationLease = 5 * time.Minute
+	// notificationMaxAttempts is how many deliveries are tried before the notification is dead-lettered.
+	notificationMaxAttempts = 8
+	notificationBaseBackoff = time.Minute
+	notificationMaxBackoff  = 6 * time.Hour
+)
+
+// NotificationService delivers the notifications queued with reservation changes, retrying failures with
+// exponential backoff and dead-lettering them after notificationMaxAttempts.
+type NotificationService struct {
+	repo            repository.NotificationRepository
+	reservationRepo repository.ReservationRepository
+	senderService   *SenderService
+}
+
+func NewNotificationService(repo repository.NotificationRepository, reservationRepo repository.ReservationRepository, senderService *SenderService) *NotificationService {
+	return &NotificationService{repo: repo, reservationRepo: reservationRepo, senderService: senderService}
+}
+
+// DeliverDue sends every notification due at now and returns how many were sent.
+func (s *NotificationService) DeliverDue(now time.Time) (int, error) {
+	due, err := s.repo.ClaimDueNotifications(now, notificationLease, notificationBatchSize)
+	if err != nil {
+		log.Printf("Error claiming notifications: %v", err)
+		return 0, err
+	}
+
+	sent := 0
+	for _, n := range due {
+		delivered, err := s.deliver(n, now)
+		if err != nil {
+			return sent, err
+		}
+		if delivered {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// deliver sends one notification and records the outcome. The error is only about recording it.
+func (s *NotificationService) deliver(n db.Notification, now time.Time) (bool, error) {
+	sendErr := s.senderService.Deliver(n)
+	if sendErr == nil {
+		if err := s.repo.MarkNotificationSent(n.ID, time.Now().UTC()); err != nil {
+			log.Printf("Error marking notification %d as sent: %v", n.ID, err)
+			return true, err
+		}
+		return true, nil
+	}
+
+	attempts := n.Attempts + 1
+	if attempts >= notificationMaxAttempts {
+		log.Printf("ALERTA: %s para reserva %s descartado tras %d intentos: %v", n.Channel, n.ReservationCode, attempts, sendErr)
+		return false, s.repo.MarkNotificationFailed(n.ID, attempts, sendErr.Error())
+	}
+	next := now.Add(notificationBackoff(attempts))
+	log.Printf("Falló el envío de %s para reserva %s (intento %d), reintento a las %s: %v", n.Channel, n.ReservationCode, attempts, next.Format(time.RFC3339), sendErr)
+	return false, s.repo.MarkNotificationRetry(n.ID, attempts, next, sendErr.Error())
+}
+
+// notificationBackoff is the wait after the given number of failed attempts: 1m, 2m, 4m... capped at 6h.
+func notificationBackoff(attempts int) time.Duration {
+	backoff := notificationBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= notificationMaxBackoff {
+			return notificationMaxBackoff
+		}
+	}
+	return backoff
+}
+
+// ListFailedNotifications returns the dead-lettered notifications, optionally for one reservation code.
+func (s *NotificationService) ListFailedNotifications(code string) ([]db.Notification, error) {
+	notifications, err := s.repo.ListFailedNotifications(code)
+	if err != nil {
+		log.Printf("Error listing failed notifications: %v", err)
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// ResendFailedNotifications queues the failed notifications of a reservation again and returns how many there were.
+func (s *NotificationService) ResendFailedNotifications(code string) (int64, error) {
+	if _, err := s.reservationRepo.GetReservationByCodeOnly(code); err != nil {
+		log.Printf("Error getting reservation %s: %v", code, err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return 0, errors.NewHTTPError(http.StatusNotFound, "Reservation not found")
+		}
+		return 0, err
+	}
+	requeued, err := s.repo.RequeueFailedNotifications(code)
+	if err != nil {
+		log.Printf("Error requeuing notifications for reservation %s: %v", code, err)
+		return 0, err
+	}
+	return requeued, nil
+}
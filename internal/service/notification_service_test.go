@@ -0,0 +1,147 @@
+package service
+
+import (
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/repository/memory"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// flakySender fails every delivery while down is true.
+type flakySender struct {
+	down   bool
+	outbox *OutboxSender
+}
+
+func (f *flakySender) SendEmail(msg EmailMessage) error {
+	if f.down {
+		return fmt.Errorf("provider unavailable")
+	}
+	return f.outbox.SendEmail(msg)
+}
+
+func (f *flakySender) SendSMS(toNumber, body string) error {
+	if f.down {
+		return fmt.Errorf("provider unavailable")
+	}
+	return f.outbox.SendSMS(toNumber, body)
+}
+
+func adminRequestWithPhone(vehicleTypeID int, start, end time.Time) *entities.ReservationRequest {
+	req := adminRequest(vehicleTypeID, start, end)
+	req.UserPhone = "+390000000000"
+	return req
+}
+
+func TestNotificationsAreQueuedWithTheReservation(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := newTestReservationService(store)
+	store.InsertReservation(newReservation("CANCEL01", carTypeID, statusActive, futureHour(72), futureHour(74)))
+
+	if _, err := svc.CancelReservation("CANCEL01", "mario@example.com"); err != nil {
+		t.Fatalf("CancelReservation: %v", err)
+	}
+	// Reservations without a Stripe session are canceled silently, as before.
+	if got := store.Notifications("CANCEL01"); len(got) != 0 {
+		t.Fatalf("expected no notifications, got %d", len(got))
+	}
+
+	admin := newTestAdminService(store)
+	created, err := admin.CreateReservation(adminRequestWithPhone(carTypeID, futureHour(72), futureHour(74)))
+	if err != nil {
+		t.Fatalf("CreateReservation: %v", err)
+	}
+	queued := store.Notifications(created.Code)
+	if len(queued) != 2 {
+		t.Fatalf("expected an email and an SMS queued with the reservation, got %d", len(queued))
+	}
+	for _, n := range queued {
+		if n.Status != "pending" || n.ReservationID == 0 {
+			t.Fatalf("expected a pending notification tied to the reservation, got %+v", n)
+		}
+	}
+}
+
+func TestNotificationRetriesWithBackoffAndDeadLetters(t *testing.T) {
+	store := memory.NewSeededStore()
+	sender := &flakySender{down: true, outbox: NewOutboxWriter(io.Discard)}
+	senderSvc := NewSenderService(sender, sender)
+	admin := NewAdminService(store, store, store, store, store, newTestStripeService(store), senderSvc)
+	notifier := NewNotificationService(store, store, senderSvc)
+
+	created, err := admin.CreateReservation(adminRequestWithPhone(carTypeID, futureHour(72), futureHour(74)))
+	if err != nil {
+		t.Fatalf("CreateReservation: %v", err)
+	}
+
+	now := time.Now().UTC()
+	for attempt := 1; attempt < notificationMaxAttempts; attempt++ {
+		sent, err := notifier.DeliverDue(now)
+		if err != nil || sent != 0 {
+			t.Fatalf("attempt %d: sent %d, err %v", attempt, sent, err)
+		}
+		for _, n := range store.Notifications(created.Code) {
+			want := now.Add(notificationBackoff(attempt))
+			if n.Status != "pending" || n.Attempts != attempt || !n.NextAttemptAt.Equal(want) {
+				t.Fatalf("attempt %d: expected retry at %s, got %+v", attempt, want, n)
+			}
+		}
+		// Nothing is due before the backoff has elapsed.
+		if sent, _ := notifier.DeliverDue(now.Add(notificationBackoff(attempt) - time.Second)); sent != 0 {
+			t.Fatalf("attempt %d: delivered before the backoff elapsed", attempt)
+		}
+		now = now.Add(notificationBackoff(attempt))
+	}
+	if _, err := notifier.DeliverDue(now); err != nil {
+		t.Fatalf("DeliverDue: %v", err)
+	}
+
+	failed, err := notifier.ListFailedNotifications(created.Code)
+	if err != nil {
+		t.Fatalf("ListFailedNotifications: %v", err)
+	}
+	if len(failed) != 2 || failed[0].Attempts != notificationMaxAttempts || !failed[0].LastError.Valid {
+		t.Fatalf("expected both notifications dead-lettered after %d attempts, got %+v", notificationMaxAttempts, failed)
+	}
+
+	sender.down = false
+	requeued, err := notifier.ResendFailedNotifications(created.Code)
+	if err != nil || requeued != 2 {
+		t.Fatalf("ResendFailedNotifications: requeued %d, err %v", requeued, err)
+	}
+	if sent, err := notifier.DeliverDue(time.Now().UTC()); err != nil || sent != 2 {
+		t.Fatalf("expected both notifications delivered after resend, sent %d, err %v", sent, err)
+	}
+	if len(sender.outbox.Messages()) != 2 {
+		t.Fatalf("expected 2 messages in the outbox, got %d", len(sender.outbox.Messages()))
+	}
+	if failed, _ := notifier.ListFailedNotifications(""); len(failed) != 0 {
+		t.Fatalf("expected no failed notifications left, got %d", len(failed))
+	}
+}
+
+func TestResendUnknownReservationIsNotFound(t *testing.T) {
+	store := memory.NewSeededStore()
+	notifier := NewNotificationService(store, store, newTestSenderService())
+	_, err := notifier.ResendFailedNotifications("MISSING1")
+	herr, ok := err.(*errors.HTTPError)
+	if !ok || herr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %v", err)
+	}
+}
+
+func TestNotificationBackoffIsCapped(t *testing.T) {
+	if got := notificationBackoff(1); got != time.Minute {
+		t.Fatalf("first retry after %s, want 1m", got)
+	}
+	if got := notificationBackoff(3); got != 4*time.Minute {
+		t.Fatalf("third retry after %s, want 4m", got)
+	}
+	if got := notificationBackoff(30); got != notificationMaxBackoff {
+		t.Fatalf("backoff not capped: %s", got)
+	}
+}
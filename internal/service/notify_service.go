@@ -7,57 +7,88 @@ import (
 	"github.com/twilio/twilio-go"
 	openapi "github.com/twilio/twilio-go/rest/api/v2010"
 	"log"
-	"os"
 	"strings"
 )
 
-func SendEmailWithSendGrid(toEmailAddress, toName, subject, plainTextContent, htmlContent string) error {
-	sendgridAPIKey := os.Getenv("SENDGRID_API_KEY")
-	if sendgridAPIKey == "" {
+// EmailMessage is an email addressed to a single customer, with plain text and HTML bodies.
+type EmailMessage struct {
+	ToEmail   string
+	ToName    string
+	Subject   string
+	PlainText string
+	HTML      string
+}
+
+// EmailSender delivers emails to customers.
+type EmailSender interface {
+	SendEmail(msg EmailMessage) error
+}
+
+// SMSSender delivers text messages to customers.
+type SMSSender interface {
+	SendSMS(toNumber, body string) error
+}
+
+// SendGridEmailSender sends emails through the SendGrid API.
+type SendGridEmailSender struct {
+	APIKey    string
+	FromEmail string
+	FromName  string
+}
+
+func NewSendGridEmailSender(apiKey, fromEmail, fromName string) *SendGridEmailSender {
+	if fromName == "" {
+		fromName = "GreenPark"
+	}
+	return &SendGridEmailSender{APIKey: apiKey, FromEmail: fromEmail, FromName: fromName}
+}
+
+func (s *SendGridEmailSender) SendEmail(msg EmailMessage) error {
+	if s.APIKey == "" {
 		log.Println("ADVERTENCIA: SENDGRID_API_KEY no está configurada. El correo no se enviará.")
 		return fmt.Errorf("SENDGRID_API_KEY no está configurada")
 	}
-
-	fromEmail := os.Getenv("SENDGRID_FROM_EMAIL")
-	if fromEmail == "" {
+	if s.FromEmail == "" {
 		log.Println("ADVERTENCIA: SENDGRID_FROM_EMAIL no está configurada. El correo no se enviará.")
 		return fmt.Errorf("SENDGRID_FROM_EMAIL no está configurada")
 	}
 
-	fromName := os.Getenv("SENDGRID_FROM_NAME")
-	if fromName == "" {
-		fromName = "GreenPark"
-	}
-
-	from := mail.NewEmail(fromName, fromEmail)
-	to := mail.NewEmail(toName, toEmailAddress)
+	from := mail.NewEmail(s.FromName, s.FromEmail)
+	to := mail.NewEmail(msg.ToName, msg.ToEmail)
 
-	message := mail.NewSingleEmail(from, subject, to, plainTextContent, htmlContent)
+	message := mail.NewSingleEmail(from, msg.Subject, to, msg.PlainText, msg.HTML)
 
-	client := sendgrid.NewSendClient(sendgridAPIKey)
+	client := sendgrid.NewSendClient(s.APIKey)
 	response, err := client.Send(message)
 
 	if err != nil {
-		log.Printf("Error al intentar enviar correo vía SendGrid a %s: %v", toEmailAddress, err)
+		log.Printf("Error al intentar enviar correo vía SendGrid a %s: %v", msg.ToEmail, err)
 		return fmt.Errorf("falló el envío del correo a través de SendGrid: %w", err)
 	}
 
 	if response.StatusCode >= 200 && response.StatusCode < 300 {
-		log.Printf("Correo enviado exitosamente a %s (Asunto: %s). Estado: %d", toEmailAddress, subject, response.StatusCode)
+		log.Printf("Correo enviado exitosamente a %s (Asunto: %s). Estado: %d", msg.ToEmail, msg.Subject, response.StatusCode)
 		return nil
 	}
 
 	log.Printf("Error al enviar correo a %s vía SendGrid. Estado: %d, Cuerpo: %s, Cabeceras: %v",
-		toEmailAddress, response.StatusCode, response.Body, response.Headers)
+		msg.ToEmail, response.StatusCode, response.Body, response.Headers)
 	return fmt.Errorf("SendGrid devolvió un estado no exitoso %d: %s", response.StatusCode, response.Body)
 }
 
-func SendSMS(toNumber string, messageBody string) error {
-	accountSid := os.Getenv("TWILIO_ACCOUNT_SID")
-	authToken := os.Getenv("TWILIO_AUTH_TOKEN")
-	fromNumber := os.Getenv("TWILIO_FROM_NUMBER")
+// TwilioSMSSender sends text messages through the Twilio API.
+type TwilioSMSSender struct {
+	AccountSid string
+	AuthToken  string
+	FromNumber string
+}
+
+func NewTwilioSMSSender(accountSid, authToken, fromNumber string) *TwilioSMSSender {
+	return &TwilioSMSSender{AccountSid: accountSid, AuthToken: authToken, FromNumber: fromNumber}
+}
 
-	if accountSid == "" || authToken == "" || fromNumber == "" {
+func (s *TwilioSMSSender) SendSMS(toNumber string, messageBody string) error {
+	if s.AccountSid == "" || s.AuthToken == "" || s.FromNumber == "" {
 		log.Println("ADVERTENCIA: Las credenciales de Twilio (SID, Token o From Number) no están configuradas. El SMS no se enviará.")
 		return fmt.Errorf("credenciales de Twilio no configuradas completamente")
 	}
@@ -67,14 +98,14 @@ func SendSMS(toNumber string, messageBody string) error {
 	}
 
 	client := twilio.NewRestClientWithParams(twilio.ClientParams{
-		Username:   accountSid,
-		Password:   authToken,
-		AccountSid: accountSid,
+		Username:   s.AccountSid,
+		Password:   s.AuthToken,
+		AccountSid: s.AccountSid,
 	})
 
 	params := &openapi.CreateMessageParams{}
 	params.SetTo(toNumber)
-	params.SetFrom(fromNumber)
+	params.SetFrom(s.FromNumber)
 	params.SetBody(messageBody)
 
 	resp, err := client.Api.CreateMessage(params)
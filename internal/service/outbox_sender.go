@@ -0,0 +1,83 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutboxMessage is a notification captured by OutboxSender instead of being delivered.
+type OutboxMessage struct {
+	Channel string // email or sms
+	To      string
+	Subject string
+	Body    string
+	HTML    string
+	SentAt  time.Time
+}
+
+// OutboxSender implements EmailSender and SMSSender without contacting any provider: every message is written
+// to a file or stdout and kept in memory, so staff can read exactly what customers would receive.
+type OutboxSender struct {
+	mu       sync.Mutex
+	w        io.Writer
+	messages []OutboxMessage
+}
+
+// NewOutboxSender writes messages to stdout when path is empty or "-", otherwise appends them to path.
+func NewOutboxSender(path string) (*OutboxSender, error) {
+	if path == "" || path == "-" {
+		return NewOutboxWriter(os.Stdout), nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening outbox %s: %w", path, err)
+	}
+	return NewOutboxWriter(f), nil
+}
+
+func NewOutboxWriter(w io.Writer) *OutboxSender {
+	return &OutboxSender{w: w}
+}
+
+func (o *OutboxSender) SendEmail(msg EmailMessage) error {
+	to := msg.ToEmail
+	if msg.ToName != "" {
+		to = fmt.Sprintf("%s <%s>", msg.ToName, msg.ToEmail)
+	}
+	return o.record(OutboxMessage{Channel: "email", To: to, Subject: msg.Subject, Body: msg.PlainText, HTML: msg.HTML})
+}
+
+func (o *OutboxSender) SendSMS(toNumber, body string) error {
+	return o.record(OutboxMessage{Channel: "sms", To: toNumber, Body: body})
+}
+
+// Messages returns every message captured so far, oldest first.
+func (o *OutboxSender) Messages() []OutboxMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]OutboxMessage(nil), o.messages...)
+}
+
+func (o *OutboxSender) record(msg OutboxMessage) error {
+	msg.SentAt = time.Now().UTC()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "===== %s to %s at %s =====\n", strings.ToUpper(msg.Channel), msg.To, msg.SentAt.Format(time.RFC3339))
+	if msg.Subject != "" {
+		fmt.Fprintf(&b, "Subject: %s\n\n", msg.Subject)
+	}
+	b.WriteString(msg.Body)
+	b.WriteString("\n\n")
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	if _, err := io.WriteString(o.w, b.String()); err != nil {
+		return fmt.Errorf("error writing %s to outbox: %w", msg.Channel, err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"estacionamienti/internal/money"
+	"fmt"
+	"time"
+
+	"github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/client"
+)
+
+// CheckoutRequest describes a hosted payment page for a single amount. With a Discount, the page shows the product at
+// Price plus the discount, less the discount.
+type CheckoutRequest struct {
+	Price         money.Money
+	Discount      *CheckoutDiscount
+	ProductName   string
+	CustomerEmail string
+	Language      string
+	SuccessURL    string
+	CancelURL     string
+	ExpiresAt     time.Time
+}
+
+// CheckoutDiscount is a discount already taken off the price of a checkout, itemized on its page under Name.
+type CheckoutDiscount struct {
+	Name   string
+	Amount money.Amount
+}
+
+// CheckoutSession is the payment page created by the gateway.
+type CheckoutSession struct {
+	ID  string
+	URL string
+}
+
+// RefundRequest refunds a captured payment. An Amount of 0 refunds whatever has not been refunded yet. Requests
+// repeated with the same IdempotencyKey return the refund of the first one instead of refunding again.
+type RefundRequest struct {
+	PaymentIntentID string
+	Amount          money.Amount
+	IdempotencyKey  string
+}
+
+// Refund is the refund issued by the gateway.
+type Refund struct {
+	ID     string
+	Amount money.Amount
+	Status string
+}
+
+// PaymentGateway is the payment provider behind reservations: Stripe in production, FakePaymentGateway locally.
+type PaymentGateway interface {
+	CreateCheckoutSession(req CheckoutRequest) (*CheckoutSession, error)
+	Refund(req RefundRequest) (*Refund, error)
+	ListRefunds(paymentIntentID string) ([]Refund, error)
+	SessionIDByPaymentIntent(paymentIntentID string) (string, error)
+}
+
+// StripeGateway implements PaymentGateway with the Stripe API.
+type StripeGateway struct {
+	api *client.API
+}
+
+func NewStripeGateway(secretKey string) *StripeGateway {
+	return &StripeGateway{api: client.New(secretKey, nil)}
+}
+
+func (g *StripeGateway) CreateCheckoutSession(req CheckoutRequest) (*CheckoutSession, error) {
+	params := &stripe.CheckoutSessionParams{
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+					Currency: stripe.String(req.Price.Currency),
+					ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+						Name: stripe.String(req.ProductName),
+					},
+					UnitAmount: stripe.Int64(req.Price.Amount.Cents()),
+				},
+				Quantity: stripe.Int64(1),
+			},
+		},
+		Mode:          stripe.String(string(stripe.CheckoutSessionModePayment)),
+		SuccessURL:    stripe.String(req.SuccessURL),
+		CancelURL:     stripe.String(req.CancelURL),
+		CustomerEmail: stripe.String(req.CustomerEmail),
+		Locale:        stripe.String(req.Language),
+		ExpiresAt:     stripe.Int64(req.ExpiresAt.Unix()),
+	}
+	if req.Discount != nil && req.Discount.Amount > 0 {
+		// Line items can't be negative: the product goes at its full price and a single-use coupon takes the
+		// discount off.
+		coupon, err := g.api.Coupons.New(&stripe.CouponParams{
+			AmountOff:      stripe.Int64(req.Discount.Amount.Cents()),
+			Currency:       stripe.String(req.Price.Currency),
+			Duration:       stripe.String(string(stripe.CouponDurationOnce)),
+			MaxRedemptions: stripe.Int64(1),
+			Name:           stripe.String(req.Discount.Name),
+		})
+		if err != nil {
+			return nil, err
+		}
+		params.LineItems[0].PriceData.UnitAmount = stripe.Int64((req.Price.Amount + req.Discount.Amount).Cents())
+		params.Discounts = []*stripe.CheckoutSessionDiscountParams{{Coupon: stripe.String(coupon.ID)}}
+	}
+
+	sess, err := g.api.CheckoutSessions.New(params)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckoutSession{ID: sess.ID, URL: sess.URL}, nil
+}
+
+func (g *StripeGateway) Refund(req RefundRequest) (*Refund, error) {
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(req.PaymentIntentID),
+	}
+	if req.Amount > 0 {
+		params.Amount = stripe.Int64(req.Amount.Cents())
+	}
+	if req.IdempotencyKey != "" {
+		params.SetIdempotencyKey(req.IdempotencyKey)
+	}
+	ref, err := g.api.Refunds.New(params)
+	if err != nil {
+		return nil, err
+	}
+	return &Refund{ID: ref.ID, Amount: money.Amount(ref.Amount), Status: string(ref.Status)}, nil
+}
+
+// ListRefunds returns every refund of a payment intent, including the ones made from the Stripe dashboard.
+func (g *StripeGateway) ListRefunds(paymentIntentID string) ([]Refund, error) {
+	params := &stripe.RefundListParams{PaymentIntent: stripe.String(paymentIntentID)}
+	var refunds []Refund
+	it := g.api.Refunds.List(params)
+	for it.Next() {
+		ref := it.Refund()
+		refunds = append(refunds, Refund{ID: ref.ID, Amount: money.Amount(ref.Amount), Status: string(ref.Status)})
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return refunds, nil
+}
+
+// SessionIDByPaymentIntent busca el session_id en Stripe a partir de un PaymentIntentID
+func (g *StripeGateway) SessionIDByPaymentIntent(paymentIntentID string) (string, error) {
+	params := &stripe.CheckoutSessionListParams{
+		PaymentIntent: &paymentIntentID,
+	}
+	params.Limit = stripe.Int64(1)
+	it := g.api.CheckoutSessions.List(params)
+	for it.Next() {
+		sess := it.CheckoutSession()
+		if sess != nil && sess.ID != "" {
+			return sess.ID, nil
+		}
+	}
+	if err := it.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("No session_id found for PaymentIntentID %s", paymentIntentID)
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"database/sql"
+	stdErrors "errors"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/money"
+	"estacionamienti/internal/repository"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	paymentKindCharge     = "charge"
+	paymentKindRefund     = "refund"
+	paymentKindOnsite     = "onsite"
+	paymentKindAdjustment = "adjustment"
+
+	paymentMethodStripe = "stripe"
+)
+
+// PaymentService keeps the payments ledger of reservations: Stripe charges and refunds, money collected on site
+// and manual adjustments. Stripe entries are keyed by their Stripe ID, so recording one twice is harmless.
+type PaymentService struct {
+	repo            repository.PaymentRepository
+	reservationRepo repository.ReservationRepository
+}
+
+func NewPaymentService(repo repository.PaymentRepository, reservationRepo repository.ReservationRepository) *PaymentService {
+	return &PaymentService{repo: repo, reservationRepo: reservationRepo}
+}
+
+// RecordStripeCharge records the payment of a checkout.
+func (s *PaymentService) RecordStripeCharge(reservation *db.Reservation, paymentIntentID string, amount money.Amount) error {
+	if paymentIntentID == "" || amount <= 0 {
+		return nil
+	}
+	return s.record(&db.Payment{
+		ReservationID:   reservation.ID,
+		ReservationCode: reservation.Code,
+		Kind:            paymentKindCharge,
+		Amount:          amount,
+		Method:          paymentMethodStripe,
+		ExternalID:      sql.NullString{String: paymentIntentID, Valid: true},
+	})
+}
+
+// RecordStripeRefund records a refund issued by Stripe unless it failed or was canceled.
+func (s *PaymentService) RecordStripeRefund(reservation *db.Reservation, refund *Refund, note string) error {
+	if refund == nil || refund.Amount <= 0 || refund.Status == "failed" || refund.Status == "canceled" {
+		return nil
+	}
+	return s.record(&db.Payment{
+		ReservationID:   reservation.ID,
+		ReservationCode: reservation.Code,
+		Kind:            paymentKindRefund,
+		Amount:          refund.Amount,
+		Method:          paymentMethodStripe,
+		ExternalID:      sql.NullString{String: refund.ID, Valid: refund.ID != ""},
+		Note:            note,
+	})
+}
+
+// stripeCharge is a payment intent that charged a reservation.
+type stripeCharge struct {
+	paymentIntentID string
+	amount          money.Amount
+}
+
+// stripeCharges returns the Stripe payments of a reservation, oldest first. The checkout payment of the reservation
+// is included even when the ledger missed it.
+func (s *PaymentService) stripeCharges(reservation *db.Reservation) ([]stripeCharge, error) {
+	charges, _, err := s.stripeLedger(reservation)
+	return charges, err
+}
+
+// stripePaid is what the reservation paid through Stripe according to the payments ledger, its checkout and every
+// later payment of a modification or extension, and how much of it was refunded. Onsite payments are not counted.
+func (s *PaymentService) stripePaid(reservation *db.Reservation) (paid, refunded money.Amount, err error) {
+	charges, refunded, err := s.stripeLedger(reservation)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, charge := range charges {
+		paid += charge.amount
+	}
+	return paid, refunded, nil
+}
+
+// stripeLedger reads the Stripe charges of a reservation, as stripeCharges returns them, and the sum of its Stripe
+// refunds from the payments ledger.
+func (s *PaymentService) stripeLedger(reservation *db.Reservation) ([]stripeCharge, money.Amount, error) {
+	payments, err := s.repo.ListPaymentsByReservation(reservation.ID)
+	if err != nil {
+		log.Printf("Error listing payments of reservation %s: %v", reservation.Code, err)
+		return nil, 0, err
+	}
+	var charges []stripeCharge
+	var refunded money.Amount
+	checkoutRecorded := false
+	for _, p := range payments {
+		if p.Method != paymentMethodStripe {
+			continue
+		}
+		switch {
+		case p.Kind == paymentKindCharge && p.ExternalID.Valid:
+			charges = append(charges, stripeCharge{paymentIntentID: p.ExternalID.String, amount: p.Amount})
+			checkoutRecorded = checkoutRecorded || p.ExternalID.String == reservation.StripePaymentIntentID.String
+		case p.Kind == paymentKindRefund:
+			refunded += p.Amount
+		}
+	}
+	if !checkoutRecorded && reservation.StripePaymentIntentID.String != "" {
+		charges = append([]stripeCharge{{
+			paymentIntentID: reservation.StripePaymentIntentID.String,
+			amount:          reservation.DepositPayment,
+		}}, charges...)
+	}
+	return charges, refunded, nil
+}
+
+// netPaid is what the reservation has paid so far according to its ledger, as amount_paid in reservation responses.
+func (s *PaymentService) netPaid(reservation *db.Reservation) (money.Amount, error) {
+	payments, err := s.repo.ListPaymentsByReservation(reservation.ID)
+	if err != nil {
+		log.Printf("Error listing payments of reservation %s: %v", reservation.Code, err)
+		return 0, err
+	}
+	var net money.Amount
+	for _, p := range payments {
+		if p.Kind == paymentKindRefund {
+			net -= p.Amount
+		} else {
+			net += p.Amount
+		}
+	}
+	return net, nil
+}
+
+// refundedWithNote is what the Stripe refunds recorded with the note add up to.
+func (s *PaymentService) refundedWithNote(reservation *db.Reservation, note string) (money.Amount, error) {
+	payments, err := s.repo.ListPaymentsByReservation(reservation.ID)
+	if err != nil {
+		log.Printf("Error listing payments of reservation %s: %v", reservation.Code, err)
+		return 0, err
+	}
+	var refunded money.Amount
+	for _, p := range payments {
+		if p.Kind == paymentKindRefund && p.Method == paymentMethodStripe && p.Note == note {
+			refunded += p.Amount
+		}
+	}
+	return refunded, nil
+}
+
+func (s *PaymentService) record(p *db.Payment) error {
+	created, err := s.repo.RecordPayment(p)
+	if err != nil {
+		log.Printf("Error recording %s of %s for reservation %s: %v", p.Kind, p.Amount, p.ReservationCode, err)
+		return err
+	}
+	if !created {
+		log.Printf("%s %s of reservation %s already recorded", p.Kind, p.ExternalID.String, p.ReservationCode)
+	}
+	return nil
+}
+
+// RecordAdminPayment records money collected at the parking or a manual adjustment, entered by an admin.
+func (s *PaymentService) RecordAdminPayment(code string, req entities.PaymentRequest, recordedBy string) (*db.Payment, error) {
+	if req.Kind == "" {
+		req.Kind = paymentKindOnsite
+	}
+	switch req.Kind {
+	case paymentKindOnsite:
+		if req.Amount <= 0 {
+			return nil, errors.NewHTTPError(http.StatusBadRequest, "amount must be positive")
+		}
+		if req.Method == "" {
+			req.Method = "cash"
+		}
+		if req.Method != "cash" && req.Method != "card" {
+			return nil, errors.NewHTTPError(http.StatusBadRequest, "method must be cash or card")
+		}
+	case paymentKindAdjustment:
+		if req.Amount == 0 {
+			return nil, errors.NewHTTPError(http.StatusBadRequest, "amount can't be zero")
+		}
+		if strings.TrimSpace(req.Note) == "" {
+			return nil, errors.NewHTTPError(http.StatusBadRequest, "adjustments need a note explaining them")
+		}
+	default:
+		return nil, errors.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("kind must be %s or %s", paymentKindOnsite, paymentKindAdjustment))
+	}
+
+	reservation, err := s.getReservation(code)
+	if err != nil {
+		return nil, err
+	}
+	if reservation.Status == statusCancel {
+		return nil, errors.NewHTTPError(http.StatusConflict, "Reservation is canceled")
+	}
+
+	payment := &db.Payment{
+		ReservationID:   reservation.ID,
+		ReservationCode: reservation.Code,
+		Kind:            req.Kind,
+		Amount:          req.Amount,
+		Method:          req.Method,
+		Note:            strings.TrimSpace(req.Note),
+		RecordedBy:      recordedBy,
+	}
+	if err := s.record(payment); err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// ListPayments returns the ledger of a reservation, oldest first.
+func (s *PaymentService) ListPayments(code string) ([]db.Payment, error) {
+	reservation, err := s.getReservation(code)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := s.repo.ListPaymentsByReservation(reservation.ID)
+	if err != nil {
+		log.Printf("Error listing payments of reservation %s: %v", code, err)
+		return nil, err
+	}
+	return payments, nil
+}
+
+func (s *PaymentService) getReservation(code string) (*db.Reservation, error) {
+	reservation, err := s.reservationRepo.GetReservationByCodeOnly(code)
+	if err != nil {
+		log.Printf("Error getting reservation %s: %v", code, err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NewHTTPError(http.StatusNotFound, "Reservation not found")
+		}
+		return nil, err
+	}
+	return reservation, nil
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/repository/memory"
+	"net/http"
+	"testing"
+)
+
+func TestRecordOnsitePaymentUpdatesBalanceDue(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := NewPaymentService(store, store)
+	res := newReservation("ONSITE01", carTypeID, statusActive, futureHour(72), futureHour(75))
+	res.TotalPrice = 1200
+	store.InsertReservation(res)
+	if err := svc.RecordStripeCharge(store.Reservation("ONSITE01"), "pi_test", 360); err != nil {
+		t.Fatalf("recording deposit: %v", err)
+	}
+
+	before, _ := store.FindReservationByCode("ONSITE01")
+	if before.AmountPaid != 360 || before.BalanceDue != 840 {
+		t.Fatalf("expected 3.60 paid and 8.40 due after the deposit, got %+v", before)
+	}
+
+	payment, err := svc.RecordAdminPayment("ONSITE01", entities.PaymentRequest{Amount: 840, Method: "card"}, "admin")
+	if err != nil {
+		t.Fatalf("RecordAdminPayment: %v", err)
+	}
+	if payment.Kind != paymentKindOnsite || payment.RecordedBy != "admin" {
+		t.Fatalf("unexpected payment %+v", payment)
+	}
+	after, _ := store.FindReservationByCode("ONSITE01")
+	if after.AmountPaid != 1200 || after.BalanceDue != 0 {
+		t.Fatalf("expected the reservation to be paid off, got paid %s, due %s", after.AmountPaid, after.BalanceDue)
+	}
+
+	payments, err := svc.ListPayments("ONSITE01")
+	if err != nil || len(payments) != 2 {
+		t.Fatalf("expected the deposit and the on-site payment, got %+v, %v", payments, err)
+	}
+}
+
+func TestRecordAdminPaymentValidation(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := NewPaymentService(store, store)
+	store.InsertReservation(newReservation("ONSITE02", carTypeID, statusActive, futureHour(72), futureHour(75)))
+	store.InsertReservation(newReservation("ONSITE03", carTypeID, statusCancel, futureHour(72), futureHour(75)))
+
+	cases := []struct {
+		name string
+		code string
+		req  entities.PaymentRequest
+		want int
+	}{
+		{"negative amount", "ONSITE02", entities.PaymentRequest{Amount: -500}, http.StatusBadRequest},
+		{"unknown method", "ONSITE02", entities.PaymentRequest{Amount: 500, Method: "cheque"}, http.StatusBadRequest},
+		{"adjustment without note", "ONSITE02", entities.PaymentRequest{Kind: paymentKindAdjustment, Amount: -200}, http.StatusBadRequest},
+		{"refunds are not entered by hand", "ONSITE02", entities.PaymentRequest{Kind: paymentKindRefund, Amount: 500}, http.StatusBadRequest},
+		{"canceled reservation", "ONSITE03", entities.PaymentRequest{Amount: 500}, http.StatusConflict},
+		{"unknown reservation", "MISSING0", entities.PaymentRequest{Amount: 500}, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := svc.RecordAdminPayment(tc.code, tc.req, "admin")
+			herr, ok := err.(*errors.HTTPError)
+			if !ok || herr.Code != tc.want {
+				t.Fatalf("expected a %d HTTPError, got %v", tc.want, err)
+			}
+		})
+	}
+
+	if _, err := svc.RecordAdminPayment("ONSITE02", entities.PaymentRequest{Kind: paymentKindAdjustment, Amount: -200, Note: "late exit"}, "admin"); err != nil {
+		t.Fatalf("expected a negative adjustment with a note to be accepted: %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"database/sql"
+	stdErrors "errors"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/money"
+	"estacionamienti/internal/repository"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// pricingUnits are the reservation_times rows, largest first, in the order getUnitCounts returns them.
+var pricingUnits = []struct {
+	ID   int
+	Name string
+}{{4, "month"}, {3, "week"}, {2, "day"}, {1, "hour"}}
+
+// pricingLocation is the time zone pricing rule dates, weekdays and hours are written in.
+var pricingLocation = loadPricingLocation()
+
+func loadPricingLocation() *time.Location {
+	loc, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		log.Printf("No se pudo cargar Europe/Rome para las reglas de precio, usando CET fijo: %v", err)
+		return time.FixedZone("CET", 3600)
+	}
+	return loc
+}
+
+// pricingRepos are the repositories reservations are priced with: unit prices and pricing rules, and promo codes.
+type pricingRepos struct {
+	repository.PricingRepository
+	repository.PromoCodeRepository
+}
+
+// priceReservation prices a reservation from startTime to endTime, to the cent. The base price comes from the unit
+// prices of the vehicle type, spread evenly over the hours of the reservation, the last one rounded up. Each hour is
+// then adjusted by the highest priority pricing rule covering its start, and the adjustments are itemized per rule.
+func priceReservation(repo repository.PricingRepository, vehicleTypeID int, startTime, endTime time.Time) (*entities.PriceBreakdown, error) {
+	if !endTime.After(startTime) {
+		return nil, fmt.Errorf("end_time must be after start_time")
+	}
+	months, weeks, days, hours := getUnitCounts(startTime, endTime)
+
+	breakdown := &entities.PriceBreakdown{Units: []entities.PriceUnitLine{}, Adjustments: []entities.PriceAdjustmentLine{}}
+	var base money.Amount
+	for i, quantity := range []int{months, weeks, days, hours} {
+		unit := pricingUnits[i]
+		price, err := repo.GetPriceForUnit(vehicleTypeID, unit.ID)
+		if err != nil {
+			log.Printf("Error from GetPriceForUnit (%s): %v", unit.Name, err)
+			return nil, fmt.Errorf("could not get price per %s: %w", unit.Name, err)
+		}
+		if quantity == 0 {
+			continue
+		}
+		amount := price * money.Amount(quantity)
+		base += amount
+		breakdown.Units = append(breakdown.Units, entities.PriceUnitLine{Unit: unit.Name, Quantity: quantity, UnitPrice: price, Amount: amount})
+	}
+	breakdown.BasePrice = base
+	breakdown.TotalPrice = base
+
+	rules, err := repo.GetPricingRules(vehicleTypeID)
+	if err != nil {
+		log.Printf("Error getting pricing rules for vehicle type %d: %v", vehicleTypeID, err)
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return breakdown, nil
+	}
+
+	slots := int(math.Ceil(float64(endTime.Sub(startTime)) / float64(time.Hour)))
+	slotBase := float64(base) / float64(slots)
+	lines := map[int]int{}
+	var amounts []float64 // in fractions of a cent until every hour is added
+	for i := 0; i < slots; i++ {
+		rule := matchingPricingRule(rules, startTime.Add(time.Duration(i)*time.Hour))
+		if rule == nil {
+			continue
+		}
+		price := slotBase
+		if rule.HourlyPrice != nil {
+			price = float64(*rule.HourlyPrice)
+		} else if rule.Multiplier != nil {
+			price = slotBase * *rule.Multiplier
+		}
+		line, ok := lines[rule.ID]
+		if !ok {
+			line = len(breakdown.Adjustments)
+			lines[rule.ID] = line
+			breakdown.Adjustments = append(breakdown.Adjustments, entities.PriceAdjustmentLine{RuleID: rule.ID, Rule: rule.Name})
+			amounts = append(amounts, 0)
+		}
+		breakdown.Adjustments[line].Hours++
+		amounts[line] += price - slotBase
+	}
+
+	total := base
+	for i := range breakdown.Adjustments {
+		breakdown.Adjustments[i].Amount = money.Amount(math.Round(amounts[i]))
+		total += breakdown.Adjustments[i].Amount
+	}
+	if total < 0 {
+		total = 0
+	}
+	breakdown.TotalPrice = total
+	return breakdown, nil
+}
+
+// matchingPricingRule returns the rule covering the hour starting at the given time, or nil. Among overlapping
+// rules the highest priority wins, and the newest one on a tie.
+func matchingPricingRule(rules []db.PricingRule, at time.Time) *db.PricingRule {
+	local := at.In(pricingLocation)
+	var match *db.PricingRule
+	for i := range rules {
+		rule := &rules[i]
+		if !pricingRuleCovers(rule, local) {
+			continue
+		}
+		if match == nil || rule.Priority > match.Priority || (rule.Priority == match.Priority && rule.ID > match.ID) {
+			match = rule
+		}
+	}
+	return match
+}
+
+func pricingRuleCovers(rule *db.PricingRule, local time.Time) bool {
+	date := local.Format("2006-01-02")
+	if (rule.StartDate != "" && date < rule.StartDate) || (rule.EndDate != "" && date > rule.EndDate) {
+		return false
+	}
+	if len(rule.Weekdays) > 0 {
+		found := false
+		for _, day := range rule.Weekdays {
+			if day == int(local.Weekday()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if rule.StartHour != nil && rule.EndHour != nil && *rule.StartHour != *rule.EndHour {
+		hour := local.Hour()
+		if *rule.StartHour < *rule.EndHour {
+			return hour >= *rule.StartHour && hour < *rule.EndHour
+		}
+		return hour >= *rule.StartHour || hour < *rule.EndHour
+	}
+	return true
+}
+
+func (s *AdminService) ListPricingRules() ([]db.PricingRule, error) {
+	rules, err := s.adminRepo.ListPricingRules()
+	if err != nil {
+		log.Printf("[AdminService] Error listing pricing rules: %v", err)
+		return nil, err
+	}
+	return rules, nil
+}
+
+// CreatePricingRule validates and stores a pricing rule. It applies to prices computed from now on; reservations
+// already made keep their price.
+func (s *AdminService) CreatePricingRule(rule *db.PricingRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if err := validatePricingRule(rule); err != nil {
+		return err
+	}
+	if rule.VehicleTypeID != nil {
+		if err := checkVehicleType(s.reservationRepo, *rule.VehicleTypeID); err != nil {
+			return err
+		}
+	}
+	if err := s.adminRepo.CreatePricingRule(rule); err != nil {
+		log.Printf("[AdminService] Error creating pricing rule '%s': %v", rule.Name, err)
+		return err
+	}
+	return nil
+}
+
+func (s *AdminService) DeletePricingRule(id int) error {
+	if err := s.adminRepo.DeletePricingRule(id); err != nil {
+		log.Printf("[AdminService] Error deleting pricing rule %d: %v", id, err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return errors.NewHTTPError(http.StatusNotFound, "Pricing rule not found")
+		}
+		return err
+	}
+	return nil
+}
+
+func validatePricingRule(rule *db.PricingRule) error {
+	if rule.Name == "" {
+		return errors.NewHTTPError(http.StatusBadRequest, "name is required")
+	}
+	if (rule.Multiplier == nil) == (rule.HourlyPrice == nil) {
+		return errors.NewHTTPError(http.StatusBadRequest, "Exactly one of multiplier or hourly_price is required")
+	}
+	if (rule.Multiplier != nil && *rule.Multiplier < 0) || (rule.HourlyPrice != nil && *rule.HourlyPrice < 0) {
+		return errors.NewHTTPError(http.StatusBadRequest, "multiplier and hourly_price can't be negative")
+	}
+	for _, date := range []string{rule.StartDate, rule.EndDate} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return errors.NewHTTPError(http.StatusBadRequest, "Invalid date format. Use YYYY-MM-DD")
+		}
+	}
+	if rule.StartDate != "" && rule.EndDate != "" && rule.EndDate < rule.StartDate {
+		return errors.NewHTTPError(http.StatusBadRequest, "end_date must not be before start_date")
+	}
+	for _, day := range rule.Weekdays {
+		if day < 0 || day > 6 {
+			return errors.NewHTTPError(http.StatusBadRequest, "weekdays go from 0 (Sunday) to 6 (Saturday)")
+		}
+	}
+	if (rule.StartHour == nil) != (rule.EndHour == nil) {
+		return errors.NewHTTPError(http.StatusBadRequest, "start_hour and end_hour go together")
+	}
+	if rule.StartHour != nil && (*rule.StartHour < 0 || *rule.StartHour > 23 || *rule.EndHour < 0 || *rule.EndHour > 24) {
+		return errors.NewHTTPError(http.StatusBadRequest, "start_hour goes from 0 to 23 and end_hour from 0 to 24")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/money"
+	"estacionamienti/internal/repository/memory"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func intPtr(v int) *int                      { return &v }
+func floatPtr(v float64) *float64            { return &v }
+func amountPtr(v money.Amount) *money.Amount { return &v }
+
+func addPricingRule(t *testing.T, admin *AdminService, rule db.PricingRule) int {
+	t.Helper()
+	if err := admin.CreatePricingRule(&rule); err != nil {
+		t.Fatalf("CreatePricingRule %s: %v", rule.Name, err)
+	}
+	return rule.ID
+}
+
+func TestPricingRulesAdjustCoveredHours(t *testing.T) {
+	store := memory.NewSeededStore()
+	admin := newTestAdminService(store)
+	svc := newTestReservationService(store)
+
+	night := addPricingRule(t, admin, db.PricingRule{Name: "Night", StartHour: intPtr(22), EndHour: intPtr(6), Multiplier: floatPtr(0.5)})
+	august := addPricingRule(t, admin, db.PricingRule{Name: "August", StartDate: "2030-08-01", EndDate: "2030-08-31",
+		Multiplier: floatPtr(1.5), Priority: 1})
+	addPricingRule(t, admin, db.PricingRule{Name: "Sunday cars", VehicleTypeID: intPtr(carTypeID), Weekdays: []int{0},
+		HourlyPrice: amountPtr(1000), Priority: 2})
+
+	tests := []struct {
+		name      string
+		vehicle   int
+		start     time.Time
+		hours     int
+		wantTotal money.Amount
+		wantLines int
+	}{
+		// 20:00-24:00 in July: the last two hours at half price.
+		{"night discount", carTypeID, time.Date(2030, 7, 10, 20, 0, 0, 0, pricingLocation), 4, 1200, 1},
+		// August wins over the night rule by priority.
+		{"august over night", carTypeID, time.Date(2030, 8, 3, 22, 0, 0, 0, pricingLocation), 2, 1200, 1},
+		// Sunday 2030-08-04 overrides August for cars only.
+		{"sunday override", carTypeID, time.Date(2030, 8, 4, 10, 0, 0, 0, pricingLocation), 2, 2000, 1},
+		{"sunday motorcycle", motorcycleTypeID, time.Date(2030, 8, 4, 10, 0, 0, 0, pricingLocation), 2, 600, 1},
+		{"no rule", carTypeID, time.Date(2030, 7, 10, 10, 0, 0, 0, pricingLocation), 3, 1200, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.GetTotalPriceForReservation(tt.vehicle, tt.start, tt.start.Add(time.Duration(tt.hours)*time.Hour))
+			if err != nil {
+				t.Fatalf("GetTotalPriceForReservation: %v", err)
+			}
+			if got.TotalPrice != tt.wantTotal || len(got.Adjustments) != tt.wantLines {
+				t.Fatalf("got %+v, want total %v with %d adjustments", got, tt.wantTotal, tt.wantLines)
+			}
+		})
+	}
+
+	got, err := svc.GetTotalPriceForReservation(carTypeID, time.Date(2030, 7, 31, 22, 0, 0, 0, pricingLocation),
+		time.Date(2030, 8, 1, 2, 0, 0, 0, pricingLocation))
+	if err != nil {
+		t.Fatalf("GetTotalPriceForReservation: %v", err)
+	}
+	// Two night hours in July (-4) and two in August (+4).
+	if got.BasePrice != 1600 || got.TotalPrice != 1600 || len(got.Adjustments) != 2 ||
+		got.Adjustments[0].RuleID != night || got.Adjustments[0].Amount != -400 ||
+		got.Adjustments[1].RuleID != august || got.Adjustments[1].Amount != 400 || got.Adjustments[1].Hours != 2 {
+		t.Fatalf("unexpected breakdown across rules: %+v", got)
+	}
+}
+
+func TestCreatePricingRuleValidation(t *testing.T) {
+	admin := newTestAdminService(memory.NewSeededStore())
+	for name, rule := range map[string]db.PricingRule{
+		"both prices":     {Name: "x", Multiplier: floatPtr(2), HourlyPrice: amountPtr(500)},
+		"no price":        {Name: "x"},
+		"bad weekday":     {Name: "x", Multiplier: floatPtr(2), Weekdays: []int{7}},
+		"lonely hour":     {Name: "x", Multiplier: floatPtr(2), StartHour: intPtr(8)},
+		"reversed dates":  {Name: "x", Multiplier: floatPtr(2), StartDate: "2030-08-31", EndDate: "2030-08-01"},
+		"unknown vehicle": {Name: "x", Multiplier: floatPtr(2), VehicleTypeID: intPtr(99)},
+	} {
+		err := admin.CreatePricingRule(&rule)
+		if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %v", name, err)
+		}
+	}
+	if err := admin.DeletePricingRule(42); err == nil {
+		t.Fatal("expected an error deleting a missing rule")
+	}
+}
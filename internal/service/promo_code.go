@@ -0,0 +1,218 @@
+package service
+
+import (
+	"database/sql"
+	stdErrors "errors"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/money"
+	"estacionamienti/internal/repository"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// normalizePromoCode is how promo codes are stored and looked up: trimmed and in upper case.
+func normalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// applyPromoCode checks the promo code can be used now for a reservation of the vehicle type and window, by email
+// when it is known, and returns it with what it takes off totalPrice.
+func applyPromoCode(repo repository.PromoCodeRepository, code string, vehicleTypeID int, startTime, endTime time.Time,
+	email string, totalPrice money.Amount) (*db.PromoCode, money.Amount, error) {
+	promo, err := repo.GetPromoCodeByCode(normalizePromoCode(code))
+	if err != nil {
+		log.Printf("Error getting promo code %q: %v", code, err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return nil, 0, errors.NewHTTPError(http.StatusBadRequest, "Invalid promo code")
+		}
+		return nil, 0, err
+	}
+	if err := checkPromoCode(promo, vehicleTypeID, startTime, endTime); err != nil {
+		return nil, 0, err
+	}
+
+	if promo.MaxRedemptions != nil || promo.MaxRedemptionsPerEmail != nil {
+		total, byEmail, err := repo.CountPromoRedemptions(promo.ID, email)
+		if err != nil {
+			log.Printf("Error counting redemptions of promo code %s: %v", promo.Code, err)
+			return nil, 0, err
+		}
+		if (promo.MaxRedemptions != nil && total >= *promo.MaxRedemptions) ||
+			(email != "" && promo.MaxRedemptionsPerEmail != nil && byEmail >= *promo.MaxRedemptionsPerEmail) {
+			return nil, 0, errPromoCodeExhausted()
+		}
+	}
+	return promo, promoDiscount(promo, totalPrice), nil
+}
+
+// checkPromoCode checks the promo code is active and valid now for a reservation of the vehicle type and window.
+func checkPromoCode(promo *db.PromoCode, vehicleTypeID int, startTime, endTime time.Time) error {
+	now := time.Now()
+	switch {
+	case !promo.Active:
+		return errors.NewHTTPError(http.StatusBadRequest, "Invalid promo code")
+	case promo.ValidFrom != nil && now.Before(*promo.ValidFrom):
+		return errors.NewHTTPError(http.StatusBadRequest, "The promo code is not valid yet")
+	case promo.ValidUntil != nil && !now.Before(*promo.ValidUntil):
+		return errors.NewHTTPError(http.StatusBadRequest, "The promo code has expired")
+	case len(promo.VehicleTypeIDs) > 0 && !slices.Contains(promo.VehicleTypeIDs, vehicleTypeID):
+		return errors.NewHTTPError(http.StatusBadRequest, "The promo code is not valid for this vehicle type")
+	case endTime.Sub(startTime) < time.Duration(promo.MinDurationHours)*time.Hour:
+		return errors.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("The promo code needs a reservation of at least %d hours", promo.MinDurationHours))
+	}
+	return nil
+}
+
+// promoDiscount is what the promo code takes off totalPrice, never more than the price itself.
+func promoDiscount(promo *db.PromoCode, totalPrice money.Amount) money.Amount {
+	if promo.PercentOff != nil {
+		return totalPrice.Percent(*promo.PercentOff)
+	}
+	return min(*promo.AmountOff, totalPrice)
+}
+
+func errPromoCodeExhausted() *errors.HTTPError {
+	return errors.NewHTTPError(http.StatusConflict, "The promo code has no redemptions left")
+}
+
+// checkoutDiscount is the share of the promo discount in the upfront payment, shown on the checkout page.
+func checkoutDiscount(reservation *db.Reservation, promoCode string) *CheckoutDiscount {
+	if reservation.DiscountAmount <= 0 {
+		return nil
+	}
+	undiscounted := upfrontPayment(reservation.PaymentMethodID, reservation.TotalPrice+reservation.DiscountAmount)
+	amount := undiscounted - reservation.DepositPayment
+	if amount <= 0 {
+		return nil
+	}
+	return &CheckoutDiscount{Name: promoCode, Amount: amount}
+}
+
+// rediscountedChange applies the promo code of the reservation again to the new price of a modification, so a
+// percentage keeps its share and a fixed discount its amount.
+func rediscountedChange(repo repository.PromoCodeRepository, reservation *db.Reservation, change *db.ReservationChange) error {
+	if !reservation.PromoCodeID.Valid {
+		return nil
+	}
+	promo, err := repo.GetPromoCodeByID(int(reservation.PromoCodeID.Int64))
+	if err != nil {
+		return err
+	}
+	change.NewDiscount = promoDiscount(promo, change.NewTotalPrice)
+	change.NewTotalPrice -= change.NewDiscount
+	return nil
+}
+
+func (s *AdminService) ListPromoCodes() ([]db.PromoCode, error) {
+	promos, err := s.adminRepo.ListPromoCodes()
+	if err != nil {
+		log.Printf("[AdminService] Error listing promo codes: %v", err)
+		return nil, err
+	}
+	return promos, nil
+}
+
+// CreatePromoCode validates and stores a promo code.
+func (s *AdminService) CreatePromoCode(promo *db.PromoCode) error {
+	if err := s.checkPromoCode(promo); err != nil {
+		return err
+	}
+	if err := s.adminRepo.CreatePromoCode(promo); err != nil {
+		log.Printf("[AdminService] Error creating promo code '%s': %v", promo.Code, err)
+		return err
+	}
+	return nil
+}
+
+// UpdatePromoCode replaces a promo code. Reservations already booked with it keep their discount.
+func (s *AdminService) UpdatePromoCode(promo *db.PromoCode) error {
+	if err := s.checkPromoCode(promo); err != nil {
+		return err
+	}
+	if err := s.adminRepo.UpdatePromoCode(promo); err != nil {
+		log.Printf("[AdminService] Error updating promo code %d: %v", promo.ID, err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return errors.NewHTTPError(http.StatusNotFound, "Promo code not found")
+		}
+		return err
+	}
+	return nil
+}
+
+// DeletePromoCode removes a promo code never redeemed. Redeemed ones are kept for reporting and can only be
+// deactivated.
+func (s *AdminService) DeletePromoCode(id int) error {
+	if err := s.adminRepo.DeletePromoCode(id); err != nil {
+		log.Printf("[AdminService] Error deleting promo code %d: %v", id, err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return errors.NewHTTPError(http.StatusNotFound, "Promo code not found")
+		}
+		if stdErrors.Is(err, repository.ErrPromoCodeInUse) {
+			return errors.NewHTTPError(http.StatusConflict, "The promo code has been redeemed, deactivate it instead")
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *AdminService) checkPromoCode(promo *db.PromoCode) error {
+	promo.Code = normalizePromoCode(promo.Code)
+	promo.Description = strings.TrimSpace(promo.Description)
+	if err := validatePromoCode(promo); err != nil {
+		return err
+	}
+	for _, vehicleTypeID := range promo.VehicleTypeIDs {
+		if err := checkVehicleType(s.reservationRepo, vehicleTypeID); err != nil {
+			return err
+		}
+	}
+	existing, err := s.pricing.GetPromoCodeByCode(promo.Code)
+	if err != nil && !stdErrors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if existing != nil && existing.ID != promo.ID {
+		return errors.NewHTTPError(http.StatusConflict, fmt.Sprintf("Promo code %s already exists", promo.Code))
+	}
+	return nil
+}
+
+func validatePromoCode(promo *db.PromoCode) error {
+	if promo.Code == "" || len(promo.Code) > 50 {
+		return errors.NewHTTPError(http.StatusBadRequest, "code is required, up to 50 characters")
+	}
+	if (promo.PercentOff == nil) == (promo.AmountOff == nil) {
+		return errors.NewHTTPError(http.StatusBadRequest, "Exactly one of percent_off or amount_off is required")
+	}
+	if promo.PercentOff != nil && (*promo.PercentOff < 1 || *promo.PercentOff > 100) {
+		return errors.NewHTTPError(http.StatusBadRequest, "percent_off goes from 1 to 100")
+	}
+	if promo.AmountOff != nil && *promo.AmountOff <= 0 {
+		return errors.NewHTTPError(http.StatusBadRequest, "amount_off must be positive")
+	}
+	if promo.ValidFrom != nil && promo.ValidUntil != nil && !promo.ValidUntil.After(*promo.ValidFrom) {
+		return errors.NewHTTPError(http.StatusBadRequest, "valid_until must be after valid_from")
+	}
+	if promo.MinDurationHours < 0 {
+		return errors.NewHTTPError(http.StatusBadRequest, "min_duration_hours can't be negative")
+	}
+	if (promo.MaxRedemptions != nil && *promo.MaxRedemptions < 1) || (promo.MaxRedemptionsPerEmail != nil && *promo.MaxRedemptionsPerEmail < 1) {
+		return errors.NewHTTPError(http.StatusBadRequest, "max_redemptions and max_redemptions_per_email must be at least 1")
+	}
+	return nil
+}
+
+// promoQuoteLine is the promo line of a quote, with the negative discount.
+func promoQuoteLine(promo *db.PromoCode, discount money.Amount) entities.QuoteLine {
+	description := promo.Code
+	if promo.Description != "" {
+		description += ": " + promo.Description
+	}
+	return entities.QuoteLine{Kind: "promo", Description: description, Quantity: 1, Amount: -discount}
+}
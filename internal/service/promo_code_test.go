@@ -0,0 +1,235 @@
+package service
+
+import (
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/money"
+	"estacionamienti/internal/repository/memory"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func addPromoCode(t *testing.T, store *memory.Store, promo db.PromoCode) *db.PromoCode {
+	t.Helper()
+	promo.Active = true
+	if err := newTestAdminService(store).CreatePromoCode(&promo); err != nil {
+		t.Fatalf("CreatePromoCode: %v", err)
+	}
+	return &promo
+}
+
+func promoReservationRequest(email string, start time.Time, totalPrice money.Amount) *entities.ReservationRequest {
+	return &entities.ReservationRequest{
+		VehicleTypeID:   carTypeID,
+		UserName:        "Mario Rossi",
+		UserEmail:       email,
+		PaymentMethodID: paymentMethodOnline,
+		StartTime:       start,
+		EndTime:         start.Add(3 * time.Hour),
+		Language:        "en",
+		TotalPrice:      totalPrice,
+		PromoCode:       "summer20",
+	}
+}
+
+func TestQuoteAndBookWithPromoCode(t *testing.T) {
+	t.Setenv("QUOTE_SECRET", "quote-secret")
+	env := newChangeEnv()
+	addPromoCode(t, env.store, db.PromoCode{Code: "summer20", Description: "Summer", PercentOff: intPtr(20)})
+	start := futureHour(72)
+
+	quote, err := env.svc.QuoteReservation(entities.QuoteRequest{VehicleTypeID: carTypeID, PaymentMethodID: paymentMethodOnline,
+		StartTime: start, EndTime: start.Add(3 * time.Hour), PromoCode: " Summer20 "})
+	if err != nil {
+		t.Fatalf("QuoteReservation: %v", err)
+	}
+	last := quote.Lines[len(quote.Lines)-1]
+	if last.Kind != "promo" || last.Description != "SUMMER20: Summer" || last.Amount != -240 {
+		t.Fatalf("unexpected promo line: %+v", last)
+	}
+	if quote.PromoCode != "SUMMER20" || quote.TotalAmount != 960 || quote.DepositAmount != 960 {
+		t.Fatalf("unexpected quote: %+v", quote)
+	}
+
+	req := quoteReservationRequest(quote)
+	req.PromoCode = "summer20"
+	created, err := env.svc.CreateReservation(req)
+	if err != nil {
+		t.Fatalf("CreateReservation: %v", err)
+	}
+	got := env.store.Reservation(created.Code)
+	if got.TotalPrice != 960 || got.DiscountAmount != 240 || !got.PromoCodeID.Valid {
+		t.Fatalf("expected the discounted price and the promo code stored, got %+v", got)
+	}
+	sess, _ := env.gateway.Session(created.SessionID)
+	if sess.Amount != 960 || sess.Discount != 240 || sess.DiscountName != "SUMMER20" {
+		t.Fatalf("expected the discount on the checkout page, got %+v", sess)
+	}
+}
+
+func TestPromoCodeRestrictions(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := newTestReservationService(store)
+	past, future := time.Now().Add(-48*time.Hour), time.Now().Add(48*time.Hour)
+	addPromoCode(t, store, db.PromoCode{Code: "MOTO", PercentOff: intPtr(10), VehicleTypeIDs: []int{motorcycleTypeID}})
+	addPromoCode(t, store, db.PromoCode{Code: "LONG", PercentOff: intPtr(10), MinDurationHours: 4})
+	addPromoCode(t, store, db.PromoCode{Code: "SOON", PercentOff: intPtr(10), ValidFrom: &future})
+	addPromoCode(t, store, db.PromoCode{Code: "OVER", PercentOff: intPtr(10), ValidUntil: &past})
+	off := addPromoCode(t, store, db.PromoCode{Code: "OFF", PercentOff: intPtr(10)})
+	off.Active = false
+	if err := newTestAdminService(store).UpdatePromoCode(off); err != nil {
+		t.Fatalf("UpdatePromoCode: %v", err)
+	}
+	start := futureHour(72)
+
+	for _, code := range []string{"MOTO", "LONG", "SOON", "OVER", "OFF", "NOPE"} {
+		_, err := svc.QuoteReservation(entities.QuoteRequest{VehicleTypeID: carTypeID, PaymentMethodID: paymentMethodOnline,
+			StartTime: start, EndTime: start.Add(3 * time.Hour), PromoCode: code})
+		if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusBadRequest {
+			t.Errorf("promo code %s: expected 400, got %v", code, err)
+		}
+	}
+}
+
+func TestBookingRechecksQuotedPromoCode(t *testing.T) {
+	t.Setenv("QUOTE_SECRET", "quote-secret")
+	store := memory.NewSeededStore()
+	svc := newTestReservationService(store)
+	promo := addPromoCode(t, store, db.PromoCode{Code: "FLASH", PercentOff: intPtr(50)})
+	start := futureHour(72)
+	quote, err := svc.QuoteReservation(entities.QuoteRequest{VehicleTypeID: carTypeID, PaymentMethodID: paymentMethodOnline,
+		StartTime: start, EndTime: start.Add(3 * time.Hour), PromoCode: "FLASH"})
+	if err != nil {
+		t.Fatalf("QuoteReservation: %v", err)
+	}
+	req := quoteReservationRequest(quote)
+	req.PromoCode = "FLASH"
+
+	// The promo code is disabled, then expired, while the quote is still valid.
+	past := time.Now().Add(-time.Minute)
+	for name, update := range map[string]func(){
+		"disabled": func() { promo.Active = false },
+		"expired":  func() { promo.Active, promo.ValidUntil = true, &past },
+	} {
+		update()
+		if err := newTestAdminService(store).UpdatePromoCode(promo); err != nil {
+			t.Fatalf("UpdatePromoCode: %v", err)
+		}
+		_, err := svc.CreateReservation(req)
+		if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %v", name, err)
+		}
+	}
+}
+
+func TestPromoCodeRedemptionLimits(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := newTestReservationService(store)
+	addPromoCode(t, store, db.PromoCode{Code: "SUMMER20", PercentOff: intPtr(20), MaxRedemptions: intPtr(2), MaxRedemptionsPerEmail: intPtr(1)})
+	start := futureHour(72)
+
+	first, err := svc.CreateReservation(promoReservationRequest("mario@example.com", start, 960))
+	if err != nil {
+		t.Fatalf("CreateReservation: %v", err)
+	}
+	_, err = svc.CreateReservation(promoReservationRequest("Mario@Example.com", start, 960))
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a second redemption by the same email, got %v", err)
+	}
+	if _, err := svc.CreateReservation(promoReservationRequest("luigi@example.com", start, 960)); err != nil {
+		t.Fatalf("CreateReservation by another email: %v", err)
+	}
+	_, err = svc.CreateReservation(promoReservationRequest("anna@example.com", start, 960))
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 once the code is exhausted, got %v", err)
+	}
+
+	// A canceled reservation gives its redemption back.
+	if _, err := cancelReservation(store, svc.stripeService, store.Reservation(first.Code), 0, "", nil); err != nil {
+		t.Fatalf("cancelReservation: %v", err)
+	}
+	if _, err := svc.CreateReservation(promoReservationRequest("anna@example.com", start, 960)); err != nil {
+		t.Fatalf("CreateReservation after a cancellation: %v", err)
+	}
+}
+
+func TestModifiedReservationKeepsFixedDiscount(t *testing.T) {
+	store := memory.NewSeededStore()
+	admin := newTestAdminService(store)
+	addPromoCode(t, store, db.PromoCode{Code: "FIVE", AmountOff: amountPtr(500)})
+	start := futureHour(72)
+
+	req := adminRequest(carTypeID, start, start.Add(3*time.Hour))
+	req.PromoCode = "five"
+	created, err := admin.CreateReservation(req)
+	if err != nil {
+		t.Fatalf("CreateReservation: %v", err)
+	}
+	if got := store.Reservation(created.Code); got.TotalPrice != 700 || got.DiscountAmount != 500 {
+		t.Fatalf("expected 12 EUR less 5, got %+v", got)
+	}
+
+	newEnd := start.Add(5 * time.Hour)
+	undiscounted, err := totalPriceForReservation(store, carTypeID, start, newEnd)
+	if err != nil {
+		t.Fatalf("totalPriceForReservation: %v", err)
+	}
+	change, err := admin.ModifyReservation(created.Code, entities.ReservationChangeRequest{EndTime: &newEnd}, "admin")
+	if err != nil {
+		t.Fatalf("ModifyReservation: %v", err)
+	}
+	if change.NewTotalPrice != undiscounted-500 {
+		t.Fatalf("expected the new price less 5 EUR, got %s", change.NewTotalPrice)
+	}
+	if got := store.Reservation(created.Code); got.DiscountAmount != 500 {
+		t.Fatalf("expected the discount kept, got %s", got.DiscountAmount)
+	}
+}
+
+func TestAdminPromoCodes(t *testing.T) {
+	store := memory.NewSeededStore()
+	admin := newTestAdminService(store)
+	svc := newTestReservationService(store)
+	summer := addPromoCode(t, store, db.PromoCode{Code: "summer20", PercentOff: intPtr(20)})
+	unused := addPromoCode(t, store, db.PromoCode{Code: "UNUSED", AmountOff: amountPtr(100)})
+
+	cases := map[string]db.PromoCode{
+		"duplicate":    {Code: "Summer20", PercentOff: intPtr(10)},
+		"both":         {Code: "BOTH", PercentOff: intPtr(10), AmountOff: amountPtr(100)},
+		"percent":      {Code: "HUGE", PercentOff: intPtr(150)},
+		"vehicle type": {Code: "VT", PercentOff: intPtr(10), VehicleTypeIDs: []int{99}},
+	}
+	for name, promo := range cases {
+		err := admin.CreatePromoCode(&promo)
+		if _, ok := err.(*errors.HTTPError); !ok {
+			t.Errorf("%s: expected an HTTP error, got %v", name, err)
+		}
+	}
+
+	if _, err := svc.CreateReservation(promoReservationRequest("mario@example.com", futureHour(72), 960)); err != nil {
+		t.Fatalf("CreateReservation: %v", err)
+	}
+	promos, err := admin.ListPromoCodes()
+	if err != nil {
+		t.Fatalf("ListPromoCodes: %v", err)
+	}
+	for _, promo := range promos {
+		if promo.ID == summer.ID && (promo.Redemptions != 1 || promo.DiscountGiven != 240) {
+			t.Fatalf("expected one redemption of 2.40, got %+v", promo)
+		}
+	}
+
+	err = admin.DeletePromoCode(summer.ID)
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 deleting a redeemed promo code, got %v", err)
+	}
+	if err := admin.DeletePromoCode(unused.ID); err != nil {
+		t.Fatalf("DeletePromoCode: %v", err)
+	}
+	err = admin.DeletePromoCode(unused.ID)
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 deleting it again, got %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"database/sql"
+	stdErrors "errors"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/money"
+	"estacionamienti/internal/repository"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// quoteTTL is how long a quoted price can be booked.
+	quoteTTL = 15 * time.Minute
+	// vatRate is the Italian VAT included in every price.
+	vatRate = 0.22
+	// quoteAudience marks quote tokens, so no other token signed with the same key passes for one.
+	quoteAudience = "quote"
+)
+
+// quoteClaims is what a quote token signs: the reservation it prices and the total in cents of Currency, after the
+// discount of PromoCode.
+type quoteClaims struct {
+	VehicleTypeID   int    `json:"vehicle_type_id"`
+	PaymentMethodID int    `json:"payment_method_id"`
+	StartTime       int64  `json:"start"`
+	EndTime         int64  `json:"end"`
+	TotalAmount     int64  `json:"total_cents"`
+	Currency        string `json:"currency"`
+	PromoCode       string `json:"promo_code,omitempty"`
+	PromoDiscount   int64  `json:"promo_discount_cents,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// QuoteReservation itemizes the price of a reservation, with the discount of its promo code, and signs it in
+// a token that books it at that price for the next quoteTTL.
+func (s *ReservationService) QuoteReservation(req entities.QuoteRequest) (*entities.Quote, error) {
+	if req.PaymentMethodID != paymentMethodOnsite && req.PaymentMethodID != paymentMethodOnline {
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "Método de pago no soportado")
+	}
+	if err := checkVehicleType(s.Repo, req.VehicleTypeID); err != nil {
+		return nil, err
+	}
+	if req.EndTime.Sub(req.StartTime) < minReservationDuration {
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "Minimum reservation duration is 1 hour")
+	}
+	breakdown, err := priceReservation(s.pricing, req.VehicleTypeID, req.StartTime, req.EndTime)
+	if err != nil {
+		log.Printf("Error pricing quote for vehicle type %d: %v", req.VehicleTypeID, err)
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "Could not compute the price for the requested reservation")
+	}
+
+	quote := &entities.Quote{
+		VehicleTypeID:   req.VehicleTypeID,
+		PaymentMethodID: req.PaymentMethodID,
+		StartTime:       req.StartTime,
+		EndTime:         req.EndTime,
+		Currency:        money.DefaultCurrency(),
+		TaxRate:         vatRate,
+	}
+	for _, unit := range breakdown.Units {
+		line := entities.QuoteLine{Kind: "unit", Description: unit.Unit, Quantity: unit.Quantity,
+			UnitAmount: unit.UnitPrice, Amount: unit.Amount}
+		quote.SubtotalAmount += line.Amount
+		quote.Lines = append(quote.Lines, line)
+	}
+	for _, adjustment := range breakdown.Adjustments {
+		line := entities.QuoteLine{Kind: "surcharge", Description: adjustment.Rule, Quantity: adjustment.Hours,
+			Amount: adjustment.Amount}
+		if line.Amount < 0 {
+			line.Kind = "discount"
+			quote.DiscountAmount -= line.Amount
+		} else {
+			quote.SurchargeAmount += line.Amount
+		}
+		quote.Lines = append(quote.Lines, line)
+	}
+	totalPrice := breakdown.TotalPrice
+	var promoDiscount money.Amount
+	if req.PromoCode != "" {
+		var promo *db.PromoCode
+		promo, promoDiscount, err = applyPromoCode(s.pricing, req.PromoCode, req.VehicleTypeID, req.StartTime, req.EndTime, req.UserEmail, totalPrice)
+		if err != nil {
+			return nil, err
+		}
+		line := promoQuoteLine(promo, promoDiscount)
+		quote.PromoCode = promo.Code
+		quote.DiscountAmount -= line.Amount
+		quote.Lines = append(quote.Lines, line)
+		totalPrice -= promoDiscount
+	}
+	quote.TotalAmount = totalPrice
+	quote.TaxAmount = totalPrice - totalPrice.Mul(1/(1+vatRate))
+	quote.DepositAmount = upfrontPayment(req.PaymentMethodID, totalPrice)
+	quote.DueOnSiteAmount = quote.TotalAmount - quote.DepositAmount
+
+	quote.ExpiresAt = time.Now().UTC().Add(quoteTTL).Truncate(time.Second)
+	quote.Token, err = signQuote(quote, promoDiscount)
+	if err != nil {
+		log.Printf("Error signing quote: %v", err)
+		return nil, err
+	}
+	return quote, nil
+}
+
+// quotedPrice returns the price signed in the quote token of the request, checking it was issued for this same
+// reservation and promo code and has not expired. The promo code must still be active and valid now, since it may
+// have been disabled or expired since the quote; its redemptions left are checked when the reservation is stored.
+func quotedPrice(repo repository.PromoCodeRepository, req *entities.ReservationRequest) (*reservationPrice, error) {
+	secret, err := quoteSecret()
+	if err != nil {
+		return nil, err
+	}
+	var claims quoteClaims
+	_, err = jwt.ParseWithClaims(req.QuoteToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(quoteAudience), jwt.WithExpirationRequired())
+	if err != nil {
+		log.Printf("Rejected quote token from %s: %v", req.UserEmail, err)
+		if stdErrors.Is(err, jwt.ErrTokenExpired) {
+			return nil, errors.NewHTTPError(http.StatusConflict, "The quote has expired, request a new one")
+		}
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "Invalid quote_token")
+	}
+	if claims.VehicleTypeID != req.VehicleTypeID || claims.PaymentMethodID != req.PaymentMethodID ||
+		claims.StartTime != req.StartTime.Unix() || claims.EndTime != req.EndTime.Unix() || claims.Currency != money.DefaultCurrency() ||
+		claims.PromoCode != normalizePromoCode(req.PromoCode) {
+		log.Printf("SUSPICIOUS: reservation request from %s does not match its quote token", req.UserEmail)
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "The reservation does not match the quote")
+	}
+
+	price := &reservationPrice{total: money.Amount(claims.TotalAmount)}
+	if claims.PromoCode != "" {
+		price.promo, err = repo.GetPromoCodeByCode(claims.PromoCode)
+		if err != nil {
+			log.Printf("Error getting promo code %s of a quote: %v", claims.PromoCode, err)
+			if stdErrors.Is(err, sql.ErrNoRows) {
+				return nil, errors.NewHTTPError(http.StatusBadRequest, "Invalid promo code")
+			}
+			return nil, err
+		}
+		if err := checkPromoCode(price.promo, req.VehicleTypeID, req.StartTime, req.EndTime); err != nil {
+			log.Printf("Rejected quote of %s with promo code %s: %v", req.UserEmail, claims.PromoCode, err)
+			return nil, err
+		}
+		price.discount = money.Amount(claims.PromoDiscount)
+	}
+	return price, nil
+}
+
+func signQuote(quote *entities.Quote, promoDiscount money.Amount) (string, error) {
+	secret, err := quoteSecret()
+	if err != nil {
+		return "", err
+	}
+	claims := quoteClaims{
+		VehicleTypeID:   quote.VehicleTypeID,
+		PaymentMethodID: quote.PaymentMethodID,
+		StartTime:       quote.StartTime.Unix(),
+		EndTime:         quote.EndTime.Unix(),
+		TotalAmount:     quote.TotalAmount.Cents(),
+		Currency:        quote.Currency,
+		PromoCode:       quote.PromoCode,
+		PromoDiscount:   promoDiscount.Cents(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "quote",
+			Audience:  jwt.ClaimStrings{quoteAudience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(quote.ExpiresAt),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+}
+
+// CheckQuoteSecret reports whether QUOTE_SECRET can sign quote tokens, so the server refuses to start without it.
+func CheckQuoteSecret() error {
+	_, err := quoteSecret()
+	return err
+}
+
+// quoteSecret signs quote tokens with QUOTE_SECRET. It must differ from the secrets of admin and customer tokens, so
+// none of them can be replayed as another.
+func quoteSecret() ([]byte, error) {
+	secret := os.Getenv("QUOTE_SECRET")
+	if secret == "" {
+		return nil, fmt.Errorf("QUOTE_SECRET not set")
+	}
+	if secret == os.Getenv("JWT_SECRET") || secret == os.Getenv("CUSTOMER_JWT_SECRET") {
+		return nil, fmt.Errorf("QUOTE_SECRET must differ from JWT_SECRET and CUSTOMER_JWT_SECRET")
+	}
+	return []byte(secret), nil
+}
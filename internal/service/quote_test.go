@@ -0,0 +1,142 @@
+package service
+
+import (
+	"encoding/json"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/repository/memory"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func quoteReservationRequest(quote *entities.Quote) *entities.ReservationRequest {
+	return &entities.ReservationRequest{
+		VehicleTypeID:   quote.VehicleTypeID,
+		UserName:        "Mario Rossi",
+		UserEmail:       "mario@example.com",
+		PaymentMethodID: quote.PaymentMethodID,
+		StartTime:       quote.StartTime,
+		EndTime:         quote.EndTime,
+		Language:        "en",
+		QuoteToken:      quote.Token,
+	}
+}
+
+func TestQuoteReservationIsItemizedToTheCent(t *testing.T) {
+	t.Setenv("QUOTE_SECRET", "quote-secret")
+	store := memory.NewSeededStore()
+	store.SetPrice(carTypeID, 1, 425)
+	svc := newTestReservationService(store)
+	start := futureHour(72)
+
+	quote, err := svc.QuoteReservation(entities.QuoteRequest{VehicleTypeID: carTypeID, PaymentMethodID: paymentMethodOnsite,
+		StartTime: start, EndTime: start.Add(26 * time.Hour)})
+	if err != nil {
+		t.Fatalf("QuoteReservation: %v", err)
+	}
+	// One day at 10 EUR and two hours at 4.25, no longer truncated to 18.5.
+	if len(quote.Lines) != 2 || quote.Lines[1].UnitAmount != 425 || quote.Lines[1].Amount != 850 ||
+		quote.SubtotalAmount != 1850 || quote.TotalAmount != 1850 {
+		t.Fatalf("unexpected lines: %+v", quote)
+	}
+	if quote.DepositAmount != 555 || quote.DueOnSiteAmount != 1295 || quote.TaxAmount != 334 || quote.Token == "" {
+		t.Fatalf("unexpected deposit, tax or token: %+v", quote)
+	}
+	// Quotes are sent in decimal units like every other amount of the API.
+	body, err := json.Marshal(quote)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	for _, field := range []string{`"unit_amount":4.25`, `"total_amount":18.5`, `"deposit_amount":5.55`, `"tax_amount":3.34`} {
+		if !strings.Contains(string(body), field) {
+			t.Errorf("expected %s in %s", field, body)
+		}
+	}
+}
+
+func TestCreateReservationWithQuoteKeepsQuotedPrice(t *testing.T) {
+	t.Setenv("QUOTE_SECRET", "quote-secret")
+	store := memory.NewSeededStore()
+	svc := newTestReservationService(store)
+	start := futureHour(72)
+
+	quote, err := svc.QuoteReservation(entities.QuoteRequest{VehicleTypeID: carTypeID, PaymentMethodID: paymentMethodOnline,
+		StartTime: start, EndTime: start.Add(3 * time.Hour)})
+	if err != nil {
+		t.Fatalf("QuoteReservation: %v", err)
+	}
+	// Prices go up after the quote; the customer still pays what they were shown.
+	if err := newTestAdminService(store).CreatePricingRule(&db.PricingRule{Name: "Event", Multiplier: floatPtr(2)}); err != nil {
+		t.Fatalf("CreatePricingRule: %v", err)
+	}
+	created, err := svc.CreateReservation(quoteReservationRequest(quote))
+	if err != nil {
+		t.Fatalf("CreateReservation: %v", err)
+	}
+	if got := store.Reservation(created.Code); got.TotalPrice != 1200 || got.DepositPayment != 1200 {
+		t.Fatalf("expected the quoted 12 EUR, got %+v", got)
+	}
+}
+
+func TestCreateReservationRejectsBadQuote(t *testing.T) {
+	t.Setenv("QUOTE_SECRET", "quote-secret")
+	svc := newTestReservationService(memory.NewSeededStore())
+	start := futureHour(72)
+	quote, err := svc.QuoteReservation(entities.QuoteRequest{VehicleTypeID: carTypeID, PaymentMethodID: paymentMethodOnline,
+		StartTime: start, EndTime: start.Add(3 * time.Hour)})
+	if err != nil {
+		t.Fatalf("QuoteReservation: %v", err)
+	}
+
+	longer := quoteReservationRequest(quote)
+	longer.EndTime = longer.EndTime.Add(24 * time.Hour)
+	tampered := quoteReservationRequest(quote)
+	tampered.QuoteToken += "x"
+	expiredQuote := *quote
+	expiredQuote.ExpiresAt = time.Now().Add(-time.Minute)
+	expiredQuote.Token, _ = signQuote(&expiredQuote, 0)
+	// A token with the same claims and key but for another audience, e.g. a customer token, is not a quote.
+	otherAudience := quoteReservationRequest(quote)
+	otherAudience.QuoteToken, _ = jwt.NewWithClaims(jwt.SigningMethodHS256, quoteClaims{
+		VehicleTypeID: quote.VehicleTypeID, PaymentMethodID: quote.PaymentMethodID, StartTime: quote.StartTime.Unix(),
+		EndTime: quote.EndTime.Unix(), TotalAmount: 1, Currency: quote.Currency,
+		RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"customer"}, ExpiresAt: jwt.NewNumericDate(quote.ExpiresAt)},
+	}).SignedString([]byte("quote-secret"))
+
+	for name, tt := range map[string]struct {
+		req  *entities.ReservationRequest
+		code int
+	}{
+		"other window":   {longer, http.StatusBadRequest},
+		"tampered":       {tampered, http.StatusBadRequest},
+		"expired":        {quoteReservationRequest(&expiredQuote), http.StatusConflict},
+		"other audience": {otherAudience, http.StatusBadRequest},
+	} {
+		_, err := svc.CreateReservation(tt.req)
+		if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != tt.code {
+			t.Errorf("%s: expected %d, got %v", name, tt.code, err)
+		}
+	}
+}
+
+func TestQuoteSecretMustBeItsOwn(t *testing.T) {
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	t.Setenv("CUSTOMER_JWT_SECRET", "")
+	t.Setenv("QUOTE_SECRET", "")
+	if err := CheckQuoteSecret(); err == nil {
+		t.Fatal("expected QUOTE_SECRET to be required, without falling back to JWT_SECRET")
+	}
+	t.Setenv("QUOTE_SECRET", "jwt-secret")
+	if err := CheckQuoteSecret(); err == nil {
+		t.Fatal("expected QUOTE_SECRET to be rejected when it is JWT_SECRET")
+	}
+	t.Setenv("QUOTE_SECRET", "quote-secret")
+	if err := CheckQuoteSecret(); err != nil {
+		t.Fatalf("CheckQuoteSecret: %v", err)
+	}
+}
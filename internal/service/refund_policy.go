@@ -0,0 +1,77 @@
+package service
+
+import (
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/repository"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+)
+
+// refundPercent returns the percent of the tier with the longest notice that hoursBefore still meets, or 0 when
+// none does. tiers must be ordered by MinHoursBefore, longest first.
+func refundPercent(tiers []db.RefundTier, hoursBefore float64) int {
+	for _, tier := range tiers {
+		if hoursBefore >= float64(tier.MinHoursBefore) {
+			return tier.RefundPercent
+		}
+	}
+	return 0
+}
+
+// quoteCancellation computes the refund for canceling the reservation at now, or an HTTPError if it can't be
+// canceled anymore. The refund percent applies to what the payments ledger says was paid through Stripe and not
+// refunded yet, including what modifications and extensions added.
+func quoteCancellation(repo repository.RefundPolicyRepository, payments *PaymentService, reservation *db.Reservation, now time.Time) (*entities.RefundQuote, error) {
+	if reservation.Status != statusActive && reservation.Status != statusPending {
+		return nil, errors.NewHTTPError(http.StatusConflict, fmt.Sprintf("Reservation is %s and can't be cancelled", reservation.Status))
+	}
+	hoursBefore := reservation.StartTime.Sub(now).Hours()
+	if hoursBefore <= 0 {
+		return nil, errors.NewHTTPError(http.StatusConflict, "Reservations can't be cancelled once they have started")
+	}
+
+	tiers, err := repo.GetRefundPolicy(reservation.PaymentMethodID)
+	if err != nil {
+		log.Printf("Error getting refund policy for payment method %d: %v", reservation.PaymentMethodID, err)
+		return nil, err
+	}
+	paid, refunded, err := payments.stripePaid(reservation)
+	if err != nil {
+		return nil, err
+	}
+	percent := refundPercent(tiers, hoursBefore)
+	refund := max(paid-refunded, 0).Percent(percent)
+
+	return &entities.RefundQuote{
+		Code:             reservation.Code,
+		PaymentMethodID:  reservation.PaymentMethodID,
+		HoursBeforeStart: math.Round(hoursBefore*10) / 10,
+		AmountPaid:       paid,
+		AlreadyRefunded:  refunded,
+		RefundPercent:    percent,
+		RefundAmount:     refund,
+	}, nil
+}
+
+// validateRefundTiers checks a refund policy before it replaces the current one.
+func validateRefundTiers(tiers []db.RefundTier) error {
+	seen := map[int]bool{}
+	for _, tier := range tiers {
+		if tier.MinHoursBefore < 0 {
+			return errors.NewHTTPError(http.StatusBadRequest, "min_hours_before can't be negative")
+		}
+		if tier.RefundPercent < 0 || tier.RefundPercent > 100 {
+			return errors.NewHTTPError(http.StatusBadRequest, "refund_percent must be between 0 and 100")
+		}
+		if seen[tier.MinHoursBefore] {
+			return errors.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Duplicated tier for %d hours", tier.MinHoursBefore))
+		}
+		seen[tier.MinHoursBefore] = true
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/money"
+	"estacionamienti/internal/repository/memory"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v82"
+)
+
+// insertPaidReservation stores a reservation paid through gateway with the given amount upfront, and its payment.
+func insertPaidReservation(t *testing.T, store *memory.Store, gateway *FakePaymentGateway, code string, paymentMethodID int, paid money.Amount, hoursBefore int) {
+	t.Helper()
+	checkout, err := gateway.CreateCheckoutSession(CheckoutRequest{Price: money.New(paid, "eur")})
+	if err != nil {
+		t.Fatalf("CreateCheckoutSession: %v", err)
+	}
+	if _, err := gateway.CompleteCheckout(checkout.ID); err != nil {
+		t.Fatalf("CompleteCheckout: %v", err)
+	}
+	sess, _ := gateway.Session(checkout.ID)
+
+	res := newReservation(code, carTypeID, statusActive, futureHour(hoursBefore), futureHour(hoursBefore+3))
+	res.PaymentMethodID = paymentMethodID
+	res.StripeSessionID = sql.NullString{String: checkout.ID, Valid: true}
+	res.StripePaymentIntentID = sql.NullString{String: sess.PaymentIntentID, Valid: true}
+	res.PaymentStatus = sql.NullString{String: paymentSucceeded, Valid: true}
+	res.DepositPayment = paid
+	store.InsertReservation(res)
+	// The checkout webhook records the payment in the ledger.
+	if _, err := store.RecordPayment(&db.Payment{ReservationID: store.Reservation(code).ID, ReservationCode: code, Kind: paymentKindCharge,
+		Amount: paid, Method: paymentMethodStripe, ExternalID: res.StripePaymentIntentID}); err != nil {
+		t.Fatalf("RecordPayment: %v", err)
+	}
+}
+
+func TestCancelReservationRefundTiers(t *testing.T) {
+	cases := []struct {
+		name            string
+		paymentMethodID int
+		paid            money.Amount
+		hoursBefore     int
+		percent         int
+		refund          money.Amount
+	}{
+		{"online, more than 48h", paymentMethodOnline, 4000, 72, 100, 4000},
+		{"online, between 12h and 48h", paymentMethodOnline, 4000, 24, 70, 2800},
+		{"online, under 12h", paymentMethodOnline, 4000, 6, 0, 0},
+		{"onsite deposit, between 12h and 48h", paymentMethodOnsite, 365, 24, 50, 183},
+		{"onsite deposit, under 12h", paymentMethodOnsite, 365, 2, 0, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := memory.NewSeededStore()
+			gateway := NewFakePaymentGateway("whsec_test", "http://localhost/dev/checkout")
+			svc := NewReservationService(store, store, store, store, NewStripeService(store, gateway, NewPaymentService(store, store)), newTestSenderService())
+			insertPaidReservation(t, store, gateway, "REFUND01", tc.paymentMethodID, tc.paid, tc.hoursBefore)
+
+			quote, err := svc.QuoteCancellation("REFUND01", "mario@example.com")
+			if err != nil {
+				t.Fatalf("QuoteCancellation: %v", err)
+			}
+			if quote.RefundPercent != tc.percent || quote.RefundAmount != tc.refund || quote.Canceled {
+				t.Fatalf("expected a quote of %d%% = %s, got %+v", tc.percent, tc.refund, quote)
+			}
+			if got := store.Reservation("REFUND01").Status; got != statusActive {
+				t.Fatalf("quoting must not cancel, got %q", got)
+			}
+
+			canceled, err := svc.CancelReservation("REFUND01", "mario@example.com")
+			if err != nil {
+				t.Fatalf("CancelReservation: %v", err)
+			}
+			if !canceled.Canceled || canceled.RefundAmount != tc.refund {
+				t.Fatalf("expected the quoted refund after canceling, got %+v", canceled)
+			}
+			got := store.Reservation("REFUND01")
+			if got.Status != statusCancel || got.RefundedAmount != tc.refund {
+				t.Fatalf("expected canceled with %s refunded, got %s with %s", tc.refund, got.Status, got.RefundedAmount)
+			}
+			refunds := gateway.Refunds()
+			if tc.refund == 0 {
+				if len(refunds) != 0 {
+					t.Fatalf("expected no refund, got %+v", refunds)
+				}
+				return
+			}
+			if len(refunds) != 1 || refunds[0].Amount != tc.refund.Cents() {
+				t.Fatalf("expected one refund of %s, got %+v", tc.refund, refunds)
+			}
+		})
+	}
+}
+
+func TestRefundPolicyIsConfigurable(t *testing.T) {
+	store := memory.NewSeededStore()
+	gateway := NewFakePaymentGateway("whsec_test", "http://localhost/dev/checkout")
+	svc := NewReservationService(store, store, store, store, NewStripeService(store, gateway, NewPaymentService(store, store)), newTestSenderService())
+	admin := newTestAdminService(store)
+	insertPaidReservation(t, store, gateway, "REFUND02", paymentMethodOnline, 2000, 24)
+
+	err := admin.UpdateRefundPolicy(paymentMethodOnline, []db.RefundTier{{MinHoursBefore: 0, RefundPercent: 100}, {MinHoursBefore: 0, RefundPercent: 50}})
+	if err == nil {
+		t.Fatal("expected duplicated tiers to be rejected")
+	}
+	if err := admin.UpdateRefundPolicy(paymentMethodOnline, []db.RefundTier{{MinHoursBefore: 6, RefundPercent: 90}, {MinHoursBefore: 72, RefundPercent: 100}}); err != nil {
+		t.Fatalf("UpdateRefundPolicy: %v", err)
+	}
+
+	quote, err := svc.QuoteCancellation("REFUND02", "mario@example.com")
+	if err != nil {
+		t.Fatalf("QuoteCancellation: %v", err)
+	}
+	if quote.RefundPercent != 90 || quote.RefundAmount != 1800 {
+		t.Fatalf("expected the 6h tier to refund 90%%, got %+v", quote)
+	}
+}
+
+func TestRefundPercentWithoutMatchingTier(t *testing.T) {
+	tiers := []db.RefundTier{{MinHoursBefore: 48, RefundPercent: 100}, {MinHoursBefore: 12, RefundPercent: 50}}
+	if got := refundPercent(tiers, 11.5); got != 0 {
+		t.Fatalf("expected nothing below the shortest tier, got %d%%", got)
+	}
+	if got := refundPercent(tiers, 48); got != 100 {
+		t.Fatalf("expected the 48h tier to include its boundary, got %d%%", got)
+	}
+}
+
+func TestCancellationQuoteFollowsThePaymentsLedger(t *testing.T) {
+	env := newChangeEnv()
+	insertPaidReservation(t, env.store, env.gateway, "REFUND06", paymentMethodOnline, 1200, 24)
+	res := env.store.Reservation("REFUND06")
+
+	// 2 more hours paid in their own checkout, then 5 EUR refunded from the Stripe dashboard.
+	newEnd := res.EndTime.Add(2 * time.Hour)
+	change, err := env.svc.ModifyReservation("REFUND06", res.UserEmail, entities.ReservationChangeRequest{EndTime: &newEnd})
+	if err != nil {
+		t.Fatalf("ModifyReservation: %v", err)
+	}
+	env.pay(t, change.SessionID)
+	if _, err := env.gateway.Refund(RefundRequest{PaymentIntentID: res.StripePaymentIntentID.String, Amount: 500}); err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	if err := env.svc.stripeService.RecordRefunds(res, res.StripePaymentIntentID.String); err != nil {
+		t.Fatalf("RecordRefunds: %v", err)
+	}
+
+	quote, err := env.svc.QuoteCancellation("REFUND06", res.UserEmail)
+	if err != nil {
+		t.Fatalf("QuoteCancellation: %v", err)
+	}
+	if quote.AmountPaid != 2000 || quote.AlreadyRefunded != 500 || quote.RefundPercent != 70 || quote.RefundAmount != 1050 {
+		t.Fatalf("expected 70%% of the 15 EUR still paid refunded, got %+v", quote)
+	}
+	if _, err := env.svc.CancelReservation("REFUND06", res.UserEmail); err != nil {
+		t.Fatalf("CancelReservation: %v", err)
+	}
+	if refunded := refundedCents(env.gateway); refunded != 1550 {
+		t.Fatalf("expected 1550 cents refunded in all, got %d", refunded)
+	}
+}
+
+func TestCancelReservationTwiceRefundsOnce(t *testing.T) {
+	env := newChangeEnv()
+	insertPaidReservation(t, env.store, env.gateway, "REFUND03", paymentMethodOnline, 4000, 24)
+
+	if _, err := env.svc.CancelReservation("REFUND03", "mario@example.com"); err != nil {
+		t.Fatalf("CancelReservation: %v", err)
+	}
+	_, err := env.svc.CancelReservation("REFUND03", "mario@example.com")
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 canceling again, got %v", err)
+	}
+	// The claim also stops a retry that skips the status check of the quote.
+	if _, err := cancelReservation(env.store, env.svc.stripeService, env.store.Reservation("REFUND03"), 2800, "cancellation", nil); err == nil {
+		t.Fatal("expected a canceled reservation not to be claimed again")
+	}
+	if refunds := env.gateway.Refunds(); len(refunds) != 1 || refunds[0].Amount != 2800 {
+		t.Fatalf("expected a single refund of 2800 cents, got %+v", refunds)
+	}
+	if got := env.store.Reservation("REFUND03"); got.Status != statusCancel || got.RefundedAmount != 2800 {
+		t.Fatalf("expected canceled with 2800 refunded, got %s with %s", got.Status, got.RefundedAmount)
+	}
+}
+
+func TestConcurrentCancellationsRefundOnce(t *testing.T) {
+	env := newChangeEnv()
+	insertPaidReservation(t, env.store, env.gateway, "REFUND04", paymentMethodOnline, 4000, 72)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	canceled, conflicts := 0, 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := env.svc.CancelReservation("REFUND04", "mario@example.com")
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				canceled++
+			} else if herr, ok := err.(*errors.HTTPError); ok && herr.Code == http.StatusConflict {
+				conflicts++
+			} else {
+				t.Errorf("CancelReservation: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if canceled != 1 || conflicts != 7 {
+		t.Fatalf("expected one cancellation and 7 conflicts, got %d and %d", canceled, conflicts)
+	}
+	if refunds := env.gateway.Refunds(); len(refunds) != 1 || refunds[0].Amount != 4000 {
+		t.Fatalf("expected a single refund of 4000 cents, got %+v", refunds)
+	}
+	if got := env.store.Reservation("REFUND04").RefundedAmount; got != 4000 {
+		t.Fatalf("expected 4000 refunded, got %s", got)
+	}
+}
+
+func TestRefundWebhookSettlesInterruptedCancellation(t *testing.T) {
+	env := newChangeEnv()
+	insertPaidReservation(t, env.store, env.gateway, "REFUND05", paymentMethodOnline, 4000, 24)
+	res := env.store.Reservation("REFUND05")
+
+	// A cancellation that refunded and then failed to store the cancellation.
+	if _, err := env.store.ClaimCancellation("REFUND05", 2800); err != nil {
+		t.Fatalf("ClaimCancellation: %v", err)
+	}
+	if _, err := env.svc.stripeService.RefundReservation(res, 2800, "cancellation", "cancel-REFUND05"); err != nil {
+		t.Fatalf("RefundReservation: %v", err)
+	}
+
+	// Retrying is rejected while the claim is held, and the same keyed refund is not issued again.
+	_, err := env.svc.CancelReservation("REFUND05", "mario@example.com")
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 while the cancellation is in progress, got %v", err)
+	}
+	if _, err := env.gateway.Refund(RefundRequest{PaymentIntentID: res.StripePaymentIntentID.String, Amount: 2800,
+		IdempotencyKey: "cancel-REFUND05-" + res.StripePaymentIntentID.String}); err != nil {
+		t.Fatalf("repeating the keyed refund: %v", err)
+	}
+	if refunds := env.gateway.Refunds(); len(refunds) != 1 {
+		t.Fatalf("expected a single refund, got %+v", refunds)
+	}
+
+	hook, err := env.gateway.RefundedWebhook(res.StripePaymentIntentID.String)
+	if err != nil {
+		t.Fatalf("RefundedWebhook: %v", err)
+	}
+	var event stripe.Event
+	if err := json.Unmarshal(hook.Payload, &event); err != nil {
+		t.Fatalf("parsing webhook: %v", err)
+	}
+	if err := env.events.HandleEvent(event, hook.Payload); err != nil {
+		t.Fatalf("HandleEvent: %v", err)
+	}
+	if got := env.store.Reservation("REFUND05"); got.Status != statusCancel || got.RefundedAmount != 2800 {
+		t.Fatalf("expected the webhook to settle the cancellation with 2800 refunded, got %s with %s", got.Status, got.RefundedAmount)
+	}
+}
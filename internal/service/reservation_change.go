@@ -0,0 +1,314 @@
+package service
+
+import (
+	"database/sql"
+	stdErrors "errors"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/money"
+	"estacionamienti/internal/repository"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	changeAwaitingPayment = "awaiting_payment"
+	changeApplied         = "applied"
+	changeExpired         = "expired"
+	changeRejected        = "rejected"
+	// changeRefundPending is held by an applied change until the refund it owes the customer is issued.
+	changeRefundPending = "refund_pending"
+
+	// statusModified is only used in notifications, telling the customer their reservation has new details.
+	statusModified = "modified"
+
+	minReservationDuration = time.Hour
+)
+
+// ModifyReservation moves a customer's reservation to a new window or vehicle before it starts. When the change costs
+// more than what was paid online, it only applies once the difference is paid in the returned checkout.
+func (s *ReservationService) ModifyReservation(code, email string, req entities.ReservationChangeRequest) (*entities.ReservationChangeResponse, error) {
+	reservation, err := customerReservation(s.Repo, code, email)
+	if err != nil {
+		return nil, err
+	}
+	if !reservation.StartTime.After(time.Now().UTC()) {
+		return nil, errors.NewHTTPError(http.StatusConflict, "Reservations can't be modified once they have started")
+	}
+	return modifyReservation(s.Repo, s.pricing, s.refundPolicy, s.stripeService, s.senderService, reservation, req, "customer", false)
+}
+
+// modifyReservation prices the requested change against the reservation and settles the difference with what the
+// payments ledger says was paid online: cheaper changes apply right away and refund the difference, dearer ones wait
+// for a checkout of the difference. Customers get back the share of the difference the refund policy would give back
+// if they canceled now; admins override it and refund all of it. Admin changes never open a checkout, and reservations
+// with nothing paid online are not settled at all: what they add is left as balance due.
+func modifyReservation(repo repository.ReservationRepository, pricing pricingRepos, refundPolicy repository.RefundPolicyRepository,
+	stripeService *StripeService, senderService *SenderService, reservation *db.Reservation, req entities.ReservationChangeRequest,
+	requestedBy string, byAdmin bool) (*entities.ReservationChangeResponse, error) {
+	if reservation.Status != statusActive && reservation.Status != statusCheckedIn && reservation.Status != statusOverstay {
+		return nil, errors.NewHTTPError(http.StatusConflict, fmt.Sprintf("Reservation is %s and can't be modified", reservation.Status))
+	}
+	if reservation.WalkIn && reservation.EndTime.IsZero() {
+		return nil, errors.NewHTTPError(http.StatusConflict, "Walk-in sessions are priced at check-out and can't be modified")
+	}
+	now := time.Now().UTC()
+	change, err := newReservationChange(repo, pricing, reservation, req, now)
+	if err != nil {
+		return nil, err
+	}
+	change.RequestedBy = requestedBy
+	response := changeResponse(change)
+
+	paid, refunded, err := stripeService.payments.stripePaid(reservation)
+	if err != nil {
+		return nil, err
+	}
+	netPaid, err := stripeService.payments.netPaid(reservation)
+	if err != nil {
+		return nil, err
+	}
+	newUpfront := upfrontPayment(reservation.PaymentMethodID, change.NewTotalPrice)
+	var difference money.Amount
+	if paid > 0 {
+		difference = newUpfront - (paid - refunded)
+		change.NewDepositPayment = newUpfront
+	}
+
+	if difference > 0 && !byAdmin {
+		holdSince := now.Add(-pendingHoldWindow)
+		slots, err := repo.GetHourlyAvailabilityDetails(change.StartTime, change.EndTime, change.VehicleTypeID, holdSince, reservation.ID)
+		if err != nil {
+			log.Printf("Error checking availability for change of reservation %s: %v", reservation.Code, err)
+			return nil, err
+		}
+		if conflicts := fullSlots(slots); len(conflicts) > 0 {
+			return nil, errNoAvailability(conflicts)
+		}
+
+		url, sessionID, err := stripeService.CreateChangeCheckoutSession(money.Of(difference), reservation.UserEmail, reservation.Language,
+			reservation.Code, now.Add(checkoutSessionTTL))
+		if err != nil {
+			log.Printf("Error creating Stripe checkout session for change of reservation %s: %v", reservation.Code, err)
+			return nil, err
+		}
+		change.AmountDue = difference
+		change.Status = changeAwaitingPayment
+		change.StripeSessionID = sql.NullString{String: sessionID, Valid: true}
+		if err := repo.CreateReservationChange(change); err != nil {
+			log.Printf("Error storing change of reservation %s: %v", reservation.Code, err)
+			return nil, err
+		}
+		response.Status = change.Status
+		response.AmountDue = change.AmountDue
+		response.BalanceDue = max(change.NewTotalPrice-netPaid-difference, 0)
+		response.URL = url
+		response.SessionID = sessionID
+		return response, nil
+	}
+
+	if difference < 0 {
+		refund := -difference
+		if !byAdmin {
+			tiers, err := refundPolicy.GetRefundPolicy(reservation.PaymentMethodID)
+			if err != nil {
+				log.Printf("Error getting refund policy for payment method %d: %v", reservation.PaymentMethodID, err)
+				return nil, err
+			}
+			refund = refund.Percent(refundPercent(tiers, reservation.StartTime.Sub(now).Hours()))
+		}
+		change.AmountDue = -refund
+	}
+	// A change that owes a refund is stored as refund_pending until the refund is issued, so it can be retried.
+	conflicts, err := applyReservationChange(repo, senderService, reservation, change)
+	if err != nil {
+		log.Printf("Error applying change of reservation %s: %v", reservation.Code, err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NewHTTPError(http.StatusConflict, "Reservation is no longer active")
+		}
+		return nil, err
+	}
+	if len(conflicts) > 0 {
+		return nil, errNoAvailability(conflicts)
+	}
+	response.Status = change.Status
+	response.BalanceDue = max(change.NewTotalPrice-netPaid-change.AmountDue, 0)
+
+	if change.Status == changeRefundPending {
+		refunded, err := refundChange(repo, stripeService, reservation, change)
+		response.RefundAmount = refunded
+		if err != nil {
+			log.Printf("ALERTA: reserva %s modificada pero falló el reembolso de %s, se reintentará: %v", reservation.Code,
+				formatMoney(-change.AmountDue-refunded), err)
+			alert := senderService.AdminAlert(reservation, "Reembolso fallido",
+				fmt.Sprintf("La reserva se modificó y bajó de precio, pero no se pudo reembolsar %s: %v. El reembolso se reintentará automáticamente.",
+					formatMoney(-change.AmountDue-refunded), err))
+			if updateErr := repo.UpdatePaymentStatus(reservation.ID, paymentRefundFailed, alert); updateErr != nil {
+				log.Printf("Error flagging failed refund of reservation %s: %v", reservation.Code, updateErr)
+			}
+			return response, nil
+		}
+		response.Status = changeApplied
+	}
+	return response, nil
+}
+
+// refundChange issues what is left to refund of a change stored as refund_pending and marks it applied. The refunds
+// are keyed by the change and noted with it in the ledger, so a retry only refunds what the previous attempts didn't.
+func refundChange(repo repository.ReservationRepository, stripeService *StripeService, reservation *db.Reservation, change *db.ReservationChange) (money.Amount, error) {
+	note := fmt.Sprintf("modification %d", change.ID)
+	done, err := stripeService.payments.refundedWithNote(reservation, note)
+	if err != nil {
+		return 0, err
+	}
+	var refunded money.Amount
+	if left := -change.AmountDue - done; left > 0 {
+		refunded, err = stripeService.RefundReservation(reservation, left, note, fmt.Sprintf("change-%d", change.ID))
+		if err != nil {
+			return refunded, err
+		}
+	}
+	if err := repo.UpdateReservationChangeStatus(change.ID, changeApplied); err != nil {
+		log.Printf("Error marking the refund of change %d of reservation %s as issued: %v", change.ID, reservation.Code, err)
+		return refunded, err
+	}
+	change.Status = changeApplied
+	return refunded, nil
+}
+
+// RetryChangeRefunds issues the refunds of applied changes that could not be refunded when they were made, and
+// returns how many were refunded.
+func (s *ReservationService) RetryChangeRefunds() (int, error) {
+	changes, err := s.Repo.ListReservationChangesByStatus(changeRefundPending)
+	if err != nil {
+		return 0, fmt.Errorf("error listing changes with a pending refund: %w", err)
+	}
+	refunded := 0
+	for i := range changes {
+		change := &changes[i]
+		reservation, err := s.Repo.GetReservationByCodeOnly(change.ReservationCode)
+		if err != nil {
+			log.Printf("Error getting reservation %s to refund its change %d: %v", change.ReservationCode, change.ID, err)
+			continue
+		}
+		if _, err := refundChange(s.Repo, s.stripeService, reservation, change); err != nil {
+			log.Printf("ALERTA: sigue fallando el reembolso de %s por la modificación %d de la reserva %s: %v",
+				formatMoney(-change.AmountDue), change.ID, reservation.Code, err)
+			continue
+		}
+		refunded++
+	}
+	return refunded, nil
+}
+
+// newReservationChange builds the change the request asks for, with the price of the new window and vehicle.
+func newReservationChange(repo repository.ReservationRepository, pricing pricingRepos, reservation *db.Reservation, req entities.ReservationChangeRequest,
+	now time.Time) (*db.ReservationChange, error) {
+	change := &db.ReservationChange{
+		ReservationID:     reservation.ID,
+		ReservationCode:   reservation.Code,
+		StartTime:         reservation.StartTime,
+		EndTime:           reservation.EndTime,
+		VehicleTypeID:     reservation.VehicleTypeID,
+		VehiclePlate:      reservation.VehiclePlate,
+		VehicleModel:      reservation.VehicleModel,
+		OldTotalPrice:     reservation.TotalPrice,
+		NewDepositPayment: reservation.DepositPayment,
+		NewDiscount:       reservation.DiscountAmount,
+	}
+	if req.StartTime != nil {
+		change.StartTime = req.StartTime.UTC()
+	}
+	if req.EndTime != nil {
+		change.EndTime = req.EndTime.UTC()
+	}
+	if req.VehicleTypeID != nil {
+		change.VehicleTypeID = *req.VehicleTypeID
+	}
+	if req.VehiclePlate != nil {
+		plate := strings.TrimSpace(*req.VehiclePlate)
+		change.VehiclePlate = sql.NullString{String: plate, Valid: plate != ""}
+	}
+	if req.VehicleModel != nil {
+		model := strings.TrimSpace(*req.VehicleModel)
+		change.VehicleModel = sql.NullString{String: model, Valid: model != ""}
+	}
+
+	if change.StartTime.Equal(reservation.StartTime) && change.EndTime.Equal(reservation.EndTime) &&
+		change.VehicleTypeID == reservation.VehicleTypeID && change.VehiclePlate.String == reservation.VehiclePlate.String &&
+		change.VehicleModel.String == reservation.VehicleModel.String {
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "Nothing to change")
+	}
+	// A reservation that has started keeps its start and can't end before the time already used; one that hasn't
+	// can't be moved into the past.
+	if reservation.StartTime.After(now) {
+		if change.StartTime.Before(now) {
+			return nil, errors.NewHTTPError(http.StatusBadRequest, "start_time must be in the future")
+		}
+	} else {
+		if !change.StartTime.Equal(reservation.StartTime) {
+			return nil, errors.NewHTTPError(http.StatusConflict, "The start of a reservation can't be moved once it has started")
+		}
+		if change.EndTime.Before(now) {
+			return nil, errors.NewHTTPError(http.StatusConflict, "A started reservation can't end before now")
+		}
+	}
+	if change.EndTime.Sub(change.StartTime) < minReservationDuration {
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "Minimum reservation duration is 1 hour")
+	}
+	if change.VehicleTypeID != reservation.VehicleTypeID {
+		if err := checkVehicleType(repo, change.VehicleTypeID); err != nil {
+			return nil, err
+		}
+	}
+
+	totalPrice, err := totalPriceForReservation(pricing, change.VehicleTypeID, change.StartTime, change.EndTime)
+	if err != nil {
+		log.Printf("Error computing price for change of reservation %s: %v", reservation.Code, err)
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "Could not compute the price for the requested change")
+	}
+	change.NewTotalPrice = totalPrice
+	if err := rediscountedChange(pricing, reservation, change); err != nil {
+		log.Printf("Error applying the promo code of reservation %s to its change: %v", reservation.Code, err)
+		return nil, err
+	}
+	return change, nil
+}
+
+// applyReservationChange moves the reservation to the change and queues the customer notification with its new
+// details. It returns the full slots when the new window has no room.
+func applyReservationChange(repo repository.ReservationRepository, senderService *SenderService, reservation *db.Reservation, change *db.ReservationChange) ([]repository.SlotOccupationInfo, error) {
+	modified := *reservation
+	modified.StartTime, modified.EndTime = change.StartTime, change.EndTime
+	modified.VehicleTypeID = change.VehicleTypeID
+	modified.VehiclePlate, modified.VehicleModel = change.VehiclePlate, change.VehicleModel
+	notifications := senderService.ReservationNotifications(&modified, statusModified)
+	return repo.ApplyReservationChange(change, time.Now().UTC().Add(-pendingHoldWindow), notifications)
+}
+
+func fullSlots(slots []repository.SlotOccupationInfo) []repository.SlotOccupationInfo {
+	var full []repository.SlotOccupationInfo
+	for _, slot := range slots {
+		if slot.TotalSpaces-slot.BookedSpaces <= 0 {
+			full = append(full, slot)
+		}
+	}
+	return full
+}
+
+func changeResponse(change *db.ReservationChange) *entities.ReservationChangeResponse {
+	return &entities.ReservationChangeResponse{
+		Code:          change.ReservationCode,
+		StartTime:     change.StartTime,
+		EndTime:       change.EndTime,
+		VehicleTypeID: change.VehicleTypeID,
+		VehiclePlate:  change.VehiclePlate.String,
+		VehicleModel:  change.VehicleModel.String,
+		OldTotalPrice: change.OldTotalPrice,
+		NewTotalPrice: change.NewTotalPrice,
+	}
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"encoding/json"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/repository/memory"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v82"
+)
+
+type changeEnv struct {
+	store   *memory.Store
+	gateway *FakePaymentGateway
+	svc     *ReservationService
+	events  *StripeEventService
+}
+
+func newChangeEnv() *changeEnv {
+	store := memory.NewSeededStore()
+	gateway := NewFakePaymentGateway("whsec_test", "http://localhost/dev/checkout")
+	stripeSvc := NewStripeService(store, gateway, NewPaymentService(store, store))
+	sender := newTestSenderService()
+	return &changeEnv{
+		store:   store,
+		gateway: gateway,
+		svc:     NewReservationService(store, store, store, store, stripeSvc, sender),
+		events:  NewStripeEventService(store, store, stripeSvc, sender),
+	}
+}
+
+// pay completes a checkout session and processes its webhook.
+func (e *changeEnv) pay(t *testing.T, sessionID string) {
+	t.Helper()
+	hook, err := e.gateway.CompleteCheckout(sessionID)
+	if err != nil {
+		t.Fatalf("CompleteCheckout: %v", err)
+	}
+	var event stripe.Event
+	if err := json.Unmarshal(hook.Payload, &event); err != nil {
+		t.Fatalf("parsing webhook: %v", err)
+	}
+	if err := e.events.HandleEvent(event, hook.Payload); err != nil {
+		t.Fatalf("HandleEvent: %v", err)
+	}
+}
+
+func refundedCents(gateway *FakePaymentGateway) int64 {
+	var total int64
+	for _, r := range gateway.Refunds() {
+		total += r.Amount
+	}
+	return total
+}
+
+func TestModifyReservationCheaperRefundsDifference(t *testing.T) {
+	env := newChangeEnv()
+	// 3 car hours paid online: 12 EUR.
+	insertPaidReservation(t, env.store, env.gateway, "CHANGE01", paymentMethodOnline, 1200, 72)
+	res := env.store.Reservation("CHANGE01")
+	newEnd := res.EndTime.Add(-time.Hour)
+
+	change, err := env.svc.ModifyReservation("CHANGE01", res.UserEmail, entities.ReservationChangeRequest{EndTime: &newEnd})
+	if err != nil {
+		t.Fatalf("ModifyReservation: %v", err)
+	}
+	if change.Status != changeApplied || change.NewTotalPrice != 800 || change.RefundAmount != 400 || change.URL != "" {
+		t.Fatalf("expected the change applied with 4 EUR refunded, got %+v", change)
+	}
+	got := env.store.Reservation("CHANGE01")
+	if !got.EndTime.Equal(newEnd) || got.DepositPayment != 800 || got.TotalPrice != 800 {
+		t.Fatalf("reservation not moved to the new window: %+v", got)
+	}
+	if refunded := refundedCents(env.gateway); refunded != 400 {
+		t.Fatalf("expected 400 cents refunded, got %d", refunded)
+	}
+}
+
+func TestModifyReservationDearerWaitsForPayment(t *testing.T) {
+	env := newChangeEnv()
+	insertPaidReservation(t, env.store, env.gateway, "CHANGE02", paymentMethodOnline, 1200, 72)
+	res := env.store.Reservation("CHANGE02")
+	newEnd := res.EndTime.Add(2 * time.Hour)
+
+	change, err := env.svc.ModifyReservation("CHANGE02", res.UserEmail, entities.ReservationChangeRequest{EndTime: &newEnd})
+	if err != nil {
+		t.Fatalf("ModifyReservation: %v", err)
+	}
+	if change.Status != changeAwaitingPayment || change.AmountDue != 800 || change.URL == "" {
+		t.Fatalf("expected a checkout for the 8 EUR difference, got %+v", change)
+	}
+	if got := env.store.Reservation("CHANGE02"); !got.EndTime.Equal(res.EndTime) {
+		t.Fatalf("the change must not apply before it is paid, end is %s", got.EndTime)
+	}
+
+	env.pay(t, change.SessionID)
+	got := env.store.Reservation("CHANGE02")
+	if !got.EndTime.Equal(newEnd) || got.DepositPayment != 2000 {
+		t.Fatalf("paid change not applied: %+v", got)
+	}
+
+	// Canceling 72h ahead refunds everything, taken from both payments.
+	quote, err := env.svc.CancelReservation("CHANGE02", "mario@example.com")
+	if err != nil {
+		t.Fatalf("CancelReservation: %v", err)
+	}
+	if quote.RefundAmount != 2000 {
+		t.Fatalf("expected the 20 EUR paid refunded, got %+v", quote)
+	}
+	if refunded := refundedCents(env.gateway); refunded != 2000 || len(env.gateway.Refunds()) != 2 {
+		t.Fatalf("expected 2000 cents refunded over two payments, got %d in %v", refunded, env.gateway.Refunds())
+	}
+}
+
+func TestModifyReservationSupersededPaymentIsRefunded(t *testing.T) {
+	env := newChangeEnv()
+	insertPaidReservation(t, env.store, env.gateway, "CHANGE03", paymentMethodOnline, 1200, 72)
+	res := env.store.Reservation("CHANGE03")
+	first, second := res.EndTime.Add(time.Hour), res.EndTime.Add(2*time.Hour)
+
+	stale, err := env.svc.ModifyReservation("CHANGE03", res.UserEmail, entities.ReservationChangeRequest{EndTime: &first})
+	if err != nil {
+		t.Fatalf("ModifyReservation: %v", err)
+	}
+	if _, err := env.svc.ModifyReservation("CHANGE03", res.UserEmail, entities.ReservationChangeRequest{EndTime: &second}); err != nil {
+		t.Fatalf("ModifyReservation: %v", err)
+	}
+
+	env.pay(t, stale.SessionID)
+	if got := env.store.Reservation("CHANGE03"); !got.EndTime.Equal(res.EndTime) {
+		t.Fatalf("a superseded change must not apply, end is %s", got.EndTime)
+	}
+	if refunded := refundedCents(env.gateway); refunded != 400 {
+		t.Fatalf("expected the 400 cents of the superseded change refunded, got %d", refunded)
+	}
+	changes := env.store.ReservationChanges("CHANGE03")
+	if len(changes) != 2 || changes[0].Status != changeRejected || changes[1].Status != changeAwaitingPayment {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+}
+
+func TestModifyReservationChecksAvailabilityWithoutItself(t *testing.T) {
+	env := newChangeEnv()
+	insertPaidReservation(t, env.store, env.gateway, "CHANGE04", paymentMethodOnline, 1200, 72)
+	res := env.store.Reservation("CHANGE04")
+	// The rest of the car pool is taken during the reservation and the hour right after it.
+	fillPool(env.store, suvTypeID, 19, res.StartTime, res.EndTime.Add(time.Hour))
+
+	plate := "ZZ999ZZ"
+	change, err := env.svc.ModifyReservation("CHANGE04", res.UserEmail, entities.ReservationChangeRequest{VehiclePlate: &plate})
+	if err != nil {
+		t.Fatalf("changing the plate in a full pool: %v", err)
+	}
+	if change.Status != changeApplied || env.store.Reservation("CHANGE04").VehiclePlate.String != plate {
+		t.Fatalf("plate not changed: %+v", change)
+	}
+
+	fillPool(env.store, carTypeID, 1, res.EndTime, res.EndTime.Add(time.Hour))
+	newEnd := res.EndTime.Add(time.Hour)
+	_, err = env.svc.ModifyReservation("CHANGE04", res.UserEmail, entities.ReservationChangeRequest{EndTime: &newEnd})
+	herr, ok := err.(*errors.HTTPError)
+	if !ok || herr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 extending into a full hour, got %v", err)
+	}
+}
+
+func TestModifyReservationRules(t *testing.T) {
+	env := newChangeEnv()
+	started := newReservation("STARTED1", carTypeID, statusActive, futureHour(-1), futureHour(2))
+	env.store.InsertReservation(started)
+	newEnd := futureHour(3)
+
+	_, err := env.svc.ModifyReservation("STARTED1", started.UserEmail, entities.ReservationChangeRequest{EndTime: &newEnd})
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 modifying a started reservation, got %v", err)
+	}
+	_, err = env.svc.ModifyReservation("STARTED1", "someone@example.com", entities.ReservationChangeRequest{EndTime: &newEnd})
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 with another email, got %v", err)
+	}
+
+	// Admins may extend a started reservation; an onsite one just owes more.
+	admin := newTestAdminService(env.store)
+	change, err := admin.ModifyReservation("STARTED1", entities.ReservationChangeRequest{EndTime: &newEnd}, "admin")
+	if err != nil {
+		t.Fatalf("admin ModifyReservation: %v", err)
+	}
+	if change.Status != changeApplied || change.NewTotalPrice != 1600 {
+		t.Fatalf("expected the admin change applied at 16 EUR, got %+v", change)
+	}
+}
+
+func TestModifyReservationRefundFollowsThePolicy(t *testing.T) {
+	env := newChangeEnv()
+	// 3 car hours paid online, 24 hours ahead: the 12-48h tier refunds 70%.
+	insertPaidReservation(t, env.store, env.gateway, "CHANGE05", paymentMethodOnline, 1200, 24)
+	res := env.store.Reservation("CHANGE05")
+	newEnd := res.StartTime.Add(time.Hour)
+
+	change, err := env.svc.ModifyReservation("CHANGE05", res.UserEmail, entities.ReservationChangeRequest{EndTime: &newEnd})
+	if err != nil {
+		t.Fatalf("ModifyReservation: %v", err)
+	}
+	if change.Status != changeApplied || change.NewTotalPrice != 400 || change.RefundAmount != 560 || change.BalanceDue != 0 {
+		t.Fatalf("expected 70%% of the 8 EUR difference refunded, got %+v", change)
+	}
+	if refunded := refundedCents(env.gateway); refunded != 560 {
+		t.Fatalf("expected 560 cents refunded, got %d", refunded)
+	}
+
+	// Moving an unstarted reservation into the past is rejected.
+	past := futureHour(-2)
+	_, err = env.svc.ModifyReservation("CHANGE05", res.UserEmail, entities.ReservationChangeRequest{StartTime: &past})
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 moving the start into the past, got %v", err)
+	}
+}
+
+func TestModifyStartedReservationKeepsItsStartAndUsedTime(t *testing.T) {
+	env := newChangeEnv()
+	admin := newTestAdminService(env.store)
+	parked := newReservation("PARKED01", carTypeID, statusCheckedIn, futureHour(-3), futureHour(2))
+	env.store.InsertReservation(parked)
+
+	newStart := futureHour(-2)
+	_, err := admin.ModifyReservation("PARKED01", entities.ReservationChangeRequest{StartTime: &newStart}, "admin")
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 moving the start of a started reservation, got %v", err)
+	}
+	newEnd := futureHour(-1)
+	_, err = admin.ModifyReservation("PARKED01", entities.ReservationChangeRequest{EndTime: &newEnd}, "admin")
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 ending a parked car's reservation before now, got %v", err)
+	}
+}
+
+func TestModifyUnpaidReservationLeavesTheDifferenceDue(t *testing.T) {
+	env := newChangeEnv()
+	admin := newTestAdminService(env.store)
+	start := futureHour(48)
+	created, err := admin.CreateReservation(adminRequest(carTypeID, start, start.Add(3*time.Hour)))
+	if err != nil {
+		t.Fatalf("CreateReservation: %v", err)
+	}
+	newEnd := start.Add(5 * time.Hour)
+
+	change, err := env.svc.ModifyReservation(created.Code, created.UserEmail, entities.ReservationChangeRequest{EndTime: &newEnd})
+	if err != nil {
+		t.Fatalf("ModifyReservation: %v", err)
+	}
+	if change.Status != changeApplied || change.URL != "" || change.BalanceDue != change.NewTotalPrice {
+		t.Fatalf("expected the change applied with its whole price due, got %+v", change)
+	}
+}
+
+func TestFailedChangeRefundIsRetried(t *testing.T) {
+	env := newChangeEnv()
+	admin := newTestAdminService(env.store)
+	insertPaidReservation(t, env.store, env.gateway, "CHANGE06", paymentMethodOnline, 1200, -1)
+	res := env.store.Reservation("CHANGE06")
+	if err := env.store.CheckInReservation(res.ID, res.StartTime); err != nil {
+		t.Fatalf("CheckInReservation: %v", err)
+	}
+	newEnd := res.EndTime.Add(-time.Hour)
+
+	env.gateway.RefundError = fmt.Errorf("stripe is down")
+	change, err := admin.ModifyReservation("CHANGE06", entities.ReservationChangeRequest{EndTime: &newEnd}, "admin")
+	if err != nil {
+		t.Fatalf("ModifyReservation: %v", err)
+	}
+	if change.Status != changeRefundPending || change.RefundAmount != 0 {
+		t.Fatalf("expected the change applied with its refund pending, got %+v", change)
+	}
+	got := env.store.Reservation("CHANGE06")
+	if got.Status != statusCheckedIn || got.PaymentStatus.String != paymentRefundFailed || !got.EndTime.Equal(newEnd) {
+		t.Fatalf("expected the car still checked in with the refund flagged, got %s / %s", got.Status, got.PaymentStatus.String)
+	}
+
+	env.gateway.RefundError = nil
+	for i := 0; i < 2; i++ {
+		if _, err := env.svc.RetryChangeRefunds(); err != nil {
+			t.Fatalf("RetryChangeRefunds: %v", err)
+		}
+	}
+	if refunds := env.gateway.Refunds(); len(refunds) != 1 || refunds[0].Amount != 400 {
+		t.Fatalf("expected the 400 cents refunded once, got %+v", refunds)
+	}
+	if changes := env.store.ReservationChanges("CHANGE06"); changes[0].Status != changeApplied {
+		t.Fatalf("expected the change applied once refunded, got %s", changes[0].Status)
+	}
+}
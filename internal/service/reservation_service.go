@@ -2,39 +2,62 @@ package service
 
 import (
 	"database/sql"
+	stdErrors "errors"
 	"estacionamienti/internal/db"
 	"estacionamienti/internal/entities"
 	"estacionamienti/internal/errors"
+	"estacionamienti/internal/money"
 	"estacionamienti/internal/repository"
 	"fmt"
 	"log"
+	"net/http"
+	"strings"
 	"time"
-
-	"github.com/stripe/stripe-go/v82"
-	"github.com/stripe/stripe-go/v82/checkout/session"
 )
 
 const (
 	statusActive  = "active"
 	statusPending = "pending"
 	statusCancel  = "canceled"
-	deposit       = 0.3
+	// statusCanceling is held by a reservation between claiming its cancellation and settling it.
+	statusCanceling = "canceling"
+	deposit         = 0.3
+
+	// statusConfirmed is only used in notifications, reservations become active once paid.
+	statusConfirmed  = "confirmed"
+	paymentSucceeded = "succeeded"
+
+	paymentMethodOnsite = 1
+	paymentMethodOnline = 2
+)
+
+const (
+	// checkoutSessionTTL is how long a Stripe checkout session stays open. Stripe requires at least 30 minutes.
+	checkoutSessionTTL = 31 * time.Minute
+	// pendingHoldWindow is how long a pending reservation keeps its space while the customer is paying.
+	// It outlives the checkout session a little so a late webhook still finds the space held.
+	pendingHoldWindow = checkoutSessionTTL + 5*time.Minute
 )
 
 type ReservationService struct {
 	stripeService *StripeService
-	Repo          *repository.ReservationRepository
+	Repo          repository.ReservationRepository
+	pricing       pricingRepos
+	refundPolicy  repository.RefundPolicyRepository
 	senderService *SenderService
 }
 
-func NewReservationService(repo *repository.ReservationRepository, stripeService *StripeService, senderService *SenderService) *ReservationService {
+func NewReservationService(repo repository.ReservationRepository, pricingRepo repository.PricingRepository, promoCodeRepo repository.PromoCodeRepository,
+	refundPolicyRepo repository.RefundPolicyRepository, stripeService *StripeService, senderService *SenderService) *ReservationService {
 	return &ReservationService{Repo: repo,
+		pricing:       pricingRepos{pricingRepo, promoCodeRepo},
+		refundPolicy:  refundPolicyRepo,
 		stripeService: stripeService,
 		senderService: senderService}
 }
 
 func (s *ReservationService) GetPrices() ([]entities.PriceResponse, error) {
-	priceResponse, err := s.Repo.GetPrices()
+	priceResponse, err := s.pricing.GetPrices()
 	if err != nil {
 		log.Printf("Error from GetPrices: %v", err)
 		return nil, err
@@ -52,22 +75,13 @@ func (s *ReservationService) GetVehicleTypes() ([]db.VehicleType, error) {
 }
 
 func (s *ReservationService) CheckAvailability(req entities.ReservationRequest) (*entities.AvailabilityResponse, error) {
-	// You need vehicle type name for mapping
-	var vehicleTypeName string
-	vehicleTypes, err := s.Repo.GetVehicleTypes()
-	if err != nil {
-		log.Printf("Error from GetVehicleTypes: %v", err)
-		return nil, fmt.Errorf("internal error checking availability: %w", err)
-	}
-
-	for _, vt := range vehicleTypes {
-		if vt.ID == req.VehicleTypeID {
-			vehicleTypeName = vt.Name
-			break
-		}
+	if err := checkVehicleType(s.Repo, req.VehicleTypeID); err != nil {
+		log.Printf("Error checking vehicle type: %v", err)
+		return nil, err
 	}
 
-	hourlyDetails, err := s.Repo.GetHourlyAvailabilityDetails(req.StartTime, req.EndTime, req.VehicleTypeID, vehicleTypeName)
+	holdSince := time.Now().UTC().Add(-pendingHoldWindow)
+	hourlyDetails, err := s.Repo.GetHourlyAvailabilityDetails(req.StartTime, req.EndTime, req.VehicleTypeID, holdSince, 0)
 	if err != nil {
 		log.Printf("Error from GetHourlyAvailabilityDetails: %v", err)
 		return nil, fmt.Errorf("internal error checking availability: %w", err)
@@ -109,43 +123,42 @@ func (s *ReservationService) CheckAvailability(req entities.ReservationRequest)
 	return response, nil
 }
 
-func (s *ReservationService) GetTotalPriceForReservation(vehicleTypeID int, startTime, endTime time.Time) (float32, error) {
-	if !endTime.After(startTime) {
-		return 0, fmt.Errorf("end_time must be after start_time")
-	}
-	months, weeks, days, hours := getUnitCounts(startTime, endTime)
+// GetTotalPriceForReservation prices a reservation and itemizes its base price and the pricing rules applied to it.
+func (s *ReservationService) GetTotalPriceForReservation(vehicleTypeID int, startTime, endTime time.Time) (*entities.PriceBreakdown, error) {
+	return priceReservation(s.pricing, vehicleTypeID, startTime, endTime)
+}
 
-	priceHour, err := s.Repo.GetPriceForUnit(vehicleTypeID, 1)
+func totalPriceForReservation(repo repository.PricingRepository, vehicleTypeID int, startTime, endTime time.Time) (money.Amount, error) {
+	breakdown, err := priceReservation(repo, vehicleTypeID, startTime, endTime)
 	if err != nil {
-		log.Printf("Error from GetPriceForUnit (hour): %v", err)
-		return 0, fmt.Errorf("could not get price per hour: %w", err)
+		return 0, err
 	}
-	priceDay, err := s.Repo.GetPriceForUnit(vehicleTypeID, 2)
-	if err != nil {
-		log.Printf("Error from GetPriceForUnit (day): %v", err)
-		return 0, fmt.Errorf("could not get price per day: %w", err)
+	return breakdown.TotalPrice, nil
+}
+
+func (s *ReservationService) CreateReservation(req *entities.ReservationRequest) (*entities.StripeSessionResponse, error) {
+	if req.PaymentMethodID != paymentMethodOnsite && req.PaymentMethodID != paymentMethodOnline {
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "Método de pago no soportado")
 	}
-	priceWeek, err := s.Repo.GetPriceForUnit(vehicleTypeID, 3)
-	if err != nil {
-		log.Printf("Error from GetPriceForUnit (week): %v", err)
-		return 0, fmt.Errorf("could not get price per week: %w", err)
+	if err := checkVehicleType(s.Repo, req.VehicleTypeID); err != nil {
+		log.Printf("Error checking vehicle type: %v", err)
+		return nil, err
+	}
+
+	var price *reservationPrice
+	var err error
+	if req.QuoteToken != "" {
+		price, err = quotedPrice(s.pricing, req)
+	} else {
+		price, err = checkDeclaredPrice(s.pricing, req)
 	}
-	priceMonth, err := s.Repo.GetPriceForUnit(vehicleTypeID, 4)
 	if err != nil {
-		log.Printf("Error from GetPriceForUnit (month): %v", err)
-		return 0, fmt.Errorf("could not get price per month: %w", err)
+		return nil, err
 	}
+	depositPayment := upfrontPayment(req.PaymentMethodID, price.total)
 
-	result := float32(months)*priceMonth + float32(weeks)*priceWeek + float32(days)*priceDay + float32(hours)*priceHour
-	result = float32(int(result*10)) / 10
-	return result, nil
-}
-
-func (s *ReservationService) CreateReservation(req *entities.ReservationRequest) (*entities.StripeSessionResponse, error) {
-	code := fmt.Sprintf("%08X", time.Now().UnixNano()%100000000)
-
+	// The repository gives the reservation its code.
 	reservation := &db.Reservation{
-		Code:            code,
 		UserName:        req.UserName,
 		UserEmail:       req.UserEmail,
 		UserPhone:       sql.NullString{String: req.UserPhone, Valid: req.UserPhone != ""},
@@ -157,26 +170,44 @@ func (s *ReservationService) CreateReservation(req *entities.ReservationRequest)
 		StartTime:       req.StartTime,
 		EndTime:         req.EndTime,
 		Language:        req.Language,
-		TotalPrice:      sql.NullFloat64{Float64: float64(req.TotalPrice), Valid: req.TotalPrice != 0},
-		DepositPayment:  sql.NullFloat64{Float64: float64(req.DepositPayment), Valid: req.DepositPayment != 0},
+		TotalPrice:      price.total,
+		DepositPayment:  depositPayment,
 		CreatedAt:       time.Now().UTC(),
 		UpdatedAt:       time.Now().UTC(),
 	}
+	price.applyTo(reservation)
 
-	sessionURL, err := s.handlePaymentIntent(req, reservation)
+	// The reservation is stored as pending before going to Stripe so its space is held while the customer pays.
+	conflicts, err := s.Repo.CreateReservationIfAvailable(reservation, reservation.CreatedAt.Add(-pendingHoldWindow), nil)
+	if err != nil {
+		log.Printf("Error creating reservation in repository: %v", err)
+		if stdErrors.Is(err, repository.ErrPromoCodeExhausted) {
+			return nil, errPromoCodeExhausted()
+		}
+		return nil, err
+	}
+	if len(conflicts) > 0 {
+		log.Printf("Reservation rejected, no spaces left for vehicle type %d in %d slots", req.VehicleTypeID, len(conflicts))
+		return nil, errNoAvailability(conflicts)
+	}
+
+	sessionURL, err := s.handlePaymentIntent(reservation, price.checkoutDiscount(reservation))
 	if err != nil {
 		log.Printf("Error from handlePaymentIntent: %v", err)
+		if _, cancelErr := cancelReservation(s.Repo, s.stripeService, reservation, 0, "", nil); cancelErr != nil {
+			log.Printf("Error releasing reservation %s after checkout failure: %v", reservation.Code, cancelErr)
+		}
 		return nil, err
 	}
 
-	err = s.Repo.CreateReservation(reservation)
+	err = s.Repo.UpdateReservationStripeSession(reservation.ID, reservation.StripeSessionID.String, reservation.PaymentStatus.String)
 	if err != nil {
-		log.Printf("Error creating reservation in repository: %v", err)
+		log.Printf("Error storing Stripe session for reservation %s: %v", reservation.Code, err)
 		return nil, err
 	}
 
 	return &entities.StripeSessionResponse{
-		Code:      code,
+		Code:      reservation.Code,
 		URL:       sessionURL,
 		SessionID: reservation.StripeSessionID.String}, nil
 }
@@ -190,121 +221,127 @@ func (s *ReservationService) GetReservationByCode(code, email string) (*entities
 	return reservationResponse, nil
 }
 
-func (s *ReservationService) CancelReservation(code string) error {
-	reservation, err := s.Repo.GetReservationByCodeOnly(code)
+// ListCustomerReservations returns every reservation booked with the email, the latest first.
+func (s *ReservationService) ListCustomerReservations(email string) ([]entities.ReservationResponse, error) {
+	reservations, err := s.Repo.ListReservationsByEmail(email)
 	if err != nil {
-		return err
+		log.Printf("Error listing reservations of %s: %v", email, err)
+		return nil, err
 	}
-	log.Printf("Canceling reservation with code: %s", code)
+	return reservations, nil
+}
 
-	currentTime := time.Now().UTC()
-	if reservation.StartTime.Sub(currentTime) < 12*time.Hour {
-		log.Printf("Reservation can only be cancelled more than 12 hours before the start time")
-		return errors.ErrUnauthorized("Reservations can only be cancelled more than 12 hours before the start time")
+// customerReservation returns the reservation with the code if it was booked with the email, and 404 otherwise so
+// codes of other customers can't be told apart from unknown ones.
+func customerReservation(repo repository.ReservationRepository, code, email string) (*db.Reservation, error) {
+	reservation, err := repo.GetReservationByCodeOnly(code)
+	if err != nil {
+		log.Printf("Error getting reservation %s: %v", code, err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NewHTTPError(http.StatusNotFound, "Reservation not found")
+		}
+		return nil, err
 	}
-
-	sessionID := reservation.StripeSessionID.String
-	if sessionID == "" {
-		_, err = s.Repo.CancelReservation(code)
-		return err
+	if !strings.EqualFold(reservation.UserEmail, email) {
+		log.Printf("Reservation %s requested by %s, who did not book it", code, email)
+		return nil, errors.NewHTTPError(http.StatusNotFound, "Reservation not found")
 	}
+	return reservation, nil
+}
 
-	// If reservation has a Stripe session ID
-	reservationResp, err := s.GetReservationBySessionID(sessionID)
+// QuoteCancellation returns what canceling the customer's reservation now would refund, without canceling it.
+func (s *ReservationService) QuoteCancellation(code, email string) (*entities.RefundQuote, error) {
+	reservation, err := customerReservation(s.Repo, code, email)
 	if err != nil {
-		log.Printf("Error getting reservation by Stripe session ID: %v", err)
-		return err
+		return nil, err
 	}
+	return quoteCancellation(s.refundPolicy, s.stripeService.payments, reservation, time.Now().UTC())
+}
 
-	err = s.stripeService.RefundPaymentBySessionID(reservation.StripeSessionID.String)
+// CancelReservation cancels the customer's reservation and refunds what the refund policy of its payment method
+// allows.
+func (s *ReservationService) CancelReservation(code, email string) (*entities.RefundQuote, error) {
+	reservation, err := customerReservation(s.Repo, code, email)
 	if err != nil {
-		log.Printf("Error refunding payment: %v", err)
-		return err
+		return nil, err
 	}
+	log.Printf("Canceling reservation with code: %s", code)
 
-	_, err = s.Repo.CancelReservation(code)
+	quote, err := quoteCancellation(s.refundPolicy, s.stripeService.payments, reservation, time.Now().UTC())
 	if err != nil {
-		log.Printf("Error canceling reservation: %v", err)
-		return err
+		return nil, err
 	}
 
-	statusTraducido := s.senderService.StatusTranslation(statusCancel, reservationResp.Language)
-	s.senderService.SendReservationSMS(*reservationResp, statusTraducido)
-	s.senderService.SendReservationEmail(*reservationResp, statusTraducido)
-	return nil
-}
-
-func (s *ReservationService) GetReservationBySessionID(sessionID string) (*entities.ReservationResponse, error) {
-	reservation, err := s.Repo.GetReservationByStripeSessionID(sessionID)
-	if err != nil {
-		log.Printf("Error getting reservation by Stripe session ID: %v", err)
+	var notifications []db.Notification
+	if reservation.StripeSessionID.String != "" {
+		notifications = s.senderService.ReservationNotifications(reservation, statusCancel)
+	}
+	if _, err := cancelReservation(s.Repo, s.stripeService, reservation, quote.RefundAmount, "cancellation", notifications); err != nil {
 		return nil, err
 	}
-	resp := &entities.ReservationResponse{
-		Code:            reservation.Code,
-		UserName:        reservation.UserName,
-		UserEmail:       reservation.UserEmail,
-		UserPhone:       reservation.UserPhone.String,
-		VehicleTypeID:   reservation.VehicleTypeID,
-		VehiclePlate:    reservation.VehiclePlate.String,
-		VehicleModel:    reservation.VehicleModel.String,
-		PaymentMethodID: reservation.PaymentMethodID,
-		Status:          reservation.Status,
-		StartTime:       reservation.StartTime,
-		EndTime:         reservation.EndTime,
-		CreatedAt:       reservation.CreatedAt,
-		UpdatedAt:       reservation.UpdatedAt,
-		PaymentStatus:   reservation.PaymentStatus.String,
-		Language:        reservation.Language,
-		TotalPrice:      float32(reservation.TotalPrice.Float64),
-		DepositPayment:  float32(reservation.DepositPayment.Float64),
-	}
-	return resp, nil
+	quote.Canceled = true
+	return quote, nil
 }
 
-func (s *ReservationService) UpdateReservationAndPaymentStatusBySessionID(sessionID, reservationStatus, paymentStatus string) error {
-	reservation, err := s.Repo.GetReservationByStripeSessionID(sessionID)
+// cancelReservation cancels the reservation and refunds refundAmount of what it paid through Stripe. The cancellation
+// is claimed before refunding, so only one of several requests refunds it, and the refund is keyed by the reservation
+// code, so retrying it doesn't refund twice. When the refund fails the reservation gets its status back; when the
+// cancellation can't be stored after refunding, the charge.refunded webhook of the refund settles it.
+func cancelReservation(repo repository.ReservationRepository, stripeService *StripeService, reservation *db.Reservation,
+	refundAmount money.Amount, note string, notifications []db.Notification) (money.Amount, error) {
+	previous, err := repo.ClaimCancellation(reservation.Code, refundAmount)
+	if stdErrors.Is(err, repository.ErrNotCancelable) {
+		return 0, errors.NewHTTPError(http.StatusConflict, "Reservation is already cancelled or being cancelled")
+	}
 	if err != nil {
-		return err
+		log.Printf("Error claiming cancellation of reservation %s: %v", reservation.Code, err)
+		return 0, err
 	}
-	return s.Repo.UpdateReservationAndPaymentStatus(reservation.ID, reservationStatus, paymentStatus)
-}
 
-func (s *ReservationService) UpdateReservationStatusPaymentAndIntentBySessionID(sessionID, reservationStatus, paymentStatus, paymentIntentID string) error {
-	reservation, err := s.Repo.GetReservationByStripeSessionID(sessionID)
-	if err != nil {
-		return err
+	var refunded money.Amount
+	if refundAmount > 0 {
+		refunded, err = stripeService.RefundReservation(reservation, refundAmount, note, "cancel-"+reservation.Code)
+		if err != nil {
+			log.Printf("Error refunding payment: %v", err)
+			if releaseErr := repo.SettleCancellation(reservation.Code, previous, refundAmount-refunded, nil); releaseErr != nil {
+				log.Printf("ALERTA: la reserva %s quedó en cancelación tras fallar el reembolso: %v", reservation.Code, releaseErr)
+			}
+			return refunded, err
+		}
+	}
+
+	if err := repo.SettleCancellation(reservation.Code, statusCancel, refundAmount-refunded, notifications); err != nil {
+		log.Printf("Error canceling reservation %s after refunding %s: %v", reservation.Code, refunded, err)
+		return refunded, err
 	}
-	return s.Repo.UpdateReservationStatusPaymentAndIntent(reservation.ID, reservationStatus, paymentStatus, paymentIntentID)
+	return refunded, nil
 }
 
-// GetSessionIDByPaymentIntentID busca el session_id en Stripe a partir de un PaymentIntentID
-func (s *ReservationService) GetSessionIDByPaymentIntentID(paymentIntentID string) (string, error) {
-	params := &stripe.CheckoutSessionListParams{
-		PaymentIntent: &paymentIntentID,
-	}
-	params.Limit = stripe.Int64(1)
-	it := session.List(params)
-	for it.Next() {
-		sess := it.CheckoutSession()
-		if sess != nil && sess.ID != "" {
-			return sess.ID, nil
-		}
+// GetReservationBySessionID returns the status of the reservation paid through the Stripe session. Anyone with the
+// session ID can ask, so it only tells the code and status; the reservation itself needs a customer token.
+func (s *ReservationService) GetReservationBySessionID(sessionID string) (*entities.ReservationSessionStatus, error) {
+	reservation, err := s.Repo.GetReservationByStripeSessionID(sessionID)
+	if err != nil {
+		log.Printf("Error getting reservation by Stripe session ID: %v", err)
+		return nil, err
 	}
-	return "", fmt.Errorf("No session_id found for PaymentIntentID %s", paymentIntentID)
+	return &entities.ReservationSessionStatus{
+		Code:          reservation.Code,
+		Status:        reservation.Status,
+		PaymentStatus: reservation.PaymentStatus.String,
+	}, nil
 }
 
-func (s *ReservationService) handlePaymentIntent(req *entities.ReservationRequest, reservation *db.Reservation) (string, error) {
-	var amount int64
-	if req.PaymentMethodID == 2 { // online
-		amount = int64(req.TotalPrice * 100)
-	} else if req.PaymentMethodID == 1 { // onsite
-		amount = int64(float64(req.TotalPrice) * deposit * 100)
-	} else {
-		return "", fmt.Errorf("Método de pago no soportado")
+// handlePaymentIntent opens a Stripe checkout for the upfront part of the reservation, already computed by the server
+// and stored in DepositPayment. The promo discount in it, if any, is itemized on the checkout page.
+func (s *ReservationService) handlePaymentIntent(reservation *db.Reservation, discount *CheckoutDiscount) (string, error) {
+	amount := reservation.DepositPayment
+	if amount <= 0 {
+		return "", fmt.Errorf("nothing to charge for reservation %s", reservation.Code)
 	}
 
-	sessionURL, sessionID, err := s.stripeService.CreateCheckoutSession(amount, "eur", req.UserEmail, reservation.Language)
+	expiresAt := time.Now().Add(checkoutSessionTTL)
+	sessionURL, sessionID, err := s.stripeService.CreateCheckoutSession(money.Of(amount), discount, reservation.UserEmail, reservation.Language, expiresAt)
 	if err != nil {
 		log.Printf("Error creating Stripe checkout session: %v", err)
 		return "", err
@@ -351,3 +388,96 @@ func getUnitCounts(startTime, endTime time.Time) (months, weeks, days, hours int
 	}
 	return
 }
+
+// reservationPrice is what a new reservation costs: its total, with the discount of its promo code, if any, already
+// taken off.
+type reservationPrice struct {
+	total    money.Amount
+	discount money.Amount
+	promo    *db.PromoCode
+}
+
+// applyTo records the promo code and its discount in the reservation.
+func (p *reservationPrice) applyTo(reservation *db.Reservation) {
+	if p.promo != nil {
+		reservation.PromoCodeID = sql.NullInt64{Int64: int64(p.promo.ID), Valid: true}
+		reservation.DiscountAmount = p.discount
+	}
+}
+
+func (p *reservationPrice) checkoutDiscount(reservation *db.Reservation) *CheckoutDiscount {
+	if p.promo == nil {
+		return nil
+	}
+	return checkoutDiscount(reservation, p.promo.Code)
+}
+
+// priceRequest computes the price of the requested reservation, applying its promo code.
+func priceRequest(pricing pricingRepos, req *entities.ReservationRequest) (*reservationPrice, error) {
+	totalPrice, err := totalPriceForReservation(pricing, req.VehicleTypeID, req.StartTime, req.EndTime)
+	if err != nil {
+		log.Printf("Error computing price for reservation request: %v", err)
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "Could not compute the price for the requested reservation")
+	}
+	price := &reservationPrice{total: totalPrice}
+	if req.PromoCode != "" {
+		price.promo, price.discount, err = applyPromoCode(pricing, req.PromoCode, req.VehicleTypeID, req.StartTime, req.EndTime, req.UserEmail, totalPrice)
+		if err != nil {
+			return nil, err
+		}
+		price.total -= price.discount
+	}
+	return price, nil
+}
+
+// checkDeclaredPrice recomputes the price of the requested reservation and rejects the request when the total the
+// client declared differs from it. The client total is never used for charging; a mismatch is logged as suspicious.
+func checkDeclaredPrice(pricing pricingRepos, req *entities.ReservationRequest) (*reservationPrice, error) {
+	price, err := priceRequest(pricing, req)
+	if err != nil {
+		return nil, err
+	}
+	if req.TotalPrice != price.total {
+		log.Printf("SUSPICIOUS: reservation request from %s declared total_price %s but the computed price is %s (vehicle type %d, %s - %s)",
+			req.UserEmail, req.TotalPrice, price.total, req.VehicleTypeID, req.StartTime.Format(time.RFC3339), req.EndTime.Format(time.RFC3339))
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "total_price does not match the current price for this reservation")
+	}
+	return price, nil
+}
+
+// upfrontPayment is what the customer pays through Stripe when booking: the deposit for on-site payments and the
+// whole price for online payments. It is stored as the reservation's deposit_payment.
+func upfrontPayment(paymentMethodID int, totalPrice money.Amount) money.Amount {
+	if paymentMethodID == paymentMethodOnline {
+		return totalPrice
+	}
+	return totalPrice.Mul(deposit)
+}
+
+// checkVehicleType rejects requests for vehicle types that don't exist.
+func checkVehicleType(repo repository.ReservationRepository, vehicleTypeID int) error {
+	vehicleTypes, err := repo.GetVehicleTypes()
+	if err != nil {
+		return err
+	}
+	for _, vt := range vehicleTypes {
+		if vt.ID == vehicleTypeID {
+			return nil
+		}
+	}
+	return errors.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Vehicle type %d does not exist", vehicleTypeID))
+}
+
+// errNoAvailability builds the 409 returned when a reservation would overbook its space pool.
+func errNoAvailability(conflicts []repository.SlotOccupationInfo) *errors.HTTPError {
+	slots := make([]entities.TimeSlotAvailability, 0, len(conflicts))
+	for _, c := range conflicts {
+		slots = append(slots, entities.TimeSlotAvailability{
+			StartTime:       c.SlotStart,
+			EndTime:         c.SlotEnd,
+			IsAvailable:     false,
+			AvailableSpaces: c.TotalSpaces - c.BookedSpaces,
+		})
+	}
+	return errors.ErrConflict("No spaces available for the requested time", slots)
+}
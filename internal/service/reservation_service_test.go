@@ -0,0 +1,212 @@
+package service
+
+import (
+	"database/sql"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/money"
+	"estacionamienti/internal/repository/memory"
+	"estacionamienti/internal/reservationcode"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestReservationService(store *memory.Store) *ReservationService {
+	return NewReservationService(store, store, store, store, newTestStripeService(store), newTestSenderService())
+}
+
+func TestCheckAvailabilitySharesPoolBetweenCarAndSUV(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := newTestReservationService(store)
+	start, end := futureHour(72), futureHour(75)
+	fillPool(store, suvTypeID, 20, start, start.Add(time.Hour))
+
+	resp, err := svc.CheckAvailability(entities.ReservationRequest{VehicleTypeID: carTypeID, StartTime: start, EndTime: end})
+	if err != nil {
+		t.Fatalf("CheckAvailability: %v", err)
+	}
+	if resp.IsOverallAvailable {
+		t.Fatal("expected car availability to be blocked by SUVs in the shared pool")
+	}
+	if len(resp.SlotDetails) != 3 {
+		t.Fatalf("expected 3 hourly slots, got %d", len(resp.SlotDetails))
+	}
+	if resp.SlotDetails[0].IsAvailable || !resp.SlotDetails[1].IsAvailable {
+		t.Fatalf("expected only the first slot to be full, got %+v", resp.SlotDetails)
+	}
+
+	resp, err = svc.CheckAvailability(entities.ReservationRequest{VehicleTypeID: motorcycleTypeID, StartTime: start, EndTime: end})
+	if err != nil {
+		t.Fatalf("CheckAvailability: %v", err)
+	}
+	if !resp.IsOverallAvailable {
+		t.Fatal("motorcycles have their own pool and should be available")
+	}
+}
+
+func TestCheckAvailabilityCountsPendingHolds(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := newTestReservationService(store)
+	start, end := futureHour(72), futureHour(73)
+	store.AddSpacePool("tiny", 1)
+	if err := store.AssignVehicleTypeToPool("motorcycle", "tiny"); err != nil {
+		t.Fatalf("AssignVehicleTypeToPool: %v", err)
+	}
+
+	stale := newReservation("STALE001", motorcycleTypeID, statusPending, start, end)
+	stale.CreatedAt = time.Now().UTC().Add(-2 * pendingHoldWindow)
+	store.InsertReservation(stale)
+
+	resp, err := svc.CheckAvailability(entities.ReservationRequest{VehicleTypeID: motorcycleTypeID, StartTime: start, EndTime: end})
+	if err != nil {
+		t.Fatalf("CheckAvailability: %v", err)
+	}
+	if !resp.IsOverallAvailable {
+		t.Fatal("a pending reservation past its checkout window must not hold a space")
+	}
+
+	store.InsertReservation(newReservation("HOLD0001", motorcycleTypeID, statusPending, start, end))
+	resp, err = svc.CheckAvailability(entities.ReservationRequest{VehicleTypeID: motorcycleTypeID, StartTime: start, EndTime: end})
+	if err != nil {
+		t.Fatalf("CheckAvailability: %v", err)
+	}
+	if resp.IsOverallAvailable {
+		t.Fatal("a pending reservation inside its checkout window must hold a space")
+	}
+}
+
+func TestGetTotalPriceForReservation(t *testing.T) {
+	svc := newTestReservationService(memory.NewSeededStore())
+	start := futureHour(72)
+
+	tests := []struct {
+		name     string
+		duration time.Duration
+		want     money.Amount
+	}{
+		{"three hours", 3 * time.Hour, 1200},
+		{"partial hour rounds up", 90 * time.Minute, 800},
+		{"one day and two hours", 26 * time.Hour, 1800},
+		{"eight days", 8 * 24 * time.Hour, 3000},
+		{"one month", 30 * 24 * time.Hour, 4000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.GetTotalPriceForReservation(carTypeID, start, start.Add(tt.duration))
+			if err != nil {
+				t.Fatalf("GetTotalPriceForReservation: %v", err)
+			}
+			if got.TotalPrice != tt.want || got.BasePrice != tt.want {
+				t.Fatalf("got %+v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateReservationRejectsTamperedPrice(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := newTestReservationService(store)
+	start := futureHour(72)
+
+	_, err := svc.CreateReservation(&entities.ReservationRequest{
+		VehicleTypeID:   carTypeID,
+		UserName:        "Mario Rossi",
+		UserEmail:       "mario@example.com",
+		PaymentMethodID: paymentMethodOnline,
+		StartTime:       start,
+		EndTime:         start.Add(30 * 24 * time.Hour),
+		TotalPrice:      1,
+	})
+	herr, ok := err.(*errors.HTTPError)
+	if !ok || herr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a 400 HTTPError, got %v", err)
+	}
+	list, _ := store.ListReservationsWithFilters("", "", "", "", "", "", "")
+	if list.Total != 0 {
+		t.Fatalf("no reservation should be stored, found %d", list.Total)
+	}
+}
+
+func TestCreateReservationRejectsFullPool(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := newTestReservationService(store)
+	start, end := futureHour(72), futureHour(74)
+	fillPool(store, carTypeID, 20, start.Add(time.Hour), end)
+
+	_, err := svc.CreateReservation(&entities.ReservationRequest{
+		VehicleTypeID:   suvTypeID,
+		UserName:        "Mario Rossi",
+		UserEmail:       "mario@example.com",
+		PaymentMethodID: paymentMethodOnsite,
+		StartTime:       start,
+		EndTime:         end,
+		TotalPrice:      1200,
+	})
+	herr, ok := err.(*errors.HTTPError)
+	if !ok || herr.Code != http.StatusConflict {
+		t.Fatalf("expected a 409 HTTPError, got %v", err)
+	}
+	slots, ok := herr.Details.([]entities.TimeSlotAvailability)
+	if !ok || len(slots) != 1 || !slots[0].StartTime.Equal(start.Add(time.Hour)) {
+		t.Fatalf("expected the second hour as the only conflicting slot, got %+v", herr.Details)
+	}
+}
+
+func TestCancelReservationWithoutPayment(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := newTestReservationService(store)
+	store.InsertReservation(newReservation("CANCEL01", carTypeID, statusActive, futureHour(72), futureHour(74)))
+
+	if _, err := svc.CancelReservation("CANCEL01", "mario@example.com"); err != nil {
+		t.Fatalf("CancelReservation: %v", err)
+	}
+	if got := store.Reservation("CANCEL01").Status; got != statusCancel {
+		t.Fatalf("expected status %q, got %q", statusCancel, got)
+	}
+}
+
+func TestCancelReservationAfterStart(t *testing.T) {
+	store := memory.NewSeededStore()
+	svc := newTestReservationService(store)
+	res := newReservation("LATE0001", carTypeID, statusActive, futureHour(-1), futureHour(4))
+	res.StripeSessionID = sql.NullString{String: "cs_test", Valid: true}
+	store.InsertReservation(res)
+
+	_, err := svc.CancelReservation("LATE0001", "mario@example.com")
+	herr, ok := err.(*errors.HTTPError)
+	if !ok || herr.Code != http.StatusConflict {
+		t.Fatalf("expected a 409 HTTPError, got %v", err)
+	}
+	if got := store.Reservation("LATE0001").Status; got != statusActive {
+		t.Fatalf("reservation should still be active, got %q", got)
+	}
+}
+
+func TestCreatedReservationsGetRandomCodes(t *testing.T) {
+	store := memory.NewSeededStore()
+	admin := newTestAdminService(store)
+	start := futureHour(72)
+
+	first, err := admin.CreateReservation(adminRequest(carTypeID, start, start.Add(2*time.Hour)))
+	if err != nil {
+		t.Fatalf("CreateReservation: %v", err)
+	}
+	if !reservationcode.Valid(first.Code) {
+		t.Fatalf("expected a valid reservation code, got %q", first.Code)
+	}
+	if notifications := store.Notifications(first.Code); len(notifications) == 0 || !strings.Contains(notifications[0].Body, first.Code) {
+		t.Fatalf("expected the notifications to carry the final code, got %+v", notifications)
+	}
+
+	// A code already taken is replaced instead of failing the booking.
+	taken := newReservation("", carTypeID, statusActive, start, start.Add(time.Hour))
+	taken.Code = first.Code
+	if _, err := store.CreateReservationIfAvailable(taken, start, nil); err != nil {
+		t.Fatalf("CreateReservationIfAvailable: %v", err)
+	}
+	if taken.Code == first.Code || !reservationcode.Valid(taken.Code) {
+		t.Fatalf("expected a new valid code instead of %s, got %s", first.Code, taken.Code)
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"database/sql"
+	stdErrors "errors"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/money"
+	"estacionamienti/internal/repository"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	statusOverstay = "overstay"
+
+	// overstayGrace is how late a car may leave before the extra time is charged.
+	overstayGrace = 15 * time.Minute
+)
+
+// ExtendReservation adds hours to the end of a customer's active or overstaying reservation. It is priced and paid
+// like any other modification: when it costs more than what was paid online, it applies once the returned checkout
+// is paid.
+func (s *ReservationService) ExtendReservation(code, email string, hours int) (*entities.ReservationChangeResponse, error) {
+	reservation, err := customerReservation(s.Repo, code, email)
+	if err != nil {
+		return nil, err
+	}
+	return extendReservation(s.Repo, s.pricing, s.refundPolicy, s.stripeService, s.senderService, reservation, hours, "customer", false)
+}
+
+// ExtendReservation adds hours to the end of a reservation. What the extension adds is left as balance due.
+func (s *AdminService) ExtendReservation(code string, hours int, adminUser string) (*entities.ReservationChangeResponse, error) {
+	reservation, err := s.reservationRepo.GetReservationByCodeOnly(code)
+	if err != nil {
+		log.Printf("[AdminService] Error getting reservation %s to extend: %v", code, err)
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NewHTTPError(http.StatusNotFound, "Reservation not found")
+		}
+		return nil, err
+	}
+	return extendReservation(s.reservationRepo, s.pricing, s.refundPolicy, s.stripeService, s.senderService, reservation, hours, adminUser, true)
+}
+
+func extendReservation(repo repository.ReservationRepository, pricing pricingRepos, refundPolicy repository.RefundPolicyRepository,
+	stripeService *StripeService, senderService *SenderService, reservation *db.Reservation, hours int, requestedBy string,
+	byAdmin bool) (*entities.ReservationChangeResponse, error) {
+	if hours < 1 {
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "hours must be at least 1")
+	}
+	newEnd := reservation.EndTime.Add(time.Duration(hours) * time.Hour)
+	if !newEnd.After(time.Now().UTC()) {
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "The extended reservation must end in the future")
+	}
+	return modifyReservation(repo, pricing, refundPolicy, stripeService, senderService, reservation, entities.ReservationChangeRequest{EndTime: &newEnd},
+		requestedBy, byAdmin)
+}
+
+// overstayFee prices the time between the end of the reservation and checkedOutAt like a reservation of its own.
+func overstayFee(repo repository.PricingRepository, reservation *db.Reservation, checkedOutAt time.Time) (money.Amount, error) {
+	if !checkedOutAt.After(reservation.EndTime.Add(overstayGrace)) {
+		return 0, nil
+	}
+	return totalPriceForReservation(repo, reservation.VehicleTypeID, reservation.EndTime, checkedOutAt)
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExtendStartedReservationWaitsForPayment(t *testing.T) {
+	env := newChangeEnv()
+	// Started 2 hours ago, 3 car hours paid online: 12 EUR.
+	insertPaidReservation(t, env.store, env.gateway, "EXTEND01", paymentMethodOnline, 1200, -2)
+	res := env.store.Reservation("EXTEND01")
+
+	change, err := env.svc.ExtendReservation("EXTEND01", res.UserEmail, 2)
+	if err != nil {
+		t.Fatalf("ExtendReservation: %v", err)
+	}
+	if change.Status != changeAwaitingPayment || change.AmountDue != 800 || change.URL == "" {
+		t.Fatalf("expected a checkout for the 8 EUR of 2 more hours, got %+v", change)
+	}
+
+	env.pay(t, change.SessionID)
+	got := env.store.Reservation("EXTEND01")
+	if !got.EndTime.Equal(res.EndTime.Add(2*time.Hour)) || got.Status != statusActive {
+		t.Fatalf("paid extension not applied: %+v", got)
+	}
+
+	if _, err := env.svc.ExtendReservation("EXTEND01", res.UserEmail, 0); err == nil {
+		t.Fatal("expected an error extending by 0 hours")
+	}
+}
+
+func TestOverstayIsChargedAtCheckOut(t *testing.T) {
+	env := newChangeEnv()
+	jobs := NewJobService(env.store)
+	admin := newTestAdminService(env.store)
+	late := newReservation("LATE0001", carTypeID, statusCheckedIn, futureHour(-5), futureHour(-2))
+	late.TotalPrice = 1200
+	env.store.InsertReservation(late)
+	onTime := newReservation("ONTIME01", carTypeID, statusCheckedIn, futureHour(-5), futureHour(-2))
+	onTime.TotalPrice = 1200
+	env.store.InsertReservation(onTime)
+
+	if err := jobs.UpdateFinishedReservations(); err != nil {
+		t.Fatalf("UpdateFinishedReservations: %v", err)
+	}
+	if got := env.store.Reservation("LATE0001").Status; got != statusOverstay {
+		t.Fatalf("expected the reservation flagged as overstay, got %q", got)
+	}
+	// The cars still parked take their spaces in the current hour.
+	slots, err := env.store.GetHourlyAvailabilityDetails(futureHour(0), futureHour(2), carTypeID, time.Now().UTC(), 0)
+	if err != nil {
+		t.Fatalf("GetHourlyAvailabilityDetails: %v", err)
+	}
+	if slots[0].BookedSpaces != 2 || slots[1].BookedSpaces != 0 {
+		t.Fatalf("expected both overstaying cars in the current hour only, got %+v", slots)
+	}
+
+	leftAt := late.EndTime.Add(2 * time.Hour)
+	resp, err := admin.CheckOut(entities.CheckOutRequest{Code: "LATE0001", CheckedOutAt: &leftAt}, "admin")
+	if err != nil {
+		t.Fatalf("CheckOut: %v", err)
+	}
+	if resp.Status != "finished" || resp.OverstayFee != 800 || resp.TotalPrice != 2000 || resp.CheckedOutAt == nil {
+		t.Fatalf("expected 2 extra hours charged, got %+v", resp.ReservationResponse)
+	}
+
+	leftAt = onTime.EndTime.Add(overstayGrace)
+	resp, err = admin.CheckOut(entities.CheckOutRequest{Code: "ONTIME01", CheckedOutAt: &leftAt}, "admin")
+	if err != nil {
+		t.Fatalf("CheckOut: %v", err)
+	}
+	if resp.OverstayFee != 0 || resp.TotalPrice != 1200 {
+		t.Fatalf("leaving within the grace period must not be charged, got %+v", resp.ReservationResponse)
+	}
+
+	_, err = admin.CheckOut(entities.CheckOutRequest{Code: "ONTIME01"}, "admin")
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 checking out twice, got %v", err)
+	}
+}
+
+func TestAdminExtendsOverstayingReservation(t *testing.T) {
+	env := newChangeEnv()
+	admin := newTestAdminService(env.store)
+	env.store.InsertReservation(newReservation("LATE0002", carTypeID, statusOverstay, futureHour(-5), futureHour(-1)))
+
+	if _, err := admin.ExtendReservation("LATE0002", 1, "admin"); err == nil {
+		t.Fatal("expected an error extending to an end already past")
+	}
+	change, err := admin.ExtendReservation("LATE0002", 3, "admin")
+	if err != nil {
+		t.Fatalf("ExtendReservation: %v", err)
+	}
+	got := env.store.Reservation("LATE0002")
+	if change.Status != changeApplied || got.Status != statusActive || !got.EndTime.Equal(futureHour(2)) {
+		t.Fatalf("expected the reservation active until %s, got %+v", futureHour(2), got)
+	}
+}
@@ -2,22 +2,97 @@ package service
 
 import (
 	"bytes"
+	"estacionamienti/internal/db"
 	"estacionamienti/internal/entities"
 	"fmt"
 	"html/template"
 	"log"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
+const (
+	channelEmail = "email"
+	channelSMS   = "sms"
+)
+
 type SenderService struct {
+	email EmailSender
+	sms   SMSSender
+
+	// AdminEmail receives alerts that need staff attention, such as disputes. Alerts are dropped when it is empty.
+	AdminEmail string
 }
 
-func NewSenderService() *SenderService {
-	return &SenderService{}
+func NewSenderService(email EmailSender, sms SMSSender) *SenderService {
+	return &SenderService{email: email, sms: sms}
+}
+
+// ReservationNotifications renders the email, and the SMS when there is a phone number, telling the customer their
+// reservation is now in the given status. They are meant to be queued with the status change and sent by the worker.
+func (s *SenderService) ReservationNotifications(reservation *db.Reservation, status string) []db.Notification {
+	translated := s.StatusTranslation(status, reservation.Language)
+	email := s.reservationEmail(reservation, translated)
+	notifications := []db.Notification{{
+		ReservationCode: reservation.Code,
+		Channel:         channelEmail,
+		Recipient:       email.ToEmail,
+		RecipientName:   email.ToName,
+		Subject:         email.Subject,
+		Body:            email.PlainText,
+		HTMLBody:        email.HTML,
+	}}
+	if reservation.UserPhone.String != "" {
+		notifications = append(notifications, db.Notification{
+			ReservationCode: reservation.Code,
+			Channel:         channelSMS,
+			Recipient:       reservation.UserPhone.String,
+			RecipientName:   reservation.UserName,
+			Body:            s.reservationSMS(reservation, translated),
+		})
+	}
+	return notifications
+}
+
+// AdminAlert renders an email to AdminEmail about a reservation, to be queued like customer notifications.
+func (s *SenderService) AdminAlert(reservation *db.Reservation, subject, body string) []db.Notification {
+	if s.AdminEmail == "" {
+		log.Printf("ALERTA (sin ADMIN_NOTIFICATION_EMAIL) reserva %s: %s - %s", reservation.Code, subject, body)
+		return nil
+	}
+	return []db.Notification{{
+		ReservationCode: reservation.Code,
+		Channel:         channelEmail,
+		Recipient:       s.AdminEmail,
+		RecipientName:   "GreenParking",
+		Subject:         fmt.Sprintf("[GreenParking] %s - %s", subject, reservation.Code),
+		Body: fmt.Sprintf("%s\n\nReserva: %s\nCliente: %s <%s>\nCheck-in: %s\nCheck-out: %s\nEstado: %s\nPago: %s",
+			body, reservation.Code, reservation.UserName, reservation.UserEmail,
+			reservation.StartTime.UTC().Format(time.RFC3339), reservation.EndTime.UTC().Format(time.RFC3339),
+			reservation.Status, reservation.PaymentStatus.String),
+	}}
+}
+
+// Deliver sends a queued notification through the configured email or SMS provider.
+func (s *SenderService) Deliver(n db.Notification) error {
+	switch n.Channel {
+	case channelEmail:
+		return s.email.SendEmail(EmailMessage{
+			ToEmail:   n.Recipient,
+			ToName:    n.RecipientName,
+			Subject:   n.Subject,
+			PlainText: n.Body,
+			HTML:      n.HTMLBody,
+		})
+	case channelSMS:
+		return s.sms.SendSMS(n.Recipient, n.Body)
+	default:
+		return fmt.Errorf("unknown notification channel %q", n.Channel)
+	}
 }
 
-func (s *SenderService) SendReservationEmail(reservation entities.ReservationResponse, status string) {
+func (s *SenderService) reservationEmail(reservation *db.Reservation, status string) EmailMessage {
 	italyLoc, errLoc := time.LoadLocation("Europe/Rome")
 	if errLoc != nil {
 		italyLoc = time.FixedZone("CET", 1*60*60) // fallback CET
@@ -26,8 +101,8 @@ func (s *SenderService) SendReservationEmail(reservation entities.ReservationRes
 	emailData := entities.ReservationEmailData{
 		UserName:           reservation.UserName,
 		ReservationCode:    reservation.Code,
-		VehicleModel:       reservation.VehicleModel,
-		VehiclePlate:       reservation.VehiclePlate,
+		VehicleModel:       reservation.VehicleModel.String,
+		VehiclePlate:       reservation.VehiclePlate.String,
 		StartTimeFormatted: reservation.StartTime.In(italyLoc).Format("02 Jan 2006 15:04 MST"),
 		EndTimeFormatted:   reservation.EndTime.In(italyLoc).Format("02 Jan 2006 15:04 MST"),
 		CurrentYear:        time.Now().In(italyLoc).Year(),
@@ -47,7 +122,7 @@ func (s *SenderService) SendReservationEmail(reservation entities.ReservationRes
 				"Check-in: %s\n"+
 				"Check-out: %s\n\n"+
 				"Gracias por elegir GreenParking.\n\n"+
-				"GreenParking. Todos los derechos reservados.",
+				"© %d GreenParking. Todos los derechos reservados.",
 			emailData.UserName, status, emailData.ReservationCode, emailData.VehicleModel, emailData.VehiclePlate,
 			emailData.StartTimeFormatted, emailData.EndTimeFormatted, emailData.CurrentYear,
 		)
@@ -61,7 +136,7 @@ func (s *SenderService) SendReservationEmail(reservation entities.ReservationRes
 				"Check-in: %s\n"+
 				"Check-out: %s\n\n"+
 				"Grazie per aver scelto GreenParking.\n\n"+
-				"GreenParking. Tutti i diritti riservati.",
+				"© %d GreenParking. Tutti i diritti riservati.",
 			emailData.UserName, status, emailData.ReservationCode, emailData.VehicleModel, emailData.VehiclePlate,
 			emailData.StartTimeFormatted, emailData.EndTimeFormatted, emailData.CurrentYear,
 		)
@@ -75,7 +150,7 @@ func (s *SenderService) SendReservationEmail(reservation entities.ReservationRes
 				"Check-in: %s\n"+
 				"Check-out: %s\n\n"+
 				"Thank you for choosing GreenParking.\n\n"+
-				"GreenParking. All rights reserved.",
+				"© %d GreenParking. All rights reserved.",
 			emailData.UserName, status, emailData.ReservationCode, emailData.VehicleModel, emailData.VehiclePlate,
 			emailData.StartTimeFormatted, emailData.EndTimeFormatted, emailData.CurrentYear,
 		)
@@ -88,26 +163,27 @@ func (s *SenderService) SendReservationEmail(reservation entities.ReservationRes
 	}
 
 	var htmlBodyBuffer bytes.Buffer
-	if err := tmpl.Execute(&htmlBodyBuffer, emailData); err != nil {
-		log.Printf("ALERTA: Error al ejecutar la plantilla de correo HTML para reserva %s: %v", emailData.ReservationCode, err)
+	if tmpl != nil {
+		if err := tmpl.Execute(&htmlBodyBuffer, emailData); err != nil {
+			log.Printf("ALERTA: Error al ejecutar la plantilla de correo HTML para reserva %s: %v", emailData.ReservationCode, err)
+		}
 	}
-	htmlBody := htmlBodyBuffer.String()
 
-	go func(toEmail, userName, subject, plainBody, htmlBodyContent string) {
-		errEmail := SendEmailWithSendGrid(toEmail, userName, subject, plainBody, htmlBodyContent)
-		if errEmail != nil {
-			log.Printf("ALERTA (asíncrono): Falló envío de correo para reserva %s: %v", emailData.ReservationCode, errEmail)
-		}
-	}(reservation.UserEmail, emailData.UserName, emailSubject, plainTextBody, htmlBody)
+	return EmailMessage{
+		ToEmail:   reservation.UserEmail,
+		ToName:    emailData.UserName,
+		Subject:   emailSubject,
+		PlainText: plainTextBody,
+		HTML:      htmlBodyBuffer.String(),
+	}
 }
 
-func (s *SenderService) SendReservationSMS(reservation entities.ReservationResponse, status string) {
+func (s *SenderService) reservationSMS(reservation *db.Reservation, status string) string {
 	italyLoc, errLoc := time.LoadLocation("Europe/Rome")
 	if errLoc != nil {
 		italyLoc = time.FixedZone("CET", 1*60*60)
 	}
 
-	userPhoneNumber := reservation.UserPhone
 	reservationCode := reservation.Code
 
 	var smsMessage string
@@ -129,10 +205,7 @@ func (s *SenderService) SendReservationSMS(reservation entities.ReservationRespo
 		)
 	}
 
-	errSMS := SendSMS(userPhoneNumber, smsMessage)
-	if errSMS != nil {
-		log.Printf("ALERTA: La reserva %s se creó, pero falló el envío del SMS de confirmación a %s: %v", reservationCode, userPhoneNumber, errSMS)
-	}
+	return smsMessage
 }
 
 func (s *SenderService) StatusTranslation(status, lang string) string {
@@ -149,6 +222,12 @@ func (s *SenderService) StatusTranslation(status, lang string) string {
 			return "cancelada"
 		case "confirmed":
 			return "confirmada"
+		case "expired":
+			return "expirada"
+		case "partially_refunded":
+			return "reembolsada parcialmente"
+		case "modified":
+			return "modificada"
 		}
 	case "it":
 		switch status {
@@ -162,8 +241,52 @@ func (s *SenderService) StatusTranslation(status, lang string) string {
 			return "annullata"
 		case "confirmed":
 			return "confermata"
+		case "expired":
+			return "scaduta"
+		case "partially_refunded":
+			return "rimborsata parzialmente"
+		case "modified":
+			return "modificata"
 		}
 	}
 	// Default: English
-	return status
+	return strings.ReplaceAll(status, "_", " ")
+}
+
+// LoginCodeNotification renders the email with a customer's code to sign in and, when link is not empty, the magic
+// link doing the same. It is queued on one of their reservations like any other notification; sent after ttl, it
+// just doesn't work anymore.
+func (s *SenderService) LoginCodeNotification(reservationCode, toEmail, toName, language, code, link string, ttl time.Duration) db.Notification {
+	minutes := int(ttl.Minutes())
+	var subject, body, linkLine string
+	switch language {
+	case "es":
+		subject = "Tu código de acceso a GreenParking"
+		body = "Hola %s,\n\nTu código para ver y gestionar tus reservas es %s. Caduca en %d minutos.\n%s\n" +
+			"Si no lo has pedido, ignora este correo."
+		linkLine = "\nTambién puedes entrar con este enlace:\n%s\n"
+	case "it":
+		subject = "Il tuo codice di accesso a GreenParking"
+		body = "Ciao %s,\n\nIl tuo codice per vedere e gestire le tue prenotazioni è %s. Scade tra %d minuti.\n%s\n" +
+			"Se non l'hai richiesto, ignora questa email."
+		linkLine = "\nPuoi anche accedere con questo link:\n%s\n"
+	default:
+		subject = "Your GreenParking sign-in code"
+		body = "Hello %s,\n\nYour code to view and manage your reservations is %s. It expires in %d minutes.\n%s\n" +
+			"If you didn't ask for it, ignore this email."
+		linkLine = "\nYou can also sign in with this link:\n%s\n"
+	}
+	if link != "" {
+		linkLine = fmt.Sprintf(linkLine, link)
+	} else {
+		linkLine = ""
+	}
+	return db.Notification{
+		ReservationCode: reservationCode,
+		Channel:         channelEmail,
+		Recipient:       toEmail,
+		RecipientName:   toName,
+		Subject:         subject,
+		Body:            fmt.Sprintf(body, toName, code, minutes, linkLine),
+	}
 }
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReservationNotificationsRenderAndDeliverToOutbox(t *testing.T) {
+	var out bytes.Buffer
+	outbox := NewOutboxWriter(&out)
+	svc := NewSenderService(outbox, outbox)
+	reservation := newReservation("ABCD1234", carTypeID, statusActive, futureHour(48), futureHour(50))
+	reservation.Language = "it"
+
+	notifications := svc.ReservationNotifications(reservation, statusConfirmed)
+	if len(notifications) != 2 {
+		t.Fatalf("expected an email and an SMS, got %d notifications", len(notifications))
+	}
+	email, sms := notifications[0], notifications[1]
+	if email.Channel != channelEmail || email.Recipient != "mario@example.com" || !strings.Contains(email.Subject, "ABCD1234") {
+		t.Fatalf("unexpected email %+v", email)
+	}
+	if !strings.Contains(email.HTMLBody, "ABCD1234") {
+		t.Fatal("expected the HTML template to be rendered with the reservation code")
+	}
+	if sms.Channel != channelSMS || sms.Recipient != "+390000000000" || !strings.Contains(sms.Body, "confermata") {
+		t.Fatalf("unexpected SMS %+v", sms)
+	}
+
+	for _, n := range notifications {
+		if err := svc.Deliver(n); err != nil {
+			t.Fatalf("Deliver %s: %v", n.Channel, err)
+		}
+	}
+	if msgs := outbox.Messages(); len(msgs) != 2 || msgs[0].Channel != "email" || msgs[1].Channel != "sms" {
+		t.Fatalf("expected the outbox to hold the email and the SMS, got %+v", msgs)
+	}
+	if !strings.Contains(out.String(), "Subject: La tua prenotazione GreenParking è confermata - Codice: ABCD1234") {
+		t.Fatalf("outbox output is missing the email subject:\n%s", out.String())
+	}
+}
+
+func TestReservationNotificationsSkipSMSWithoutPhone(t *testing.T) {
+	svc := newTestSenderService()
+	reservation := newReservation("NOPHONE1", carTypeID, statusActive, futureHour(48), futureHour(50))
+	reservation.UserPhone.String, reservation.UserPhone.Valid = "", false
+
+	notifications := svc.ReservationNotifications(reservation, statusCancel)
+	if len(notifications) != 1 || notifications[0].Channel != channelEmail {
+		t.Fatalf("expected only an email, got %+v", notifications)
+	}
+}
+
+func TestBuildMIMEMessageHasBothParts(t *testing.T) {
+	body, err := buildMIMEMessage("GreenPark", "noreply@example.com", EmailMessage{
+		ToEmail:   "mario@example.com",
+		ToName:    "Mario Rossi",
+		Subject:   "Prenotazione è confermata",
+		PlainText: "Ciao Mario",
+		HTML:      "<p>Ciao Mario</p>",
+	})
+	if err != nil {
+		t.Fatalf("buildMIMEMessage: %v", err)
+	}
+	msg := string(body)
+	for _, want := range []string{"multipart/alternative", "text/plain; charset=utf-8", "text/html; charset=utf-8", "=?utf-8?q?", "To: \"Mario Rossi\" <mario@example.com>"} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("expected %q in message:\n%s", want, msg)
+		}
+	}
+}
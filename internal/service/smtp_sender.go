@@ -0,0 +1,101 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"time"
+)
+
+// SMTPEmailSender sends emails through a plain SMTP server. STARTTLS is used when the server offers it.
+type SMTPEmailSender struct {
+	Host      string
+	Port      string
+	Username  string
+	Password  string
+	FromEmail string
+	FromName  string
+}
+
+func NewSMTPEmailSender(host, port, username, password, fromEmail, fromName string) *SMTPEmailSender {
+	if port == "" {
+		port = "587"
+	}
+	if fromName == "" {
+		fromName = "GreenPark"
+	}
+	return &SMTPEmailSender{Host: host, Port: port, Username: username, Password: password, FromEmail: fromEmail, FromName: fromName}
+}
+
+func (s *SMTPEmailSender) SendEmail(msg EmailMessage) error {
+	if s.Host == "" || s.FromEmail == "" {
+		log.Println("ADVERTENCIA: SMTP_HOST o SMTP_FROM_EMAIL no están configurados. El correo no se enviará.")
+		return fmt.Errorf("SMTP no está configurado")
+	}
+
+	body, err := buildMIMEMessage(s.FromName, s.FromEmail, msg)
+	if err != nil {
+		return fmt.Errorf("error building email for %s: %w", msg.ToEmail, err)
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	if err := smtp.SendMail(net.JoinHostPort(s.Host, s.Port), auth, s.FromEmail, []string{msg.ToEmail}, body); err != nil {
+		log.Printf("Error al enviar correo vía SMTP a %s: %v", msg.ToEmail, err)
+		return fmt.Errorf("falló el envío del correo por SMTP: %w", err)
+	}
+	log.Printf("Correo enviado exitosamente a %s vía SMTP (Asunto: %s)", msg.ToEmail, msg.Subject)
+	return nil
+}
+
+// buildMIMEMessage renders msg as a multipart/alternative email with a plain text and an HTML part.
+func buildMIMEMessage(fromName, fromEmail string, msg EmailMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	from := mail.Address{Name: fromName, Address: fromEmail}
+	to := mail.Address{Name: msg.ToName, Address: msg.ToEmail}
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", writer.Boundary())
+
+	parts := []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.PlainText},
+		{"text/html; charset=utf-8", msg.HTML},
+	}
+	for _, p := range parts {
+		if p.content == "" {
+			continue
+		}
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(part)
+		if _, err := qp.Write([]byte(p.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,538 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	stdErrors "errors"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/money"
+	"estacionamienti/internal/repository"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/stripe/stripe-go/v82"
+)
+
+const (
+	eventProcessed = "processed"
+	eventIgnored   = "ignored"
+	eventFailed    = "failed"
+
+	paymentRefunded          = "refunded"
+	paymentPartiallyRefunded = "partially_refunded"
+	paymentRefundFailed      = "refund_failed"
+	paymentProcessing        = "processing"
+	paymentFailed            = "failed"
+	paymentExpired           = "expired"
+	paymentDisputed          = "disputed"
+
+	// statusExpired is only used to tell the customer why their pending reservation was canceled.
+	statusExpired = "expired"
+)
+
+// StripeEventService applies Stripe webhook events to reservations. Every event is recorded by ID, so retries of an
+// already processed event are skipped, and transitions are only applied from the states they make sense in, so
+// events arriving out of order cannot undo each other.
+type StripeEventService struct {
+	eventRepo       repository.StripeEventRepository
+	reservationRepo repository.ReservationRepository
+	stripeService   *StripeService
+	senderService   *SenderService
+}
+
+func NewStripeEventService(eventRepo repository.StripeEventRepository, reservationRepo repository.ReservationRepository, stripeService *StripeService, senderService *SenderService) *StripeEventService {
+	return &StripeEventService{
+		eventRepo:       eventRepo,
+		reservationRepo: reservationRepo,
+		stripeService:   stripeService,
+		senderService:   senderService,
+	}
+}
+
+// eventOutcome is what processing an event did, stored with the event.
+type eventOutcome struct {
+	status          string
+	result          string
+	reservationCode string
+}
+
+// HandleEvent processes a verified event unless it was already processed. An error means the event failed and
+// Stripe should deliver it again.
+func (s *StripeEventService) HandleEvent(event stripe.Event, payload []byte) error {
+	record := &db.StripeEvent{
+		ID:              event.ID,
+		Type:            string(event.Type),
+		Payload:         payload,
+		StripeCreatedAt: time.Unix(event.Created, 0).UTC(),
+	}
+	claimed, err := s.eventRepo.ClaimStripeEvent(record)
+	if err != nil {
+		log.Printf("Error recording Stripe event %s: %v", event.ID, err)
+		return err
+	}
+	if !claimed {
+		log.Printf("Stripe event %s (%s) already processed, skipping", event.ID, event.Type)
+		return nil
+	}
+
+	outcome, procErr := s.process(event)
+	if procErr != nil {
+		outcome.status = eventFailed
+		outcome.result = procErr.Error()
+		log.Printf("Error processing Stripe event %s (%s), attempt %d: %v", event.ID, event.Type, record.Attempts, procErr)
+	}
+	if err := s.eventRepo.FinishStripeEvent(event.ID, outcome.status, outcome.result, outcome.reservationCode); err != nil {
+		log.Printf("Error storing result of Stripe event %s: %v", event.ID, err)
+		return err
+	}
+	return procErr
+}
+
+func (s *StripeEventService) process(event stripe.Event) (eventOutcome, error) {
+	switch event.Type {
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded",
+		"checkout.session.async_payment_failed", "checkout.session.expired":
+		var sess stripe.CheckoutSession
+		if err := json.Unmarshal(event.Data.Raw, &sess); err != nil {
+			return eventOutcome{}, fmt.Errorf("error parsing checkout.session: %w", err)
+		}
+		if sess.ID == "" {
+			return eventOutcome{}, fmt.Errorf("no session ID in %s", event.Type)
+		}
+		change, err := s.reservationRepo.GetReservationChangeByStripeSessionID(sess.ID)
+		if err == nil {
+			return s.changeCheckout(string(event.Type), &sess, change)
+		}
+		if !stdErrors.Is(err, sql.ErrNoRows) {
+			return eventOutcome{}, err
+		}
+		switch event.Type {
+		case "checkout.session.completed":
+			if sess.PaymentStatus == stripe.CheckoutSessionPaymentStatusUnpaid {
+				return s.checkoutProcessing(&sess)
+			}
+			return s.checkoutCompleted(&sess)
+		case "checkout.session.async_payment_succeeded":
+			return s.checkoutCompleted(&sess)
+		case "checkout.session.async_payment_failed":
+			return s.checkoutReleased(&sess, paymentFailed, statusCancel)
+		default:
+			return s.checkoutReleased(&sess, paymentExpired, statusExpired)
+		}
+	case "payment_intent.payment_failed":
+		var intent stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &intent); err != nil {
+			return eventOutcome{}, fmt.Errorf("error parsing payment_intent: %w", err)
+		}
+		return s.paymentFailed(&intent)
+	case "charge.refunded":
+		var charge stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+			return eventOutcome{}, fmt.Errorf("error parsing charge: %w", err)
+		}
+		return s.chargeRefunded(&charge)
+	case "charge.refund.updated":
+		var refund stripe.Refund
+		if err := json.Unmarshal(event.Data.Raw, &refund); err != nil {
+			return eventOutcome{}, fmt.Errorf("error parsing refund: %w", err)
+		}
+		return s.refundUpdated(&refund)
+	case "charge.dispute.created":
+		var dispute stripe.Dispute
+		if err := json.Unmarshal(event.Data.Raw, &dispute); err != nil {
+			return eventOutcome{}, fmt.Errorf("error parsing dispute: %w", err)
+		}
+		return s.disputeCreated(&dispute)
+	default:
+		log.Printf("Unhandled event type: %s", event.Type)
+		return eventOutcome{status: eventIgnored, result: "unhandled event type"}, nil
+	}
+}
+
+// checkoutCompleted confirms the reservation of a paid session. Not finding the reservation fails the event, so
+// Stripe retries it once the session has been stored.
+func (s *StripeEventService) checkoutCompleted(sess *stripe.CheckoutSession) (eventOutcome, error) {
+	reservation, err := s.reservationRepo.GetReservationByStripeSessionID(sess.ID)
+	if err != nil {
+		return eventOutcome{}, err
+	}
+	outcome := eventOutcome{reservationCode: reservation.Code}
+	if err := s.stripeService.RecordCharge(reservation, paymentIntentID(sess), money.Amount(sess.AmountTotal)); err != nil {
+		return outcome, err
+	}
+
+	if reservation.Status == statusActive && reservation.PaymentStatus.String == paymentSucceeded {
+		outcome.status, outcome.result = eventIgnored, "payment already confirmed"
+		return outcome, nil
+	}
+	if reservation.Status != statusPending {
+		outcome.status, outcome.result = eventIgnored, fmt.Sprintf("reservation is %s, payment not applied", reservation.Status)
+		log.Printf("ALERTA: pago recibido para la reserva %s en estado %s (session %s)", reservation.Code, reservation.Status, sess.ID)
+		alert := s.senderService.AdminAlert(reservation, "Pago recibido para reserva no pendiente",
+			fmt.Sprintf("Stripe cobró la sesión %s pero la reserva ya está %s. Revisar y reembolsar si corresponde.", sess.ID, reservation.Status))
+		if len(alert) > 0 {
+			if err := s.reservationRepo.UpdateReservationAndPaymentStatus(reservation.ID, reservation.Status, reservation.PaymentStatus.String, alert); err != nil {
+				return outcome, err
+			}
+		}
+		return outcome, nil
+	}
+
+	notifications := s.senderService.ReservationNotifications(reservation, statusConfirmed)
+	err = s.reservationRepo.UpdateReservationStatusPaymentAndIntent(reservation.ID, statusActive, paymentSucceeded, paymentIntentID(sess), notifications)
+	if err != nil {
+		return outcome, err
+	}
+	outcome.status, outcome.result = eventProcessed, "reservation confirmed"
+	return outcome, nil
+}
+
+// changeCheckout follows the checkout of a modification's price difference: paying it applies the change, while a
+// failed or expired payment leaves the reservation as it was.
+func (s *StripeEventService) changeCheckout(eventType string, sess *stripe.CheckoutSession, change *db.ReservationChange) (eventOutcome, error) {
+	outcome := eventOutcome{reservationCode: change.ReservationCode}
+	switch eventType {
+	case "checkout.session.completed":
+		if sess.PaymentStatus == stripe.CheckoutSessionPaymentStatusUnpaid {
+			outcome.status, outcome.result = eventIgnored, "modification payment processing"
+			return outcome, nil
+		}
+		return s.changePaid(sess, change)
+	case "checkout.session.async_payment_succeeded":
+		return s.changePaid(sess, change)
+	default:
+		if change.Status != changeAwaitingPayment {
+			outcome.status, outcome.result = eventIgnored, fmt.Sprintf("modification is %s", change.Status)
+			return outcome, nil
+		}
+		if err := s.reservationRepo.UpdateReservationChangeStatus(change.ID, changeExpired); err != nil {
+			return outcome, err
+		}
+		outcome.status, outcome.result = eventProcessed, "modification not paid"
+		return outcome, nil
+	}
+}
+
+// changePaid applies a modification once its difference is paid. If it can't apply anymore, because a later
+// modification superseded it, the reservation is no longer active or the new window filled up meanwhile, the
+// payment is refunded and the admins are told.
+func (s *StripeEventService) changePaid(sess *stripe.CheckoutSession, change *db.ReservationChange) (eventOutcome, error) {
+	reservation, err := s.reservationRepo.GetReservationByCodeOnly(change.ReservationCode)
+	if err != nil {
+		return eventOutcome{}, err
+	}
+	outcome := eventOutcome{reservationCode: reservation.Code}
+	if err := s.stripeService.RecordCharge(reservation, paymentIntentID(sess), money.Amount(sess.AmountTotal)); err != nil {
+		return outcome, err
+	}
+	if change.Status == changeApplied {
+		outcome.status, outcome.result = eventIgnored, "modification already applied"
+		return outcome, nil
+	}
+
+	reason := fmt.Sprintf("the modification is %s", change.Status)
+	if change.Status == changeAwaitingPayment {
+		conflicts, err := applyReservationChange(s.reservationRepo, s.senderService, reservation, change)
+		switch {
+		case err == nil && len(conflicts) == 0:
+			outcome.status, outcome.result = eventProcessed, "reservation modified"
+			return outcome, nil
+		case err == nil:
+			reason = "the new window has no free spaces anymore"
+		case stdErrors.Is(err, sql.ErrNoRows):
+			reason = fmt.Sprintf("the reservation is %s", reservation.Status)
+		default:
+			return outcome, err
+		}
+	}
+
+	refunded, err := s.stripeService.RefundCharge(reservation, paymentIntentID(sess), money.Amount(sess.AmountTotal), "modification rejected")
+	if err != nil {
+		return outcome, err
+	}
+	if err := s.reservationRepo.UpdateReservationChangeStatus(change.ID, changeRejected); err != nil {
+		return outcome, err
+	}
+	log.Printf("ALERTA: modificación pagada de la reserva %s no aplicada (%s), reembolsados %s", reservation.Code, reason, formatMoney(refunded))
+	alert := s.senderService.AdminAlert(reservation, "Modificación no aplicada",
+		fmt.Sprintf("El cliente pagó %s por modificar la reserva, pero no se pudo aplicar: %s. Se reembolsaron %s.",
+			formatMoney(money.Amount(sess.AmountTotal)), reason, formatMoney(refunded)))
+	if len(alert) > 0 {
+		if err := s.reservationRepo.UpdateReservationAndPaymentStatus(reservation.ID, reservation.Status, reservation.PaymentStatus.String, alert); err != nil {
+			return outcome, err
+		}
+	}
+	outcome.status, outcome.result = eventProcessed, "modification rejected and refunded: "+reason
+	return outcome, nil
+}
+
+// checkoutProcessing records a checkout finished with a delayed payment method (e.g. SEPA debit). The reservation
+// stays pending and keeps its space until async_payment_succeeded or async_payment_failed arrives.
+func (s *StripeEventService) checkoutProcessing(sess *stripe.CheckoutSession) (eventOutcome, error) {
+	reservation, err := s.reservationRepo.GetReservationByStripeSessionID(sess.ID)
+	if err != nil {
+		return eventOutcome{}, err
+	}
+	outcome := eventOutcome{reservationCode: reservation.Code}
+	if reservation.Status != statusPending || reservation.PaymentStatus.String == paymentSucceeded {
+		outcome.status, outcome.result = eventIgnored, fmt.Sprintf("reservation is %s, processing not applied", reservation.Status)
+		return outcome, nil
+	}
+	err = s.reservationRepo.UpdateReservationStatusPaymentAndIntent(reservation.ID, statusPending, paymentProcessing, paymentIntentID(sess), nil)
+	if err != nil {
+		return outcome, err
+	}
+	outcome.status, outcome.result = eventProcessed, "payment processing"
+	return outcome, nil
+}
+
+// checkoutReleased cancels the pending reservation of a session that expired or whose delayed payment failed, so
+// its space is free right away. notifyStatus is the status the customer is told about.
+func (s *StripeEventService) checkoutReleased(sess *stripe.CheckoutSession, paymentStatus, notifyStatus string) (eventOutcome, error) {
+	reservation, err := s.reservationRepo.GetReservationByStripeSessionID(sess.ID)
+	if err != nil {
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			// The cleanup job may already have deleted the abandoned reservation.
+			return eventOutcome{status: eventIgnored, result: "reservation not found"}, nil
+		}
+		return eventOutcome{}, err
+	}
+	outcome := eventOutcome{reservationCode: reservation.Code}
+	if reservation.Status != statusPending {
+		outcome.status, outcome.result = eventIgnored, fmt.Sprintf("reservation is %s, not released", reservation.Status)
+		return outcome, nil
+	}
+	notifications := s.senderService.ReservationNotifications(reservation, notifyStatus)
+	if err := s.reservationRepo.UpdateReservationAndPaymentStatus(reservation.ID, statusCancel, paymentStatus, notifications); err != nil {
+		return outcome, err
+	}
+	outcome.status, outcome.result = eventProcessed, "reservation released, payment "+paymentStatus
+	return outcome, nil
+}
+
+// paymentFailed marks a declined payment. The reservation stays pending: the customer can still retry on the same
+// checkout page until the session expires.
+func (s *StripeEventService) paymentFailed(intent *stripe.PaymentIntent) (eventOutcome, error) {
+	reservation, outcome, err := s.reservationByPaymentIntent(intent.ID)
+	if reservation == nil {
+		return outcome, err
+	}
+	if reservation.Status != statusPending || reservation.PaymentStatus.String == paymentSucceeded {
+		outcome.status, outcome.result = eventIgnored, fmt.Sprintf("reservation is %s, failure not applied", reservation.Status)
+		return outcome, nil
+	}
+	if err := s.reservationRepo.UpdateReservationAndPaymentStatus(reservation.ID, statusPending, paymentFailed, nil); err != nil {
+		return outcome, err
+	}
+	reason := ""
+	if intent.LastPaymentError != nil {
+		reason = ": " + intent.LastPaymentError.Msg
+	}
+	outcome.status, outcome.result = eventProcessed, "payment failed"+reason
+	return outcome, nil
+}
+
+// chargeRefunded cancels the reservation once its payment is fully refunded; partial refunds only update the
+// payment status.
+func (s *StripeEventService) chargeRefunded(charge *stripe.Charge) (eventOutcome, error) {
+	if charge.PaymentIntent == nil {
+		return eventOutcome{status: eventIgnored, result: "charge has no payment intent"}, nil
+	}
+	reservation, outcome, err := s.reservationByPaymentIntent(charge.PaymentIntent.ID)
+	if reservation == nil {
+		return outcome, err
+	}
+	if err := s.stripeService.RecordRefunds(reservation, charge.PaymentIntent.ID); err != nil {
+		return outcome, err
+	}
+	if main := reservation.StripePaymentIntentID.String; main != "" && main != charge.PaymentIntent.ID {
+		outcome.status, outcome.result = eventIgnored, "refund of a modification payment recorded"
+		return outcome, nil
+	}
+	if reservation.Status == statusCanceling {
+		// The cancellation that issued this refund hasn't been stored yet, or failed to; whichever comes first settles
+		// it.
+		notifications := s.senderService.ReservationNotifications(reservation, statusCancel)
+		if err := s.reservationRepo.SettleCancellation(reservation.Code, statusCancel, 0, notifications); err != nil {
+			return outcome, err
+		}
+		reservation.Status = statusCancel
+	}
+	if reservation.PaymentStatus.String == paymentRefunded {
+		outcome.status, outcome.result = eventIgnored, "payment already refunded"
+		return outcome, nil
+	}
+	if !charge.Refunded {
+		return s.partialRefund(reservation, outcome, money.Amount(charge.AmountRefunded))
+	}
+
+	var notifications []db.Notification
+	if reservation.Status == statusActive {
+		// Refunds made from the Stripe dashboard cancel the reservation without going through our cancel endpoint.
+		notifications = s.senderService.ReservationNotifications(reservation, statusCancel)
+	}
+	if err := s.reservationRepo.UpdateReservationAndPaymentStatus(reservation.ID, statusCancel, paymentRefunded, notifications); err != nil {
+		return outcome, err
+	}
+	outcome.status, outcome.result = eventProcessed, "reservation canceled and refunded"
+	return outcome, nil
+}
+
+// refundUpdated follows a refund after it was created: partial refunds that succeed update the payment status and
+// refunds that fail are escalated to the admins, since the customer was told the money is coming back.
+func (s *StripeEventService) refundUpdated(refund *stripe.Refund) (eventOutcome, error) {
+	if refund.PaymentIntent == nil {
+		return eventOutcome{status: eventIgnored, result: "refund has no payment intent"}, nil
+	}
+	reservation, outcome, err := s.reservationByPaymentIntent(refund.PaymentIntent.ID)
+	if reservation == nil {
+		return outcome, err
+	}
+
+	switch refund.Status {
+	case stripe.RefundStatusSucceeded:
+		recorded := &Refund{ID: refund.ID, Amount: money.Amount(refund.Amount), Status: string(refund.Status)}
+		if err := s.stripeService.payments.RecordStripeRefund(reservation, recorded, ""); err != nil {
+			return outcome, err
+		}
+		if reservation.PaymentStatus.String == paymentRefunded {
+			outcome.status, outcome.result = eventIgnored, "payment already refunded"
+			return outcome, nil
+		}
+		if recorded.Amount >= reservation.DepositPayment {
+			outcome.status, outcome.result = eventIgnored, "full refund, applied by charge.refunded"
+			return outcome, nil
+		}
+		return s.partialRefund(reservation, outcome, recorded.Amount)
+	case stripe.RefundStatusFailed, stripe.RefundStatusCanceled:
+		log.Printf("ALERTA: reembolso %s de la reserva %s %s (%s)", refund.ID, reservation.Code, refund.Status, refund.FailureReason)
+		alert := s.senderService.AdminAlert(reservation, "Reembolso fallido",
+			fmt.Sprintf("El reembolso %s de %s no se completó (estado %s, motivo %s). Hay que devolver el dinero al cliente manualmente.",
+				refund.ID, formatMoney(money.Amount(refund.Amount)), refund.Status, refund.FailureReason))
+		if err := s.reservationRepo.UpdateReservationAndPaymentStatus(reservation.ID, reservation.Status, paymentRefundFailed, alert); err != nil {
+			return outcome, err
+		}
+		outcome.status, outcome.result = eventProcessed, "refund "+string(refund.Status)
+		return outcome, nil
+	default:
+		outcome.status, outcome.result = eventIgnored, "refund "+string(refund.Status)
+		return outcome, nil
+	}
+}
+
+func (s *StripeEventService) partialRefund(reservation *db.Reservation, outcome eventOutcome, refunded money.Amount) (eventOutcome, error) {
+	if reservation.PaymentStatus.String == paymentPartiallyRefunded {
+		outcome.status, outcome.result = eventIgnored, "partial refund already applied"
+		return outcome, nil
+	}
+	var notifications []db.Notification
+	if reservation.Status == statusActive {
+		// Cancellations already told the customer what is refunded.
+		notifications = s.senderService.ReservationNotifications(reservation, paymentPartiallyRefunded)
+	}
+	if err := s.reservationRepo.UpdateReservationAndPaymentStatus(reservation.ID, reservation.Status, paymentPartiallyRefunded, notifications); err != nil {
+		return outcome, err
+	}
+	outcome.status, outcome.result = eventProcessed, "partially refunded "+formatMoney(refunded)
+	return outcome, nil
+}
+
+// disputeCreated flags a chargeback. The reservation keeps its status; the admins have to answer the dispute in
+// Stripe before its deadline.
+func (s *StripeEventService) disputeCreated(dispute *stripe.Dispute) (eventOutcome, error) {
+	if dispute.PaymentIntent == nil {
+		return eventOutcome{status: eventIgnored, result: "dispute has no payment intent"}, nil
+	}
+	reservation, outcome, err := s.reservationByPaymentIntent(dispute.PaymentIntent.ID)
+	if reservation == nil {
+		return outcome, err
+	}
+	if reservation.PaymentStatus.String == paymentDisputed {
+		outcome.status, outcome.result = eventIgnored, "dispute already recorded"
+		return outcome, nil
+	}
+	log.Printf("ALERTA: disputa %s abierta para la reserva %s (%s)", dispute.ID, reservation.Code, dispute.Reason)
+	body := fmt.Sprintf("El cliente abrió la disputa %s por %s, motivo %s.", dispute.ID, formatMoney(money.Amount(dispute.Amount)), dispute.Reason)
+	if dispute.EvidenceDetails != nil && dispute.EvidenceDetails.DueBy > 0 {
+		body += fmt.Sprintf(" Plazo para responder: %s.", time.Unix(dispute.EvidenceDetails.DueBy, 0).UTC().Format(time.RFC3339))
+	}
+	alert := s.senderService.AdminAlert(reservation, "Disputa de pago", body)
+	if err := s.reservationRepo.UpdateReservationAndPaymentStatus(reservation.ID, reservation.Status, paymentDisputed, alert); err != nil {
+		return outcome, err
+	}
+	outcome.status, outcome.result = eventProcessed, "dispute opened: "+string(dispute.Reason)
+	return outcome, nil
+}
+
+// reservationByPaymentIntent finds the reservation paid by a payment intent. A nil reservation comes with the
+// outcome or error to return for the event.
+func (s *StripeEventService) reservationByPaymentIntent(paymentIntentID string) (*db.Reservation, eventOutcome, error) {
+	if paymentIntentID == "" {
+		return nil, eventOutcome{status: eventIgnored, result: "no payment intent"}, nil
+	}
+	sessionID, err := s.stripeService.SessionIDByPaymentIntentID(paymentIntentID)
+	if err != nil {
+		return nil, eventOutcome{}, err
+	}
+	reservation, err := s.reservationRepo.GetReservationByStripeSessionID(sessionID)
+	if stdErrors.Is(err, sql.ErrNoRows) {
+		// Modifications are paid in their own checkout session.
+		change, changeErr := s.reservationRepo.GetReservationChangeByStripeSessionID(sessionID)
+		if changeErr != nil {
+			return nil, eventOutcome{}, err
+		}
+		reservation, err = s.reservationRepo.GetReservationByCodeOnly(change.ReservationCode)
+	}
+	if err != nil {
+		return nil, eventOutcome{}, err
+	}
+	return reservation, eventOutcome{reservationCode: reservation.Code}, nil
+}
+
+func paymentIntentID(sess *stripe.CheckoutSession) string {
+	if sess.PaymentIntent == nil {
+		return ""
+	}
+	return sess.PaymentIntent.ID
+}
+
+// formatMoney writes an amount in the parking's currency for logs and alerts, as 12.50 EUR.
+func formatMoney(amount money.Amount) string {
+	return money.Of(amount).String()
+}
+
+// ListEventsForReservation returns the Stripe events applied to a reservation, oldest first.
+func (s *StripeEventService) ListEventsForReservation(code string) ([]db.StripeEvent, error) {
+	events, err := s.eventRepo.ListStripeEventsByReservation(code)
+	if err != nil {
+		log.Printf("Error listing Stripe events for reservation %s: %v", code, err)
+		return nil, err
+	}
+	return events, nil
+}
+
+// ReplayEvent processes a failed event again from its stored payload and returns it with the new outcome.
+func (s *StripeEventService) ReplayEvent(id string) (*db.StripeEvent, error) {
+	record, err := s.eventRepo.GetStripeEvent(id)
+	if err != nil {
+		if stdErrors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NewHTTPError(http.StatusNotFound, "Stripe event not found")
+		}
+		return nil, err
+	}
+	if record.Status != eventFailed {
+		return nil, errors.NewHTTPError(http.StatusConflict, fmt.Sprintf("Only failed events can be replayed, this one is %s", record.Status))
+	}
+
+	var event stripe.Event
+	if err := json.Unmarshal(record.Payload, &event); err != nil {
+		return nil, fmt.Errorf("error parsing stored Stripe event %s: %w", id, err)
+	}
+	if err := s.HandleEvent(event, record.Payload); err != nil {
+		log.Printf("Replay of Stripe event %s failed again: %v", id, err)
+	}
+	return s.eventRepo.GetStripeEvent(id)
+}
@@ -1,62 +1,156 @@
 package service
 
 import (
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/money"
 	"estacionamienti/internal/repository"
 	"fmt"
-	"github.com/stripe/stripe-go/v82"
-	"github.com/stripe/stripe-go/v82/checkout/session"
-	"github.com/stripe/stripe-go/v82/refund"
+	"log"
+	"time"
 )
 
+const frontendBaseURL = "https://front-estacionamiento-octaviomartinduarte-5073s-projects.vercel.app/"
+
 type StripeService struct {
-	Repo *repository.ReservationRepository
+	Repo     repository.ReservationRepository
+	gateway  PaymentGateway
+	payments *PaymentService
+}
+
+func NewStripeService(Repo repository.ReservationRepository, gateway PaymentGateway, payments *PaymentService) *StripeService {
+	return &StripeService{Repo: Repo, gateway: gateway, payments: payments}
+}
+
+// RefundReservation refunds amount of what the reservation paid through Stripe, 0 refunding all of it, records the
+// refunds in the payments ledger and returns the amount refunded. A reservation paid in several checkouts, e.g. a
+// modification that cost more, is refunded from its latest payment first. With an idempotencyKey, the refund of each
+// payment is keyed by it and the payment intent, so retrying the same refund doesn't issue it twice.
+func (s *StripeService) RefundReservation(reservation *db.Reservation, amount money.Amount, note, idempotencyKey string) (money.Amount, error) {
+	charges, err := s.payments.stripeCharges(reservation)
+	if err != nil {
+		return 0, err
+	}
+	if len(charges) == 0 {
+		return 0, fmt.Errorf("No PaymentIntent found for reservation %s", reservation.Code)
+	}
+
+	var refunded money.Amount
+	for i := len(charges) - 1; i >= 0; i-- {
+		left, err := s.refundableLeft(charges[i])
+		if err != nil {
+			return refunded, err
+		}
+		if amount > 0 && left > amount-refunded {
+			left = amount - refunded
+		}
+		if left <= 0 {
+			continue
+		}
+		req := RefundRequest{PaymentIntentID: charges[i].paymentIntentID, Amount: left}
+		if idempotencyKey != "" {
+			req.IdempotencyKey = idempotencyKey + "-" + charges[i].paymentIntentID
+		}
+		refund, err := s.gateway.Refund(req)
+		if err != nil {
+			return refunded, err
+		}
+		// The refund went through; a ledger failure is caught up when its charge.refunded webhook arrives.
+		if err := s.payments.RecordStripeRefund(reservation, refund, note); err != nil {
+			log.Printf("ALERTA: reembolso %s de la reserva %s no registrado: %v", refund.ID, reservation.Code, err)
+		}
+		refunded += refund.Amount
+		if amount > 0 && refunded >= amount {
+			break
+		}
+	}
+	return refunded, nil
+}
+
+// RefundCharge refunds whatever is left of one Stripe payment of the reservation, of the given amount, and returns
+// the amount refunded. Refunding a payment already refunded does nothing.
+func (s *StripeService) RefundCharge(reservation *db.Reservation, paymentIntentID string, amount money.Amount, note string) (money.Amount, error) {
+	left, err := s.refundableLeft(stripeCharge{paymentIntentID: paymentIntentID, amount: amount})
+	if err != nil || left <= 0 {
+		return 0, err
+	}
+	refund, err := s.gateway.Refund(RefundRequest{PaymentIntentID: paymentIntentID, Amount: left})
+	if err != nil {
+		return 0, err
+	}
+	if err := s.payments.RecordStripeRefund(reservation, refund, note); err != nil {
+		log.Printf("ALERTA: reembolso %s de la reserva %s no registrado: %v", refund.ID, reservation.Code, err)
+	}
+	return refund.Amount, nil
+}
+
+// refundableLeft is what is left to refund of a Stripe charge.
+func (s *StripeService) refundableLeft(charge stripeCharge) (money.Amount, error) {
+	refunds, err := s.gateway.ListRefunds(charge.paymentIntentID)
+	if err != nil {
+		return 0, err
+	}
+	left := charge.amount
+	for _, refund := range refunds {
+		if refund.Status != "failed" && refund.Status != "canceled" {
+			left -= refund.Amount
+		}
+	}
+	return left, nil
 }
 
-func NewStripeService(Repo *repository.ReservationRepository) *StripeService {
-	return &StripeService{Repo: Repo}
+// RecordCharge records the checkout payment of a reservation in the payments ledger.
+func (s *StripeService) RecordCharge(reservation *db.Reservation, paymentIntentID string, amount money.Amount) error {
+	return s.payments.RecordStripeCharge(reservation, paymentIntentID, amount)
 }
 
-func (s *StripeService) RefundPaymentBySessionID(sessionID string) error {
-	reservation, err := s.Repo.GetReservationByStripeSessionID(sessionID)
+// RecordRefunds brings the ledger in line with the refunds Stripe has for the payment intent, including those
+// made from the Stripe dashboard.
+func (s *StripeService) RecordRefunds(reservation *db.Reservation, paymentIntentID string) error {
+	refunds, err := s.gateway.ListRefunds(paymentIntentID)
 	if err != nil {
 		return err
 	}
-	if reservation.StripePaymentIntentID.String == "" {
-		return fmt.Errorf("No PaymentIntent found for session %s", sessionID)
-	}
-	params := &stripe.RefundParams{
-		PaymentIntent: stripe.String(reservation.StripePaymentIntentID.String),
-	}
-	_, err = refund.New(params)
-	return err
-}
-
-// Create checkout session
-func (s *StripeService) CreateCheckoutSession(amount int64, currency, customerEmail string, language string) (string, string, error) {
-	params := &stripe.CheckoutSessionParams{
-		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
-		LineItems: []*stripe.CheckoutSessionLineItemParams{
-			{
-				PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-					Currency: stripe.String(currency),
-					ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
-						Name: stripe.String("GreenParking"),
-					},
-					UnitAmount: stripe.Int64(amount),
-				},
-				Quantity: stripe.Int64(1),
-			},
-		},
-		Mode:          stripe.String(string(stripe.CheckoutSessionModePayment)),
-		SuccessURL:    stripe.String("https://front-estacionamiento-octaviomartinduarte-5073s-projects.vercel.app/" + language + "/reservations/create/?session_id={CHECKOUT_SESSION_ID}"),
-		CancelURL:     stripe.String("https://front-estacionamiento-octaviomartinduarte-5073s-projects.vercel.app/" + language + "/reservations/create/failed"),
-		CustomerEmail: stripe.String(customerEmail),
-		Locale:        stripe.String(language),
-	}
-
-	sess, err := session.New(params)
+	for i := range refunds {
+		if err := s.payments.RecordStripeRefund(reservation, &refunds[i], ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create checkout session. The session expires at expiresAt, after which the reservation stops holding its space.
+// A discount, when not nil, is itemized on the checkout page.
+func (s *StripeService) CreateCheckoutSession(price money.Money, discount *CheckoutDiscount, customerEmail string, language string, expiresAt time.Time) (string, string, error) {
+	return s.createCheckoutSession(price, discount, customerEmail, language, expiresAt,
+		frontendBaseURL+language+"/reservations/create/?session_id={CHECKOUT_SESSION_ID}",
+		frontendBaseURL+language+"/reservations/create/failed")
+}
+
+// CreateChangeCheckoutSession opens the checkout for the price difference of a reservation modification. The customer
+// is sent back to their reservation either way.
+func (s *StripeService) CreateChangeCheckoutSession(price money.Money, customerEmail, language, code string, expiresAt time.Time) (string, string, error) {
+	reservationURL := frontendBaseURL + language + "/reservations/" + code
+	return s.createCheckoutSession(price, nil, customerEmail, language, expiresAt,
+		reservationURL+"?session_id={CHECKOUT_SESSION_ID}", reservationURL)
+}
+
+func (s *StripeService) createCheckoutSession(price money.Money, discount *CheckoutDiscount, customerEmail, language string, expiresAt time.Time, successURL, cancelURL string) (string, string, error) {
+	sess, err := s.gateway.CreateCheckoutSession(CheckoutRequest{
+		Price:         price,
+		Discount:      discount,
+		ProductName:   "GreenParking",
+		CustomerEmail: customerEmail,
+		Language:      language,
+		SuccessURL:    successURL,
+		CancelURL:     cancelURL,
+		ExpiresAt:     expiresAt,
+	})
 	if err != nil {
 		return "", "", err
 	}
 	return sess.URL, sess.ID, nil
 }
+
+func (s *StripeService) SessionIDByPaymentIntentID(paymentIntentID string) (string, error) {
+	return s.gateway.SessionIDByPaymentIntent(paymentIntentID)
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"database/sql"
+	"estacionamienti/internal/db"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CreateWalkIn lets in a car without a reservation. The session starts now, already checked in, and has no end: it
+// holds a space until check-out, where it is priced by the hour, day, week and month prices of its vehicle type.
+func (s *AdminService) CreateWalkIn(req entities.WalkInRequest) (*entities.ReservationResponse, error) {
+	if err := checkVehicleType(s.reservationRepo, req.VehicleTypeID); err != nil {
+		log.Printf("Error checking vehicle type: %v", err)
+		return nil, err
+	}
+	plate := normalizePlate(req.VehiclePlate)
+	if plate == "" {
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "vehicle_plate is required")
+	}
+	parked, err := s.reservationRepo.FindReservationCodesByPlate(plate, []string{statusCheckedIn, statusOverstay})
+	if err != nil {
+		log.Printf("[AdminService] Error finding reservations of plate %s: %v", plate, err)
+		return nil, err
+	}
+	if len(parked) > 0 {
+		return nil, errors.NewHTTPError(http.StatusConflict, fmt.Sprintf("Vehicle %s is already parked with reservation %s", plate, parked[0]))
+	}
+
+	userName := strings.TrimSpace(req.UserName)
+	if userName == "" {
+		userName = "Walk-in"
+	}
+	now := time.Now().UTC()
+	walkIn := &db.Reservation{
+		UserName:        userName,
+		UserEmail:       strings.TrimSpace(req.UserEmail),
+		UserPhone:       sql.NullString{String: req.UserPhone, Valid: true},
+		VehicleTypeID:   req.VehicleTypeID,
+		VehiclePlate:    sql.NullString{String: plate, Valid: true},
+		VehicleModel:    sql.NullString{String: req.VehicleModel, Valid: true},
+		PaymentMethodID: paymentMethodOnsite,
+		Status:          statusCheckedIn,
+		StartTime:       now,
+		CheckedInAt:     sql.NullTime{Time: now, Valid: true},
+		WalkIn:          true,
+		Language:        req.Language,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	conflicts, err := s.reservationRepo.CreateReservationIfAvailable(walkIn, now.Add(-pendingHoldWindow), nil)
+	if err != nil {
+		log.Printf("[AdminService] Error creating walk-in for %s: %v", plate, err)
+		return nil, err
+	}
+	if len(conflicts) > 0 {
+		log.Printf("[AdminService] Walk-in rejected, no spaces left for vehicle type %d", req.VehicleTypeID)
+		return nil, errNoAvailability(conflicts)
+	}
+	log.Printf("Walk-in %s: vehículo %s entró a las %s", walkIn.Code, plate, now.Format(time.RFC3339))
+	return s.adminRepo.FindReservationByCode(walkIn.Code)
+}
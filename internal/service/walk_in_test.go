@@ -0,0 +1,75 @@
+package service
+
+import (
+	"database/sql"
+	"estacionamienti/internal/entities"
+	"estacionamienti/internal/errors"
+	"estacionamienti/internal/repository/memory"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWalkInIsPricedAtCheckOut(t *testing.T) {
+	store := memory.NewSeededStore()
+	admin := newTestAdminService(store)
+
+	walkIn, err := admin.CreateWalkIn(entities.WalkInRequest{VehicleTypeID: carTypeID, VehiclePlate: "wk 001-aa"})
+	if err != nil {
+		t.Fatalf("CreateWalkIn: %v", err)
+	}
+	if !walkIn.WalkIn || walkIn.Status != statusCheckedIn || walkIn.EndTime != nil || walkIn.VehiclePlate != "WK001AA" {
+		t.Fatalf("expected an open walk-in, got %+v", walkIn)
+	}
+	if _, err := admin.CreateWalkIn(entities.WalkInRequest{VehicleTypeID: carTypeID, VehiclePlate: "WK001AA"}); err == nil {
+		t.Fatal("expected an error opening a second walk-in for a parked car")
+	}
+
+	// The open walk-in holds its space now, but not in the next hours.
+	slots, err := store.GetHourlyAvailabilityDetails(futureHour(0), futureHour(2), carTypeID, time.Now().UTC(), 0)
+	if err != nil {
+		t.Fatalf("GetHourlyAvailabilityDetails: %v", err)
+	}
+	if slots[0].BookedSpaces != 1 || slots[1].BookedSpaces != 0 {
+		t.Fatalf("expected the walk-in in the current hour only, got %+v", slots)
+	}
+	list, err := admin.ListReservations("", "", "", "", statusCheckedIn, "", "")
+	if err != nil || len(list.Reservations) != 1 || list.Reservations[0].Code != walkIn.Code {
+		t.Fatalf("expected the walk-in in the admin list, got %+v (%v)", list, err)
+	}
+
+	out, err := admin.CheckOut(entities.CheckOutRequest{Plate: "WK001AA"}, "gate")
+	if err != nil {
+		t.Fatalf("CheckOut: %v", err)
+	}
+	if out.TotalPrice != 400 || out.AmountCollected != 400 || out.EndTime == nil {
+		t.Fatalf("expected a short walk-in charged one hour, got %+v", out.ReservationResponse)
+	}
+
+	// A car that came in 27 hours ago and stays 26: a day and two hours.
+	long := newReservation("WALKIN02", carTypeID, statusCheckedIn, time.Now().UTC().Add(-27*time.Hour), time.Time{})
+	long.WalkIn = true
+	long.CheckedInAt = sql.NullTime{Time: long.StartTime, Valid: true}
+	store.InsertReservation(long)
+	leftAt := long.StartTime.Add(26 * time.Hour)
+	out, err = admin.CheckOut(entities.CheckOutRequest{Code: "WALKIN02", CheckedOutAt: &leftAt}, "gate")
+	if err != nil {
+		t.Fatalf("CheckOut: %v", err)
+	}
+	dayAndTwoHours, _ := totalPriceForReservation(store, carTypeID, long.StartTime, leftAt)
+	if out.TotalPrice != dayAndTwoHours || out.AmountCollected != dayAndTwoHours || out.OverstayFee != 0 ||
+		out.EndTime == nil || !out.EndTime.Equal(leftAt) {
+		t.Fatalf("expected the walk-in priced at %s for 26 hours, got %+v", dayAndTwoHours, out.ReservationResponse)
+	}
+}
+
+func TestWalkInNeedsFreeSpace(t *testing.T) {
+	store := memory.NewSeededStore()
+	admin := newTestAdminService(store)
+	fillPool(store, carTypeID, 20, futureHour(-1), futureHour(3))
+
+	_, err := admin.CreateWalkIn(entities.WalkInRequest{VehicleTypeID: carTypeID, VehiclePlate: "WK002BB"})
+	if herr, ok := err.(*errors.HTTPError); !ok || herr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 with the pool full, got %v", err)
+	}
+}